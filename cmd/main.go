@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 
+	commonAWS "github.com/quadev-ltd/qd-common/pkg/aws"
 	commontConfig "github.com/quadev-ltd/qd-common/pkg/config"
 
 	"qd-email-api/internal/application"
 	"qd-email-api/internal/config"
+	"qd-email-api/internal/secret"
 )
 
 func main() {
@@ -17,6 +21,14 @@ func main() {
 	if err != nil {
 		log.Fatalln("Failed loading the configurations", err)
 	}
+	resolver, err := newSecretResolver(&configurations)
+	if err != nil {
+		log.Fatalln("Failed creating the secret resolver", err)
+	}
+	err = configurations.ResolveSecrets(context.Background(), resolver)
+	if err != nil {
+		log.Fatalln("Failed resolving the secrets", err)
+	}
 
 	var centralConfig commontConfig.Config
 	centralConfig.Load(
@@ -25,8 +37,36 @@ func main() {
 		configurations.AWS.Secret,
 	)
 
-	application := application.NewApplication(&configurations, &centralConfig)
-	application.StartServer()
+	application, err := application.NewApplication(&configurations, &centralConfig, resolver)
+	if err != nil {
+		log.Fatalln("Failed creating the application", err)
+	}
+	exitCode := application.Run(configurations.Shutdown.Timeout)
+	// The logs are written to the standard output, which may be a file
+	os.Stdout.Sync()
+	os.Exit(exitCode)
+}
 
-	defer application.Close()
+// newSecretResolver creates the resolver of the secret references. The AWS credentials giving
+// access to AWS Secrets Manager can only refer to files or environment variables.
+func newSecretResolver(configurations *config.Config) (secret.Resolverer, error) {
+	providers := map[string]secret.Providerer{
+		secret.SchemeFile: &secret.FileProvider{},
+		secret.SchemeEnv:  &secret.EnvProvider{},
+	}
+	localResolver := secret.NewResolver(providers)
+	awsKey, err := localResolver.Resolve(context.Background(), configurations.AWS.Key)
+	if err != nil {
+		return nil, err
+	}
+	awsSecret, err := localResolver.Resolve(context.Background(), configurations.AWS.Secret)
+	if err != nil {
+		return nil, err
+	}
+	secretsManager, err := secret.NewAWSSecretsManager(commonAWS.Region, awsKey, awsSecret)
+	if err != nil {
+		return nil, err
+	}
+	providers[secret.SchemeAWSSecretsManager] = secret.NewSecretsManagerProvider(secretsManager)
+	return secret.NewResolver(providers), nil
 }
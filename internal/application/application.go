@@ -1,20 +1,60 @@
 package application
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	commonPB "github.com/quadev-ltd/qd-common/pb/gen/go/pb_email"
 	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
-	"github.com/quadev-ltd/qd-common/pkg/grpcserver"
 	"github.com/quadev-ltd/qd-common/pkg/log"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	grpcHealth "google.golang.org/grpc/health"
 
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/clock"
 	"qd-email-api/internal/config"
+	"qd-email-api/internal/event"
 	grpcFactory "qd-email-api/internal/grpcserver"
+	"qd-email-api/internal/health"
+	"qd-email-api/internal/httpserver"
+	"qd-email-api/internal/metrics"
+	"qd-email-api/internal/mtls"
+	"qd-email-api/internal/ratelimit"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/secret"
 	"qd-email-api/internal/service"
+	"qd-email-api/internal/tracing"
+	"qd-email-api/internal/tracking"
+	"qd-email-api/internal/unsubscribe"
+	"qd-email-api/internal/webhook"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// Exit codes of the process
+const (
+	// ExitOK is returned after a graceful shutdown
+	ExitOK = 0
+	// ExitServeError is returned when the application fails to start or serve
+	ExitServeError = 1
+	// ExitShutdownTimeout is returned when the work in flight outlasts the shutdown timeout
+	ExitShutdownTimeout = 2
 )
 
 // Applicationer provides the main functions to start the application
 type Applicationer interface {
-	StartServer()
+	Run(shutdownTimeout time.Duration) int
+	StartServer() error
+	Shutdown(ctx context.Context) error
 	Close()
 	GetGRPCServerAddress() string
 }
@@ -22,13 +62,39 @@ type Applicationer interface {
 // Application is the main application
 type Application struct {
 	logger            log.Loggerer
-	grpcServiceServer grpcserver.GRPCServicer
+	grpcServiceServer grpcFactory.Serverer
 	grpcServerAddress string
 	service           service.EmailServicer
+	dispatcher        service.Dispatcherer
+	scheduler         service.Schedulerer
+	webhookNotifier   webhook.Notifierer
+	bounceServer      bounce.Serverer
+	httpServer        httpserver.Serverer
+	healthChecker     health.Checkerer
+	tracerProvider    tracing.Providerer
+	configWatcher     config.Watcherer
 }
 
-// NewApplication creates a new application
-func NewApplication(config *config.Config, centralConfig *commonConfig.Config) Applicationer {
+// NewApplication validates the configuration, whose secret references are already resolved,
+// and creates a new application. The resolver resolves the secrets of the reloaded
+// configurations. The components created before an error are closed.
+func NewApplication(
+	config *config.Config,
+	centralConfig *commonConfig.Config,
+	resolver secret.Resolverer,
+) (_ Applicationer, err error) {
+	if err := config.Validate(centralConfig); err != nil {
+		return nil, err
+	}
+	var closers []func()
+	defer func() {
+		if err != nil {
+			for index := len(closers) - 1; index >= 0; index-- {
+				closers[index]()
+			}
+		}
+	}()
+
 	logFactory := log.NewLogFactory(config.Environment)
 	logger := logFactory.NewLogger()
 	if centralConfig.TLSEnabled {
@@ -36,52 +102,441 @@ func NewApplication(config *config.Config, centralConfig *commonConfig.Config) A
 	} else {
 		logger.Info("TLS is disabled")
 	}
-	emailService, err := (&service.Factory{}).CreateService(config, centralConfig)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	pipelineMetrics, err := metrics.NewMetrics(registry)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating metrics: %v", err)
+	}
+	var tracerProvider tracing.Providerer
+	if config.Tracing.Enabled {
+		exporterProvider, err := tracing.NewProvider(context.Background(), tracing.Config{
+			ServiceName: config.Tracing.ServiceName,
+			Endpoint:    config.Tracing.Endpoint,
+			Insecure:    config.Tracing.Insecure,
+			SampleRatio: config.Tracing.SampleRatio,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error creating tracer provider: %v", err)
+		}
+		tracerProvider = exporterProvider
+		closers = append(closers, func() {
+			exporterProvider.Shutdown(context.Background())
+		})
+	}
+	suppressionRepository, err := repository.NewFileSuppressionRepository(config.Suppressions.StorePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating suppression repository: %v", err)
+	}
+	preferenceRepository, err := repository.NewFilePreferenceRepository(config.Preferences.StorePath)
 	if err != nil {
-		logger.Error(err, "Failed to create email service")
+		return nil, fmt.Errorf("Error creating preference repository: %v", err)
 	}
+	smtpService := metrics.NewSMTPService(&service.SMTPService{}, pipelineMetrics, &clock.Clock{})
+	reloader := NewReloader(
+		config,
+		centralConfig,
+		resolver,
+		logger,
+	)
+	serviceFactory := &service.Factory{}
+	emailService, err := serviceFactory.CreateService(
+		config,
+		centralConfig,
+		suppressionRepository,
+		preferenceRepository,
+		smtpService,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating email service: %v", err)
+	}
+	reloader.OnReload(emailService.Reload)
+	readinessChecks := []health.Check{health.NewRelayCheck(smtpService, emailService)}
+	eventBus := event.NewBus(&clock.Clock{}, config.Events.HistorySize, config.Events.BufferSize)
+	messageRepository, err := repository.NewFileMessageRepository(config.Scheduler.StorePath, metrics.NewBus(eventBus, pipelineMetrics))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating message repository: %v", err)
+	}
+	if skipped := messageRepository.CorruptEntries(); skipped > 0 {
+		logger.Warn(fmt.Sprintf("Skipped %d corrupt entries of the message store", skipped))
+	}
+	webhookNotifier, err := webhook.NewNotifier(
+		eventBus,
+		getWebhookEndpoints(config),
+		&http.Client{Timeout: config.Webhooks.Timeout},
+		&clock.Clock{},
+		logger,
+		webhook.Options{
+			Retry: webhook.Retry{
+				MaxAttempts:    config.Webhooks.MaxAttempts,
+				InitialBackoff: config.Webhooks.InitialBackoff,
+				MaxBackoff:     config.Webhooks.MaxBackoff,
+			},
+			QueueSize: config.Webhooks.QueueSize,
+			LogSize:   config.Webhooks.LogSize,
+			StorePath: config.Webhooks.StorePath,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating webhook notifier: %v", err)
+	}
+	deliveryTracker := service.NewDeliveryTracker(emailService, messageRepository, &clock.Clock{}, logger)
+	dispatcher, err := serviceFactory.CreateDispatcher(config, deliveryTracker)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating dispatcher: %v", err)
+	}
+	closers = append(closers, dispatcher.Close)
+	registry.MustRegister(metrics.NewLaneCollector(dispatcher))
+	readinessChecks = append(readinessChecks, health.NewQueueCheck(dispatcher))
+	scheduler := service.NewScheduler(
+		messageRepository,
+		dispatcher,
+		&clock.Clock{},
+		logger,
+		config.Scheduler.PollInterval,
+		config.Scheduler.Concurrency,
+		config.Scheduler.Retention,
+	)
 
+	bounceRecorder := service.NewBounceRecorder(messageRepository, suppressionRepository, &clock.Clock{}, logger)
+	var bounceServer bounce.Serverer
+	if config.Bounces.Enabled {
+		bounceServer, err = bounce.NewServer(
+			config.Bounces.Address,
+			config.Bounces.Hostname,
+			bounce.NewVERP(config.Bounces.Prefix, config.Bounces.Domain, config.Bounces.Secret),
+			config.Bounces.FeedbackAddress,
+			bounceRecorder,
+			logger,
+			config.Bounces.MaxSize,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating bounce server: %v", err)
+		}
+		closers = append(closers, func() {
+			bounceServer.Close()
+		})
+	}
+
+	var httpServer httpserver.Serverer
+	if config.HTTP.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle(unsubscribe.Path, unsubscribe.NewEndpoint(
+			unsubscribe.NewLinks(config.HTTP.URL+unsubscribe.Path, config.Unsubscribe.Secret),
+			service.NewUnsubscribeRecorder(messageRepository, suppressionRepository, preferenceRepository, &clock.Clock{}, logger),
+			logger,
+		))
+		trackingRecorder := service.NewTrackingRecorder(messageRepository, &clock.Clock{}, logger)
+		mux.Handle(tracking.OpenPath, tracking.NewOpenEndpoint(
+			tracking.NewPixels(config.HTTP.URL+tracking.OpenPath, config.Tracking.Secret),
+			trackingRecorder,
+			logger,
+		))
+		mux.Handle(tracking.ClickPath, tracking.NewClickEndpoint(
+			tracking.NewClicks(config.HTTP.URL+tracking.ClickPath, config.Tracking.Secret),
+			trackingRecorder,
+			logger,
+		))
+		mux.Handle(metrics.Path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		httpServer, err = httpserver.NewServer(config.HTTP.Address, mux)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating HTTP server: %v", err)
+		}
+		closers = append(closers, func() {
+			httpServer.Close()
+		})
+	}
+
+	idempotencyStore := service.NewIdempotencyStore(&clock.Clock{}, config.Idempotency.Window)
+	limiter := ratelimit.NewLimiter(&clock.Clock{}, getRateLimits(config))
+	reloader.OnReload(reloadRateLimits(limiter))
+	rateLimiter := metrics.NewRateLimiter(limiter, pipelineMetrics)
+
+	healthServer := grpcHealth.NewServer()
+	healthChecker := health.NewChecker(
+		healthServer,
+		[]string{
+			"",
+			pb_email_api.EmailService_ServiceDesc.ServiceName,
+			commonPB.EmailService_ServiceDesc.ServiceName,
+		},
+		readinessChecks,
+		logger,
+		config.Health.Interval,
+		config.Health.Timeout,
+	)
+
+	var tlsConfig *tls.Config
+	if centralConfig.TLSEnabled {
+		certificateStore, err := mtls.NewCertificateStore(mtls.Config{
+			CertFile:   config.TLS.CertFile,
+			KeyFile:    config.TLS.KeyFile,
+			CAFile:     config.TLS.CAFile,
+			ClientAuth: config.TLS.ClientAuth,
+		}, &clock.Clock{}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading TLS certificates: %v", err)
+		}
+		tlsConfig = certificateStore.ServerConfig()
+	}
 	grpcServerAddress := fmt.Sprintf(
 		"%s:%s",
 		centralConfig.EmailService.Host,
 		centralConfig.EmailService.Port,
 	)
-	grpcServiceServer, err := (&grpcFactory.Factory{}).Create(
+	grpcServiceServer, err := (&grpcFactory.Factory{}).Create(grpcServerAddress, grpcFactory.Dependencies{
+		EmailService: service.EmailServiceDependencies{
+			Scheduler:             scheduler,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			FeedbackHandler:       bounceRecorder,
+			EventBus:              eventBus,
+			WebhookNotifier:       webhookNotifier,
+			IdempotencyStore:      idempotencyStore,
+			RateLimiter:           rateLimiter,
+			Clock:                 &clock.Clock{},
+			MaxBatchRecipients:    config.Batch.MaxRecipients,
+			MandatoryCategories:   config.Preferences.MandatoryCategories,
+			AdminClients:          config.TLS.AdminClients,
+			APIKeys:               getAPIKeys(config),
+		},
+		Metrics:        pipelineMetrics,
+		TracerProvider: getTracerProvider(tracerProvider),
+		HealthServer:   healthServer,
+		LogFactory:     logFactory,
+		TLSConfig:      tlsConfig,
+		ClientAuth:     centralConfig.TLSEnabled && config.TLS.ClientAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating gRPC server: %v", err)
+	}
+
+	return New(
+		grpcServiceServer,
 		grpcServerAddress,
 		emailService,
-		logFactory,
-		centralConfig.TLSEnabled,
-	)
-	if err != nil {
-		logger.Error(err, "Failed to create grpc server: %v")
+		dispatcher,
+		scheduler,
+		webhookNotifier,
+		bounceServer,
+		httpServer,
+		healthChecker,
+		tracerProvider,
+		newConfigWatcher(config.Path(), reloader, logger),
+		logger,
+	), nil
+}
+
+// newConfigWatcher creates a watcher reloading the configuration when it changes, unless
+// the configuration was not loaded from a directory
+func newConfigWatcher(path string, reloader Reloaderer, logger log.Loggerer) config.Watcherer {
+	if path == "" {
+		return nil
 	}
+	return config.NewWatcher(path, func() {
+		if err := reloader.Reload(); err != nil {
+			logger.Error(err, "Failed to reload configuration")
+		}
+	}, logger)
+}
 
-	return New(grpcServiceServer, grpcServerAddress, emailService, logger)
+// reloadRateLimits returns a function applying the rate limits of a reloaded configuration
+func reloadRateLimits(limiter *ratelimit.Limiter) func(config *config.Config) {
+	return func(config *config.Config) {
+		limiter.SetLimits(getRateLimits(config))
+	}
+}
+
+func getRateLimits(config *config.Config) ratelimit.Limits {
+	return ratelimit.Limits{
+		Client:    ratelimit.Limit{Rate: config.RateLimit.Client.Rate, Burst: config.RateLimit.Client.Burst},
+		Recipient: ratelimit.Limit{Rate: config.RateLimit.Recipient.Rate, Burst: config.RateLimit.Recipient.Burst},
+		Domain:    ratelimit.Limit{Rate: config.RateLimit.Domain.Rate, Burst: config.RateLimit.Domain.Burst},
+	}
+}
+
+// getAPIKeys maps the API keys of the configuration to the clients they identify
+func getAPIKeys(config *config.Config) map[string]string {
+	apiKeys := make(map[string]string, len(config.RateLimit.APIKeys))
+	for _, apiKey := range config.RateLimit.APIKeys {
+		apiKeys[apiKey.Key] = apiKey.Client
+	}
+	return apiKeys
+}
+
+// getTracerProvider returns the tracer provider of the exporter, or one that records
+// nothing when tracing is disabled
+func getTracerProvider(tracerProvider tracing.Providerer) trace.TracerProvider {
+	if tracerProvider == nil {
+		return noop.NewTracerProvider()
+	}
+	return tracerProvider
+}
+
+func getWebhookEndpoints(config *config.Config) []webhook.Endpoint {
+	endpoints := make([]webhook.Endpoint, 0, len(config.Webhooks.Endpoints))
+	for _, endpoint := range config.Webhooks.Endpoints {
+		events := make([]webhook.EventType, 0, len(endpoint.Events))
+		for _, eventType := range endpoint.Events {
+			events = append(events, webhook.EventType(eventType))
+		}
+		endpoints = append(endpoints, webhook.Endpoint{
+			Name:   endpoint.Name,
+			URL:    endpoint.URL,
+			Secret: endpoint.Secret,
+			Events: events,
+		})
+	}
+	return endpoints
 }
 
 // New creates a new application with raw parameters
 func New(
-	grpcServiceServer grpcserver.GRPCServicer,
+	grpcServiceServer grpcFactory.Serverer,
 	grpcServerAddress string,
 	service service.EmailServicer,
+	dispatcher service.Dispatcherer,
+	scheduler service.Schedulerer,
+	webhookNotifier webhook.Notifierer,
+	bounceServer bounce.Serverer,
+	httpServer httpserver.Serverer,
+	healthChecker health.Checkerer,
+	tracerProvider tracing.Providerer,
+	configWatcher config.Watcherer,
 	logger log.Loggerer,
 ) Applicationer {
 	return &Application{
 		grpcServiceServer: grpcServiceServer,
 		grpcServerAddress: grpcServerAddress,
 		service:           service,
+		dispatcher:        dispatcher,
+		scheduler:         scheduler,
+		webhookNotifier:   webhookNotifier,
+		bounceServer:      bounceServer,
+		httpServer:        httpServer,
+		healthChecker:     healthChecker,
+		tracerProvider:    tracerProvider,
+		configWatcher:     configWatcher,
 		logger:            logger,
 	}
 }
 
-// StartServer starts the gRPC server
-func (application *Application) StartServer() {
+// Run starts the application and shuts it down gracefully on SIGINT or SIGTERM, giving
+// the work in flight up to the timeout to finish. It returns the exit code of the process.
+func (application *Application) Run(shutdownTimeout time.Duration) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		served <- application.StartServer()
+	}()
+
+	select {
+	case err := <-served:
+		if err == nil {
+			err = errors.New("gRPC server stopped")
+		}
+		application.logger.Error(err, "Application stopped unexpectedly")
+		application.Close()
+		return ExitServeError
+	case <-ctx.Done():
+	}
+	application.logger.Info("Shutting down on signal")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := application.Shutdown(shutdownCtx); err != nil {
+		application.logger.Error(err, "Failed to shut down gracefully")
+		return ExitShutdownTimeout
+	}
+	if err := <-served; err != nil {
+		application.logger.Error(err, "Failed to serve grpc server")
+		return ExitServeError
+	}
+	application.logger.Info("Application shut down")
+	return ExitOK
+}
+
+// StartServer starts the webhook notifier, the email scheduler, the configuration watcher,
+// the bounce and HTTP servers when enabled, the readiness checks and the gRPC server. It
+// returns once the gRPC server stops serving.
+func (application *Application) StartServer() error {
+	err := application.webhookNotifier.Start()
+	if err != nil {
+		application.logger.Error(err, "Failed to start webhook notifier")
+		return err
+	}
+	err = application.scheduler.Start()
+	if err != nil {
+		application.logger.Error(err, "Failed to start scheduler")
+		return err
+	}
+	if application.configWatcher != nil {
+		if err := application.configWatcher.Start(); err != nil {
+			application.logger.Error(err, "Failed to start configuration watcher")
+			return err
+		}
+	}
+	if application.bounceServer != nil {
+		go func() {
+			if err := application.bounceServer.Serve(); err != nil {
+				application.logger.Error(err, "Failed to serve bounce server")
+			}
+		}()
+	}
+	if application.httpServer != nil {
+		go func() {
+			if err := application.httpServer.Serve(); err != nil {
+				application.logger.Error(err, "Failed to serve HTTP server")
+			}
+		}()
+	}
+	if application.healthChecker != nil {
+		application.healthChecker.Start()
+	}
 	application.logger.Info(fmt.Sprintf("Starting gRPC server on %s:...", application.grpcServerAddress))
-	err := application.grpcServiceServer.Serve()
+	err = application.grpcServiceServer.Serve()
 	if err != nil {
 		application.logger.Error(err, "Failed to serve grpc server")
-		return
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, ends the event streams, waits for the other requests
+// in flight and drains the queued emails. The emails not sent when the context is done stay in the message store,
+// which the scheduler recovers on the next start.
+func (application *Application) Shutdown(ctx context.Context) error {
+	switch {
+	case application.service == nil:
+		return errors.New("Service is not created")
+	case application.grpcServiceServer == nil:
+		return errors.New("gRPC server is not created")
+	}
+	// The clients move to other instances while the requests in flight finish
+	if application.healthChecker != nil {
+		application.healthChecker.Stop()
+		application.logger.Info("Health checker stopped")
+	}
+	grpcErr := application.grpcServiceServer.Shutdown(ctx)
+	if grpcErr != nil {
+		application.logger.Error(grpcErr, "Failed to stop gRPC server gracefully")
+	} else {
+		application.logger.Info("gRPC server stopped gracefully")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		application.closeServices()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return fmt.Errorf("Timed out draining the emails in flight: %v", ctx.Err())
 	}
+	// The requests were cut short even if the emails were drained
+	return grpcErr
 }
 
 // Close closes the gRPC server and services used by the application
@@ -94,8 +549,49 @@ func (application *Application) Close() {
 		application.logger.Error(nil, "gRPC server is not created")
 		return
 	}
+	if application.healthChecker != nil {
+		application.healthChecker.Stop()
+		application.logger.Info("Health checker stopped")
+	}
 	application.grpcServiceServer.Close()
 	application.logger.Info("gRPC server closed")
+	application.closeServices()
+}
+
+// closeServices closes the servers other than the gRPC one and sends the emails in flight
+func (application *Application) closeServices() {
+	if application.configWatcher != nil {
+		application.configWatcher.Stop()
+		application.logger.Info("Configuration watcher stopped")
+	}
+	if application.bounceServer != nil {
+		application.bounceServer.Close()
+		application.logger.Info("Bounce server closed")
+	}
+	if application.httpServer != nil {
+		application.httpServer.Close()
+		application.logger.Info("HTTP server closed")
+	}
+	if application.scheduler != nil {
+		application.scheduler.Stop()
+		application.logger.Info("Scheduler stopped")
+	}
+	if application.dispatcher != nil {
+		application.dispatcher.Close()
+		application.logger.Info("Dispatcher closed")
+	}
+	if application.webhookNotifier != nil {
+		application.webhookNotifier.Stop()
+		application.logger.Info("Webhook notifier stopped")
+	}
+	if application.tracerProvider != nil {
+		// Flushes the spans still waiting for their batch
+		if err := application.tracerProvider.Shutdown(context.Background()); err != nil {
+			application.logger.Error(err, "Failed to shut down tracer provider")
+		} else {
+			application.logger.Info("Tracer provider shut down")
+		}
+	}
 }
 
 // GetGRPCServerAddress returns the gRPC server address
@@ -2,9 +2,25 @@ package application
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,8 +33,18 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"qd-email-api/internal/bounce"
 	"qd-email-api/internal/config"
+	"qd-email-api/internal/secret"
+	"qd-email-api/internal/webhook"
+	"qd-email-api/pb/gen/go/pb_email_api"
 )
 
 func isServerUp(addr string) bool {
@@ -49,6 +75,14 @@ func waitForServerUp(application Applicationer) {
 }
 
 const wrongEmail = "wrong@email.com"
+const deferredEmail = "busy@deferred.com"
+const bouncedEmail = "gone@bounced.com"
+
+// envelopeSenders holds the envelope sender the mock SMTP server received for each recipient
+var envelopeSenders sync.Map
+
+// receivedEmails holds the last email the mock SMTP server received for each recipient
+var receivedEmails sync.Map
 
 func startMockSMTPServer(mockSMTPServerHost string, mockSMTPServerPort string) *smtpd.Server {
 	authMechanisms := map[string]bool{
@@ -58,9 +92,15 @@ func startMockSMTPServer(mockSMTPServerHost string, mockSMTPServerPort string) *
 		Addr:     fmt.Sprintf("%s:%s", mockSMTPServerHost, mockSMTPServerPort),
 		Appname:  "Mock SMTP Server",
 		Hostname: mockSMTPServerPort,
+		// Unknown mailboxes are rejected permanently while busy ones are deferred
+		HandlerRcpt: func(remoteAddress net.Addr, from string, to string) bool {
+			return to != wrongEmail
+		},
 		Handler: func(remoteAddress net.Addr, from string, to []string, data []byte) error {
-			if to[0] == wrongEmail {
-				return fmt.Errorf("Invalid email address")
+			envelopeSenders.Store(to[0], from)
+			receivedEmails.Store(to[0], string(data))
+			if to[0] == deferredEmail {
+				return fmt.Errorf("Mailbox busy")
 			}
 			return nil
 		},
@@ -81,12 +121,9 @@ func startMockSMTPServer(mockSMTPServerHost string, mockSMTPServerPort string) *
 	return &smtpServer
 }
 
-func TestEmailMicroService(t *testing.T) {
-	email := "test@test.com"
-	subject := "Test Subject"
-	body := "Test Body"
-	correlationID := "1234567890"
-
+// loadTestConfig loads the test configuration from the root of the repository, which
+// stays the working directory until the end of the test
+func loadTestConfig(t *testing.T) (config.Config, commonConfig.Config) {
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	os.Setenv(commonConfig.AppEnvironmentKey, "test")
 
@@ -95,13 +132,16 @@ func TestEmailMicroService(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to change working directory: %s", err)
 	}
-	// Defer the reset of the working directory
-	defer os.Chdir(*originalWD)
+	// Reset the working directory at the end of the test
+	t.Cleanup(func() {
+		os.Chdir(*originalWD)
+	})
 
 	var config config.Config
 	config.Load("internal/config")
 
 	centralConfig := commonConfig.Config{
+		AppName:                   "QD Test",
 		TLSEnabled:                true,
 		EmailVerificationEndpoint: "http://localhost:2222/",
 		EmailService: commonConfig.Address{
@@ -113,11 +153,42 @@ func TestEmailMicroService(t *testing.T) {
 			Port: "3333",
 		},
 	}
+	return config, centralConfig
+}
+
+// newTestResolver resolves the secret references to files and environment variables
+func newTestResolver() secret.Resolverer {
+	return secret.NewResolver(map[string]secret.Providerer{
+		secret.SchemeFile: &secret.FileProvider{},
+		secret.SchemeEnv:  &secret.EnvProvider{},
+	})
+}
+
+func TestEmailMicroService(t *testing.T) {
+	email := "test@test.com"
+	subject := "Test Subject"
+	body := "Test Body"
+	correlationID := "1234567890"
+
+	config, centralConfig := loadTestConfig(t)
 
 	smtpServer := startMockSMTPServer(config.SMTP.Host, config.SMTP.Port)
 	defer smtpServer.Close()
 
-	application := NewApplication(&config, &centralConfig)
+	webhookRequests := make(chan *http.Request, 100)
+	webhookBodies := make(chan []byte, 100)
+	webhookReceiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		webhookRequests <- request
+		webhookBodies <- body
+	}))
+	defer webhookReceiver.Close()
+	config.Webhooks.Endpoints[0].URL = webhookReceiver.URL
+
+	application, err := NewApplication(&config, &centralConfig, newTestResolver())
+	if err != nil {
+		t.Fatalf("Failed to create the application: %s", err)
+	}
 	go func() {
 		application.StartServer()
 	}()
@@ -163,6 +234,34 @@ func TestEmailMicroService(t *testing.T) {
 		assert.Nil(t, registerResponse)
 	})
 
+	t.Run("SendEmail_Deferred", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := context.Background()
+		sendEmailResponse, err := client.SendEmail(
+			commonLogger.AddCorrelationIDToOutgoingContext(ctx, correlationID),
+			&pb_email_api.SendEmailRequest{
+				To:      deferredEmail,
+				Subject: subject,
+				Body:    body,
+			})
+
+		assert.NoError(t, err)
+		assert.True(t, sendEmailResponse.Success)
+		assert.Equal(t, "Email deferred", sendEmailResponse.Message)
+
+		statusResponse, err := client.GetEmailStatus(
+			commonLogger.AddCorrelationIDToOutgoingContext(ctx, correlationID),
+			&pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId},
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pb_email_api.EmailStatus_EMAIL_STATUS_DEFERRED, statusResponse.Email.Status)
+		assert.Contains(t, statusResponse.Email.History[len(statusResponse.Email.History)-1].Response, "451")
+	})
+
 	t.Run("SendEmail_Email_Error_Missing_Correlation_ID", func(t *testing.T) {
 		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
 		assert.NoError(t, err)
@@ -181,4 +280,425 @@ func TestEmailMicroService(t *testing.T) {
 		assert.Equal(t, "rpc error: code = Unknown desc = Correlation ID not found in metadata", err.Error())
 		assert.Nil(t, registerResponse)
 	})
+	t.Run("SendEmail_Scheduled_And_Cancelled", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:      email,
+			Subject: subject,
+			Body:    body,
+			SendAt:  timestamppb.New(time.Now().Add(time.Hour)),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Email scheduled", sendEmailResponse.Message)
+		assert.NotEmpty(t, sendEmailResponse.MessageId)
+
+		cancelResponse, err := client.CancelEmail(ctx, &pb_email_api.CancelEmailRequest{
+			MessageId: sendEmailResponse.MessageId,
+		})
+		assert.NoError(t, err)
+		assert.True(t, cancelResponse.Success)
+
+		_, err = client.CancelEmail(ctx, &pb_email_api.CancelEmailRequest{
+			MessageId: sendEmailResponse.MessageId,
+		})
+		assert.Equal(t, "rpc error: code = FailedPrecondition desc = Email can no longer be cancelled", err.Error())
+	})
+
+	t.Run("Webhook_Receives_Delivery_Events", func(t *testing.T) {
+		received := map[webhook.EventType]string{}
+		for len(received) < 2 {
+			select {
+			case request := <-webhookRequests:
+				body := <-webhookBodies
+				timestamp, err := strconv.ParseInt(request.Header.Get(webhook.TimestampHeader), 10, 64)
+				assert.NoError(t, err)
+				assert.Equal(t, webhook.Sign(config.Webhooks.Endpoints[0].Secret, timestamp, body), request.Header.Get(webhook.SignatureHeader))
+				var payload webhook.Payload
+				assert.NoError(t, json.Unmarshal(body, &payload))
+				received[payload.Type] = payload.To
+			case <-time.After(10 * time.Second):
+				t.Fatal("Webhook events not received")
+			}
+		}
+		assert.Equal(t, email, received[webhook.EventSent])
+		assert.Equal(t, deferredEmail, received[webhook.EventDeferred])
+
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		// The deliveries are only listed to the admin clients
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		_, err = client.ListWebhookDeliveries(ctx, &pb_email_api.ListWebhookDeliveriesRequest{Endpoint: "test"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("Bounce_Marks_Email_Bounced", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:      bouncedEmail,
+			Subject: subject,
+			Body:    body,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Email sent", sendEmailResponse.Message)
+
+		returnPath, _ := envelopeSenders.Load(bouncedEmail)
+		expectedReturnPath := bounce.NewVERP(config.Bounces.Prefix, config.Bounces.Domain, config.Bounces.Secret).Encode(sendEmailResponse.MessageId)
+		assert.Equal(t, expectedReturnPath, returnPath)
+		err = smtp.SendMail(config.Bounces.Address, nil, "", []string{expectedReturnPath}, []byte(
+			"Subject: Undelivered Mail Returned to Sender\r\n"+
+				"Content-Type: multipart/report; report-type=delivery-status; boundary=report\r\n\r\n"+
+				"--report\r\nContent-Type: message/delivery-status\r\n\r\n"+
+				"Reporting-MTA: dns; mx.bounced.com\r\n\r\n"+
+				"Final-Recipient: rfc822; "+bouncedEmail+"\r\nAction: failed\r\nStatus: 5.1.1\r\n"+
+				"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n"+
+				"--report--\r\n",
+		))
+		assert.NoError(t, err)
+
+		statusResponse, err := client.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, pb_email_api.EmailStatus_EMAIL_STATUS_BOUNCED, statusResponse.Email.Status)
+		assert.Equal(t, "550 5.1.1 User unknown", statusResponse.Email.History[len(statusResponse.Email.History)-1].Response)
+
+		// The bounced address is suppressed
+		_, err = client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:      bouncedEmail,
+			Subject: subject,
+			Body:    body,
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+	t.Run("One_Click_Unsubscribe", func(t *testing.T) {
+		const reader = "reader@test.com"
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       reader,
+			Subject:  subject,
+			Body:     body,
+			Category: "newsletter",
+		})
+		assert.NoError(t, err)
+
+		received, _ := receivedEmails.Load(reader)
+		assert.Contains(t, received, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+		match := regexp.MustCompile(`List-Unsubscribe: <([^>]+)>`).FindStringSubmatch(received.(string))
+		assert.Len(t, match, 2)
+		assert.True(t, strings.HasPrefix(match[1], config.HTTP.URL+"/unsubscribe?token="))
+		response, err := http.Post(match[1], "application/x-www-form-urlencoded", strings.NewReader("List-Unsubscribe=One-Click"))
+		assert.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		statusResponse, err := client.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, pb_email_api.EmailStatus_EMAIL_STATUS_UNSUBSCRIBED, statusResponse.Email.Status)
+
+		// The recipient no longer receives the emails of the category only
+		sendEmailResponse, err = client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       reader,
+			Subject:  subject,
+			Body:     body,
+			Category: "newsletter",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Email skipped", sendEmailResponse.Message)
+		_, err = client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       reader,
+			Subject:  subject,
+			Body:     body,
+			Category: "product-updates",
+		})
+		assert.NoError(t, err)
+		_, err = client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       reader,
+			Subject:  subject,
+			Body:     body,
+			Category: "receipts",
+		})
+		assert.NoError(t, err)
+	})
+	t.Run("Open_Tracking_Pixel", func(t *testing.T) {
+		const onboarded = "onboarded@test.com"
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:         onboarded,
+			Subject:    subject,
+			Body:       "<html><body>Welcome</body></html>",
+			Category:   "onboarding",
+			TrackOpens: true,
+		})
+		assert.NoError(t, err)
+
+		received, _ := receivedEmails.Load(onboarded)
+		match := regexp.MustCompile(`<img src="([^"]+)" width="1" height="1" alt="" style="display:none"></body>`).FindStringSubmatch(received.(string))
+		assert.Len(t, match, 2)
+		assert.True(t, strings.HasPrefix(match[1], config.HTTP.URL+"/open?token="))
+		request, _ := http.NewRequest(http.MethodGet, match[1], nil)
+		request.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Thunderbird/115.5.0")
+		response, err := http.DefaultClient.Do(request)
+		assert.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, "image/gif", response.Header.Get("Content-Type"))
+
+		statusResponse, err := client.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, pb_email_api.EmailStatus_EMAIL_STATUS_SENT, statusResponse.Email.Status)
+		assert.Equal(t, int32(1), statusResponse.Email.Opens.Count)
+		assert.Equal(t, "desktop", statusResponse.Email.Opens.UserAgent)
+	})
+	t.Run("Click_Tracking_Redirect", func(t *testing.T) {
+		const clicker = "clicker@test.com"
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), correlationID)
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:          clicker,
+			Subject:     subject,
+			Body:        `<a href="https://quadev.net/welcome">Start</a> <a href="mailto:support@quadev.net">Support</a>`,
+			Category:    "onboarding",
+			TrackClicks: true,
+		})
+		assert.NoError(t, err)
+
+		received, _ := receivedEmails.Load(clicker)
+		assert.Contains(t, received, `<a href="mailto:support@quadev.net">Support</a>`)
+		match := regexp.MustCompile(`<a href="([^"]+)">Start</a>`).FindStringSubmatch(received.(string))
+		assert.Len(t, match, 2)
+		assert.True(t, strings.HasPrefix(match[1], config.HTTP.URL+"/click?token="))
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		response, err := noRedirect.Get(match[1])
+		assert.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusFound, response.StatusCode)
+		assert.Equal(t, "https://quadev.net/welcome", response.Header.Get("Location"))
+
+		statusResponse, err := client.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), statusResponse.Email.Clicks.Count)
+		assert.Equal(t, "https://quadev.net/welcome", statusResponse.Email.Clicks.Links[0].Url)
+
+		// Tampered redirects are not followed
+		response, err = noRedirect.Get(config.HTTP.URL + "/click?token=aHR0cHM6Ly9ldmlsLnRlc3QuY29t.00000000000000000000000000000000")
+		assert.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+	t.Run("Metrics_Endpoint", func(t *testing.T) {
+		response, err := http.Get(config.HTTP.URL + "/metrics")
+		assert.NoError(t, err)
+		content, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, string(content), `email_grpc_requests_total{code="OK",method="/pb_email_api.EmailService/SendEmail"}`)
+		assert.Contains(t, string(content), `email_smtp_replies_total{class="2xx",provider="other"}`)
+		assert.Contains(t, string(content), `email_queue_depth{priority="critical"} 0`)
+		assert.Contains(t, string(content), "go_goroutines")
+	})
+
+	t.Run("Health_Check_Follows_Relay", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+		client := healthpb.NewHealthClient(connection)
+		// The checks run every second
+		waitForStatus := func(service string, expected healthpb.HealthCheckResponse_ServingStatus) {
+			var servingStatus healthpb.HealthCheckResponse_ServingStatus
+			for attempt := 0; attempt < 50 && servingStatus != expected; attempt++ {
+				response, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				assert.NoError(t, err)
+				servingStatus = response.GetStatus()
+				if servingStatus != expected {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+			assert.Equal(t, expected, servingStatus)
+		}
+
+		waitForStatus("", healthpb.HealthCheckResponse_SERVING)
+		waitForStatus("pb_email_api.EmailService", healthpb.HealthCheckResponse_SERVING)
+
+		smtpServer.Close()
+
+		waitForStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		waitForStatus("pb_email_api.EmailService", healthpb.HealthCheckResponse_NOT_SERVING)
+	})
+}
+
+func TestNewApplicationMisconfigured(t *testing.T) {
+	config, centralConfig := loadTestConfig(t)
+	config.SMTP.Host = ""
+	config.SMTP.Port = "smtp"
+	centralConfig.EmailService.Port = "0"
+
+	application, err := NewApplication(&config, &centralConfig, newTestResolver())
+
+	assert.Nil(t, application)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SMTP host is required")
+	assert.Contains(t, err.Error(), "SMTP port \"smtp\" is not a valid port")
+	assert.Contains(t, err.Error(), "Central email service port \"0\" is not a valid port")
+}
+
+// newClientCertificate signs a client certificate with the CA of the repository
+func newClientCertificate(t *testing.T, commonName string) tls.Certificate {
+	ca, err := tls.LoadX509KeyPair("certs/ca.pem", "certs/ca.key")
+	assert.NoError(t, err)
+	caCertificate, err := x509.ParseCertificate(ca.Certificate[0])
+	assert.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, caCertificate, &key.PublicKey, ca.PrivateKey)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{certificate}, PrivateKey: key}
+}
+
+func TestEmailMicroServiceMutualTLS(t *testing.T) {
+	config, centralConfig := loadTestConfig(t)
+	config.TLS.ClientAuth = true
+	config.TLS.AdminClients = []string{"qd.admin.api"}
+
+	smtpServer := startMockSMTPServer(config.SMTP.Host, config.SMTP.Port)
+	defer smtpServer.Close()
+
+	application, err := NewApplication(&config, &centralConfig, newTestResolver())
+	if err != nil {
+		t.Fatalf("Failed to create the application: %s", err)
+	}
+	go func() {
+		application.StartServer()
+	}()
+	defer application.Close()
+
+	waitForServerUp(application)
+
+	t.Run("SendEmail_Without_Client_Certificate_Unauthenticated", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+		defer connection.Close()
+
+		client := commonPB.NewEmailServiceClient(connection)
+		_, err = client.SendEmail(
+			commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890"),
+			&commonPB.SendEmailRequest{To: "test@test.com", Subject: "Test Subject", Body: "Test Body"},
+		)
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("SendEmail_With_Client_Certificate_Success", func(t *testing.T) {
+		tlsConfig, err := commonTLS.CreateTLSConfig()
+		assert.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{newClientCertificate(t, "qd.authentication.api")}
+		connection, err := grpc.Dial(application.GetGRPCServerAddress(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		assert.NoError(t, err)
+		defer connection.Close()
+
+		client := commonPB.NewEmailServiceClient(connection)
+		response, err := client.SendEmail(
+			commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890"),
+			&commonPB.SendEmailRequest{To: "test@test.com", Subject: "Test Subject", Body: "Test Body"},
+		)
+
+		assert.NoError(t, err)
+		assert.True(t, response.GetSuccess())
+	})
+
+	t.Run("UpdatePreferences_Without_Admin_Certificate_Permission_Denied", func(t *testing.T) {
+		tlsConfig, err := commonTLS.CreateTLSConfig()
+		assert.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{newClientCertificate(t, "qd.authentication.api")}
+		connection, err := grpc.Dial(application.GetGRPCServerAddress(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		assert.NoError(t, err)
+		defer connection.Close()
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		_, err = client.UpdatePreferences(
+			commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890"),
+			&pb_email_api.UpdatePreferencesRequest{Address: "member@test.com"},
+		)
+
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("Opted_Out_Category_Is_Skipped", func(t *testing.T) {
+		const member = "member@test.com"
+		tlsConfig, err := commonTLS.CreateTLSConfig()
+		assert.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{newClientCertificate(t, "qd.admin.api")}
+		connection, err := grpc.Dial(application.GetGRPCServerAddress(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		assert.NoError(t, err)
+		defer connection.Close()
+
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890")
+		_, err = client.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{
+			Address:     member,
+			Preferences: []*pb_email_api.CategoryPreference{{Category: "onboarding", Subscribed: false}},
+		})
+		assert.NoError(t, err)
+
+		sendEmailResponse, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       member,
+			Subject:  "Test Subject",
+			Body:     "Test Body",
+			Category: "onboarding",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Email skipped", sendEmailResponse.Message)
+		statusResponse, err := client.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: sendEmailResponse.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, pb_email_api.EmailStatus_EMAIL_STATUS_UNSUBSCRIBED, statusResponse.Email.Status)
+
+		// The mandatory categories are always sent
+		sendEmailResponse, err = client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       member,
+			Subject:  "Test Subject",
+			Body:     "Test Body",
+			Category: "security-alerts",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Email sent", sendEmailResponse.Message)
+	})
+
+	t.Run("Health_Check_Without_Client_Certificate", func(t *testing.T) {
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+		defer connection.Close()
+
+		client := healthpb.NewHealthClient(connection)
+		_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+
+		assert.NoError(t, err)
+	})
 }
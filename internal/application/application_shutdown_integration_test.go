@@ -0,0 +1,157 @@
+package application
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mhale/smtpd"
+	commonLogger "github.com/quadev-ltd/qd-common/pkg/log"
+	commonTLS "github.com/quadev-ltd/qd-common/pkg/tls"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// startGatedSMTPServer starts a mock SMTP server on a free port holding every email until
+// it is released. It signals on entered when an email arrives.
+func startGatedSMTPServer(t *testing.T, entered chan<- struct{}, release <-chan struct{}) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for SMTP connections: %s", err)
+	}
+	smtpServer := &smtpd.Server{
+		Appname:  "Gated SMTP Server",
+		Hostname: "localhost",
+		Handler: func(remoteAddress net.Addr, from string, to []string, data []byte) error {
+			entered <- struct{}{}
+			<-release
+			return nil
+		},
+		AuthHandler: func(remoteAddress net.Addr, mechanism string, username []byte, password []byte, shared []byte) (bool, error) {
+			return true, nil
+		},
+		AuthMechs: map[string]bool{"PLAIN": true},
+	}
+	go smtpServer.Serve(listener)
+	t.Cleanup(func() {
+		smtpServer.Close()
+		listener.Close()
+	})
+	return listener.Addr().String()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	config, centralConfig := loadTestConfig(t)
+	config.Bounces.Enabled = false
+	config.HTTP.Enabled = false
+	config.Webhooks.Endpoints = nil
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	smtpAddress := startGatedSMTPServer(t, entered, release)
+	config.SMTP.Host, config.SMTP.Port, _ = net.SplitHostPort(smtpAddress)
+
+	// run starts an application and sends an email through it, returning once the email
+	// reaches the SMTP server
+	run := func(t *testing.T, shutdownTimeout time.Duration) (Applicationer, chan int, chan error) {
+		application, err := NewApplication(&config, &centralConfig, newTestResolver())
+		if err != nil {
+			t.Fatalf("Failed to create the application: %s", err)
+		}
+		exitCode := make(chan int, 1)
+		go func() {
+			exitCode <- application.Run(shutdownTimeout)
+		}()
+		waitForServerUp(application)
+
+		connection, err := commonTLS.CreateGRPCConnection(application.GetGRPCServerAddress(), centralConfig.TLSEnabled)
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			connection.Close()
+		})
+		sent := make(chan error, 1)
+		go func() {
+			client := pb_email_api.NewEmailServiceClient(connection)
+			ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890")
+			_, err := client.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+				To:      "test@test.com",
+				Subject: "Test Subject",
+				Body:    "Test Body",
+			})
+			sent <- err
+		}()
+		<-entered
+		return application, exitCode, sent
+	}
+
+	t.Run("Signal_Drains_Send_In_Flight", func(t *testing.T) {
+		application, exitCode, sent := run(t, 5*time.Second)
+
+		assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+		// The server stops accepting connections while the email is still being sent
+		for isServerUp(application.GetGRPCServerAddress()) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		release <- struct{}{}
+
+		assert.NoError(t, <-sent)
+		assert.Equal(t, ExitOK, <-exitCode)
+	})
+
+	t.Run("Signal_Timeout_Cancels_Send_In_Flight", func(t *testing.T) {
+		_, exitCode, sent := run(t, 200*time.Millisecond)
+
+		assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+		assert.Error(t, <-sent)
+		assert.Equal(t, ExitShutdownTimeout, <-exitCode)
+		release <- struct{}{}
+	})
+	t.Run("Signal_Ends_Event_Streams", func(t *testing.T) {
+		// The events are only streamed to the admin clients
+		adminConfig := config
+		adminConfig.TLS.ClientAuth = true
+		adminConfig.TLS.AdminClients = []string{"qd.admin.api"}
+		application, err := NewApplication(&adminConfig, &centralConfig, newTestResolver())
+		if err != nil {
+			t.Fatalf("Failed to create the application: %s", err)
+		}
+		exitCode := make(chan int, 1)
+		go func() {
+			exitCode <- application.Run(5 * time.Second)
+		}()
+		waitForServerUp(application)
+		tlsConfig, err := commonTLS.CreateTLSConfig()
+		assert.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{newClientCertificate(t, "qd.admin.api")}
+		connection, err := grpc.Dial(application.GetGRPCServerAddress(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		assert.NoError(t, err)
+		defer connection.Close()
+		client := pb_email_api.NewEmailServiceClient(connection)
+		ctx := commonLogger.AddCorrelationIDToOutgoingContext(context.Background(), "1234567890")
+		stream, err := client.StreamEvents(ctx, &pb_email_api.StreamEventsRequest{})
+		assert.NoError(t, err)
+		// The headers arrive once the stream is subscribed
+		_, err = stream.Header()
+		assert.NoError(t, err)
+
+		assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, "Server is shutting down", status.Convert(err).Message())
+		select {
+		case code := <-exitCode:
+			assert.Equal(t, ExitOK, code)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Shutdown blocked by the event stream")
+		}
+	})
+}
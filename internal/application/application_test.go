@@ -1,85 +1,271 @@
 package application
 
 import (
+	"context"
 	"errors"
+	bounceMock "qd-email-api/internal/bounce/mock"
+	configMock "qd-email-api/internal/config/mock"
+	grpcserverMock "qd-email-api/internal/grpcserver/mock"
+	healthMock "qd-email-api/internal/health/mock"
+	httpserverMock "qd-email-api/internal/httpserver/mock"
 	"qd-email-api/internal/service/mock"
+	webhookMock "qd-email-api/internal/webhook/mock"
 	"testing"
+	"time"
 
-	grpcserverMock "github.com/quadev-ltd/qd-common/pkg/grpcserver/mock"
 	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
 
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
 )
 
-func setupApplication(t *testing.T, useEmailService, useGRPCServer bool) (Applicationer, *gomock.Controller, *grpcserverMock.MockGRPCServicer, *mock.MockEmailServicer, *loggerMock.MockLoggerer) {
+type applicationMocks struct {
+	controller        *gomock.Controller
+	grpcServiceServer *grpcserverMock.MockServerer
+	emailService      *mock.MockEmailServicer
+	dispatcher        *mock.MockDispatcherer
+	scheduler         *mock.MockSchedulerer
+	webhookNotifier   *webhookMock.MockNotifierer
+	bounceServer      *bounceMock.MockServerer
+	httpServer        *httpserverMock.MockServerer
+	healthChecker     *healthMock.MockCheckerer
+	configWatcher     *configMock.MockWatcherer
+	logger            *loggerMock.MockLoggerer
+}
+
+func setupApplication(t *testing.T, useEmailService, useGRPCServer bool) (Applicationer, *applicationMocks) {
 	controller := gomock.NewController(t)
 	var application Applicationer
 
-	emailServiceMock := mock.NewMockEmailServicer(controller)
-	grpcServiceServerMock := grpcserverMock.NewMockGRPCServicer(controller)
-	loggerMock := loggerMock.NewMockLoggerer(controller)
+	mocks := &applicationMocks{
+		controller:        controller,
+		grpcServiceServer: grpcserverMock.NewMockServerer(controller),
+		emailService:      mock.NewMockEmailServicer(controller),
+		dispatcher:        mock.NewMockDispatcherer(controller),
+		scheduler:         mock.NewMockSchedulerer(controller),
+		webhookNotifier:   webhookMock.NewMockNotifierer(controller),
+		bounceServer:      bounceMock.NewMockServerer(controller),
+		httpServer:        httpserverMock.NewMockServerer(controller),
+		healthChecker:     healthMock.NewMockCheckerer(controller),
+		configWatcher:     configMock.NewMockWatcherer(controller),
+		logger:            loggerMock.NewMockLoggerer(controller),
+	}
 	grpcAddres := "localhost:8080"
 
 	switch {
 	case useEmailService && useGRPCServer:
-		application = New(grpcServiceServerMock, grpcAddres, emailServiceMock, loggerMock)
+		application = New(mocks.grpcServiceServer, grpcAddres, mocks.emailService, mocks.dispatcher, mocks.scheduler, mocks.webhookNotifier, mocks.bounceServer, mocks.httpServer, mocks.healthChecker, nil, mocks.configWatcher, mocks.logger)
 	case !useEmailService:
-		application = New(grpcServiceServerMock, grpcAddres, nil, loggerMock)
+		application = New(mocks.grpcServiceServer, grpcAddres, nil, mocks.dispatcher, mocks.scheduler, mocks.webhookNotifier, mocks.bounceServer, mocks.httpServer, mocks.healthChecker, nil, mocks.configWatcher, mocks.logger)
 	case !useGRPCServer:
-		application = New(nil, grpcAddres, emailServiceMock, loggerMock)
+		application = New(nil, grpcAddres, mocks.emailService, mocks.dispatcher, mocks.scheduler, mocks.webhookNotifier, mocks.bounceServer, mocks.httpServer, mocks.healthChecker, nil, mocks.configWatcher, mocks.logger)
 	}
 
-	return application, controller, grpcServiceServerMock, emailServiceMock, loggerMock
+	return application, mocks
 }
 
 func TestApplication(t *testing.T) {
 
+	t.Run("Webhook_Notifier_Start_Error", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		expectedError := errors.New("Error subscribing to events")
+		mocks.webhookNotifier.EXPECT().Start().Return(expectedError)
+		mocks.logger.EXPECT().Error(expectedError, "Failed to start webhook notifier").Times(1)
+
+		assert.Equal(t, expectedError, application.StartServer())
+	})
+
+	t.Run("Scheduler_Start_Error", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		expectedError := errors.New("Error reading message store")
+		mocks.webhookNotifier.EXPECT().Start().Return(nil)
+		mocks.scheduler.EXPECT().Start().Return(expectedError)
+		mocks.logger.EXPECT().Error(expectedError, "Failed to start scheduler").Times(1)
+
+		assert.Equal(t, expectedError, application.StartServer())
+	})
+	t.Run("Config_Watcher_Start_Error", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		expectedError := errors.New("Error watching internal/config")
+		mocks.webhookNotifier.EXPECT().Start().Return(nil)
+		mocks.scheduler.EXPECT().Start().Return(nil)
+		mocks.configWatcher.EXPECT().Start().Return(expectedError)
+		mocks.logger.EXPECT().Error(expectedError, "Failed to start configuration watcher").Times(1)
+
+		assert.Equal(t, expectedError, application.StartServer())
+	})
 	t.Run("Serve_Error", func(t *testing.T) {
-		application, controller, grpcServiceServerMock, _, loggerMock := setupApplication(t, true, true)
-		defer controller.Finish()
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
 
+		mocks.webhookNotifier.EXPECT().Start().Return(nil)
+		mocks.scheduler.EXPECT().Start().Return(nil)
+		mocks.configWatcher.EXPECT().Start().Return(nil)
+		bounceError := errors.New("Error accepting connection")
+		served := make(chan struct{}, 2)
+		mocks.bounceServer.EXPECT().Serve().Return(bounceError)
+		mocks.logger.EXPECT().Error(bounceError, "Failed to serve bounce server").Do(func(err error, message string) {
+			served <- struct{}{}
+		}).Times(1)
+		httpError := errors.New("Error accepting request")
+		mocks.httpServer.EXPECT().Serve().Return(httpError)
+		mocks.logger.EXPECT().Error(httpError, "Failed to serve HTTP server").Do(func(err error, message string) {
+			served <- struct{}{}
+		}).Times(1)
+		mocks.healthChecker.EXPECT().Start().Times(1)
 		expectedError := errors.New("Error sending email")
-		grpcServiceServerMock.EXPECT().Serve().Return(expectedError)
-		loggerMock.EXPECT().Info("Starting gRPC server on localhost:8080:...").Times(1)
-		loggerMock.EXPECT().Error(expectedError, "Failed to serve grpc server").Times(1)
+		mocks.grpcServiceServer.EXPECT().Serve().Return(expectedError)
+		mocks.logger.EXPECT().Info("Starting gRPC server on localhost:8080:...").Times(1)
+		mocks.logger.EXPECT().Error(expectedError, "Failed to serve grpc server").Times(1)
 
-		application.StartServer()
+		assert.Equal(t, expectedError, application.StartServer())
+		<-served
+		<-served
 	})
 	t.Run("Serve_Success", func(t *testing.T) {
-		application, controller, grpcServiceServerMock, _, loggerMock := setupApplication(t, true, true)
-		defer controller.Finish()
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
 
-		grpcServiceServerMock.EXPECT().Serve().Times(1).Return(nil)
-		loggerMock.EXPECT().Info("Starting gRPC server on localhost:8080:...").Times(1)
+		mocks.webhookNotifier.EXPECT().Start().Return(nil)
+		mocks.scheduler.EXPECT().Start().Return(nil)
+		mocks.configWatcher.EXPECT().Start().Return(nil)
+		served := make(chan struct{}, 2)
+		mocks.bounceServer.EXPECT().Serve().DoAndReturn(func() error {
+			served <- struct{}{}
+			return nil
+		})
+		mocks.httpServer.EXPECT().Serve().DoAndReturn(func() error {
+			served <- struct{}{}
+			return nil
+		})
+		mocks.healthChecker.EXPECT().Start().Times(1)
+		mocks.grpcServiceServer.EXPECT().Serve().Times(1).Return(nil)
+		mocks.logger.EXPECT().Info("Starting gRPC server on localhost:8080:...").Times(1)
 
-		application.StartServer()
+		assert.NoError(t, application.StartServer())
+		<-served
+		<-served
 	})
 
 	t.Run("Close_No_Service_Error", func(t *testing.T) {
-		application, controller, _, _, loggerMock := setupApplication(t, false, true)
-		defer controller.Finish()
+		application, mocks := setupApplication(t, false, true)
+		defer mocks.controller.Finish()
 
-		loggerMock.EXPECT().Error(nil, "Service is not created").Times(1)
+		mocks.logger.EXPECT().Error(nil, "Service is not created").Times(1)
 
 		application.Close()
 	})
 
 	t.Run("Close_No_GRPC_Server_Error", func(t *testing.T) {
-		application, controller, _, _, loggerMock := setupApplication(t, true, false)
-		defer controller.Finish()
+		application, mocks := setupApplication(t, true, false)
+		defer mocks.controller.Finish()
 
-		loggerMock.EXPECT().Error(nil, "gRPC server is not created").Times(1)
+		mocks.logger.EXPECT().Error(nil, "gRPC server is not created").Times(1)
 
 		application.Close()
 	})
 
 	t.Run("Close_Success", func(t *testing.T) {
-		application, controller, grpcServiceServerMock, _, loggerMock := setupApplication(t, true, true)
-		defer controller.Finish()
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
 
-		grpcServiceServerMock.EXPECT().Close().Times(1)
-		loggerMock.EXPECT().Info("gRPC server closed").Times(1)
+		mocks.healthChecker.EXPECT().Stop().Times(1)
+		mocks.grpcServiceServer.EXPECT().Close().Times(1)
+		mocks.configWatcher.EXPECT().Stop().Times(1)
+		mocks.bounceServer.EXPECT().Close().Times(1)
+		mocks.httpServer.EXPECT().Close().Times(1)
+		mocks.scheduler.EXPECT().Stop().Times(1)
+		mocks.dispatcher.EXPECT().Close().Times(1)
+		mocks.webhookNotifier.EXPECT().Stop().Times(1)
+		mocks.logger.EXPECT().Info("Health checker stopped").Times(1)
+		mocks.logger.EXPECT().Info("gRPC server closed").Times(1)
+		mocks.logger.EXPECT().Info("Configuration watcher stopped").Times(1)
+		mocks.logger.EXPECT().Info("Bounce server closed").Times(1)
+		mocks.logger.EXPECT().Info("HTTP server closed").Times(1)
+		mocks.logger.EXPECT().Info("Scheduler stopped").Times(1)
+		mocks.logger.EXPECT().Info("Dispatcher closed").Times(1)
+		mocks.logger.EXPECT().Info("Webhook notifier stopped").Times(1)
 
 		application.Close()
 	})
+	t.Run("Shutdown_Success", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		gomock.InOrder(
+			mocks.healthChecker.EXPECT().Stop(),
+			mocks.grpcServiceServer.EXPECT().Shutdown(gomock.Any()).Return(nil),
+			mocks.configWatcher.EXPECT().Stop(),
+			mocks.scheduler.EXPECT().Stop(),
+			mocks.dispatcher.EXPECT().Close(),
+		)
+		mocks.bounceServer.EXPECT().Close().Times(1)
+		mocks.httpServer.EXPECT().Close().Times(1)
+		mocks.webhookNotifier.EXPECT().Stop().Times(1)
+		mocks.logger.EXPECT().Info(gomock.Any()).Times(8)
+
+		assert.NoError(t, application.Shutdown(context.Background()))
+	})
+
+	t.Run("Shutdown_Drain_Timeout", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		release := make(chan struct{})
+		drained := make(chan struct{})
+		mocks.healthChecker.EXPECT().Stop()
+		mocks.grpcServiceServer.EXPECT().Shutdown(ctx).Return(nil)
+		mocks.configWatcher.EXPECT().Stop()
+		mocks.bounceServer.EXPECT().Close()
+		mocks.httpServer.EXPECT().Close()
+		mocks.scheduler.EXPECT().Stop().Do(func() {
+			<-release
+		})
+		mocks.dispatcher.EXPECT().Close()
+		mocks.webhookNotifier.EXPECT().Stop()
+		mocks.logger.EXPECT().Info(gomock.Not("Webhook notifier stopped")).AnyTimes()
+		mocks.logger.EXPECT().Info("Webhook notifier stopped").Do(func(message string) {
+			close(drained)
+		})
+
+		err := application.Shutdown(ctx)
+		close(release)
+		<-drained
+
+		assert.EqualError(t, err, "Timed out draining the emails in flight: context deadline exceeded")
+	})
+
+	t.Run("Shutdown_Forced_gRPC_Stop", func(t *testing.T) {
+		application, mocks := setupApplication(t, true, true)
+		defer mocks.controller.Finish()
+
+		forcedError := errors.New("Requests in flight were cancelled: context deadline exceeded")
+		mocks.healthChecker.EXPECT().Stop()
+		mocks.grpcServiceServer.EXPECT().Shutdown(gomock.Any()).Return(forcedError)
+		mocks.logger.EXPECT().Error(forcedError, "Failed to stop gRPC server gracefully").Times(1)
+		mocks.configWatcher.EXPECT().Stop()
+		mocks.bounceServer.EXPECT().Close()
+		mocks.httpServer.EXPECT().Close()
+		mocks.scheduler.EXPECT().Stop()
+		mocks.dispatcher.EXPECT().Close()
+		mocks.webhookNotifier.EXPECT().Stop()
+		mocks.logger.EXPECT().Info(gomock.Any()).Times(7)
+
+		assert.Equal(t, forcedError, application.Shutdown(context.Background()))
+	})
+
+	t.Run("Shutdown_No_Service_Error", func(t *testing.T) {
+		application, mocks := setupApplication(t, false, true)
+		defer mocks.controller.Finish()
+
+		assert.EqualError(t, application.Shutdown(context.Background()), "Service is not created")
+	})
 }
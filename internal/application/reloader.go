@@ -0,0 +1,112 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/config"
+	"qd-email-api/internal/secret"
+)
+
+// reloadableFields are the fields of the configuration applied without a restart, along
+// with the fields nested in them
+var reloadableFields = []string{
+	"SMTP.Host",
+	"SMTP.Port",
+	"SMTP.Username",
+	"SMTP.Password",
+	"RateLimit",
+	"DomainThrottle",
+}
+
+// Reloaderer is the interface for reloading the configuration while the application runs
+type Reloaderer interface {
+	Reload() error
+}
+
+// Reloader loads the configuration again, resolving its secret references, and applies
+// the changes to the running components. Invalid configurations are rejected as a whole.
+type Reloader struct {
+	mutex         sync.Mutex
+	config        *config.Config
+	centralConfig *commonConfig.Config
+	resolver      secret.Resolverer
+	appliers      []func(config *config.Config)
+	logger        log.Loggerer
+}
+
+var _ Reloaderer = &Reloader{}
+
+// NewReloader creates a new reloader of the configuration
+func NewReloader(
+	config *config.Config,
+	centralConfig *commonConfig.Config,
+	resolver secret.Resolverer,
+	logger log.Loggerer,
+) *Reloader {
+	return &Reloader{
+		config:        config,
+		centralConfig: centralConfig,
+		resolver:      resolver,
+		logger:        logger,
+	}
+}
+
+// OnReload adds a function applying the reloaded configuration to a component
+func (reloader *Reloader) OnReload(apply func(config *config.Config)) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.appliers = append(reloader.appliers, apply)
+}
+
+// Reload loads the configuration, resolves its secrets and validates it, logs what changed
+// with the secrets masked and applies it. The changes of the fields applied only on restart are logged as warnings.
+func (reloader *Reloader) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	var reloaded config.Config
+	if err := reloaded.Load(reloader.config.Path()); err != nil {
+		return fmt.Errorf("Error loading configuration: %v", err)
+	}
+	if err := reloaded.ResolveSecrets(context.Background(), reloader.resolver); err != nil {
+		return fmt.Errorf("Error resolving secrets: %v", err)
+	}
+	if err := reloaded.Validate(reloader.centralConfig); err != nil {
+		return err
+	}
+	changes := config.Diff(reloader.config, &reloaded)
+	if len(changes) == 0 {
+		reloader.logger.Info("Configuration unchanged")
+		return nil
+	}
+	for _, change := range changes {
+		if isReloadable(change.Field) {
+			reloader.logger.Info(fmt.Sprintf("Configuration changed %s", change))
+		} else {
+			reloader.logger.Warn(fmt.Sprintf("Configuration changed %s, applied on restart", change))
+		}
+	}
+	for _, apply := range reloader.appliers {
+		apply(&reloaded)
+	}
+	reloader.config = &reloaded
+	reloader.logger.Info("Configuration reloaded")
+	return nil
+}
+
+func isReloadable(field string) bool {
+	for _, reloadableField := range reloadableFields {
+		if field == reloadableField ||
+			strings.HasPrefix(field, reloadableField+".") ||
+			strings.HasPrefix(field, reloadableField+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package application
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/config"
+)
+
+func TestReloader(t *testing.T) {
+	os.Setenv(commonConfig.AppEnvironmentKey, "test")
+	defer os.Unsetenv(commonConfig.AppEnvironmentKey)
+	testConfig, err := os.ReadFile("../config/config.test.yml")
+	assert.NoError(t, err)
+	centralConfig := &commonConfig.Config{
+		AppName: "QD Test",
+		EmailService: commonConfig.Address{
+			Host: "qd.email.api",
+			Port: "1111",
+		},
+	}
+
+	// setupReloader loads the test configuration from a copy the test rewrites
+	setupReloader := func(t *testing.T) (*Reloader, *loggerMock.MockLoggerer, func(old, new string), chan *config.Config) {
+		controller := gomock.NewController(t)
+		logger := loggerMock.NewMockLoggerer(controller)
+		path := t.TempDir()
+		file := filepath.Join(path, "config.test.yml")
+		assert.NoError(t, os.WriteFile(file, testConfig, 0600))
+		var loaded config.Config
+		assert.NoError(t, loaded.Load(path))
+
+		reloader := NewReloader(&loaded, centralConfig, newTestResolver(), logger)
+		applied := make(chan *config.Config, 1)
+		reloader.OnReload(func(config *config.Config) {
+			applied <- config
+		})
+		rewrite := func(old, new string) {
+			content, err := os.ReadFile(file)
+			assert.NoError(t, err)
+			assert.NoError(t, os.WriteFile(file, []byte(strings.Replace(string(content), old, new, 1)), 0600))
+		}
+		return reloader, logger, rewrite, applied
+	}
+
+	t.Run("Reload_Applies_Changes", func(t *testing.T) {
+		reloader, logger, rewrite, applied := setupReloader(t)
+		rewrite("password: test_password", "password: rotated_password")
+		rewrite("rate: 10\n", "rate: 20\n")
+		rewrite("historySize: 100", "historySize: 200")
+
+		gomock.InOrder(
+			logger.EXPECT().Info("Configuration changed SMTP.Password: ****** -> ******"),
+			logger.EXPECT().Info("Configuration changed RateLimit.Client.Rate: 10 -> 20"),
+			logger.EXPECT().Warn("Configuration changed Events.HistorySize: 100 -> 200, applied on restart"),
+			logger.EXPECT().Info("Configuration reloaded"),
+		)
+
+		assert.NoError(t, reloader.Reload())
+		reloaded := <-applied
+		assert.Equal(t, "rotated_password", reloaded.SMTP.Password)
+		assert.Equal(t, 20.0, reloaded.RateLimit.Client.Rate)
+
+		logger.EXPECT().Info("Configuration unchanged")
+		assert.NoError(t, reloader.Reload())
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Reload_Invalid_Configuration_Error", func(t *testing.T) {
+		reloader, _, rewrite, applied := setupReloader(t)
+		rewrite("port: 9999", "port: smtp")
+		rewrite("host: localhost", "host: \"\"")
+
+		err := reloader.Reload()
+
+		assert.EqualError(t, err, "Invalid configuration:\n- SMTP host is required\n- SMTP port \"smtp\" is not a valid port")
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Reload_Resolves_Rotated_Secrets", func(t *testing.T) {
+		reloader, logger, rewrite, applied := setupReloader(t)
+		passwordFile := filepath.Join(t.TempDir(), "smtp")
+		assert.NoError(t, os.WriteFile(passwordFile, []byte("rotated_password\n"), 0600))
+		rewrite("password: test_password", "password: file://"+passwordFile)
+
+		logger.EXPECT().Info("Configuration changed SMTP.Password: ****** -> ******")
+		logger.EXPECT().Info("Configuration reloaded")
+
+		assert.NoError(t, reloader.Reload())
+		assert.Equal(t, "rotated_password", (<-applied).SMTP.Password)
+
+		assert.NoError(t, os.Remove(passwordFile))
+		err := reloader.Reload()
+		assert.ErrorContains(t, err, "Error resolving secrets: SMTP.Password: Error resolving secret file://"+passwordFile)
+		assert.Empty(t, applied)
+	})
+}
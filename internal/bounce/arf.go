@@ -0,0 +1,84 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrNotComplaint is returned when a message is not a feedback report
+var ErrNotComplaint = errors.New("Message is not a feedback report")
+
+// FeedbackAbuse is the feedback type of the recipients reporting an email as spam
+const FeedbackAbuse = "abuse"
+
+// Complaint is the feedback report a mailbox provider sends when a recipient reports an
+// email, as defined by RFC 5965
+type Complaint struct {
+	// MessageID is the ID of the email read from its Message-ID header, empty when the
+	// report does not include the headers of the email
+	MessageID string
+	// Recipient is the address that complained, empty when the provider redacts it
+	Recipient string
+	// FeedbackType is the kind of report, such as abuse
+	FeedbackType string
+	// UserAgent is the software that generated the report
+	UserAgent string
+	// ReturnPath is the envelope sender of the email, if reported
+	ReturnPath string
+}
+
+// ParseComplaint returns the complaint of a feedback report, read from its
+// message/feedback-report part and the headers of the email it includes
+func ParseComplaint(data []byte) (*Complaint, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotComplaint
+	}
+	parts := &bounceParts{}
+	if err := parts.walk(textproto.MIMEHeader(message.Header), message.Body); err != nil || parts.feedbackReport == nil {
+		return nil, ErrNotComplaint
+	}
+	report := readFields(parts.feedbackReport)
+	if report.Get("Feedback-Type") == "" {
+		return nil, ErrNotComplaint
+	}
+	original := readFields(parts.original)
+
+	complaint := &Complaint{
+		MessageID:    getMessageID(original.Get("Message-ID")),
+		Recipient:    strings.Trim(strings.TrimSpace(report.Get("Original-Rcpt-To")), "<>"),
+		FeedbackType: strings.ToLower(strings.TrimSpace(report.Get("Feedback-Type"))),
+		UserAgent:    strings.TrimSpace(report.Get("User-Agent")),
+		ReturnPath:   strings.Trim(strings.TrimSpace(report.Get("Original-Mail-From")), "<>"),
+	}
+	if complaint.Recipient == "" {
+		if address, err := mail.ParseAddress(original.Get("To")); err == nil {
+			complaint.Recipient = address.Address
+		}
+	}
+	if complaint.ReturnPath == "" {
+		complaint.ReturnPath = strings.Trim(strings.TrimSpace(original.Get("Return-Path")), "<>")
+	}
+	return complaint, nil
+}
+
+// readFields reads the header lines at the start of a part, keeping the ones read before
+// a malformed line
+func readFields(content []byte) textproto.MIMEHeader {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(content)))
+	fields, _ := reader.ReadMIMEHeader()
+	if fields == nil {
+		return textproto.MIMEHeader{}
+	}
+	return fields
+}
+
+// getMessageID returns the ID of an email from its Message-ID header, as in <ID@domain>
+func getMessageID(header string) string {
+	id, _, _ := strings.Cut(strings.Trim(strings.TrimSpace(header), "<>"), "@")
+	return strings.ToLower(id)
+}
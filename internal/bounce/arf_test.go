@@ -0,0 +1,80 @@
+package bounce
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const feedbackReport = `From: feedback@mail.example.net
+To: fbl@bounces.test.com
+Subject: FW: Welcome
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report;
+	boundary="report-boundary"
+
+--report-boundary
+Content-Type: text/plain; charset=us-ascii
+
+This is an email abuse report for an email message received from IP
+192.0.2.1 on Mon, 1 Jan 2024 10:00:00 +0000.
+
+--report-boundary
+Content-Type: message/feedback-report
+
+Feedback-Type: abuse
+User-Agent: ExampleFBL/1.0
+Version: 1
+Original-Mail-From: <bounce+1-0123456789abcdef@bounces.test.com>
+Original-Rcpt-To: <user@example.com>
+Arrival-Date: Mon, 1 Jan 2024 10:00:00 +0000
+
+--report-boundary
+Content-Type: message/rfc822
+
+From: noreply@test.com
+To: user@example.com
+Subject: Welcome
+Message-ID: <ABC123@test.com>
+
+Welcome to our service.
+
+--report-boundary--
+`
+
+func TestParseComplaint(test *testing.T) {
+	test.Run("Feedback_Report", func(test *testing.T) {
+		complaint, err := ParseComplaint([]byte(feedbackReport))
+
+		assert.NoError(test, err)
+		assert.Equal(test, &Complaint{
+			MessageID:    "abc123",
+			Recipient:    "user@example.com",
+			FeedbackType: FeedbackAbuse,
+			UserAgent:    "ExampleFBL/1.0",
+			ReturnPath:   "bounce+1-0123456789abcdef@bounces.test.com",
+		}, complaint)
+	})
+
+	test.Run("Redacted_Feedback_Report", func(test *testing.T) {
+		report := strings.Replace(feedbackReport, "Original-Rcpt-To: <user@example.com>\n", "", 1)
+		report = strings.Replace(report, "Original-Mail-From: <bounce+1-0123456789abcdef@bounces.test.com>\n", "", 1)
+		report = strings.Replace(report, "Content-Type: message/rfc822", "Content-Type: text/rfc822-headers", 1)
+		report = strings.Replace(report, "From: noreply@test.com\n", "Return-Path: <bounce+2-0123456789abcdef@bounces.test.com>\n", 1)
+
+		complaint, err := ParseComplaint([]byte(report))
+
+		assert.NoError(test, err)
+		assert.Equal(test, "user@example.com", complaint.Recipient)
+		assert.Equal(test, "bounce+2-0123456789abcdef@bounces.test.com", complaint.ReturnPath)
+	})
+
+	test.Run("Not_Complaint_Error", func(test *testing.T) {
+		_, err := ParseComplaint([]byte(deliveryStatusNotification))
+		assert.ErrorIs(test, err, ErrNotComplaint)
+
+		_, err = ParseComplaint([]byte("not a message"))
+		assert.ErrorIs(test, err, ErrNotComplaint)
+	})
+}
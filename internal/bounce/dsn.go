@@ -0,0 +1,298 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// ErrNotBounce is returned when a message is neither a delivery status notification
+// nor a recognizable bounce
+var ErrNotBounce = errors.New("Message is not a bounce")
+
+// Action is the outcome of the delivery to a recipient, as defined by RFC 3464
+type Action string
+
+const (
+	// ActionFailed is a recipient that will never receive the message
+	ActionFailed Action = "failed"
+	// ActionDelayed is a recipient whose server keeps retrying the delivery
+	ActionDelayed Action = "delayed"
+	// ActionDelivered is a recipient whose mailbox received the message
+	ActionDelivered Action = "delivered"
+	// ActionRelayed is a message relayed to a server that does not report its delivery
+	ActionRelayed Action = "relayed"
+	// ActionExpanded is a message delivered to a recipient that forwarded it to others
+	ActionExpanded Action = "expanded"
+)
+
+// Report is the delivery status of a recipient reported by a bounce
+type Report struct {
+	// Recipient is the address the reporting server tried to deliver to, empty when
+	// a non-standard bounce does not say
+	Recipient string
+	Action    Action
+	// Status is the enhanced status code, such as 5.1.1
+	Status     string
+	Diagnostic string
+}
+
+var (
+	enhancedStatusPattern = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+	replyCodePattern      = regexp.MustCompile(`\b([245]\d\d)[ -]`)
+	recipientLinePattern  = regexp.MustCompile(`^<?([^\s<>@":]+@[^\s<>@":]+)>?(?::\s*(.*))?$`)
+	temporaryPattern      = regexp.MustCompile(`(?i)\b(delayed|will (be )?retr(y|ied)|temporar(y|ily)|still trying)\b`)
+)
+
+// Parse returns the recipient reports of a bounce, read from its RFC 3464 delivery status
+// notification or, for the servers that do not send one, from the text of the bounce
+func Parse(data []byte) ([]Report, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotBounce
+	}
+	parts := &bounceParts{}
+	if err := parts.walk(textproto.MIMEHeader(message.Header), message.Body); err != nil {
+		return nil, err
+	}
+	if parts.deliveryStatus != nil {
+		if reports := parseDeliveryStatus(parts.deliveryStatus); len(reports) > 0 {
+			return reports, nil
+		}
+	}
+	return parseText(message.Header.Get("Subject"), parts.text)
+}
+
+// bounceParts holds the parts of a bounce or a feedback report the reports are read from
+type bounceParts struct {
+	deliveryStatus []byte
+	feedbackReport []byte
+	original       []byte
+	text           []byte
+}
+
+// walk looks for the delivery status, the feedback report, the original message and the
+// first text part through nested multiparts
+func (parts *bounceParts) walk(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	body = decodeBody(header.Get("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return ErrNotBounce
+			}
+			if err := parts.walk(part.Header, part); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/delivery-status", mediaType == "message/global-delivery-status":
+		return readPart(&parts.deliveryStatus, body)
+	case mediaType == "message/feedback-report":
+		return readPart(&parts.feedbackReport, body)
+	case mediaType == "message/rfc822", mediaType == "text/rfc822-headers":
+		return readPart(&parts.original, body)
+	case mediaType == "text/plain":
+		return readPart(&parts.text, body)
+	}
+	return nil
+}
+
+// readPart keeps the content of the first part of each kind
+func readPart(content *[]byte, body io.Reader) error {
+	if *content != nil {
+		return nil
+	}
+	read, err := io.ReadAll(body)
+	if err != nil {
+		return ErrNotBounce
+	}
+	*content = read
+	return nil
+}
+
+func decodeBody(transferEncoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineSkipper{reader: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// newlineSkipper drops the line breaks of a base64 body, which the decoder rejects
+type newlineSkipper struct {
+	reader io.Reader
+}
+
+func (skipper *newlineSkipper) Read(buffer []byte) (int, error) {
+	count, err := skipper.reader.Read(buffer)
+	kept := 0
+	for _, character := range buffer[:count] {
+		if character != '\r' && character != '\n' {
+			buffer[kept] = character
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// parseDeliveryStatus reads the per-recipient fields of a delivery status, which follow
+// the per-message fields as blocks of header lines separated by blank lines
+func parseDeliveryStatus(content []byte) []Report {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(content)))
+	reports := []Report{}
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if len(fields) > 0 && fields.Get("Action") != "" {
+			reports = append(reports, Report{
+				Recipient:  getRecipient(fields),
+				Action:     Action(strings.ToLower(strings.TrimSpace(fields.Get("Action")))),
+				Status:     firstField(fields.Get("Status")),
+				Diagnostic: stripType(fields.Get("Diagnostic-Code")),
+			})
+		}
+		// Stop at the end or at a malformed line, keeping what was read before it
+		if err != nil {
+			return reports
+		}
+	}
+}
+
+func getRecipient(fields textproto.MIMEHeader) string {
+	if recipient := stripType(fields.Get("Original-Recipient")); recipient != "" {
+		return strings.Trim(recipient, "<>")
+	}
+	return strings.Trim(stripType(fields.Get("Final-Recipient")), "<>")
+}
+
+// stripType removes the address or diagnostic type, as in "rfc822; user@example.com"
+func stripType(value string) string {
+	if _, typed, found := strings.Cut(value, ";"); found {
+		return strings.TrimSpace(typed)
+	}
+	return strings.TrimSpace(value)
+}
+
+// firstField removes the comments following a status code, as in "5.1.1 (user unknown)"
+func firstField(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// parseText reads the bounces of the servers that explain the failure in plain text, such
+// as qmail, Exim or Postfix, where each failed recipient starts a line followed by the
+// reason, until the copy of the original message
+func parseText(subject string, text []byte) ([]Report, error) {
+	reports := []Report{}
+	var current *Report
+	var diagnostic []string
+	flush := func() {
+		if current != nil {
+			current.Diagnostic = strings.Join(diagnostic, " ")
+			classify(current)
+			reports = append(reports, *current)
+		}
+		current = nil
+		diagnostic = nil
+	}
+	for _, line := range strings.Split(string(text), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(reports) > 0 || current != nil {
+			if strings.HasPrefix(trimmed, "---") {
+				break
+			}
+		}
+		if match := recipientLinePattern.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			current = &Report{Recipient: match[1]}
+			if match[2] != "" {
+				diagnostic = append(diagnostic, match[2])
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if trimmed == "" {
+			if len(diagnostic) > 0 {
+				flush()
+			}
+			continue
+		}
+		diagnostic = append(diagnostic, trimmed)
+	}
+	flush()
+	if len(reports) > 0 {
+		return reports, nil
+	}
+
+	// Without a recipient line the whole text is the diagnostic of the recipient of the
+	// return path, as long as it looks like a bounce
+	report := Report{Diagnostic: strings.Join(strings.Fields(string(text)), " ")}
+	if !replyCodePattern.MatchString(report.Diagnostic) &&
+		!enhancedStatusPattern.MatchString(report.Diagnostic) &&
+		!isBounceSubject(subject) {
+		return nil, ErrNotBounce
+	}
+	classify(&report)
+	return []Report{report}, nil
+}
+
+// classify sets the status and the action of a report from the codes and wording of its diagnostic
+func classify(report *Report) {
+	if match := enhancedStatusPattern.FindStringSubmatch(report.Diagnostic); match != nil {
+		report.Status = match[1]
+	} else if match := replyCodePattern.FindStringSubmatch(report.Diagnostic); match != nil {
+		report.Status = match[1][:1] + ".0.0"
+	}
+	switch {
+	case strings.HasPrefix(report.Status, "2"):
+		report.Action = ActionDelivered
+	case strings.HasPrefix(report.Status, "4"),
+		report.Status == "" && temporaryPattern.MatchString(report.Diagnostic):
+		report.Action = ActionDelayed
+	default:
+		report.Action = ActionFailed
+	}
+}
+
+func isBounceSubject(subject string) bool {
+	subject = strings.ToLower(subject)
+	for _, phrase := range []string{
+		"undeliverable",
+		"undelivered mail",
+		"delivery status notification",
+		"delivery failure",
+		"mail delivery failed",
+		"failure notice",
+		"returned mail",
+	} {
+		if strings.Contains(subject, phrase) {
+			return true
+		}
+	}
+	return false
+}
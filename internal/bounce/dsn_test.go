@@ -0,0 +1,157 @@
+package bounce
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const deliveryStatusNotification = `From: MAILER-DAEMON@mx.example.com (Mail Delivery System)
+To: bounce+1-0123456789abcdef@bounces.test.com
+Subject: Undelivered Mail Returned to Sender
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status;
+	boundary="report-boundary"
+
+--report-boundary
+Content-Type: text/plain; charset=us-ascii
+
+This is the mail system at host mx.example.com.
+
+I'm sorry to have to inform you that your message could not
+be delivered to one or more recipients.
+
+--report-boundary
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+Arrival-Date: Mon,  1 Jan 2024 10:00:00 +0000 (UTC)
+
+Final-Recipient: rfc822; user@example.com
+Original-Recipient: rfc822;user@example.com
+Action: failed
+Status: 5.1.1 (bad destination mailbox address)
+Diagnostic-Code: smtp; 550 5.1.1 <user@example.com>: Recipient address
+    rejected: User unknown in virtual mailbox table
+
+Final-Recipient: rfc822; other@example.com
+Action: delayed
+Status: 4.2.2
+Diagnostic-Code: smtp; 452 4.2.2 Mailbox full
+
+--report-boundary
+Content-Type: text/rfc822-headers
+
+From: "App" <no.reply@test.com>
+To: user@example.com
+Subject: Welcome
+
+--report-boundary--
+`
+
+func TestParse(test *testing.T) {
+	test.Run("Delivery_Status_Notification", func(test *testing.T) {
+		reports, err := Parse([]byte(deliveryStatusNotification))
+
+		assert.NoError(test, err)
+		assert.Equal(test, []Report{
+			{
+				Recipient:  "user@example.com",
+				Action:     ActionFailed,
+				Status:     "5.1.1",
+				Diagnostic: "550 5.1.1 <user@example.com>: Recipient address rejected: User unknown in virtual mailbox table",
+			},
+			{
+				Recipient:  "other@example.com",
+				Action:     ActionDelayed,
+				Status:     "4.2.2",
+				Diagnostic: "452 4.2.2 Mailbox full",
+			},
+		}, reports)
+	})
+
+	test.Run("Base64_Nested_Delivery_Status_Notification", func(test *testing.T) {
+		status := base64.StdEncoding.EncodeToString([]byte("Reporting-MTA: dns; mx.example.com\r\n\r\n" +
+			"Final-Recipient: rfc822; user@example.com\r\nAction: delivered\r\nStatus: 2.0.0\r\n"))
+		message := "Subject: Delivery Status Notification (Success)\r\n" +
+			"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+			"--outer\r\nContent-Type: multipart/report; report-type=delivery-status; boundary=inner\r\n\r\n" +
+			"--inner\r\nContent-Type: message/delivery-status\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			status[:20] + "\r\n" + status[20:] + "\r\n" +
+			"--inner--\r\n--outer--\r\n"
+
+		reports, err := Parse([]byte(message))
+
+		assert.NoError(test, err)
+		assert.Equal(test, []Report{{Recipient: "user@example.com", Action: ActionDelivered, Status: "2.0.0"}}, reports)
+	})
+
+	test.Run("Qmail_Bounce", func(test *testing.T) {
+		message := strings.Join([]string{
+			"Subject: failure notice",
+			"",
+			"Hi. This is the qmail-send program at mx.example.com.",
+			"I'm afraid I wasn't able to deliver your message to the following addresses.",
+			"This is a permanent error; I've given up. Sorry it didn't work out.",
+			"",
+			"<user@example.com>:",
+			"192.0.2.1 does not like recipient.",
+			"Remote host said: 550 5.1.1 User unknown",
+			"Giving up on 192.0.2.1.",
+			"",
+			"--- Below this line is a copy of the message.",
+			"",
+			"other@example.com",
+		}, "\n")
+
+		reports, err := Parse([]byte(message))
+
+		assert.NoError(test, err)
+		assert.Equal(test, []Report{{
+			Recipient:  "user@example.com",
+			Action:     ActionFailed,
+			Status:     "5.1.1",
+			Diagnostic: "192.0.2.1 does not like recipient. Remote host said: 550 5.1.1 User unknown Giving up on 192.0.2.1.",
+		}}, reports)
+	})
+
+	test.Run("Exim_Bounce", func(test *testing.T) {
+		message := strings.Join([]string{
+			"Subject: Mail delivery failed: returning message to sender",
+			"",
+			"This message was created automatically by mail delivery software.",
+			"",
+			"A message that you sent could not be delivered to one or more of its",
+			"recipients. This is a temporary error. The following address(es) deferred:",
+			"",
+			"  user@example.com",
+			"    SMTP error from remote mail server after RCPT TO:<user@example.com>:",
+			"    452 Mailbox temporarily full",
+		}, "\n")
+
+		reports, err := Parse([]byte(message))
+
+		assert.NoError(test, err)
+		assert.Len(test, reports, 1)
+		assert.Equal(test, "user@example.com", reports[0].Recipient)
+		assert.Equal(test, ActionDelayed, reports[0].Action)
+		assert.Equal(test, "4.0.0", reports[0].Status)
+	})
+
+	test.Run("Bounce_Without_Recipient", func(test *testing.T) {
+		reports, err := Parse([]byte("Subject: Undeliverable: Welcome\n\nThe mailbox is no longer in use."))
+
+		assert.NoError(test, err)
+		assert.Equal(test, []Report{{Action: ActionFailed, Diagnostic: "The mailbox is no longer in use."}}, reports)
+	})
+
+	test.Run("Not_Bounce_Error", func(test *testing.T) {
+		_, err := Parse([]byte("Subject: Hello\n\nHow are you?"))
+		assert.ErrorIs(test, err, ErrNotBounce)
+
+		_, err = Parse([]byte("not a message"))
+		assert.ErrorIs(test, err, ErrNotBounce)
+	})
+}
@@ -0,0 +1,115 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: server.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	bounce "qd-email-api/internal/bounce"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHandlerer is a mock of Handlerer interface.
+type MockHandlerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockHandlererMockRecorder
+}
+
+// MockHandlererMockRecorder is the mock recorder for MockHandlerer.
+type MockHandlererMockRecorder struct {
+	mock *MockHandlerer
+}
+
+// NewMockHandlerer creates a new mock instance.
+func NewMockHandlerer(ctrl *gomock.Controller) *MockHandlerer {
+	mock := &MockHandlerer{ctrl: ctrl}
+	mock.recorder = &MockHandlererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHandlerer) EXPECT() *MockHandlererMockRecorder {
+	return m.recorder
+}
+
+// HandleBounce mocks base method.
+func (m *MockHandlerer) HandleBounce(ctx context.Context, bounce *bounce.Bounce) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleBounce", ctx, bounce)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandleBounce indicates an expected call of HandleBounce.
+func (mr *MockHandlererMockRecorder) HandleBounce(ctx, bounce interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleBounce", reflect.TypeOf((*MockHandlerer)(nil).HandleBounce), ctx, bounce)
+}
+
+// HandleComplaint mocks base method.
+func (m *MockHandlerer) HandleComplaint(ctx context.Context, complaint *bounce.Complaint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleComplaint", ctx, complaint)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandleComplaint indicates an expected call of HandleComplaint.
+func (mr *MockHandlererMockRecorder) HandleComplaint(ctx, complaint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleComplaint", reflect.TypeOf((*MockHandlerer)(nil).HandleComplaint), ctx, complaint)
+}
+
+// MockServerer is a mock of Serverer interface.
+type MockServerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockServererMockRecorder
+}
+
+// MockServererMockRecorder is the mock recorder for MockServerer.
+type MockServererMockRecorder struct {
+	mock *MockServerer
+}
+
+// NewMockServerer creates a new mock instance.
+func NewMockServerer(ctrl *gomock.Controller) *MockServerer {
+	mock := &MockServerer{ctrl: ctrl}
+	mock.recorder = &MockServererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockServerer) EXPECT() *MockServererMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockServerer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockServererMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockServerer)(nil).Close))
+}
+
+// Serve mocks base method.
+func (m *MockServerer) Serve() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Serve")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Serve indicates an expected call of Serve.
+func (mr *MockServererMockRecorder) Serve() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Serve", reflect.TypeOf((*MockServerer)(nil).Serve))
+}
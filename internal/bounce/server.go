@@ -0,0 +1,189 @@
+package bounce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mhale/smtpd"
+	"github.com/quadev-ltd/qd-common/pkg/log"
+)
+
+// Bounce is the reports of a bounce linked to the email it refers to
+type Bounce struct {
+	MessageID string
+	Reports   []Report
+}
+
+// ReportFor returns the report of the recipient, or the only report of the bounce when it
+// names another address, as servers may report the address an email was forwarded to
+func (bounce *Bounce) ReportFor(recipient string) (Report, bool) {
+	for _, report := range bounce.Reports {
+		if strings.EqualFold(report.Recipient, recipient) {
+			return report, true
+		}
+	}
+	if len(bounce.Reports) == 1 {
+		return bounce.Reports[0], true
+	}
+	return Report{}, false
+}
+
+// Handlerer is the interface for acting on the bounces and complaints received
+type Handlerer interface {
+	HandleBounce(ctx context.Context, bounce *Bounce) error
+	HandleComplaint(ctx context.Context, complaint *Complaint) error
+}
+
+// Serverer is the interface of the inbound SMTP server receiving the bounces
+type Serverer interface {
+	Serve() error
+	Close() error
+}
+
+// Server receives the bounces and feedback reports sent to the return paths of the emails
+// and the feedback reports sent to the feedback address. Mail to any other address or to
+// a forged return path is rejected, and mail that is neither is accepted and dropped.
+type Server struct {
+	smtpServer      *smtpd.Server
+	listener        net.Listener
+	verp            *VERP
+	feedbackAddress string
+	handler         Handlerer
+	logger          log.Loggerer
+}
+
+var _ Serverer = &Server{}
+
+// NewServer creates a bounce server listening on the given address, rejecting
+// messages larger than maxSize bytes. An empty feedback address only accepts the
+// feedback reports sent to the return paths.
+func NewServer(
+	address string,
+	hostname string,
+	verp *VERP,
+	feedbackAddress string,
+	handler Handlerer,
+	logger log.Loggerer,
+	maxSize int,
+) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Error listening for bounces: %v", err)
+	}
+	server := &Server{
+		listener:        listener,
+		verp:            verp,
+		feedbackAddress: feedbackAddress,
+		handler:         handler,
+		logger:          logger,
+	}
+	server.smtpServer = &smtpd.Server{
+		Addr:        address,
+		Appname:     "qd-email-api",
+		Hostname:    hostname,
+		MaxSize:     maxSize,
+		HandlerRcpt: server.acceptRecipient,
+		Handler:     server.handle,
+	}
+	return server, nil
+}
+
+// Serve accepts connections until the server is closed
+func (server *Server) Serve() error {
+	err := server.smtpServer.Serve(server.listener)
+	if errors.Is(err, smtpd.ErrServerClosed) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops accepting connections
+func (server *Server) Close() error {
+	server.smtpServer.Close()
+	return server.listener.Close()
+}
+
+// Addr returns the address the server listens on
+func (server *Server) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
+func (server *Server) acceptRecipient(remoteAddress net.Addr, from string, to string) bool {
+	if server.isFeedbackAddress(to) {
+		return true
+	}
+	_, err := server.verp.Decode(to)
+	if errors.Is(err, ErrForgedReturnPath) {
+		server.logger.Warn(fmt.Sprintf("Rejected bounce from %s to forged return path %s", remoteAddress, to))
+	}
+	return err == nil
+}
+
+func (server *Server) isFeedbackAddress(address string) bool {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	return server.feedbackAddress != "" && strings.EqualFold(address, server.feedbackAddress)
+}
+
+// handle passes on the feedback reports and the bounces received. Only failing to
+// record them is returned as an error, so the sending server retries it later.
+func (server *Server) handle(remoteAddress net.Addr, from string, to []string, data []byte) error {
+	complaint, err := ParseComplaint(data)
+	if err == nil {
+		return server.handleComplaint(complaint, to)
+	}
+	return server.handleBounce(from, to, data)
+}
+
+// handleComplaint links a feedback report to its email by its Message-ID or, failing
+// that, by its return path
+func (server *Server) handleComplaint(complaint *Complaint, to []string) error {
+	if complaint.MessageID == "" {
+		complaint.MessageID = server.findMessageID(append([]string{complaint.ReturnPath}, to...))
+	}
+	if complaint.MessageID == "" {
+		server.logger.Warn(fmt.Sprintf("Dropped feedback report to %s without an email ID", strings.Join(to, ", ")))
+		return nil
+	}
+	if err := server.handler.HandleComplaint(context.Background(), complaint); err != nil {
+		server.logger.Error(err, fmt.Sprintf("Error handling complaint for email %s", complaint.MessageID))
+		return err
+	}
+	return nil
+}
+
+// findMessageID returns the message ID of the first valid return path, if any
+func (server *Server) findMessageID(returnPaths []string) string {
+	for _, returnPath := range returnPaths {
+		if messageID, err := server.verp.Decode(returnPath); err == nil {
+			return messageID
+		}
+	}
+	return ""
+}
+
+// handleBounce links the reports of a bounce to the emails of its return paths
+func (server *Server) handleBounce(from string, to []string, data []byte) error {
+	reports, err := Parse(data)
+	if err != nil {
+		server.logger.Warn(fmt.Sprintf("Dropped message from %s to %s: %v", from, strings.Join(to, ", "), err))
+		return nil
+	}
+	for _, returnPath := range to {
+		messageID, err := server.verp.Decode(returnPath)
+		if err != nil {
+			continue
+		}
+		bounce := &Bounce{
+			MessageID: messageID,
+			Reports:   reports,
+		}
+		if err := server.handler.HandleBounce(context.Background(), bounce); err != nil {
+			server.logger.Error(err, fmt.Sprintf("Error handling bounce for email %s", messageID))
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package bounce_test
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/bounce/mock"
+)
+
+const deliveryStatusNotification = "Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=report\r\n\r\n" +
+	"--report\r\nContent-Type: message/delivery-status\r\n\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n\r\n" +
+	"Final-Recipient: rfc822; user@example.com\r\nAction: failed\r\nStatus: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n" +
+	"--report--\r\n"
+
+const feedbackReport = "Subject: FW: Welcome\r\n" +
+	"Content-Type: multipart/report; report-type=feedback-report; boundary=report\r\n\r\n" +
+	"--report\r\nContent-Type: message/feedback-report\r\n\r\n" +
+	"Feedback-Type: abuse\r\nUser-Agent: ExampleFBL/1.0\r\nOriginal-Rcpt-To: user@example.com\r\n\r\n" +
+	"--report\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+	"To: user@example.com\r\nSubject: Welcome\r\n" +
+	"--report--\r\n"
+
+func TestServer(test *testing.T) {
+	verp := bounce.NewVERP("bounce", "bounces.test.com", "secret")
+	returnPath := verp.Encode("1")
+	setup := func(test *testing.T) (*bounce.Server, *mock.MockHandlerer, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		handlerMock := mock.NewMockHandlerer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		server, err := bounce.NewServer("127.0.0.1:0", "localhost", verp, "fbl@bounces.test.com", handlerMock, loggerMock, 1<<20)
+		assert.NoError(test, err)
+		served := make(chan error)
+		go func() {
+			served <- server.Serve()
+		}()
+		test.Cleanup(func() {
+			assert.NoError(test, server.Close())
+			assert.NoError(test, <-served)
+		})
+		return server, handlerMock, loggerMock, controller
+	}
+
+	test.Run("Bounce_Is_Linked_To_Email", func(test *testing.T) {
+		server, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleBounce(gomock.Any(), &bounce.Bounce{
+			MessageID: "1",
+			Reports: []bounce.Report{{
+				Recipient:  "user@example.com",
+				Action:     bounce.ActionFailed,
+				Status:     "5.1.1",
+				Diagnostic: "550 5.1.1 User unknown",
+			}},
+		}).Return(nil)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{returnPath}, []byte(deliveryStatusNotification))
+
+		assert.NoError(test, err)
+	})
+
+	test.Run("Complaint_To_Feedback_Address_Is_Handled", func(test *testing.T) {
+		server, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		report := strings.Replace(feedbackReport, "Subject: Welcome", "Subject: Welcome\r\nMessage-ID: <1@test.com>", 1)
+		handlerMock.EXPECT().HandleComplaint(gomock.Any(), &bounce.Complaint{
+			MessageID:    "1",
+			Recipient:    "user@example.com",
+			FeedbackType: bounce.FeedbackAbuse,
+			UserAgent:    "ExampleFBL/1.0",
+		}).Return(nil)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{"FBL@bounces.test.com"}, []byte(report))
+
+		assert.NoError(test, err)
+	})
+
+	test.Run("Complaint_Is_Linked_By_Return_Path", func(test *testing.T) {
+		server, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleComplaint(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, complaint *bounce.Complaint) error {
+				assert.Equal(test, "1", complaint.MessageID)
+				return nil
+			},
+		)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{returnPath}, []byte(feedbackReport))
+
+		assert.NoError(test, err)
+	})
+
+	test.Run("Complaint_Without_Email_Is_Dropped", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Dropped feedback report to fbl@bounces.test.com without an email ID").Times(1)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{"fbl@bounces.test.com"}, []byte(feedbackReport))
+
+		assert.NoError(test, err)
+	})
+
+	test.Run("Unknown_Recipient_Is_Rejected", func(test *testing.T) {
+		server, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{"postmaster@bounces.test.com"}, []byte(deliveryStatusNotification))
+
+		assert.ErrorContains(test, err, "550")
+	})
+
+	test.Run("Forged_Return_Path_Is_Rejected", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		forged := bounce.NewVERP("bounce", "bounces.test.com", "guessed").Encode("1")
+		loggerMock.EXPECT().Warn(gomock.Any()).Times(1)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{forged}, []byte(deliveryStatusNotification))
+
+		assert.ErrorContains(test, err, "550")
+	})
+
+	test.Run("Not_Bounce_Is_Dropped", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Dropped message from sender@example.com to " + returnPath + ": Message is not a bounce").Times(1)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "sender@example.com", []string{returnPath}, []byte("Subject: Hello\r\n\r\nHow are you?\r\n"))
+
+		assert.NoError(test, err)
+	})
+
+	test.Run("Handler_Error_Is_Retried", func(test *testing.T) {
+		server, handlerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		handlerError := errors.New("Error storing messages")
+		handlerMock.EXPECT().HandleBounce(gomock.Any(), gomock.Any()).Return(handlerError)
+		loggerMock.EXPECT().Error(handlerError, "Error handling bounce for email 1").Times(1)
+
+		err := smtp.SendMail(server.Addr().String(), nil, "", []string{returnPath}, []byte(deliveryStatusNotification))
+
+		assert.ErrorContains(test, err, "451")
+	})
+}
@@ -0,0 +1,73 @@
+package bounce
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// signatureLength is the number of hex characters of the signature kept in the return paths
+const signatureLength = 16
+
+// ErrInvalidReturnPath is returned when an address is not a return path of the service
+var ErrInvalidReturnPath = errors.New("Invalid return path")
+
+// ErrForgedReturnPath is returned when the signature of a return path does not match its message ID
+var ErrForgedReturnPath = errors.New("Forged return path")
+
+// VERP encodes the message ID of every email in its envelope sender, so the bounces sent
+// back to it can be linked to the email that caused them. The return paths have the form
+// <prefix>+<message ID>-<signature>@<bounce domain>, where the signature is an HMAC of the
+// message ID so bounces to made up addresses are rejected.
+type VERP struct {
+	prefix string
+	domain string
+	secret []byte
+}
+
+// NewVERP creates the return paths of the given prefix at the bounce domain, signed with the secret
+func NewVERP(prefix, domain, secret string) *VERP {
+	return &VERP{
+		prefix: prefix,
+		domain: domain,
+		secret: []byte(secret),
+	}
+}
+
+// Encode returns the return path of the email with the given message ID
+func (verp *VERP) Encode(messageID string) string {
+	messageID = strings.ToLower(messageID)
+	return fmt.Sprintf("%s+%s-%s@%s", verp.prefix, messageID, verp.sign(messageID), verp.domain)
+}
+
+// Decode returns the message ID of a return path once its signature is verified.
+// Return paths are case insensitive as some servers change the case of the addresses.
+func (verp *VERP) Decode(address string) (string, error) {
+	address = strings.ToLower(strings.Trim(strings.TrimSpace(address), "<>"))
+	local, domain, found := strings.Cut(address, "@")
+	if !found || domain != strings.ToLower(verp.domain) {
+		return "", ErrInvalidReturnPath
+	}
+	prefix, signed, found := strings.Cut(local, "+")
+	if !found || prefix != strings.ToLower(verp.prefix) {
+		return "", ErrInvalidReturnPath
+	}
+	separator := strings.LastIndex(signed, "-")
+	if separator <= 0 {
+		return "", ErrInvalidReturnPath
+	}
+	messageID, signature := signed[:separator], signed[separator+1:]
+	if !hmac.Equal([]byte(signature), []byte(verp.sign(messageID))) {
+		return "", ErrForgedReturnPath
+	}
+	return messageID, nil
+}
+
+func (verp *VERP) sign(messageID string) string {
+	mac := hmac.New(sha256.New, verp.secret)
+	mac.Write([]byte(messageID))
+	return hex.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
@@ -0,0 +1,49 @@
+package bounce
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVERP(test *testing.T) {
+	verp := NewVERP("bounce", "bounces.test.com", "secret")
+
+	test.Run("Encode_Decode", func(test *testing.T) {
+		returnPath := verp.Encode("4F2A-11")
+		assert.Regexp(test, `^bounce\+4f2a-11-[0-9a-f]{16}@bounces\.test\.com$`, returnPath)
+
+		messageID, err := verp.Decode("<" + strings.ToUpper(returnPath) + ">")
+		assert.NoError(test, err)
+		assert.Equal(test, "4f2a-11", messageID)
+	})
+
+	test.Run("Decode_Forged_Return_Path_Error", func(test *testing.T) {
+		returnPath := verp.Encode("1")
+		for _, address := range []string{
+			strings.Replace(returnPath, "+1-", "+2-", 1),
+			NewVERP("bounce", "bounces.test.com", "other").Encode("1"),
+			"bounce+1-0123456789abcdef@bounces.test.com",
+			"bounce+1-@bounces.test.com",
+		} {
+			_, err := verp.Decode(address)
+			assert.ErrorIs(test, err, ErrForgedReturnPath, address)
+		}
+	})
+
+	test.Run("Decode_Invalid_Return_Path_Error", func(test *testing.T) {
+		signature := strings.TrimPrefix(strings.TrimSuffix(verp.Encode("1"), "@bounces.test.com"), "bounce+1-")
+		for _, address := range []string{
+			"bounce+1-" + signature + "@other.com",
+			"other+1-" + signature + "@bounces.test.com",
+			"bounce+1@bounces.test.com",
+			"bounce+-" + signature + "@bounces.test.com",
+			"bounce@bounces.test.com",
+			"bounces.test.com",
+		} {
+			_, err := verp.Decode(address)
+			assert.ErrorIs(test, err, ErrInvalidReturnPath, address)
+		}
+	})
+}
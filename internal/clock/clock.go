@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clocker is the interface for reading the current time so it can be replaced in tests
+type Clocker interface {
+	Now() time.Time
+}
+
+// Clock is the implementation of the clock backed by the system time
+type Clock struct{}
+
+var _ Clocker = &Clock{}
+
+// Now returns the current system time
+func (clock *Clock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a manually driven clock for tests
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+var _ Clocker = &FakeClock{}
+
+// NewFakeClock creates a fake clock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current fake time
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+// Advance moves the fake time forward by the given duration
+func (clock *FakeClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(duration)
+}
+
+// Set moves the fake time to the given time
+func (clock *FakeClock) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = now
+}
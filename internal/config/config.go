@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	commonAWS "github.com/quadev-ltd/qd-common/pkg/aws"
 	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
@@ -18,12 +19,209 @@ type smtp struct {
 	Password string
 }
 
+// scheduler is the configuration of the scheduled emails
+type scheduler struct {
+	StorePath    string
+	PollInterval time.Duration
+	Concurrency  int
+	// Retention is how long the emails no longer waiting to be sent are kept, forever when zero
+	Retention time.Duration
+}
+
+// suppressions is the configuration of the addresses no email is sent to
+type suppressions struct {
+	StorePath string
+}
+
+// preferences is the configuration of the category preferences of the recipients
+type preferences struct {
+	StorePath string
+	// MandatoryCategories are always sent and cannot be opted out of
+	MandatoryCategories []string
+}
+
+// idempotency is the configuration of the deduplication of retried requests
+type idempotency struct {
+	Window time.Duration
+}
+
+// lane is the worker budget of a sending lane
+type lane struct {
+	Concurrency int
+	QueueSize   int
+}
+
+// lanes is the configuration of the sending lanes per priority
+type lanes struct {
+	Critical      lane
+	Transactional lane
+	Bulk          lane
+}
+
+// batch is the configuration of the batch sending
+type batch struct {
+	MaxRecipients int
+}
+
+// limit is the number of requests per second and the burst allowed for each key
+type limit struct {
+	Rate  float64
+	Burst int
+}
+
+// apiKey is a key a client without a certificate identifies with in the rate limits
+type apiKey struct {
+	Client string
+	Key    string
+}
+
+// rateLimit is the configuration of the rate limits per client, recipient and recipient domain
+type rateLimit struct {
+	Client    limit
+	Recipient limit
+	Domain    limit
+	// APIKeys are the keys the clients may identify with, the other keys are ignored. A
+	// client keeps its limit across the keys sharing its name.
+	APIKeys []apiKey
+}
+
+// domainLimit is the delivery budget of a recipient domain
+type domainLimit struct {
+	Domain      string
+	Concurrency int
+	Rate        float64
+	Burst       int
+}
+
+// domainThrottle is the configuration of the outbound throttling per recipient domain
+type domainThrottle struct {
+	MaxWait time.Duration
+	Default domainLimit
+	Domains []domainLimit
+}
+
+// events is the configuration of the delivery events kept for the subscribers
+type events struct {
+	HistorySize int
+	BufferSize  int
+}
+
+// webhookEndpoint is an HTTP endpoint subscribed to the delivery events
+type webhookEndpoint struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string
+}
+
+// webhooks is the configuration of the delivery events posted to HTTP endpoints
+type webhooks struct {
+	Timeout        time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	QueueSize      int
+	LogSize        int
+	// StorePath is the file keeping the pending deliveries across restarts
+	StorePath string
+	Endpoints []webhookEndpoint
+}
+
+// bounces is the configuration of the inbound SMTP server receiving the bounces
+type bounces struct {
+	Enabled         bool
+	Address         string
+	Hostname        string
+	Domain          string
+	Prefix          string
+	Secret          string
+	FeedbackAddress string
+	MaxSize         int
+}
+
+// httpServer is the configuration of the HTTP server of the links in the emails
+type httpServer struct {
+	Enabled bool
+	Address string
+	// URL is the public address of the server the links point to
+	URL string
+}
+
+// unsubscribe is the configuration of the one-click unsubscribe links
+type unsubscribe struct {
+	Secret string
+	// Categories are the categories of the emails the recipients can unsubscribe from
+	Categories []string
+}
+
+// tracking is the configuration of the tracking of the activity of the recipients
+type tracking struct {
+	Secret string
+}
+
+// health is the configuration of the readiness checks behind the gRPC health service
+type health struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// shutdown is the configuration of the graceful shutdown on SIGINT or SIGTERM
+type shutdown struct {
+	// Timeout is the time the requests and the emails in flight have to finish
+	Timeout time.Duration
+}
+
+// tracing is the configuration of the OpenTelemetry traces exported to an OTLP collector
+type tracing struct {
+	Enabled     bool
+	ServiceName string
+	// Endpoint is the host and port of the OTLP gRPC collector
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the fraction of the traces started by the service that are exported
+	SampleRatio float64
+}
+
+// serverTLS is the configuration of the TLS of the gRPC server when TLS is enabled
+type serverTLS struct {
+	CertFile string
+	KeyFile  string
+	// CAFile is the authority signing the certificates of the clients
+	CAFile string
+	// ClientAuth requires the clients to present a certificate signed by the CA
+	ClientAuth bool
+	// AdminClients are the identities of the clients allowed to manage the suppressions and
+	// the preferences and to follow the emails of every client, matched against any name of
+	// their certificate
+	AdminClients []string
+}
+
 // Config is the configuration of the application
 type Config struct {
-	Verbose     bool
-	Environment string
-	SMTP        smtp
-	AWS         commonAWS.Config
+	Verbose        bool
+	Environment    string
+	TLS            serverTLS
+	SMTP           smtp
+	Scheduler      scheduler
+	Suppressions   suppressions
+	Preferences    preferences
+	Idempotency    idempotency
+	Lanes          lanes
+	Batch          batch
+	RateLimit      rateLimit
+	DomainThrottle domainThrottle
+	Events         events
+	Webhooks       webhooks
+	Bounces        bounces
+	HTTP           httpServer
+	Unsubscribe    unsubscribe
+	Tracking       tracking
+	Tracing        tracing
+	Health         health
+	Shutdown       shutdown
+	AWS            commonAWS.Config
+	// path is the directory the configuration was loaded from
+	path string
 }
 
 // Load loads the configuration from the given path yml file
@@ -31,6 +229,7 @@ func (config *Config) Load(path string) error {
 	env := commonConfig.GetEnvironment()
 	config.Environment = env
 	config.Verbose = commonConfig.GetVerbose()
+	config.path = path
 
 	log.Info().Msgf("Loading configuration for environment: %s", env)
 	vip, err := commonConfig.SetupConfig(path, env)
@@ -43,3 +242,8 @@ func (config *Config) Load(path string) error {
 
 	return nil
 }
+
+// Path returns the directory the configuration was loaded from
+func (config *Config) Path() string {
+	return config.path
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/quadev-ltd/qd-common/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -26,12 +27,62 @@ func TestLoad(t *testing.T) {
 		assert.NoError(t, err, "expected no error from Load")
 
 		// Assertions
+		assert.Equal(t, "certs/qd.email.api.crt", cfg.TLS.CertFile)
+		assert.Equal(t, "certs/qd.email.api.key", cfg.TLS.KeyFile)
+		assert.Equal(t, "certs/ca.pem", cfg.TLS.CAFile)
+		assert.False(t, cfg.TLS.ClientAuth)
 		assert.Equal(t, "localhost", cfg.SMTP.Host)
 		assert.Equal(t, "9999", cfg.SMTP.Port)
 		assert.Equal(t, "noreply", cfg.SMTP.From)
 		assert.Equal(t, "test.com", cfg.SMTP.Domain)
 		assert.Equal(t, "username", cfg.SMTP.Username)
 		assert.Equal(t, "test_password", cfg.SMTP.Password)
+		assert.Equal(t, "", cfg.Scheduler.StorePath)
+		assert.Equal(t, time.Second, cfg.Scheduler.PollInterval)
+		assert.Equal(t, 4, cfg.Scheduler.Concurrency)
+		assert.Equal(t, 24*time.Hour, cfg.Scheduler.Retention)
+		assert.Equal(t, "", cfg.Suppressions.StorePath)
+		assert.Equal(t, time.Hour, cfg.Idempotency.Window)
+		assert.Equal(t, 1, cfg.Lanes.Critical.Concurrency)
+		assert.Equal(t, 2, cfg.Lanes.Transactional.Concurrency)
+		assert.Equal(t, 10, cfg.Lanes.Bulk.QueueSize)
+		assert.Equal(t, 100, cfg.Batch.MaxRecipients)
+		assert.Equal(t, 10.0, cfg.RateLimit.Client.Rate)
+		assert.Equal(t, 20, cfg.RateLimit.Client.Burst)
+		assert.Equal(t, 5.0, cfg.RateLimit.Recipient.Rate)
+		assert.Equal(t, 20, cfg.RateLimit.Domain.Burst)
+		assert.Equal(t, time.Second, cfg.DomainThrottle.MaxWait)
+		assert.Equal(t, 2, cfg.DomainThrottle.Default.Concurrency)
+		assert.Len(t, cfg.DomainThrottle.Domains, 1)
+		assert.Equal(t, "gmail.com", cfg.DomainThrottle.Domains[0].Domain)
+		assert.Equal(t, 5.0, cfg.DomainThrottle.Domains[0].Rate)
+		assert.Equal(t, 100, cfg.Events.HistorySize)
+		assert.Equal(t, 10, cfg.Events.BufferSize)
+		assert.Equal(t, 3, cfg.Webhooks.MaxAttempts)
+		assert.Equal(t, 10*time.Millisecond, cfg.Webhooks.InitialBackoff)
+		assert.Len(t, cfg.Webhooks.Endpoints, 1)
+		assert.Equal(t, "test-secret", cfg.Webhooks.Endpoints[0].Secret)
+		assert.Equal(t, []string{"sent", "deferred"}, cfg.Webhooks.Endpoints[0].Events)
+		assert.True(t, cfg.Bounces.Enabled)
+		assert.Equal(t, "localhost:2526", cfg.Bounces.Address)
+		assert.Equal(t, "bounces.test.com", cfg.Bounces.Domain)
+		assert.Equal(t, "bounce", cfg.Bounces.Prefix)
+		assert.Equal(t, "test-bounce-secret", cfg.Bounces.Secret)
+		assert.Equal(t, "fbl@bounces.test.com", cfg.Bounces.FeedbackAddress)
+		assert.Equal(t, []string{"security-alerts"}, cfg.Preferences.MandatoryCategories)
+		assert.True(t, cfg.HTTP.Enabled)
+		assert.Equal(t, "http://localhost:8086", cfg.HTTP.URL)
+		assert.Equal(t, "test-unsubscribe-secret", cfg.Unsubscribe.Secret)
+		assert.Equal(t, []string{"newsletter", "product-updates"}, cfg.Unsubscribe.Categories)
+		assert.Equal(t, "test-tracking-secret", cfg.Tracking.Secret)
+		assert.False(t, cfg.Tracing.Enabled)
+		assert.Equal(t, "qd-email-api", cfg.Tracing.ServiceName)
+		assert.Equal(t, "localhost:4317", cfg.Tracing.Endpoint)
+		assert.True(t, cfg.Tracing.Insecure)
+		assert.Equal(t, 1.0, cfg.Tracing.SampleRatio)
+		assert.Equal(t, time.Second, cfg.Health.Interval)
+		assert.Equal(t, time.Second, cfg.Health.Timeout)
+		assert.Equal(t, 5*time.Second, cfg.Shutdown.Timeout)
 		assert.Equal(t, "key", cfg.AWS.Key)
 		assert.Equal(t, "secret", cfg.AWS.Secret)
 
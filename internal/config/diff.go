@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Change is a field that differs between two configurations, with the secrets masked
+type Change struct {
+	Field string
+	From  string
+	To    string
+}
+
+func (change Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", change.Field, change.From, change.To)
+}
+
+// Diff returns the fields that differ between the configurations. The elements of the
+// lists of sections are compared one by one.
+func Diff(from, to *Config) []Change {
+	return diffValues("", "", reflect.ValueOf(*from), reflect.ValueOf(*to))
+}
+
+func diffValues(field, name string, from, to reflect.Value) []Change {
+	switch {
+	case from.Kind() == reflect.Struct:
+		changes := []Change{}
+		for index := 0; index < from.NumField(); index++ {
+			structField := from.Type().Field(index)
+			if !structField.IsExported() {
+				continue
+			}
+			path := structField.Name
+			if field != "" {
+				path = field + "." + structField.Name
+			}
+			changes = append(changes, diffValues(path, structField.Name, from.Field(index), to.Field(index))...)
+		}
+		return changes
+	case from.Kind() == reflect.Slice && from.Type().Elem().Kind() == reflect.Struct:
+		changes := []Change{}
+		for index := 0; index < max(from.Len(), to.Len()); index++ {
+			changes = append(changes, diffValues(
+				fmt.Sprintf("%s[%d]", field, index),
+				name,
+				getElement(from, index),
+				getElement(to, index),
+			)...)
+		}
+		return changes
+	case reflect.DeepEqual(from.Interface(), to.Interface()):
+		return nil
+	case secretFields[name]:
+		return []Change{{Field: field, From: maskedValue, To: maskedValue}}
+	default:
+		return []Change{{Field: field, From: formatValue(from), To: formatValue(to)}}
+	}
+}
+
+// getElement returns the element of the list, or an empty one past its end
+func getElement(list reflect.Value, index int) reflect.Value {
+	if index < list.Len() {
+		return list.Index(index)
+	}
+	return reflect.Zero(list.Type().Elem())
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return strconv.Quote(value.String())
+	}
+	return fmt.Sprint(value.Interface())
+}
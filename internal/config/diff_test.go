@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("Diff_Unchanged", func(t *testing.T) {
+		cfg, _ := loadValidConfig(t)
+		reloaded, _ := loadValidConfig(t)
+
+		assert.Empty(t, Diff(cfg, reloaded))
+	})
+
+	t.Run("Diff_Masks_Secrets", func(t *testing.T) {
+		cfg, _ := loadValidConfig(t)
+		reloaded, _ := loadValidConfig(t)
+		reloaded.SMTP.Password = "rotated_password"
+		reloaded.RateLimit.Client.Rate = 20
+		reloaded.Unsubscribe.Categories = []string{"newsletter"}
+		reloaded.Webhooks.Endpoints[0].Secret = "rotated-secret"
+		reloaded.Webhooks.Endpoints = append(reloaded.Webhooks.Endpoints, webhookEndpoint{
+			Name:   "audit",
+			Secret: "audit-secret",
+		})
+
+		changes := Diff(cfg, reloaded)
+
+		assert.Equal(t, []Change{
+			{Field: "SMTP.Password", From: maskedValue, To: maskedValue},
+			{Field: "RateLimit.Client.Rate", From: "10", To: "20"},
+			{Field: "Webhooks.Endpoints[0].Secret", From: maskedValue, To: maskedValue},
+			{Field: "Webhooks.Endpoints[1].Name", From: `""`, To: `"audit"`},
+			{Field: "Webhooks.Endpoints[1].Secret", From: maskedValue, To: maskedValue},
+			{Field: "Unsubscribe.Categories", From: "[newsletter product-updates]", To: "[newsletter]"},
+		}, changes)
+		assert.Equal(t, "SMTP.Password: ****** -> ******", changes[0].String())
+	})
+}
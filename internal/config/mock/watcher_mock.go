@@ -0,0 +1,60 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: watcher.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockWatcherer is a mock of Watcherer interface.
+type MockWatcherer struct {
+	ctrl     *gomock.Controller
+	recorder *MockWatchererMockRecorder
+}
+
+// MockWatchererMockRecorder is the mock recorder for MockWatcherer.
+type MockWatchererMockRecorder struct {
+	mock *MockWatcherer
+}
+
+// NewMockWatcherer creates a new mock instance.
+func NewMockWatcherer(ctrl *gomock.Controller) *MockWatcherer {
+	mock := &MockWatcherer{ctrl: ctrl}
+	mock.recorder = &MockWatchererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWatcherer) EXPECT() *MockWatchererMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method.
+func (m *MockWatcherer) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockWatchererMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockWatcherer)(nil).Start))
+}
+
+// Stop mocks base method.
+func (m *MockWatcherer) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockWatchererMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockWatcherer)(nil).Stop))
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"qd-email-api/internal/secret"
+)
+
+// maskedValue replaces the values of the secrets in the logs and dumps
+const maskedValue = "******"
+
+// secretFields are the fields holding secrets, which may be secret references and whose
+// values are never shown
+var secretFields = map[string]bool{
+	"Password": true,
+	"Secret":   true,
+	"Key":      true,
+}
+
+// ResolveSecrets replaces the secret references of the secret fields, such as
+// file:///run/secrets/smtp, env:SMTP_PASSWORD or awssm://smtp, with the secrets they point
+// to. Every reference that cannot be resolved is reported.
+func (config *Config) ResolveSecrets(ctx context.Context, resolver secret.Resolverer) error {
+	errs := []error{}
+	walkFields("", reflect.ValueOf(config).Elem(), func(field, name string, value reflect.Value) {
+		if !secretFields[name] || value.Kind() != reflect.String {
+			return
+		}
+		resolved, err := resolver.Resolve(ctx, value.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", field, err))
+			return
+		}
+		value.SetString(resolved)
+	})
+	return errors.Join(errs...)
+}
+
+// String returns the fields of the configuration with the secrets masked, so the
+// configuration can be printed
+func (config Config) String() string {
+	fields := []string{}
+	walkFields("", reflect.ValueOf(config), func(field, name string, value reflect.Value) {
+		if secretFields[name] && !value.IsZero() {
+			fields = append(fields, field+"="+maskedValue)
+			return
+		}
+		fields = append(fields, field+"="+formatValue(value))
+	})
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+// GoString masks the secrets of the configuration printed with %#v
+func (config Config) GoString() string {
+	return config.String()
+}
+
+// walkFields calls back with every exported field that is not a section, including the
+// fields of the sections in lists
+func walkFields(field string, value reflect.Value, visit func(field, name string, value reflect.Value)) {
+	for index := 0; index < value.NumField(); index++ {
+		structField := value.Type().Field(index)
+		if !structField.IsExported() {
+			continue
+		}
+		path := structField.Name
+		if field != "" {
+			path = field + "." + structField.Name
+		}
+		fieldValue := value.Field(index)
+		switch {
+		case fieldValue.Kind() == reflect.Struct:
+			walkFields(path, fieldValue, visit)
+		case fieldValue.Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() == reflect.Struct:
+			for element := 0; element < fieldValue.Len(); element++ {
+				walkFields(fmt.Sprintf("%s[%d]", path, element), fieldValue.Index(element), visit)
+			}
+		default:
+			visit(path, structField.Name, fieldValue)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/secret"
+)
+
+func TestSecrets(t *testing.T) {
+	secretsManager := secret.NewFakeSecretsManager(map[string]string{
+		"qd-email-api/webhook": "secrets_manager_webhook_secret",
+	})
+	resolver := secret.NewResolver(map[string]secret.Providerer{
+		secret.SchemeFile:              &secret.FileProvider{},
+		secret.SchemeEnv:               &secret.EnvProvider{},
+		secret.SchemeAWSSecretsManager: secret.NewSecretsManagerProvider(secretsManager),
+	})
+
+	t.Run("Resolve_Secrets_Success", func(t *testing.T) {
+		cfg, _ := loadValidConfig(t)
+		passwordFile := filepath.Join(t.TempDir(), "smtp")
+		assert.NoError(t, os.WriteFile(passwordFile, []byte("file_password\n"), 0600))
+		os.Setenv("TEST_AWS_SECRET", "env_aws_secret")
+		defer os.Unsetenv("TEST_AWS_SECRET")
+		cfg.SMTP.Password = "file://" + passwordFile
+		cfg.AWS.Secret = "env:TEST_AWS_SECRET"
+		cfg.Webhooks.Endpoints[0].Secret = "awssm://qd-email-api/webhook"
+		cfg.SMTP.Host = "env:NOT_A_SECRET_FIELD"
+
+		err := cfg.ResolveSecrets(context.Background(), resolver)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "file_password", cfg.SMTP.Password)
+		assert.Equal(t, "env_aws_secret", cfg.AWS.Secret)
+		assert.Equal(t, "secrets_manager_webhook_secret", cfg.Webhooks.Endpoints[0].Secret)
+		assert.Equal(t, "test-bounce-secret", cfg.Bounces.Secret)
+		assert.Equal(t, "env:NOT_A_SECRET_FIELD", cfg.SMTP.Host)
+	})
+
+	t.Run("Resolve_Secrets_Reports_All_Errors", func(t *testing.T) {
+		cfg, _ := loadValidConfig(t)
+		cfg.SMTP.Password = "env:TEST_MISSING_PASSWORD"
+		cfg.Tracking.Secret = "awssm://qd-email-api/missing"
+
+		err := cfg.ResolveSecrets(context.Background(), resolver)
+
+		assert.ErrorContains(t, err, "SMTP.Password: Error resolving secret env:TEST_MISSING_PASSWORD")
+		assert.ErrorContains(t, err, "Tracking.Secret: Error resolving secret awssm://qd-email-api/missing")
+	})
+
+	t.Run("String_Masks_Secrets", func(t *testing.T) {
+		cfg, _ := loadValidConfig(t)
+		cfg.Bounces.Secret = ""
+
+		for _, dump := range []string{
+			cfg.String(),
+			fmt.Sprintf("%v", cfg),
+			fmt.Sprintf("%+v", *cfg),
+			fmt.Sprintf("%#v", cfg),
+		} {
+			assert.Contains(t, dump, `SMTP.Host="localhost"`)
+			assert.Contains(t, dump, "SMTP.Password=******")
+			assert.Contains(t, dump, "Webhooks.Endpoints[0].Secret=******")
+			assert.Contains(t, dump, "AWS.Key=******")
+			assert.Contains(t, dump, `Bounces.Secret=""`)
+			assert.NotContains(t, dump, "test_password")
+			assert.NotContains(t, dump, "test-secret")
+			assert.NotContains(t, dump, "test-tracking-secret")
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
+)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+// Error returns the problems, one per line
+func (err *ValidationError) Error() string {
+	return "Invalid configuration:\n- " + strings.Join(err.Problems, "\n- ")
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	problems []string
+}
+
+func (validator *validator) addf(format string, arguments ...interface{}) {
+	validator.problems = append(validator.problems, fmt.Sprintf(format, arguments...))
+}
+
+func (validator *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		validator.addf("%s is required", field)
+	}
+}
+
+func (validator *validator) positive(field string, value int64) {
+	if value <= 0 {
+		validator.addf("%s must be positive", field)
+	}
+}
+
+func (validator *validator) notNegative(field string, value float64) {
+	if value < 0 {
+		validator.addf("%s cannot be negative", field)
+	}
+}
+
+// port checks a port to connect to
+func (validator *validator) port(field, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		validator.addf("%s %q is not a valid port", field, value)
+	}
+}
+
+// address checks a host and port to listen on or connect to, where the host may be empty
+func (validator *validator) address(field, value string) {
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		validator.addf("%s %q is not a valid address: %v", field, value, err)
+		return
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 0 || number > 65535 {
+		validator.addf("%s %q is not a valid address: invalid port %q", field, value, port)
+	}
+}
+
+// url checks an absolute HTTP or HTTPS URL
+func (validator *validator) url(field, value string) {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		validator.addf("%s %q is not a valid HTTP URL", field, value)
+	}
+}
+
+// readable checks a file the application reads at startup
+func (validator *validator) readable(field, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		validator.addf("%s %q is not readable: %v", field, path, err)
+		return
+	}
+	file.Close()
+}
+
+func (validator *validator) lane(name string, lane lane) {
+	validator.positive(name+" concurrency", int64(lane.Concurrency))
+	validator.notNegative(name+" queue size", float64(lane.QueueSize))
+}
+
+func (validator *validator) limit(name string, limit limit) {
+	validator.notNegative(name+" rate", limit.Rate)
+	validator.notNegative(name+" burst", float64(limit.Burst))
+}
+
+func (validator *validator) domainLimit(name string, limit domainLimit) {
+	validator.notNegative(name+" concurrency", float64(limit.Concurrency))
+	validator.notNegative(name+" rate", limit.Rate)
+	validator.notNegative(name+" burst", float64(limit.Burst))
+}
+
+// Validate checks the configuration along with the fields of the central configuration the
+// application uses, reporting every problem at once. The TLS files are checked when TLS is
+// enabled.
+func (config *Config) Validate(centralConfig *commonConfig.Config) error {
+	validator := &validator{}
+
+	validator.required("Central app name", centralConfig.AppName)
+	validator.required("Central email service host", centralConfig.EmailService.Host)
+	validator.port("Central email service port", centralConfig.EmailService.Port)
+	if centralConfig.TLSEnabled {
+		validator.readable("TLS cert file", config.TLS.CertFile)
+		validator.readable("TLS key file", config.TLS.KeyFile)
+		if config.TLS.ClientAuth {
+			validator.readable("TLS CA file", config.TLS.CAFile)
+		}
+	}
+	if len(config.TLS.AdminClients) > 0 && !(centralConfig.TLSEnabled && config.TLS.ClientAuth) {
+		validator.addf("TLS admin clients need TLS client auth")
+	}
+
+	validator.required("SMTP host", config.SMTP.Host)
+	validator.port("SMTP port", config.SMTP.Port)
+	validator.required("SMTP from", config.SMTP.From)
+	validator.required("SMTP domain", config.SMTP.Domain)
+
+	validator.positive("Scheduler poll interval", int64(config.Scheduler.PollInterval))
+	validator.positive("Scheduler concurrency", int64(config.Scheduler.Concurrency))
+	validator.notNegative("Scheduler retention", float64(config.Scheduler.Retention))
+	validator.notNegative("Idempotency window", float64(config.Idempotency.Window))
+	validator.lane("Critical lane", config.Lanes.Critical)
+	validator.lane("Transactional lane", config.Lanes.Transactional)
+	validator.lane("Bulk lane", config.Lanes.Bulk)
+	validator.positive("Batch max recipients", int64(config.Batch.MaxRecipients))
+
+	validator.limit("Client rate limit", config.RateLimit.Client)
+	validator.limit("Recipient rate limit", config.RateLimit.Recipient)
+	validator.limit("Domain rate limit", config.RateLimit.Domain)
+	for index, apiKey := range config.RateLimit.APIKeys {
+		name := fmt.Sprintf("Rate limit API key %d", index+1)
+		validator.required(name+" client", apiKey.Client)
+		validator.required(name+" key", apiKey.Key)
+	}
+	validator.notNegative("Domain throttle max wait", float64(config.DomainThrottle.MaxWait))
+	validator.domainLimit("Default domain throttle", config.DomainThrottle.Default)
+	for index, domainLimit := range config.DomainThrottle.Domains {
+		name := fmt.Sprintf("Domain throttle %d", index+1)
+		validator.required(name+" domain", domainLimit.Domain)
+		validator.domainLimit(name, domainLimit)
+	}
+
+	validator.notNegative("Events history size", float64(config.Events.HistorySize))
+	validator.notNegative("Events buffer size", float64(config.Events.BufferSize))
+
+	if len(config.Webhooks.Endpoints) > 0 {
+		validator.positive("Webhooks timeout", int64(config.Webhooks.Timeout))
+		validator.positive("Webhooks max attempts", int64(config.Webhooks.MaxAttempts))
+	}
+	for index, endpoint := range config.Webhooks.Endpoints {
+		name := fmt.Sprintf("Webhook endpoint %d", index+1)
+		validator.required(name+" name", endpoint.Name)
+		validator.url(name+" URL", endpoint.URL)
+		validator.required(name+" secret", endpoint.Secret)
+		if len(endpoint.Events) == 0 {
+			validator.addf("%s needs at least one event", name)
+		}
+	}
+
+	if config.Bounces.Enabled {
+		validator.address("Bounces address", config.Bounces.Address)
+		validator.required("Bounces hostname", config.Bounces.Hostname)
+		validator.required("Bounces domain", config.Bounces.Domain)
+		validator.required("Bounces prefix", config.Bounces.Prefix)
+		validator.required("Bounces secret", config.Bounces.Secret)
+		validator.positive("Bounces max size", int64(config.Bounces.MaxSize))
+	}
+
+	if config.HTTP.Enabled {
+		validator.address("HTTP address", config.HTTP.Address)
+		validator.url("HTTP URL", config.HTTP.URL)
+		// The links of the emails are signed with the secrets
+		validator.required("Unsubscribe secret", config.Unsubscribe.Secret)
+		validator.required("Tracking secret", config.Tracking.Secret)
+	}
+
+	if config.Tracing.Enabled {
+		validator.required("Tracing service name", config.Tracing.ServiceName)
+		validator.address("Tracing endpoint", config.Tracing.Endpoint)
+		if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+			validator.addf("Tracing sample ratio %v must be between 0 and 1", config.Tracing.SampleRatio)
+		}
+	}
+
+	validator.positive("Health interval", int64(config.Health.Interval))
+	validator.positive("Health timeout", int64(config.Health.Timeout))
+	validator.positive("Shutdown timeout", int64(config.Shutdown.Timeout))
+
+	if len(validator.problems) > 0 {
+		return &ValidationError{Problems: validator.problems}
+	}
+	return nil
+}
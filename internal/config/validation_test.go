@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quadev-ltd/qd-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadValidConfig(t *testing.T) (*Config, *config.Config) {
+	os.Setenv(config.AppEnvironmentKey, "test")
+	t.Cleanup(func() {
+		os.Unsetenv(config.AppEnvironmentKey)
+	})
+	cfg := &Config{}
+	assert.NoError(t, cfg.Load(MockConfigPath))
+	// The certificates are relative to the root of the repository
+	cfg.TLS.CertFile = filepath.Join("../..", cfg.TLS.CertFile)
+	cfg.TLS.KeyFile = filepath.Join("../..", cfg.TLS.KeyFile)
+	cfg.TLS.CAFile = filepath.Join("../..", cfg.TLS.CAFile)
+	centralConfig := &config.Config{
+		AppName: "QD Test",
+		EmailService: config.Address{
+			Host: "qd.email.api",
+			Port: "1111",
+		},
+	}
+	return cfg, centralConfig
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Validate_Success", func(t *testing.T) {
+		cfg, centralConfig := loadValidConfig(t)
+		centralConfig.TLSEnabled = true
+		cfg.TLS.ClientAuth = true
+
+		err := cfg.Validate(centralConfig)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Validate_Reports_All_Problems", func(t *testing.T) {
+		cfg, centralConfig := loadValidConfig(t)
+		centralConfig.TLSEnabled = true
+		centralConfig.EmailService.Port = "grpc"
+		cfg.SMTP.Host = ""
+		cfg.SMTP.Port = "1111_env"
+		cfg.Bounces.Address = "localhost"
+		cfg.HTTP.URL = "localhost:8086"
+		cfg.Lanes.Bulk.Concurrency = 0
+		cfg.TLS.CertFile = "missing/cert.pem"
+
+		err := cfg.Validate(centralConfig)
+
+		var validationError *ValidationError
+		assert.True(t, errors.As(err, &validationError))
+		assert.Len(t, validationError.Problems, 7)
+		assert.Contains(t, err.Error(), "Central email service port \"grpc\" is not a valid port")
+		assert.Contains(t, err.Error(), "TLS cert file \"missing/cert.pem\" is not readable")
+		assert.Contains(t, err.Error(), "SMTP host is required")
+		assert.Contains(t, err.Error(), "SMTP port \"1111_env\" is not a valid port")
+		assert.Contains(t, err.Error(), "Bounces address \"localhost\" is not a valid address")
+		assert.Contains(t, err.Error(), "HTTP URL \"localhost:8086\" is not a valid HTTP URL")
+		assert.Contains(t, err.Error(), "Bulk lane concurrency must be positive")
+	})
+
+	t.Run("Validate_Skips_Disabled_Sections", func(t *testing.T) {
+		cfg, centralConfig := loadValidConfig(t)
+		cfg.Bounces.Enabled = false
+		cfg.Bounces.Address = ""
+		cfg.HTTP.Enabled = false
+		cfg.Tracking.Secret = ""
+		cfg.Tracing.SampleRatio = 2
+		cfg.TLS.CertFile = "missing/cert.pem"
+
+		err := cfg.Validate(centralConfig)
+
+		assert.NoError(t, err)
+	})
+	t.Run("Admin_Clients_Need_Client_Auth", func(t *testing.T) {
+		cfg, centralConfig := loadValidConfig(t)
+		centralConfig.TLSEnabled = true
+		cfg.TLS.AdminClients = []string{"qd.admin.api"}
+
+		err := cfg.Validate(centralConfig)
+
+		assert.EqualError(t, err, "Invalid configuration:\n- TLS admin clients need TLS client auth")
+	})
+	t.Run("API_Keys_Need_Client_And_Key", func(t *testing.T) {
+		cfg, centralConfig := loadValidConfig(t)
+		cfg.RateLimit.APIKeys = []apiKey{{Client: "notifications"}, {Key: "api-key"}}
+
+		err := cfg.Validate(centralConfig)
+
+		assert.EqualError(t, err, "Invalid configuration:\n- Rate limit API key 1 key is required\n- Rate limit API key 2 client is required")
+	})
+}
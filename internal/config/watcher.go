@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/quadev-ltd/qd-common/pkg/log"
+)
+
+// reloadDelay groups the file events of a single change of the configuration, as editors
+// and deployments write the files in several steps
+const reloadDelay = 100 * time.Millisecond
+
+// Watcherer is the interface for watching the configuration for changes
+type Watcherer interface {
+	Start() error
+	Stop()
+}
+
+// Watcher calls back when the files of the configuration directory change or the
+// process receives SIGHUP
+type Watcher struct {
+	path     string
+	onChange func()
+	logger   log.Loggerer
+	watcher  *fsnotify.Watcher
+	hangups  chan os.Signal
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+var _ Watcherer = &Watcher{}
+
+// NewWatcher creates a new watcher of the configuration directory
+func NewWatcher(path string, onChange func(), logger log.Loggerer) *Watcher {
+	return &Watcher{
+		path:     path,
+		onChange: onChange,
+		logger:   logger,
+		hangups:  make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start starts watching the configuration directory and SIGHUP
+func (watcher *Watcher) Start() error {
+	fileWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Error creating the file watcher: %v", err)
+	}
+	// The directory is watched as the files may be replaced rather than written
+	if err := fileWatcher.Add(watcher.path); err != nil {
+		fileWatcher.Close()
+		return fmt.Errorf("Error watching %s: %v", watcher.path, err)
+	}
+	watcher.watcher = fileWatcher
+	signal.Notify(watcher.hangups, syscall.SIGHUP)
+	go watcher.watch()
+	return nil
+}
+
+// Stop stops watching the configuration
+func (watcher *Watcher) Stop() {
+	if watcher.watcher == nil {
+		return
+	}
+	signal.Stop(watcher.hangups)
+	close(watcher.done)
+	<-watcher.stopped
+	watcher.watcher.Close()
+}
+
+func (watcher *Watcher) watch() {
+	defer close(watcher.stopped)
+	var changed <-chan time.Time
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case event := <-watcher.watcher.Events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			changed = time.After(reloadDelay)
+		case err := <-watcher.watcher.Errors:
+			watcher.logger.Error(err, "Failed to watch configuration")
+		case <-changed:
+			changed = nil
+			watcher.logger.Info("Configuration files changed")
+			watcher.onChange()
+		case <-watcher.hangups:
+			watcher.logger.Info("Reloading configuration on SIGHUP")
+			watcher.onChange()
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	setupWatcher := func(t *testing.T) (*Watcher, string, chan struct{}) {
+		controller := gomock.NewController(t)
+		logger := loggerMock.NewMockLoggerer(controller)
+		logger.EXPECT().Info(gomock.Any()).AnyTimes()
+		path := t.TempDir()
+		changed := make(chan struct{}, 10)
+		watcher := NewWatcher(path, func() {
+			changed <- struct{}{}
+		}, logger)
+		assert.NoError(t, watcher.Start())
+		t.Cleanup(watcher.Stop)
+		return watcher, path, changed
+	}
+
+	t.Run("File_Change_Calls_Back_Once", func(t *testing.T) {
+		_, path, changed := setupWatcher(t)
+
+		file := filepath.Join(path, "config.test.yml")
+		assert.NoError(t, os.WriteFile(file, []byte("smtp:\n"), 0600))
+		assert.NoError(t, os.WriteFile(file, []byte("smtp:\n  host: localhost\n"), 0600))
+
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Configuration change not reported")
+		}
+		select {
+		case <-changed:
+			t.Fatal("Configuration change reported twice")
+		case <-time.After(2 * reloadDelay):
+		}
+	})
+
+	t.Run("SIGHUP_Calls_Back", func(t *testing.T) {
+		_, _, changed := setupWatcher(t)
+
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("SIGHUP not reported")
+		}
+	})
+
+	t.Run("Start_Missing_Directory_Error", func(t *testing.T) {
+		watcher := NewWatcher(filepath.Join(t.TempDir(), "missing"), func() {}, nil)
+
+		assert.ErrorContains(t, watcher.Start(), "Error watching")
+		watcher.Stop()
+	})
+}
@@ -0,0 +1,173 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+)
+
+// ErrInvalidCursor is returned when a cursor was not issued by the bus
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// ErrCursorExpired is returned when the events after a cursor are no longer kept
+var ErrCursorExpired = errors.New("Cursor expired")
+
+// Event is a status change of a message
+type Event struct {
+	// Cursor identifies the event to resume a subscription after it
+	Cursor    string
+	MessageID string
+	To        string
+	Category  string
+	Status    model.Status
+	Time      time.Time
+	Response  string
+	sequence  uint64
+}
+
+// Buser is the interface for publishing and subscribing to the status changes of the messages
+type Buser interface {
+	Publish(message *model.Message, change model.StatusChange)
+	Subscribe(cursor string) (*Subscription, error)
+}
+
+// Subscription receives the events published after it was created or after its cursor
+type Subscription struct {
+	events chan Event
+	bus    *Bus
+}
+
+// Events returns the channel of events, which is closed when the subscriber falls too far behind
+func (subscription *Subscription) Events() <-chan Event {
+	return subscription.events
+}
+
+// Close stops the subscription
+func (subscription *Subscription) Close() {
+	subscription.bus.unsubscribe(subscription)
+}
+
+// Bus keeps the latest events in memory so subscribers can resume from a cursor.
+// Cursors hold the epoch of the bus so cursors from a previous run are rejected.
+type Bus struct {
+	mutex         sync.Mutex
+	epoch         string
+	sequence      uint64
+	history       []Event
+	historySize   int
+	bufferSize    int
+	subscriptions map[*Subscription]bool
+}
+
+var _ Buser = &Bus{}
+
+// NewBus creates an event bus keeping historySize events for resuming subscriptions
+// and buffering up to bufferSize events per subscriber
+func NewBus(clock clock.Clocker, historySize, bufferSize int) *Bus {
+	return &Bus{
+		epoch:         strconv.FormatInt(clock.Now().UnixNano(), 36),
+		historySize:   max(historySize, 1),
+		bufferSize:    max(bufferSize, 1),
+		subscriptions: make(map[*Subscription]bool),
+	}
+}
+
+// Publish sends the status change of the message to every subscriber. Subscribers whose
+// buffer is full are dropped so a slow subscriber never blocks the delivery of emails.
+func (bus *Bus) Publish(message *model.Message, change model.StatusChange) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.sequence++
+	event := Event{
+		Cursor:    fmt.Sprintf("%s-%d", bus.epoch, bus.sequence),
+		MessageID: message.ID,
+		To:        message.To,
+		Category:  message.Category,
+		Status:    change.Status,
+		Time:      change.Time,
+		Response:  change.Response,
+		sequence:  bus.sequence,
+	}
+	bus.history = append(bus.history, event)
+	if len(bus.history) > bus.historySize {
+		bus.history = bus.history[len(bus.history)-bus.historySize:]
+	}
+	for subscription := range bus.subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			delete(bus.subscriptions, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events published after the cursor, or to the
+// events published from now on when the cursor is empty
+func (bus *Bus) Subscribe(cursor string) (*Subscription, error) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	after := bus.sequence
+	if cursor != "" {
+		sequence, err := bus.parseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = sequence
+	}
+	missed := []Event{}
+	for _, event := range bus.history {
+		if event.sequence > after {
+			missed = append(missed, event)
+		}
+	}
+	subscription := &Subscription{
+		events: make(chan Event, len(missed)+bus.bufferSize),
+		bus:    bus,
+	}
+	for _, event := range missed {
+		subscription.events <- event
+	}
+	bus.subscriptions[subscription] = true
+	return subscription, nil
+}
+
+func (bus *Bus) parseCursor(cursor string) (uint64, error) {
+	epoch, sequenceText, found := strings.Cut(cursor, "-")
+	if !found {
+		return 0, ErrInvalidCursor
+	}
+	sequence, err := strconv.ParseUint(sequenceText, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if epoch != bus.epoch {
+		return 0, ErrCursorExpired
+	}
+	if sequence > bus.sequence {
+		return 0, ErrInvalidCursor
+	}
+	// The event right after the cursor must still be kept
+	if len(bus.history) > 0 && sequence+1 < bus.history[0].sequence {
+		return 0, ErrCursorExpired
+	}
+	return sequence, nil
+}
+
+func (bus *Bus) unsubscribe(subscription *Subscription) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	if bus.subscriptions[subscription] {
+		delete(bus.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
@@ -0,0 +1,102 @@
+package event
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+)
+
+func TestBus(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	message := &model.Message{ID: "1", To: "test@test.com", Category: "security"}
+	publish := func(bus *Bus, statuses ...model.Status) {
+		for _, status := range statuses {
+			bus.Publish(message, model.StatusChange{Status: status, Time: now})
+		}
+	}
+	receive := func(subscription *Subscription, count int) []Event {
+		events := []Event{}
+		for index := 0; index < count; index++ {
+			events = append(events, <-subscription.Events())
+		}
+		return events
+	}
+
+	test.Run("Subscribe_Receives_New_Events", func(test *testing.T) {
+		bus := NewBus(clock.NewFakeClock(now), 10, 10)
+		publish(bus, model.StatusAccepted)
+
+		subscription, err := bus.Subscribe("")
+		assert.NoError(test, err)
+		defer subscription.Close()
+		publish(bus, model.StatusQueued)
+
+		events := receive(subscription, 1)
+		assert.Equal(test, "1", events[0].MessageID)
+		assert.Equal(test, "test@test.com", events[0].To)
+		assert.Equal(test, "security", events[0].Category)
+		assert.Equal(test, model.StatusQueued, events[0].Status)
+		assert.Equal(test, fmt.Sprintf("%s-2", bus.epoch), events[0].Cursor)
+		assert.Empty(test, subscription.Events())
+	})
+
+	test.Run("Subscribe_Resumes_After_Cursor", func(test *testing.T) {
+		bus := NewBus(clock.NewFakeClock(now), 10, 10)
+		publish(bus, model.StatusAccepted, model.StatusQueued, model.StatusSending)
+
+		first, err := bus.Subscribe(fmt.Sprintf("%s-1", bus.epoch))
+		assert.NoError(test, err)
+		defer first.Close()
+		publish(bus, model.StatusSent)
+
+		events := receive(first, 3)
+		assert.Equal(test, model.StatusQueued, events[0].Status)
+		assert.Equal(test, model.StatusSending, events[1].Status)
+		assert.Equal(test, model.StatusSent, events[2].Status)
+	})
+
+	test.Run("Subscribe_Cursor_Errors", func(test *testing.T) {
+		bus := NewBus(clock.NewFakeClock(now), 2, 10)
+		publish(bus, model.StatusAccepted, model.StatusQueued, model.StatusSending, model.StatusSent)
+
+		_, err := bus.Subscribe(fmt.Sprintf("%s-1", bus.epoch))
+		assert.ErrorIs(test, err, ErrCursorExpired)
+		_, err = bus.Subscribe("previous-3")
+		assert.ErrorIs(test, err, ErrCursorExpired)
+		_, err = bus.Subscribe(fmt.Sprintf("%s-5", bus.epoch))
+		assert.ErrorIs(test, err, ErrInvalidCursor)
+		_, err = bus.Subscribe("cursor")
+		assert.ErrorIs(test, err, ErrInvalidCursor)
+
+		subscription, err := bus.Subscribe(fmt.Sprintf("%s-2", bus.epoch))
+		assert.NoError(test, err)
+		assert.Len(test, subscription.Events(), 2)
+	})
+
+	test.Run("Slow_Subscriber_Is_Dropped", func(test *testing.T) {
+		bus := NewBus(clock.NewFakeClock(now), 10, 2)
+		slow, err := bus.Subscribe("")
+		assert.NoError(test, err)
+		fast, err := bus.Subscribe("")
+		assert.NoError(test, err)
+		defer fast.Close()
+
+		publish(bus, model.StatusAccepted, model.StatusQueued)
+		receive(fast, 2)
+		publish(bus, model.StatusSending)
+
+		events := receive(slow, 2)
+		assert.Equal(test, model.StatusQueued, events[1].Status)
+		_, open := <-slow.Events()
+		assert.False(test, open)
+		assert.Equal(test, model.StatusSending, receive(fast, 1)[0].Status)
+
+		// Closing a dropped subscription is harmless
+		slow.Close()
+	})
+}
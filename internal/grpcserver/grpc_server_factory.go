@@ -1,23 +1,43 @@
 package grpcserver
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
 	commonPB "github.com/quadev-ltd/qd-common/pb/gen/go/pb_email"
-	"github.com/quadev-ltd/qd-common/pkg/grpcserver"
 	"github.com/quadev-ltd/qd-common/pkg/log"
-	commonTLS "github.com/quadev-ltd/qd-common/pkg/tls"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/metrics"
+	"qd-email-api/internal/mtls"
 	"qd-email-api/internal/service"
+	"qd-email-api/internal/tracing"
+	"qd-email-api/pb/gen/go/pb_email_api"
 )
 
+// Dependencies are the components served by the gRPC server along with the ones of its
+// interceptors
+type Dependencies struct {
+	EmailService   service.EmailServiceDependencies
+	Metrics        *metrics.Metrics
+	TracerProvider trace.TracerProvider
+	HealthServer   healthpb.HealthServer
+	LogFactory     log.Factoryer
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+	// ClientAuth requires a client certificate for the requests other than the health checks
+	ClientAuth bool
+}
+
 // Factoryer is the interfact for creating a gRPC server
 type Factoryer interface {
-	Create(
-		grpcServerAddress string,
-		authenticationService service.EmailServicer,
-		logFactory log.Factoryer,
-		tlsEnabled bool,
-	) (grpcserver.GRPCServicer, error)
+	Create(grpcServerAddress string, dependencies Dependencies) (Serverer, error)
 }
 
 // Factory is the implementation of the gRPC server factory
@@ -25,33 +45,42 @@ type Factory struct{}
 
 var _ Factoryer = &Factory{}
 
-// Create creates a gRPC server
-func (grpcServerFactory *Factory) Create(
-	grpcServerAddress string,
-	emailService service.EmailServicer,
-	logFactory log.Factoryer,
-	tlsEnabled bool,
-) (grpcserver.GRPCServicer, error) {
-	// TODO: Set domain info in the config file
-	const certFilePath = "certs/qd.email.api.crt"
-	const keyFilePath = "certs/qd.email.api.key"
+// Create creates a gRPC server, serving TLS when the TLS configuration is set. The requests
+// other than the health checks need a client certificate when the clients authenticate.
+func (grpcServerFactory *Factory) Create(grpcServerAddress string, dependencies Dependencies) (Serverer, error) {
 	// Create a listener for the gRPC server which eventually will start accepting connections when server is served
-	grpcListener, err := commonTLS.CreateTLSListener(
-		grpcServerAddress,
-		certFilePath,
-		keyFilePath,
-		tlsEnabled,
-	)
+	grpcListener, err := net.Listen("tcp", grpcServerAddress)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Failed to listen: %v", err)
+	}
+	serverOptions := []grpc.ServerOption{}
+	if dependencies.TLSConfig != nil {
+		// The handshake is done by gRPC so the requests carry the certificate of the client
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(dependencies.TLSConfig)))
 	}
 
 	// Create a gRPC server with a registered email service
-	emailServiceGRPCServer := service.NewEmailServiceServer(emailService)
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(log.CreateLoggerInterceptor(logFactory)),
-	)
-	commonPB.RegisterEmailServiceServer(grpcServer, emailServiceGRPCServer)
+	streamsCtx, endStreams := context.WithCancel(context.Background())
+	emailServiceGRPCServer := service.NewEmailServiceServer(dependencies.EmailService)
+	grpcServer := grpc.NewServer(append(
+		serverOptions,
+		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor(dependencies.TracerProvider),
+			dependencies.Metrics.UnaryServerInterceptor(&clock.Clock{}),
+			SkipHealthChecks(mtls.UnaryServerInterceptor(dependencies.ClientAuth)),
+			SkipHealthChecks(log.CreateLoggerInterceptor(dependencies.LogFactory)),
+		),
+		grpc.ChainStreamInterceptor(
+			tracing.StreamServerInterceptor(dependencies.TracerProvider),
+			dependencies.Metrics.StreamServerInterceptor(&clock.Clock{}),
+			SkipStreamHealthChecks(mtls.StreamServerInterceptor(dependencies.ClientAuth)),
+			SkipStreamHealthChecks(CreateStreamLoggerInterceptor(dependencies.LogFactory)),
+			EndServerStreams(streamsCtx),
+		),
+	)...)
+	pb_email_api.RegisterEmailServiceServer(grpcServer, emailServiceGRPCServer)
+	commonPB.RegisterEmailServiceServer(grpcServer, service.NewLegacyEmailServiceServer(emailServiceGRPCServer))
+	healthpb.RegisterHealthServer(grpcServer, dependencies.HealthServer)
 
-	return grpcserver.NewGRPCService(grpcServer, grpcListener), nil
+	return NewServer(grpcServer, grpcListener, endStreams), nil
 }
@@ -0,0 +1,110 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// errShuttingDown is the cause of the cancellation of the server streams on shutdown
+var errShuttingDown = errors.New("Server is shutting down")
+
+// contextServerStream overrides the context of a server stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context
+func (stream *contextServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+// CreateStreamLoggerInterceptor is the streaming counterpart of log.CreateLoggerInterceptor.
+// It adds a logger with the correlation ID to the context of the streaming calls.
+func CreateStreamLoggerInterceptor(logFactory log.Factoryer) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		logger, err := logFactory.NewLoggerWithCorrelationID(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(server, &contextServerStream{
+			ServerStream: stream,
+			ctx:          context.WithValue(stream.Context(), log.LoggerKey, logger),
+		})
+	}
+}
+
+// EndServerStreams cancels the streams only the server sends on once the context is done,
+// as they last until their client cancels and would hold up the graceful stop. The streams
+// ended this way fail as unavailable so their clients resume on another instance.
+func EndServerStreams(ctx context.Context) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if info.IsClientStream {
+			return handler(server, stream)
+		}
+		streamCtx, cancel := context.WithCancelCause(stream.Context())
+		defer cancel(nil)
+		stop := context.AfterFunc(ctx, func() {
+			cancel(errShuttingDown)
+		})
+		defer stop()
+		err := handler(server, &contextServerStream{ServerStream: stream, ctx: streamCtx})
+		if errors.Is(context.Cause(streamCtx), errShuttingDown) {
+			return status.Error(codes.Unavailable, errShuttingDown.Error())
+		}
+		return err
+	}
+}
+
+// isHealthCheck tells whether the method belongs to the health service, whose probes
+// carry no correlation ID
+func isHealthCheck(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// SkipHealthChecks lets the health checks through without running the interceptor
+func SkipHealthChecks(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if isHealthCheck(info.FullMethod) {
+			return handler(ctx, request)
+		}
+		return interceptor(ctx, request, info, handler)
+	}
+}
+
+// SkipStreamHealthChecks is the streaming counterpart of SkipHealthChecks
+func SkipStreamHealthChecks(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if isHealthCheck(info.FullMethod) {
+			return handler(server, stream)
+		}
+		return interceptor(server, stream, info, handler)
+	}
+}
@@ -0,0 +1,77 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: server.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockServerer is a mock of Serverer interface.
+type MockServerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockServererMockRecorder
+}
+
+// MockServererMockRecorder is the mock recorder for MockServerer.
+type MockServererMockRecorder struct {
+	mock *MockServerer
+}
+
+// NewMockServerer creates a new mock instance.
+func NewMockServerer(ctrl *gomock.Controller) *MockServerer {
+	mock := &MockServerer{ctrl: ctrl}
+	mock.recorder = &MockServererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockServerer) EXPECT() *MockServererMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockServerer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockServererMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockServerer)(nil).Close))
+}
+
+// Serve mocks base method.
+func (m *MockServerer) Serve() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Serve")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Serve indicates an expected call of Serve.
+func (mr *MockServererMockRecorder) Serve() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Serve", reflect.TypeOf((*MockServerer)(nil).Serve))
+}
+
+// Shutdown mocks base method.
+func (m *MockServerer) Shutdown(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockServererMockRecorder) Shutdown(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockServerer)(nil).Shutdown), ctx)
+}
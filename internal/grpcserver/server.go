@@ -0,0 +1,78 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/quadev-ltd/qd-common/pkg/grpcserver"
+	"google.golang.org/grpc"
+)
+
+// Serverer is the interface for the gRPC server, which can also stop gracefully
+type Serverer interface {
+	grpcserver.GRPCServicer
+	Shutdown(ctx context.Context) error
+}
+
+// Server serves the gRPC services on a listener
+type Server struct {
+	grpcServer *grpc.Server
+	listener   net.Listener
+	// endStreams ends the server streams, see EndServerStreams
+	endStreams context.CancelFunc
+}
+
+var _ Serverer = &Server{}
+
+// NewServer creates a server of the gRPC services on the listener, calling endStreams to
+// end the server streams on shutdown
+func NewServer(grpcServer *grpc.Server, listener net.Listener, endStreams context.CancelFunc) *Server {
+	return &Server{
+		grpcServer: grpcServer,
+		listener:   listener,
+		endStreams: endStreams,
+	}
+}
+
+// Serve accepts connections until the server is closed or shut down
+func (server *Server) Serve() error {
+	return server.grpcServer.Serve(server.listener)
+}
+
+// Close closes the connections right away, cancelling the requests in flight
+func (server *Server) Close() error {
+	server.grpcServer.Stop()
+	return server.closeListener()
+}
+
+// Shutdown stops accepting connections, ends the server streams and waits for the other
+// requests in flight to finish. The remaining requests are cancelled once the context is done.
+func (server *Server) Shutdown(ctx context.Context) error {
+	if server.endStreams != nil {
+		server.endStreams()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return server.closeListener()
+	case <-ctx.Done():
+		server.grpcServer.Stop()
+		<-stopped
+		server.closeListener()
+		return fmt.Errorf("Requests in flight were cancelled: %v", ctx.Err())
+	}
+}
+
+// closeListener closes the listener, which the gRPC server only closes once served
+func (server *Server) closeListener() error {
+	if err := server.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check is a named readiness check of a dependency of the service
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Statuser is the interface for publishing the serving status of the gRPC services,
+// implemented by the standard health server of grpc-go
+type Statuser interface {
+	SetServingStatus(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus)
+}
+
+// Checkerer is the interface for running the readiness checks in the background
+type Checkerer interface {
+	Start()
+	Stop()
+}
+
+// Checker runs the readiness checks periodically and reports the services as not
+// serving while any of them fails
+type Checker struct {
+	statuser  Statuser
+	services  []string
+	checks    []Check
+	logger    log.Loggerer
+	interval  time.Duration
+	timeout   time.Duration
+	serving   bool
+	stop      chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+var _ Checkerer = &Checker{}
+
+// NewChecker creates a checker of the given services. The empty service name stands for
+// the overall health of the server.
+func NewChecker(
+	statuser Statuser,
+	services []string,
+	checks []Check,
+	logger log.Loggerer,
+	interval time.Duration,
+	timeout time.Duration,
+) *Checker {
+	return &Checker{
+		statuser: statuser,
+		services: services,
+		checks:   checks,
+		logger:   logger,
+		interval: interval,
+		timeout:  timeout,
+		serving:  true,
+	}
+}
+
+// Check runs every check once and updates the serving status of the services. It returns
+// the error of the first failing check.
+func (checker *Checker) Check(ctx context.Context) error {
+	var failure error
+	for _, check := range checker.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checker.timeout)
+		err := check.Run(checkCtx)
+		cancel()
+		if err != nil {
+			failure = fmt.Errorf("Check %s failed: %v", check.Name, err)
+			break
+		}
+	}
+
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	if failure != nil {
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range checker.services {
+		checker.statuser.SetServingStatus(service, servingStatus)
+	}
+	switch {
+	case failure != nil && checker.serving:
+		checker.logger.Warn(fmt.Sprintf("Not serving: %v", failure))
+	case failure == nil && !checker.serving:
+		checker.logger.Info("Serving again")
+	}
+	checker.serving = failure == nil
+	return failure
+}
+
+// Start runs the checks right away, so the status reflects the dependencies before the
+// first request, and then periodically in the background
+func (checker *Checker) Start() {
+	checker.Check(context.Background())
+	checker.stop = make(chan struct{})
+	checker.waitGroup.Add(1)
+	go func() {
+		defer checker.waitGroup.Done()
+		ticker := time.NewTicker(checker.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-checker.stop:
+				return
+			case <-ticker.C:
+				checker.Check(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops running the checks and reports the services as not serving, so the clients
+// move away before the server closes
+func (checker *Checker) Stop() {
+	if checker.stop == nil {
+		return
+	}
+	close(checker.stop)
+	checker.waitGroup.Wait()
+	checker.stop = nil
+	for _, service := range checker.services {
+		checker.statuser.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
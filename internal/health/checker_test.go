@@ -0,0 +1,141 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+	grpcHealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"qd-email-api/internal/health"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/service"
+	serviceMock "qd-email-api/internal/service/mock"
+)
+
+// lanes returns fixed lane stats
+type lanes map[model.Priority]model.LaneStats
+
+func (lanes lanes) Stats() map[model.Priority]model.LaneStats {
+	return lanes
+}
+
+// transporter returns a fixed SMTP transport
+type transporter service.Transport
+
+func (transport transporter) Transport() service.Transport {
+	return service.Transport(transport)
+}
+
+func TestChecker(test *testing.T) {
+	services := []string{"", "pb_email_api.EmailService"}
+	setup := func(test *testing.T, checks ...health.Check) (*health.Checker, *grpcHealth.Server, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		server := grpcHealth.NewServer()
+		return health.NewChecker(server, services, checks, loggerMock, time.Hour, time.Second), server, loggerMock, controller
+	}
+	servingStatus := func(server *grpcHealth.Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+		response, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(test, err)
+		return response.Status
+	}
+	failing := errors.New("dial tcp 127.0.0.1:25: connect: connection refused")
+
+	test.Run("Passing_Checks_Serve", func(test *testing.T) {
+		checker, server, _, controller := setup(test, health.Check{Name: "smtp", Run: func(ctx context.Context) error {
+			return nil
+		}})
+		defer controller.Finish()
+
+		assert.NoError(test, checker.Check(context.Background()))
+		for _, service := range services {
+			assert.Equal(test, healthpb.HealthCheckResponse_SERVING, servingStatus(server, service))
+		}
+	})
+
+	test.Run("Failing_Check_Stops_Serving_Until_It_Passes", func(test *testing.T) {
+		result := failing
+		checker, server, loggerMock, controller := setup(test, health.Check{Name: "smtp", Run: func(ctx context.Context) error {
+			return result
+		}})
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Not serving: Check smtp failed: " + failing.Error()).Times(1)
+		assert.EqualError(test, checker.Check(context.Background()), "Check smtp failed: "+failing.Error())
+		assert.Error(test, checker.Check(context.Background()))
+		for _, service := range services {
+			assert.Equal(test, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(server, service))
+		}
+
+		result = nil
+		loggerMock.EXPECT().Info("Serving again").Times(1)
+		assert.NoError(test, checker.Check(context.Background()))
+		assert.Equal(test, healthpb.HealthCheckResponse_SERVING, servingStatus(server, ""))
+	})
+
+	test.Run("Check_Times_Out", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		checker := health.NewChecker(grpcHealth.NewServer(), services, []health.Check{{Name: "smtp", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}}, loggerMock, time.Hour, time.Millisecond)
+
+		loggerMock.EXPECT().Warn("Not serving: Check smtp failed: context deadline exceeded").Times(1)
+		assert.Error(test, checker.Check(context.Background()))
+	})
+
+	test.Run("Stop_Stops_Serving", func(test *testing.T) {
+		checker, server, _, controller := setup(test)
+		defer controller.Finish()
+
+		checker.Start()
+		assert.Equal(test, healthpb.HealthCheckResponse_SERVING, servingStatus(server, ""))
+		checker.Stop()
+
+		for _, service := range services {
+			assert.Equal(test, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(server, service))
+		}
+	})
+
+	test.Run("Queue_Check", func(test *testing.T) {
+		queueLanes := lanes{
+			model.PriorityCritical:      {Depth: 0, Capacity: 10},
+			model.PriorityTransactional: {Depth: 0, Capacity: 0},
+			model.PriorityBulk:          {Depth: 9, Capacity: 10},
+		}
+		check := health.NewQueueCheck(queueLanes)
+
+		assert.Equal(test, "queue", check.Name)
+		assert.NoError(test, check.Run(context.Background()))
+		queueLanes[model.PriorityBulk] = model.LaneStats{Depth: 10, Capacity: 10}
+		assert.EqualError(test, check.Run(context.Background()), "Lane bulk queue is full")
+	})
+
+	test.Run("Relay_Check", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+		senderMock := serviceMock.NewMockSmtpServicer(controller)
+		auth := smtp.PlainAuth("", "username", "password", "smtp.test.com")
+		check := health.NewRelayCheck(senderMock, transporter{
+			Host:     "smtp.test.com",
+			Port:     "587",
+			Username: "username",
+			Password: "password",
+		})
+
+		senderMock.EXPECT().PlainAuth("", "username", "password", "smtp.test.com").Return(auth)
+		senderMock.EXPECT().Verify(gomock.Any(), "smtp.test.com:587", auth).Return(failing)
+
+		assert.Equal(test, "smtp", check.Name)
+		assert.Equal(test, failing, check.Run(context.Background()))
+	})
+}
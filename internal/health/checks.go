@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/service"
+)
+
+// LaneStatser is the interface for reading the activity of the sending lanes
+type LaneStatser interface {
+	Stats() map[model.Priority]model.LaneStats
+}
+
+// Transporter is the interface for reading the SMTP transport the emails are sent through
+type Transporter interface {
+	Transport() service.Transport
+}
+
+// NewRelayCheck creates a check connecting and authenticating to the current SMTP relay
+// without sending any email
+func NewRelayCheck(sender service.SMTPServicer, transporter Transporter) Check {
+	return Check{
+		Name: "smtp",
+		Run: func(ctx context.Context) error {
+			transport := transporter.Transport()
+			return sender.Verify(
+				ctx,
+				net.JoinHostPort(transport.Host, transport.Port),
+				sender.PlainAuth("", transport.Username, transport.Password, transport.Host),
+			)
+		},
+	}
+}
+
+// NewQueueCheck creates a check failing while the queue of any sending lane is full, as
+// the new emails would wait for room in the queue
+func NewQueueCheck(lanes LaneStatser) Check {
+	return Check{
+		Name: "queue",
+		Run: func(ctx context.Context) error {
+			laneStats := lanes.Stats()
+			for _, priority := range model.Priorities {
+				stats := laneStats[priority]
+				if stats.Capacity > 0 && stats.Depth >= stats.Capacity {
+					return fmt.Errorf("Lane %s queue is full", priority)
+				}
+			}
+			return nil
+		},
+	}
+}
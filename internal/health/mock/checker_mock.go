@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: checker.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	grpc_health_v1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// MockStatuser is a mock of Statuser interface.
+type MockStatuser struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatuserMockRecorder
+}
+
+// MockStatuserMockRecorder is the mock recorder for MockStatuser.
+type MockStatuserMockRecorder struct {
+	mock *MockStatuser
+}
+
+// NewMockStatuser creates a new mock instance.
+func NewMockStatuser(ctrl *gomock.Controller) *MockStatuser {
+	mock := &MockStatuser{ctrl: ctrl}
+	mock.recorder = &MockStatuserMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatuser) EXPECT() *MockStatuserMockRecorder {
+	return m.recorder
+}
+
+// SetServingStatus mocks base method.
+func (m *MockStatuser) SetServingStatus(service string, servingStatus grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetServingStatus", service, servingStatus)
+}
+
+// SetServingStatus indicates an expected call of SetServingStatus.
+func (mr *MockStatuserMockRecorder) SetServingStatus(service, servingStatus interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetServingStatus", reflect.TypeOf((*MockStatuser)(nil).SetServingStatus), service, servingStatus)
+}
+
+// MockCheckerer is a mock of Checkerer interface.
+type MockCheckerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockCheckererMockRecorder
+}
+
+// MockCheckererMockRecorder is the mock recorder for MockCheckerer.
+type MockCheckererMockRecorder struct {
+	mock *MockCheckerer
+}
+
+// NewMockCheckerer creates a new mock instance.
+func NewMockCheckerer(ctrl *gomock.Controller) *MockCheckerer {
+	mock := &MockCheckerer{ctrl: ctrl}
+	mock.recorder = &MockCheckererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCheckerer) EXPECT() *MockCheckererMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method.
+func (m *MockCheckerer) Start() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Start")
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockCheckererMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockCheckerer)(nil).Start))
+}
+
+// Stop mocks base method.
+func (m *MockCheckerer) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockCheckererMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockCheckerer)(nil).Stop))
+}
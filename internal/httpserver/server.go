@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readHeaderTimeout stops the clients that never finish sending their request headers
+const readHeaderTimeout = 10 * time.Second
+
+// Serverer is the interface of the HTTP server of the links in the emails
+type Serverer interface {
+	Serve() error
+	Close() error
+}
+
+// Server serves the endpoints the links in the emails point to
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+var _ Serverer = &Server{}
+
+// NewServer creates an HTTP server listening on the given address
+func NewServer(address string, handler http.Handler) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Error listening for HTTP requests: %v", err)
+	}
+	return &Server{
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		listener: listener,
+	}, nil
+}
+
+// Serve accepts connections until the server is closed
+func (server *Server) Serve() error {
+	err := server.httpServer.Serve(server.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops accepting connections and closes the open ones
+func (server *Server) Close() error {
+	if err := server.httpServer.Close(); err != nil {
+		return err
+	}
+	// The listener is only closed by the HTTP server once it is served
+	if err := server.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (server *Server) Addr() net.Addr {
+	return server.listener.Addr()
+}
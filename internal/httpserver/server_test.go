@@ -0,0 +1,46 @@
+package httpserver_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/httpserver"
+)
+
+func TestServer(test *testing.T) {
+	test.Run("Serve_Close", func(test *testing.T) {
+		server, err := httpserver.NewServer("127.0.0.1:0", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			io.WriteString(writer, "Hello")
+		}))
+		assert.NoError(test, err)
+		served := make(chan error)
+		go func() {
+			served <- server.Serve()
+		}()
+
+		response, err := http.Get("http://" + server.Addr().String() + "/")
+		assert.NoError(test, err)
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		assert.Equal(test, "Hello", string(body))
+
+		assert.NoError(test, server.Close())
+		assert.NoError(test, <-served)
+	})
+
+	test.Run("Close_Before_Serve", func(test *testing.T) {
+		server, err := httpserver.NewServer("127.0.0.1:0", http.NotFoundHandler())
+		assert.NoError(test, err)
+
+		assert.NoError(test, server.Close())
+	})
+
+	test.Run("Listen_Error", func(test *testing.T) {
+		_, err := httpserver.NewServer("invalid address", http.NotFoundHandler())
+
+		assert.ErrorContains(test, err, "Error listening for HTTP requests")
+	})
+}
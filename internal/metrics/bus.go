@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+)
+
+// Bus counts the retries and the bounces among the status changes published to an event bus
+type Bus struct {
+	event.Buser
+	metrics *Metrics
+}
+
+var _ event.Buser = &Bus{}
+
+// NewBus creates an event bus counting the status changes published to the given one
+func NewBus(bus event.Buser, metrics *Metrics) *Bus {
+	return &Bus{
+		Buser:   bus,
+		metrics: metrics,
+	}
+}
+
+// Publish counts the status change and publishes it
+func (bus *Bus) Publish(message *model.Message, change model.StatusChange) {
+	switch change.Status {
+	case model.StatusDeferred:
+		bus.metrics.retries.WithLabelValues(string(message.Priority)).Inc()
+	case model.StatusBounced:
+		bus.metrics.bounces.WithLabelValues(Provider(message.To)).Inc()
+	}
+	bus.Buser.Publish(message, change)
+}
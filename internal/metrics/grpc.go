@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"qd-email-api/internal/clock"
+)
+
+// UnaryServerInterceptor counts the unary gRPC requests and observes their duration
+func (metrics *Metrics) UnaryServerInterceptor(clock clock.Clocker) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := clock.Now()
+		response, err := handler(ctx, request)
+		metrics.observeRequest(info.FullMethod, clock.Now().Sub(start).Seconds(), err)
+		return response, err
+	}
+}
+
+// StreamServerInterceptor counts the streaming gRPC requests and observes their duration
+func (metrics *Metrics) StreamServerInterceptor(clock clock.Clocker) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := clock.Now()
+		err := handler(server, stream)
+		metrics.observeRequest(info.FullMethod, clock.Now().Sub(start).Seconds(), err)
+		return err
+	}
+}
+
+func (metrics *Metrics) observeRequest(method string, seconds float64, err error) {
+	metrics.grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	metrics.grpcDuration.WithLabelValues(method).Observe(seconds)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"qd-email-api/internal/model"
+)
+
+// LaneStatser is the interface for reading the activity of the sending lanes
+type LaneStatser interface {
+	Stats() map[model.Priority]model.LaneStats
+}
+
+// LaneCollector reports the queues of the sending lanes when the metrics are gathered
+type LaneCollector struct {
+	lanes    LaneStatser
+	depth    *prometheus.Desc
+	inFlight *prometheus.Desc
+	wait     *prometheus.Desc
+	maxWait  *prometheus.Desc
+}
+
+var _ prometheus.Collector = &LaneCollector{}
+
+// NewLaneCollector creates a collector of the given lanes
+func NewLaneCollector(lanes LaneStatser) *LaneCollector {
+	labels := []string{"priority"}
+	return &LaneCollector{
+		lanes: lanes,
+		depth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "depth"),
+			"Emails waiting in the queue of the sending lane.",
+			labels, nil,
+		),
+		inFlight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "in_flight"),
+			"Emails of the sending lane being delivered.",
+			labels, nil,
+		),
+		wait: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "wait_seconds"),
+			"Time the emails waited in the queue of the sending lane.",
+			labels, nil,
+		),
+		maxWait: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "queue", "max_wait_seconds"),
+			"Longest time an email waited in the queue of the sending lane.",
+			labels, nil,
+		),
+	}
+}
+
+// Describe sends the descriptions of the lane metrics
+func (collector *LaneCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- collector.depth
+	descriptions <- collector.inFlight
+	descriptions <- collector.wait
+	descriptions <- collector.maxWait
+}
+
+// Collect sends the current activity of every lane
+func (collector *LaneCollector) Collect(metrics chan<- prometheus.Metric) {
+	for priority, stats := range collector.lanes.Stats() {
+		label := string(priority)
+		metrics <- prometheus.MustNewConstMetric(collector.depth, prometheus.GaugeValue, float64(stats.Depth), label)
+		metrics <- prometheus.MustNewConstMetric(collector.inFlight, prometheus.GaugeValue, float64(stats.InFlight), label)
+		metrics <- prometheus.MustNewConstSummary(collector.wait, stats.Dequeued, stats.TotalWait.Seconds(), nil, label)
+		metrics <- prometheus.MustNewConstMetric(collector.maxWait, prometheus.GaugeValue, stats.MaxWait.Seconds(), label)
+	}
+}
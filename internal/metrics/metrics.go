@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Path is the path of the metrics endpoint on the HTTP server
+const Path = "/metrics"
+
+// namespace prefixes the name of every metric of the service
+const namespace = "email"
+
+// providers maps the domains of the largest mailbox providers to their name, so the
+// metrics per provider keep a bounded number of series
+var providers = map[string]string{
+	"gmail.com":      "google",
+	"googlemail.com": "google",
+	"outlook.com":    "microsoft",
+	"hotmail.com":    "microsoft",
+	"live.com":       "microsoft",
+	"msn.com":        "microsoft",
+	"yahoo.com":      "yahoo",
+	"ymail.com":      "yahoo",
+	"aol.com":        "yahoo",
+	"icloud.com":     "apple",
+	"me.com":         "apple",
+	"mac.com":        "apple",
+}
+
+// Metrics holds the collectors of the email pipeline. The collectors are registered in
+// the registry given to NewMetrics rather than in the global one, so every test can
+// gather its own.
+type Metrics struct {
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+	rateLimited  *prometheus.CounterVec
+	smtpDuration *prometheus.HistogramVec
+	smtpReplies  *prometheus.CounterVec
+	retries      *prometheus.CounterVec
+	bounces      *prometheus.CounterVec
+}
+
+// NewMetrics creates the collectors of the email pipeline and registers them
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	metrics := &Metrics{
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "gRPC requests handled by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Duration of the gRPC requests by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected by the rate limits by scope.",
+		}, []string{"scope"}),
+		smtpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "smtp_send_duration_seconds",
+			Help:      "Duration of the deliveries to the SMTP relay by recipient provider.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"provider"}),
+		smtpReplies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "smtp_replies_total",
+			Help:      "Replies of the SMTP relay by recipient provider and reply class: 2xx, 4xx, 5xx or error when no reply was received.",
+		}, []string{"provider", "class"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Deliveries deferred to be retried by priority.",
+		}, []string{"priority"}),
+		bounces: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bounces_total",
+			Help:      "Emails reported as undeliverable by recipient provider.",
+		}, []string{"provider"}),
+	}
+	for _, collector := range []prometheus.Collector{
+		metrics.grpcRequests,
+		metrics.grpcDuration,
+		metrics.rateLimited,
+		metrics.smtpDuration,
+		metrics.smtpReplies,
+		metrics.retries,
+		metrics.bounces,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+// Provider returns the mailbox provider of an address, or other for the domains
+// outside of the largest providers
+func Provider(address string) string {
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	if provider, exists := providers[domain]; exists {
+		return provider
+	}
+	return "other"
+}
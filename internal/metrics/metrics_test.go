@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/ratelimit"
+	"qd-email-api/internal/service/mock"
+)
+
+type fakeLanes map[model.Priority]model.LaneStats
+
+func (lanes fakeLanes) Stats() map[model.Priority]model.LaneStats {
+	return lanes
+}
+
+func TestMetrics(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*Metrics, *prometheus.Registry) {
+		registry := prometheus.NewRegistry()
+		metrics, err := NewMetrics(registry)
+		assert.NoError(test, err)
+		return metrics, registry
+	}
+
+	test.Run("Registered_Once_Per_Registry", func(test *testing.T) {
+		registry := prometheus.NewRegistry()
+		_, err := NewMetrics(registry)
+		assert.NoError(test, err)
+
+		_, err = NewMetrics(registry)
+		assert.Error(test, err)
+	})
+
+	test.Run("GRPC_Requests_By_Method_And_Code", func(test *testing.T) {
+		metrics, _ := setup(test)
+		interceptor := metrics.UnaryServerInterceptor(clock.NewFakeClock(now))
+		info := &grpc.UnaryServerInfo{FullMethod: "/pb_email_api.EmailService/SendEmail"}
+
+		interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid email")
+		})
+		streamInterceptor := metrics.StreamServerInterceptor(clock.NewFakeClock(now))
+		streamInterceptor(nil, nil, &grpc.StreamServerInfo{FullMethod: "/pb_email_api.EmailService/StreamEvents"}, func(interface{}, grpc.ServerStream) error {
+			return nil
+		})
+
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.grpcRequests.WithLabelValues("/pb_email_api.EmailService/SendEmail", "OK")))
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.grpcRequests.WithLabelValues("/pb_email_api.EmailService/SendEmail", "InvalidArgument")))
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.grpcRequests.WithLabelValues("/pb_email_api.EmailService/StreamEvents", "OK")))
+		assert.Equal(test, 2, testutil.CollectAndCount(metrics.grpcDuration))
+	})
+
+	test.Run("Rate_Limit_Rejections_By_Scope", func(test *testing.T) {
+		metrics, _ := setup(test)
+		limiter := NewRateLimiter(ratelimit.NewLimiter(clock.NewFakeClock(now), ratelimit.Limits{
+			Recipient: ratelimit.Limit{Rate: 1, Burst: 1},
+		}), metrics)
+
+		assert.NoError(test, limiter.Allow("", "user@example.com"))
+		assert.Error(test, limiter.Allow("", "user@example.com"))
+
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.rateLimited.WithLabelValues("recipient")))
+	})
+
+	test.Run("SMTP_Latency_And_Replies_By_Provider", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+		metrics, _ := setup(test)
+		senderMock := mock.NewMockSmtpServicer(controller)
+		smtpService := NewSMTPService(senderMock, metrics, clock.NewFakeClock(now))
+
+		senderMock.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), []string{"user@gmail.com"}, gomock.Any()).Return(nil)
+		senderMock.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), []string{"user@Hotmail.com"}, gomock.Any()).Return(&textproto.Error{Code: 451, Msg: "Try again later"})
+		senderMock.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), []string{"user@example.com"}, gomock.Any()).Return(errors.New("Connection refused"))
+
+		assert.NoError(test, smtpService.SendMail(context.Background(), "localhost:25", nil, "noreply@test.com", []string{"user@gmail.com"}, nil))
+		assert.Error(test, smtpService.SendMail(context.Background(), "localhost:25", nil, "noreply@test.com", []string{"user@Hotmail.com"}, nil))
+		assert.Error(test, smtpService.SendMail(context.Background(), "localhost:25", nil, "noreply@test.com", []string{"user@example.com"}, nil))
+
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.smtpReplies.WithLabelValues("google", "2xx")))
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.smtpReplies.WithLabelValues("microsoft", "4xx")))
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.smtpReplies.WithLabelValues("other", "error")))
+		assert.Equal(test, 3, testutil.CollectAndCount(metrics.smtpDuration))
+	})
+
+	test.Run("Retries_And_Bounces_From_Events", func(test *testing.T) {
+		metrics, _ := setup(test)
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		subscription, _ := eventBus.Subscribe("")
+		bus := NewBus(eventBus, metrics)
+		message := &model.Message{ID: "1", To: "user@yahoo.com", Priority: model.PriorityBulk}
+
+		bus.Publish(message, model.StatusChange{Status: model.StatusDeferred, Time: now})
+		bus.Publish(message, model.StatusChange{Status: model.StatusDeferred, Time: now})
+		bus.Publish(message, model.StatusChange{Status: model.StatusBounced, Time: now})
+
+		assert.Equal(test, 2.0, testutil.ToFloat64(metrics.retries.WithLabelValues("bulk")))
+		assert.Equal(test, 1.0, testutil.ToFloat64(metrics.bounces.WithLabelValues("yahoo")))
+		assert.Len(test, subscription.Events(), 3)
+	})
+
+	test.Run("Queue_Depth_And_Wait", func(test *testing.T) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(NewLaneCollector(fakeLanes{
+			model.PriorityBulk: {Depth: 3, InFlight: 1, MaxWait: 2 * time.Second, Dequeued: 4, TotalWait: 5 * time.Second},
+		}))
+
+		assert.NoError(test, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP email_queue_depth Emails waiting in the queue of the sending lane.
+# TYPE email_queue_depth gauge
+email_queue_depth{priority="bulk"} 3
+# HELP email_queue_max_wait_seconds Longest time an email waited in the queue of the sending lane.
+# TYPE email_queue_max_wait_seconds gauge
+email_queue_max_wait_seconds{priority="bulk"} 2
+# HELP email_queue_wait_seconds Time the emails waited in the queue of the sending lane.
+# TYPE email_queue_wait_seconds summary
+email_queue_wait_seconds_sum{priority="bulk"} 5
+email_queue_wait_seconds_count{priority="bulk"} 4
+`), "email_queue_depth", "email_queue_max_wait_seconds", "email_queue_wait_seconds"))
+	})
+}
+
+func TestProvider(test *testing.T) {
+	assert.Equal(test, "google", Provider("user@GMAIL.com"))
+	assert.Equal(test, "apple", Provider("user@icloud.com"))
+	assert.Equal(test, "other", Provider("user@quadev.net"))
+	assert.Equal(test, "other", Provider("invalid"))
+}
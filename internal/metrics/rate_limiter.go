@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"errors"
+
+	"qd-email-api/internal/ratelimit"
+)
+
+// RateLimiter counts the requests rejected by a rate limiter
+type RateLimiter struct {
+	limiter ratelimit.Limiterer
+	metrics *Metrics
+}
+
+var _ ratelimit.Limiterer = &RateLimiter{}
+
+// NewRateLimiter creates a rate limiter counting the rejections of the given one
+func NewRateLimiter(limiter ratelimit.Limiterer, metrics *Metrics) *RateLimiter {
+	return &RateLimiter{
+		limiter: limiter,
+		metrics: metrics,
+	}
+}
+
+// Allow checks the request with the rate limiter and counts it when it is rejected
+func (limiter *RateLimiter) Allow(client, recipient string) error {
+	return limiter.count(limiter.limiter.Allow(client, recipient))
+}
+
+// AllowRecipient checks the recipient with the rate limiter and counts it when it is rejected
+func (limiter *RateLimiter) AllowRecipient(recipient string) error {
+	return limiter.count(limiter.limiter.AllowRecipient(recipient))
+}
+
+func (limiter *RateLimiter) count(err error) error {
+	var limitExceeded *ratelimit.LimitExceededError
+	if errors.As(err, &limitExceeded) {
+		limiter.metrics.rateLimited.WithLabelValues(string(limitExceeded.Scope)).Inc()
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/service"
+)
+
+// SMTPService observes the latency and the replies of the deliveries to the SMTP relay
+type SMTPService struct {
+	sender  service.SMTPServicer
+	metrics *Metrics
+	clock   clock.Clocker
+}
+
+var _ service.SMTPServicer = &SMTPService{}
+
+// NewSMTPService creates an SMTP service observing the deliveries of the given one
+func NewSMTPService(sender service.SMTPServicer, metrics *Metrics, clock clock.Clocker) *SMTPService {
+	return &SMTPService{
+		sender:  sender,
+		metrics: metrics,
+		clock:   clock,
+	}
+}
+
+// SendMail sends an email, observing its latency and the class of the reply per provider
+// of its first recipient
+func (smtpService *SMTPService) SendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	start := smtpService.clock.Now()
+	err := smtpService.sender.SendMail(ctx, addr, a, from, to, msg)
+	provider := "other"
+	if len(to) > 0 {
+		provider = Provider(to[0])
+	}
+	smtpService.metrics.smtpDuration.WithLabelValues(provider).Observe(smtpService.clock.Now().Sub(start).Seconds())
+	smtpService.metrics.smtpReplies.WithLabelValues(provider, replyClass(err)).Inc()
+	return err
+}
+
+// Verify checks the relay without observing it, as no email is delivered
+func (smtpService *SMTPService) Verify(ctx context.Context, addr string, a smtp.Auth) error {
+	return smtpService.sender.Verify(ctx, addr, a)
+}
+
+// PlainAuth returns an Auth that implements the PLAIN authentication mechanism
+func (smtpService *SMTPService) PlainAuth(identity, username, password, host string) smtp.Auth {
+	return smtpService.sender.PlainAuth(identity, username, password, host)
+}
+
+// replyClass returns the class of the SMTP reply of a delivery, or error when the
+// relay did not reply
+func replyClass(err error) string {
+	if err == nil {
+		return "2xx"
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 200 && reply.Code < 600 {
+		return fmt.Sprintf("%dxx", reply.Code/100)
+	}
+	return "error"
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// LaneStats is a snapshot of the activity of a sending lane
+type LaneStats struct {
+	Depth int
+	// Capacity is the number of emails the queue holds before the senders wait
+	Capacity int
+	InFlight int64
+	Sent     uint64
+	Failed   uint64
+	MaxWait  time.Duration
+	// Dequeued is the number of emails that left the queue and TotalWait the time they waited
+	Dequeued  uint64
+	TotalWait time.Duration
+}
@@ -0,0 +1,146 @@
+package model
+
+import "time"
+
+// Status is the lifecycle state of a message
+type Status string
+
+const (
+	// StatusAccepted is a message that passed validation and was stored
+	StatusAccepted Status = "accepted"
+	// StatusScheduled is a message waiting for its send time
+	StatusScheduled Status = "scheduled"
+	// StatusQueued is a message waiting in its sending lane for a worker
+	StatusQueued Status = "queued"
+	// StatusSending is a message claimed for delivery
+	StatusSending Status = "sending"
+	// StatusSent is a message accepted by the SMTP relay
+	StatusSent Status = "sent"
+	// StatusDelivered is a sent message the recipient server reported as delivered
+	StatusDelivered Status = "delivered"
+	// StatusDeferred is a message temporarily rejected that waits to be retried
+	StatusDeferred Status = "deferred"
+	// StatusBounced is a message the recipient server reported as undeliverable
+	StatusBounced Status = "bounced"
+	// StatusComplained is a delivered message the recipient reported as spam
+	StatusComplained Status = "complained"
+	// StatusUnsubscribed is a message whose recipient unsubscribed from its category
+	StatusUnsubscribed Status = "unsubscribed"
+	// StatusFailed is a message that could not be delivered
+	StatusFailed Status = "failed"
+	// StatusCancelled is a message cancelled before being sent
+	StatusCancelled Status = "cancelled"
+	// StatusOpened is only published as an event when the recipient opens a tracked
+	// message, which keeps its status
+	StatusOpened Status = "opened"
+	// StatusClicked is only published as an event when the recipient clicks a link of a
+	// tracked message, which keeps its status
+	StatusClicked Status = "clicked"
+)
+
+// StatusChange is a step in the lifecycle of a message
+type StatusChange struct {
+	Status   Status    `json:"status"`
+	Time     time.Time `json:"time"`
+	Response string    `json:"response,omitempty"`
+}
+
+// Priority is the sending lane of a message
+type Priority string
+
+const (
+	// PriorityCritical is for messages that must never wait, such as password resets
+	PriorityCritical Priority = "critical"
+	// PriorityTransactional is for messages triggered by a user action
+	PriorityTransactional Priority = "transactional"
+	// PriorityBulk is for messages sent to many recipients, such as newsletters
+	PriorityBulk Priority = "bulk"
+)
+
+// Priorities lists the priorities from the highest to the lowest
+var Priorities = []Priority{PriorityCritical, PriorityTransactional, PriorityBulk}
+
+// Message is an email handled by the service
+type Message struct {
+	ID                string         `json:"id"`
+	To                string         `json:"to"`
+	Subject           string         `json:"subject"`
+	Body              string         `json:"body"`
+	SendAt            time.Time      `json:"send_at"`
+	Priority          Priority       `json:"priority"`
+	Category          string         `json:"category,omitempty"`
+	IgnoreSuppression bool           `json:"ignore_suppression,omitempty"`
+	TrackOpens        bool           `json:"track_opens,omitempty"`
+	Opens             *Opens         `json:"opens,omitempty"`
+	TrackClicks       bool           `json:"track_clicks,omitempty"`
+	Clicks            *Clicks        `json:"clicks,omitempty"`
+	Status            Status         `json:"status"`
+	Deferrals         int            `json:"deferrals"`
+	History           []StatusChange `json:"history"`
+	CorrelationID     string         `json:"correlation_id"`
+	ClientID          string         `json:"client_id,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// Record moves the message to the status of the change and adds it to its history
+func (message *Message) Record(change StatusChange) {
+	message.Status = change.Status
+	message.UpdatedAt = change.Time
+	message.History = append(message.History, change)
+}
+
+// UserAgentClass is the kind of client that fetched a tracked resource
+type UserAgentClass string
+
+const (
+	// UserAgentDesktop is a desktop mail client or browser
+	UserAgentDesktop UserAgentClass = "desktop"
+	// UserAgentMobile is a mobile mail client or browser
+	UserAgentMobile UserAgentClass = "mobile"
+	// UserAgentProxy is a mailbox provider fetching the images on behalf of the recipient
+	UserAgentProxy UserAgentClass = "proxy"
+	// UserAgentBot is an automated client, such as a link scanner
+	UserAgentBot UserAgentClass = "bot"
+	// UserAgentUnknown is a client that could not be classified
+	UserAgentUnknown UserAgentClass = "unknown"
+)
+
+// Opens sums up the opens of a tracked message
+type Opens struct {
+	Count         int       `json:"count"`
+	FirstOpenedAt time.Time `json:"first_opened_at"`
+	LastOpenedAt  time.Time `json:"last_opened_at"`
+	// UserAgent is the class of the client of the first open
+	UserAgent UserAgentClass `json:"user_agent"`
+}
+
+// RecordOpen counts an open of the message by a client of the user agent class
+func (message *Message) RecordOpen(time time.Time, userAgent UserAgentClass) {
+	if message.Opens == nil {
+		message.Opens = &Opens{FirstOpenedAt: time, UserAgent: userAgent}
+	}
+	message.Opens.Count++
+	message.Opens.LastOpenedAt = time
+}
+
+// Clicks sums up the clicks on the links of a tracked message
+type Clicks struct {
+	Count          int       `json:"count"`
+	FirstClickedAt time.Time `json:"first_clicked_at"`
+	LastClickedAt  time.Time `json:"last_clicked_at"`
+	// UserAgent is the class of the client of the first click
+	UserAgent UserAgentClass `json:"user_agent"`
+	// Links counts the clicks per link target
+	Links map[string]int `json:"links"`
+}
+
+// RecordClick counts a click on the link to the URL by a client of the user agent class
+func (message *Message) RecordClick(time time.Time, url string, userAgent UserAgentClass) {
+	if message.Clicks == nil {
+		message.Clicks = &Clicks{FirstClickedAt: time, UserAgent: userAgent, Links: make(map[string]int)}
+	}
+	message.Clicks.Count++
+	message.Clicks.LastClickedAt = time
+	message.Clicks.Links[url]++
+}
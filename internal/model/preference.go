@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Preference is whether a recipient receives the emails of a category. Recipients receive
+// the emails of every category they have no preference for.
+type Preference struct {
+	Address    string    `json:"address"`
+	Category   string    `json:"category"`
+	Subscribed bool      `json:"subscribed"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
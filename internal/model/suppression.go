@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// SuppressionReason is why the emails to an address are stopped
+type SuppressionReason string
+
+const (
+	// SuppressionHardBounce is an address the recipient server reported as permanently undeliverable
+	SuppressionHardBounce SuppressionReason = "hard_bounce"
+	// SuppressionComplaint is an address whose owner reported an email as spam
+	SuppressionComplaint SuppressionReason = "complaint"
+	// SuppressionManual is an address suppressed by an administrator
+	SuppressionManual SuppressionReason = "manual"
+	// SuppressionUnsubscribe is an address whose owner unsubscribed from the emails they can opt out of
+	SuppressionUnsubscribe SuppressionReason = "unsubscribe"
+)
+
+// Suppression is an address no email is sent to
+type Suppression struct {
+	Address     string            `json:"address"`
+	Reason      SuppressionReason `json:"reason"`
+	Description string            `json:"description,omitempty"`
+	MessageID   string            `json:"message_id,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Blocks reports whether the suppression stops an email of the given priority, whose category
+// the recipient can unsubscribe from or not. Complaints do not stop the critical emails, such
+// as password resets, as the recipient still needs them, and unsubscribes only stop the emails
+// the recipient can unsubscribe from.
+func (suppression *Suppression) Blocks(priority Priority, unsubscribable bool) bool {
+	switch suppression.Reason {
+	case SuppressionComplaint:
+		return priority != PriorityCritical
+	case SuppressionUnsubscribe:
+		return unsubscribable
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/clock"
+)
+
+// checkInterval is how often the files are checked for a rotation, at most once per handshake
+const checkInterval = time.Second
+
+// Config is the configuration of the certificates of the server
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// CAFile holds the certificate of the authority signing the client certificates
+	CAFile string
+	// ClientAuth verifies the certificates of the clients against the CA
+	ClientAuth bool
+}
+
+// CertificateStorer is the interface for reading the TLS configuration of the server
+type CertificateStorer interface {
+	ServerConfig() *tls.Config
+}
+
+// fileVersion tells whether a file changed
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// CertificateStore serves the certificate of the server and the CA of the clients, loading
+// them again when their files rotate. The previous ones are served while the new files fail
+// to load, such as while they are being written.
+type CertificateStore struct {
+	config      Config
+	clock       clock.Clocker
+	logger      log.Loggerer
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	versions    []fileVersion
+	lastCheck   time.Time
+}
+
+var _ CertificateStorer = &CertificateStore{}
+
+// NewCertificateStore creates a new certificate store loading the files of the configuration
+func NewCertificateStore(config Config, clock clock.Clocker, logger log.Loggerer) (*CertificateStore, error) {
+	store := &CertificateStore{
+		config:    config,
+		clock:     clock,
+		logger:    logger,
+		lastCheck: clock.Now(),
+	}
+	versions, err := store.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.load(versions); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// ServerConfig returns the TLS configuration of the server, which picks the current
+// certificates for every connection
+func (store *CertificateStore) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return store.current(), nil
+		},
+	}
+}
+
+func (store *CertificateStore) current() *tls.Config {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.refresh()
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*store.certificate},
+		NextProtos:   []string{"h2"},
+	}
+	if store.config.ClientAuth {
+		// The clients without a certificate still reach the health checks, while the
+		// interceptors reject their other requests
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = store.clientCAs
+	}
+	return config
+}
+
+// refresh loads the files again when they changed since the last check
+func (store *CertificateStore) refresh() {
+	now := store.clock.Now()
+	if now.Sub(store.lastCheck) < checkInterval {
+		return
+	}
+	store.lastCheck = now
+	versions, err := store.stat()
+	if err != nil {
+		store.logger.Error(err, "Failed to check the certificates")
+		return
+	}
+	if slices.Equal(versions, store.versions) {
+		return
+	}
+	if err := store.load(versions); err != nil {
+		store.logger.Error(err, "Failed to reload the certificates")
+		return
+	}
+	store.logger.Info("Certificates reloaded")
+}
+
+func (store *CertificateStore) files() []string {
+	files := []string{store.config.CertFile, store.config.KeyFile}
+	if store.config.ClientAuth {
+		files = append(files, store.config.CAFile)
+	}
+	return files
+}
+
+func (store *CertificateStore) stat() ([]fileVersion, error) {
+	versions := []fileVersion{}
+	for _, file := range store.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %v", file, err)
+		}
+		versions = append(versions, fileVersion{modTime: info.ModTime(), size: info.Size()})
+	}
+	return versions, nil
+}
+
+// load replaces the certificates with the ones of the files, unless any of them fails to load
+func (store *CertificateStore) load(versions []fileVersion) error {
+	certificate, err := tls.LoadX509KeyPair(store.config.CertFile, store.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("Error loading the server key pair: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if store.config.ClientAuth {
+		ca, err := os.ReadFile(store.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("Error reading the CA certificate: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("No CA certificate found in %s", store.config.CAFile)
+		}
+	}
+	store.certificate = &certificate
+	store.clientCAs = clientCAs
+	store.versions = versions
+	return nil
+}
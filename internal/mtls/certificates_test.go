@@ -0,0 +1,154 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+)
+
+// testCertificate is a certificate and its key, signed by a parent or by itself
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	der         []byte
+}
+
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate, dnsNames ...string) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCertificate{certificate: certificate, key: key, der: der}
+}
+
+// write writes the certificate and its key as PEM files, dated at the given time
+func (certificate *testCertificate) write(t *testing.T, certFile, keyFile string, modTime time.Time) {
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func TestCertificateStore(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	ca := newTestCertificate(t, "qd-test-ca", nil)
+
+	// setupStore writes the certificates of the server and the CA and loads them
+	setupStore := func(t *testing.T, clientAuth bool) (*CertificateStore, Config, *clock.FakeClock, *loggerMock.MockLoggerer) {
+		controller := gomock.NewController(t)
+		logger := loggerMock.NewMockLoggerer(controller)
+		directory := t.TempDir()
+		config := Config{
+			CertFile:   filepath.Join(directory, "server.crt"),
+			KeyFile:    filepath.Join(directory, "server.key"),
+			CAFile:     filepath.Join(directory, "ca.pem"),
+			ClientAuth: clientAuth,
+		}
+		newTestCertificate(t, "qd.email.api", ca, "localhost").write(t, config.CertFile, config.KeyFile, now)
+		ca.write(t, config.CAFile, filepath.Join(directory, "ca.key"), now)
+		fakeClock := clock.NewFakeClock(now)
+		store, err := NewCertificateStore(config, fakeClock, logger)
+		assert.NoError(t, err)
+		return store, config, fakeClock, logger
+	}
+	getServedCertificate := func(t *testing.T, store *CertificateStore) []byte {
+		config, err := store.ServerConfig().GetConfigForClient(nil)
+		assert.NoError(t, err)
+		return config.Certificates[0].Certificate[0]
+	}
+
+	t.Run("Server_Config_Without_Client_Auth", func(t *testing.T) {
+		store, _, _, _ := setupStore(t, false)
+
+		config, err := store.ServerConfig().GetConfigForClient(nil)
+
+		assert.NoError(t, err)
+		assert.Len(t, config.Certificates, 1)
+		assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+		assert.Nil(t, config.ClientCAs)
+	})
+
+	t.Run("Server_Config_With_Client_Auth", func(t *testing.T) {
+		store, _, _, _ := setupStore(t, true)
+
+		config, err := store.ServerConfig().GetConfigForClient(nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+		assert.NotNil(t, config.ClientCAs)
+	})
+
+	t.Run("Rotated_Files_Reloaded_After_Check_Interval", func(t *testing.T) {
+		store, config, fakeClock, logger := setupStore(t, true)
+		served := getServedCertificate(t, store)
+		rotated := newTestCertificate(t, "qd.email.api", ca, "localhost")
+		rotated.write(t, config.CertFile, config.KeyFile, now.Add(time.Hour))
+
+		assert.Equal(t, served, getServedCertificate(t, store))
+		fakeClock.Advance(checkInterval)
+		logger.EXPECT().Info("Certificates reloaded")
+		assert.Equal(t, rotated.der, getServedCertificate(t, store))
+	})
+
+	t.Run("Failed_Reload_Keeps_Previous_Certificate", func(t *testing.T) {
+		store, config, fakeClock, logger := setupStore(t, false)
+		served := getServedCertificate(t, store)
+		assert.NoError(t, os.WriteFile(config.KeyFile, []byte("partially written key"), 0600))
+
+		fakeClock.Advance(checkInterval)
+		logger.EXPECT().Error(gomock.Any(), "Failed to reload the certificates")
+		assert.Equal(t, served, getServedCertificate(t, store))
+
+		rotated := newTestCertificate(t, "qd.email.api", ca, "localhost")
+		rotated.write(t, config.CertFile, config.KeyFile, now.Add(time.Hour))
+		fakeClock.Advance(checkInterval)
+		logger.EXPECT().Info("Certificates reloaded")
+		assert.Equal(t, rotated.der, getServedCertificate(t, store))
+	})
+
+	t.Run("New_Certificate_Store_Missing_File_Error", func(t *testing.T) {
+		_, err := NewCertificateStore(Config{
+			CertFile: "missing/server.crt",
+			KeyFile:  "missing/server.key",
+		}, clock.NewFakeClock(now), nil)
+
+		assert.ErrorContains(t, err, "Error reading missing/server.crt")
+	})
+}
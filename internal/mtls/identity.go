@@ -0,0 +1,140 @@
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Identity is the identity of a client verified from its certificate
+type Identity struct {
+	CommonName     string
+	DNSNames       []string
+	URIs           []string
+	EmailAddresses []string
+}
+
+// String returns the common name of the client, or its first alternative name
+func (identity *Identity) String() string {
+	for _, names := range [][]string{{identity.CommonName}, identity.DNSNames, identity.URIs, identity.EmailAddresses} {
+		if len(names) > 0 && names[0] != "" {
+			return names[0]
+		}
+	}
+	return ""
+}
+
+// Names returns every name of the client in its certificate
+func (identity *Identity) Names() []string {
+	names := []string{}
+	if identity.CommonName != "" {
+		names = append(names, identity.CommonName)
+	}
+	names = append(names, identity.DNSNames...)
+	names = append(names, identity.URIs...)
+	return append(names, identity.EmailAddresses...)
+}
+
+// identityKey is the key of the identity of the client in the context
+type identityKey struct{}
+
+// NewContext returns a copy of the context carrying the identity of the client
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the client of the request, if it presented a
+// certificate signed by the CA
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// UnaryServerInterceptor adds the identity of the client to the context of every unary
+// gRPC request. The requests without an identity are rejected when it is required.
+func UnaryServerInterceptor(required bool) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := authenticate(ctx, required)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor
+func StreamServerInterceptor(required bool) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authenticate(stream.Context(), required)
+		if err != nil {
+			return err
+		}
+		return handler(server, &contextServerStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// contextServerStream overrides the context of a server stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context
+func (stream *contextServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+// authenticate adds the identity of the verified certificate of the client to the context
+// and to the span of the request for the audit
+func authenticate(ctx context.Context, required bool) (context.Context, error) {
+	certificate := getVerifiedCertificate(ctx)
+	if certificate == nil {
+		if required {
+			return ctx, status.Error(codes.Unauthenticated, "Client certificate required")
+		}
+		return ctx, nil
+	}
+	identity := &Identity{
+		CommonName:     certificate.Subject.CommonName,
+		DNSNames:       certificate.DNSNames,
+		EmailAddresses: certificate.EmailAddresses,
+	}
+	for _, uri := range certificate.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("tls.client.subject", certificate.Subject.String()),
+		attribute.String("tls.client.identity", identity.String()),
+	)
+	return NewContext(ctx, identity), nil
+}
+
+// getVerifiedCertificate returns the certificate of the client verified against the CA
+func getVerifiedCertificate(ctx context.Context) *x509.Certificate {
+	client, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := client.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return tlsInfo.State.VerifiedChains[0][0]
+}
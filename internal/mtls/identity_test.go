@@ -0,0 +1,143 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// serverStream is a server stream carrying a context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *serverStream) Context() context.Context {
+	return stream.ctx
+}
+
+// newPeerContext returns the context of a request of a client connected over a TLS handshake
+// verifying its certificate, if any, against the CA
+func newPeerContext(t *testing.T, ca, server, client *testCertificate) context.Context {
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.certificate)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	serverTLS := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	})
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+	if client != nil {
+		clientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{client.der}, PrivateKey: client.key}}
+	}
+	handshake := make(chan error)
+	go func() {
+		handshake <- tls.Client(clientConn, clientConfig).Handshake()
+	}()
+	assert.NoError(t, serverTLS.Handshake())
+	assert.NoError(t, <-handshake)
+
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: serverTLS.ConnectionState()},
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	ca := newTestCertificate(t, "qd-test-ca", nil)
+	server := newTestCertificate(t, "qd.email.api", ca, "localhost")
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb_email.EmailService/SendEmail"}
+
+	t.Run("Identity_Attached", func(t *testing.T) {
+		client := newTestCertificate(t, "qd.authentication.api", ca, "auth.internal")
+		ctx := newPeerContext(t, ca, server, client)
+		var identity *Identity
+		handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+			identity, _ = IdentityFromContext(ctx)
+			return "response", nil
+		}
+
+		response, err := UnaryServerInterceptor(true)(ctx, "request", info, handler)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "response", response)
+		assert.Equal(t, "qd.authentication.api", identity.CommonName)
+		assert.Equal(t, []string{"auth.internal"}, identity.DNSNames)
+		assert.Equal(t, "qd.authentication.api", identity.String())
+		assert.Equal(t, []string{"qd.authentication.api", "auth.internal"}, identity.Names())
+	})
+
+	t.Run("Required_Without_Certificate_Unauthenticated", func(t *testing.T) {
+		ctx := newPeerContext(t, ca, server, nil)
+		handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+			t.Fatal("Handler called without a client certificate")
+			return nil, nil
+		}
+
+		response, err := UnaryServerInterceptor(true)(ctx, "request", info, handler)
+
+		assert.Nil(t, response)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, "Client certificate required", status.Convert(err).Message())
+	})
+
+	t.Run("Optional_Without_Certificate_Passes", func(t *testing.T) {
+		ctx := newPeerContext(t, ca, server, nil)
+		found := true
+		handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+			_, found = IdentityFromContext(ctx)
+			return "response", nil
+		}
+
+		response, err := UnaryServerInterceptor(false)(ctx, "request", info, handler)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "response", response)
+		assert.False(t, found)
+	})
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	ca := newTestCertificate(t, "qd-test-ca", nil)
+	server := newTestCertificate(t, "qd.email.api", ca, "localhost")
+	info := &grpc.StreamServerInfo{FullMethod: "/pb_email.EmailService/SendEmails"}
+
+	t.Run("Identity_Attached", func(t *testing.T) {
+		client := newTestCertificate(t, "", ca, "auth.internal")
+		stream := &serverStream{ctx: newPeerContext(t, ca, server, client)}
+		var identity *Identity
+		handler := func(server interface{}, stream grpc.ServerStream) error {
+			identity, _ = IdentityFromContext(stream.Context())
+			return nil
+		}
+
+		err := StreamServerInterceptor(true)(nil, stream, info, handler)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "auth.internal", identity.String())
+	})
+
+	t.Run("Required_Without_Certificate_Unauthenticated", func(t *testing.T) {
+		stream := &serverStream{ctx: context.Background()}
+		handler := func(server interface{}, stream grpc.ServerStream) error {
+			t.Fatal("Handler called without a client certificate")
+			return nil
+		}
+
+		err := StreamServerInterceptor(true)(nil, stream, info, handler)
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
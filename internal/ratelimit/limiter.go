@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"qd-email-api/internal/clock"
+)
+
+// Scope is what a limit is applied to
+type Scope string
+
+// Scopes of the rate limits
+const (
+	ScopeClient    Scope = "client"
+	ScopeRecipient Scope = "recipient"
+	ScopeDomain    Scope = "domain"
+)
+
+// sweepInterval is how often the buckets that have refilled completely are forgotten
+const sweepInterval = time.Minute
+
+// Limit is the sustained number of requests per second and the burst allowed for
+// every key of a scope. A limit without a rate is disabled.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limits holds the limit of every scope
+type Limits struct {
+	Client    Limit
+	Recipient Limit
+	Domain    Limit
+}
+
+// LimitExceededError is returned when a request goes over one of the limits
+type LimitExceededError struct {
+	Scope      Scope
+	RetryAfter time.Duration
+}
+
+func (err *LimitExceededError) Error() string {
+	return fmt.Sprintf("Rate limit per %s exceeded, retry after %s", err.Scope, err.RetryAfter)
+}
+
+// Limiterer is the interface for rate limiting the requests of the clients
+type Limiterer interface {
+	Allow(client, recipient string) error
+	AllowRecipient(recipient string) error
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type scopeLimiter struct {
+	scope   Scope
+	limit   Limit
+	buckets map[string]*bucket
+}
+
+// Limiter is the implementation of the rate limiter with a token bucket per
+// client, recipient address and recipient domain
+type Limiter struct {
+	clock     clock.Clocker
+	mutex     sync.Mutex
+	scopes    []*scopeLimiter
+	lastSweep time.Time
+}
+
+var _ Limiterer = &Limiter{}
+
+// NewLimiter creates a new rate limiter
+func NewLimiter(clock clock.Clocker, limits Limits) *Limiter {
+	return &Limiter{
+		clock:     clock,
+		scopes:    newScopeLimiters(limits),
+		lastSweep: clock.Now(),
+	}
+}
+
+func newScopeLimiters(limits Limits) []*scopeLimiter {
+	scopes := []*scopeLimiter{}
+	for _, scopeLimiter := range []*scopeLimiter{
+		{scope: ScopeClient, limit: limits.Client},
+		{scope: ScopeRecipient, limit: limits.Recipient},
+		{scope: ScopeDomain, limit: limits.Domain},
+	} {
+		if scopeLimiter.limit.Rate <= 0 {
+			continue
+		}
+		if scopeLimiter.limit.Burst < 1 {
+			scopeLimiter.limit.Burst = 1
+		}
+		scopeLimiter.buckets = make(map[string]*bucket)
+		scopes = append(scopes, scopeLimiter)
+	}
+	return scopes
+}
+
+// SetLimits replaces the limits while the requests are limited. The buckets of the scopes
+// still limited keep their tokens and refill at the new rate.
+func (limiter *Limiter) SetLimits(limits Limits) {
+	now := limiter.clock.Now()
+	scopes := newScopeLimiters(limits)
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	for _, scopeLimiter := range scopes {
+		for _, previous := range limiter.scopes {
+			if previous.scope != scopeLimiter.scope {
+				continue
+			}
+			scopeLimiter.buckets = previous.buckets
+			for _, keyBucket := range scopeLimiter.buckets {
+				keyBucket.limiter.SetLimitAt(now, rate.Limit(scopeLimiter.limit.Rate))
+				keyBucket.limiter.SetBurstAt(now, scopeLimiter.limit.Burst)
+			}
+		}
+	}
+	limiter.scopes = scopes
+}
+
+// Allow takes a token from the buckets of the client, the recipient and its domain.
+// Empty values are not limited. No token is taken unless every bucket has one.
+func (limiter *Limiter) Allow(client, recipient string) error {
+	keys := map[Scope]string{ScopeClient: client}
+	if recipient != "" {
+		address := strings.ToLower(recipient)
+		keys[ScopeRecipient] = address
+		if at := strings.LastIndex(address, "@"); at >= 0 {
+			keys[ScopeDomain] = address[at+1:]
+		}
+	}
+	return limiter.allow(keys)
+}
+
+// AllowRecipient takes a token from the bucket of the recipient only. It limits the
+// recipients of batches, whose domains are paced by the delivery rather than rejected.
+func (limiter *Limiter) AllowRecipient(recipient string) error {
+	return limiter.allow(map[Scope]string{ScopeRecipient: strings.ToLower(recipient)})
+}
+
+func (limiter *Limiter) allow(keys map[Scope]string) error {
+	now := limiter.clock.Now()
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.sweep(now)
+
+	reservations := []*rate.Reservation{}
+	for _, scopeLimiter := range limiter.scopes {
+		key := keys[scopeLimiter.scope]
+		if key == "" {
+			continue
+		}
+		reservation := scopeLimiter.bucket(key, now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			for _, taken := range reservations {
+				taken.CancelAt(now)
+			}
+			return &LimitExceededError{
+				Scope:      scopeLimiter.scope,
+				RetryAfter: delay,
+			}
+		}
+		reservations = append(reservations, reservation)
+	}
+	return nil
+}
+
+func (scopeLimiter *scopeLimiter) bucket(key string, now time.Time) *rate.Limiter {
+	keyBucket, exists := scopeLimiter.buckets[key]
+	if !exists {
+		keyBucket = &bucket{
+			limiter: rate.NewLimiter(rate.Limit(scopeLimiter.limit.Rate), scopeLimiter.limit.Burst),
+		}
+		scopeLimiter.buckets[key] = keyBucket
+	}
+	keyBucket.lastSeen = now
+	return keyBucket.limiter
+}
+
+// sweep forgets the buckets that have refilled completely, as they behave like new ones
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+	for _, scopeLimiter := range limiter.scopes {
+		refill := time.Duration(float64(scopeLimiter.limit.Burst) / scopeLimiter.limit.Rate * float64(time.Second))
+		for key, keyBucket := range scopeLimiter.buckets {
+			if now.Sub(keyBucket.lastSeen) >= refill {
+				delete(scopeLimiter.buckets, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+)
+
+func TestLimiter(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	limits := Limits{
+		Client:    Limit{Rate: 1, Burst: 2},
+		Recipient: Limit{Rate: 0.5, Burst: 3},
+		Domain:    Limit{Rate: 10, Burst: 4},
+	}
+
+	test.Run("Client_Limit_Exceeded", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, limits)
+
+		assert.NoError(test, limiter.Allow("client", ""))
+		assert.NoError(test, limiter.Allow("client", ""))
+		err := limiter.Allow("client", "")
+
+		assert.Equal(test, &LimitExceededError{Scope: ScopeClient, RetryAfter: time.Second}, err)
+		assert.EqualError(test, err, "Rate limit per client exceeded, retry after 1s")
+		assert.NoError(test, limiter.Allow("other-client", ""))
+
+		fakeClock.Advance(time.Second)
+		assert.NoError(test, limiter.Allow("client", ""))
+	})
+
+	test.Run("Recipient_Limit_Ignores_Case", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, limits)
+
+		assert.NoError(test, limiter.Allow("", "user@test.com"))
+		assert.NoError(test, limiter.Allow("", "USER@test.com"))
+		assert.NoError(test, limiter.Allow("", "user@TEST.com"))
+		err := limiter.Allow("", "User@Test.com")
+
+		assert.Equal(test, &LimitExceededError{Scope: ScopeRecipient, RetryAfter: 2 * time.Second}, err)
+	})
+
+	test.Run("Domain_Limit_Exceeded", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, limits)
+
+		for _, recipient := range []string{"one@test.com", "two@test.com", "three@test.com", "four@test.com"} {
+			assert.NoError(test, limiter.Allow("", recipient))
+		}
+		err := limiter.Allow("", "five@test.com")
+
+		assert.Equal(test, &LimitExceededError{Scope: ScopeDomain, RetryAfter: 100 * time.Millisecond}, err)
+		assert.NoError(test, limiter.Allow("", "five@other.com"))
+	})
+
+	test.Run("Allow_Recipient_Skips_Domain", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, limits)
+
+		for _, recipient := range []string{"one@test.com", "two@test.com", "three@test.com", "four@test.com", "five@test.com"} {
+			assert.NoError(test, limiter.AllowRecipient(recipient))
+		}
+		for index := 0; index < 2; index++ {
+			assert.NoError(test, limiter.AllowRecipient("ONE@test.com"))
+		}
+		err := limiter.AllowRecipient("one@test.com")
+
+		assert.Equal(test, &LimitExceededError{Scope: ScopeRecipient, RetryAfter: 2 * time.Second}, err)
+	})
+
+	test.Run("Rejected_Request_Takes_No_Tokens", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, Limits{
+			Client:    Limit{Rate: 1, Burst: 1},
+			Recipient: Limit{Rate: 1, Burst: 1},
+		})
+
+		assert.NoError(test, limiter.Allow("first-client", "user@test.com"))
+		err := limiter.Allow("second-client", "user@test.com")
+		assert.Equal(test, &LimitExceededError{Scope: ScopeRecipient, RetryAfter: time.Second}, err)
+
+		// The second client did not spend its token on the rejected request
+		assert.NoError(test, limiter.Allow("second-client", "other@test.com"))
+	})
+
+	test.Run("Disabled_Limits_Allow_Everything", func(test *testing.T) {
+		limiter := NewLimiter(clock.NewFakeClock(now), Limits{})
+
+		for index := 0; index < 100; index++ {
+			assert.NoError(test, limiter.Allow("client", "user@test.com"))
+		}
+	})
+
+	test.Run("Sweep_Forgets_Refilled_Buckets", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, limits)
+
+		assert.NoError(test, limiter.Allow("client", "user@test.com"))
+		fakeClock.Advance(sweepInterval)
+		assert.NoError(test, limiter.Allow("other-client", ""))
+
+		assert.Len(test, limiter.scopes[0].buckets, 1)
+		assert.Contains(test, limiter.scopes[0].buckets, "other-client")
+		assert.Empty(test, limiter.scopes[1].buckets)
+		assert.Empty(test, limiter.scopes[2].buckets)
+	})
+
+	test.Run("Set_Limits_Keeps_Tokens_Taken", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		limiter := NewLimiter(fakeClock, Limits{Client: Limit{Rate: 1, Burst: 2}})
+
+		assert.NoError(test, limiter.Allow("client", "user@test.com"))
+		assert.NoError(test, limiter.Allow("client", "user@test.com"))
+		limiter.SetLimits(Limits{
+			Client:    Limit{Rate: 2, Burst: 2},
+			Recipient: Limit{Rate: 1, Burst: 1},
+		})
+		err := limiter.Allow("client", "")
+
+		// The client spent its tokens before the change and refills twice as fast
+		assert.Equal(test, &LimitExceededError{Scope: ScopeClient, RetryAfter: 500 * time.Millisecond}, err)
+		fakeClock.Advance(500 * time.Millisecond)
+		assert.NoError(test, limiter.Allow("client", "user@test.com"))
+		fakeClock.Advance(500 * time.Millisecond)
+		err = limiter.Allow("client", "user@test.com")
+		assert.Equal(test, &LimitExceededError{Scope: ScopeRecipient, RetryAfter: 500 * time.Millisecond}, err)
+
+		limiter.SetLimits(Limits{})
+		assert.NoError(test, limiter.Allow("client", "user@test.com"))
+	})
+}
@@ -0,0 +1,62 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: limiter.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLimiterer is a mock of Limiterer interface.
+type MockLimiterer struct {
+	ctrl     *gomock.Controller
+	recorder *MockLimitererMockRecorder
+}
+
+// MockLimitererMockRecorder is the mock recorder for MockLimiterer.
+type MockLimitererMockRecorder struct {
+	mock *MockLimiterer
+}
+
+// NewMockLimiterer creates a new mock instance.
+func NewMockLimiterer(ctrl *gomock.Controller) *MockLimiterer {
+	mock := &MockLimiterer{ctrl: ctrl}
+	mock.recorder = &MockLimitererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLimiterer) EXPECT() *MockLimitererMockRecorder {
+	return m.recorder
+}
+
+// Allow mocks base method.
+func (m *MockLimiterer) Allow(client, recipient string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allow", client, recipient)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Allow indicates an expected call of Allow.
+func (mr *MockLimitererMockRecorder) Allow(client, recipient interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allow", reflect.TypeOf((*MockLimiterer)(nil).Allow), client, recipient)
+}
+
+// AllowRecipient mocks base method.
+func (m *MockLimiterer) AllowRecipient(recipient string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AllowRecipient", recipient)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AllowRecipient indicates an expected call of AllowRecipient.
+func (mr *MockLimitererMockRecorder) AllowRecipient(recipient interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllowRecipient", reflect.TypeOf((*MockLimiterer)(nil).AllowRecipient), recipient)
+}
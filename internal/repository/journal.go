@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"qd-email-api/internal/model"
+)
+
+// compactMinEntries is the number of journal entries below which the journal is never compacted
+const compactMinEntries = 1000
+
+// journalEntry is a line of the journal, which either stores the latest version of a
+// message or deletes it
+type journalEntry struct {
+	Message *model.Message `json:"message,omitempty"`
+	Deleted string         `json:"deleted,omitempty"`
+}
+
+// messageJournal appends the changes of the messages to a file of JSON lines, so that every
+// write costs the size of the change rather than the size of the store. It is replayed
+// on load and rewritten once most of its entries are outdated.
+type messageJournal struct {
+	path    string
+	name    string
+	entries int
+	// skipped is the number of corrupt entries skipped on load
+	skipped int
+}
+
+// loadJournal replays the journal at path, leaving the messages untouched when it does not
+// exist yet. A truncated last entry, left by a crash while appending, is discarded, and the
+// corrupt entries are skipped so that a single torn line does not lose the whole store.
+func loadJournal(path, name string, messages map[string]*model.Message) (*messageJournal, error) {
+	journal := &messageJournal{path: path, name: name}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %v", name, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := os.Truncate(path, offset); err != nil {
+					return nil, fmt.Errorf("Could not repair %s: %v", name, err)
+				}
+			}
+			return journal, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s: %v", name, err)
+		}
+		offset += int64(len(line))
+		journal.entries++
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			journal.skipped++
+			continue
+		}
+		switch {
+		case entry.Message != nil:
+			messages[entry.Message.ID] = entry.Message
+		case entry.Deleted != "":
+			delete(messages, entry.Deleted)
+		}
+	}
+}
+
+// append writes the entries at the end of the journal at once and syncs them to the disk.
+// A failed write is truncated away so that the next entries start on a line of their own.
+func (journal *messageJournal) append(entries ...journalEntry) error {
+	var content bytes.Buffer
+	encoder := json.NewEncoder(&content)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("Could not serialize %s: %v", journal.name, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(journal.path), 0o755); err != nil {
+		return fmt.Errorf("Could not create %s directory: %v", journal.name, err)
+	}
+	file, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %v", journal.name, err)
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %v", journal.name, err)
+	}
+	if _, err := file.Write(content.Bytes()); err != nil {
+		file.Truncate(offset)
+		return fmt.Errorf("Could not write %s: %v", journal.name, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Truncate(offset)
+		return fmt.Errorf("Could not write %s: %v", journal.name, err)
+	}
+	journal.entries += len(entries)
+	return nil
+}
+
+// compact rewrites the journal with a single entry per message once most of its entries
+// are outdated. The journal stays valid when it fails, so compaction is retried on the
+// next write.
+func (journal *messageJournal) compact(messages map[string]*model.Message) {
+	if journal.entries < compactMinEntries || journal.entries < 2*len(messages) {
+		return
+	}
+	entries := make([]journalEntry, 0, len(messages))
+	for _, message := range messages {
+		entries = append(entries, journalEntry{Message: message})
+	}
+	compacted := &messageJournal{path: journal.path + ".tmp", name: journal.name}
+	os.Remove(compacted.path)
+	if err := compacted.append(entries...); err != nil {
+		return
+	}
+	if err := os.Rename(compacted.path, journal.path); err != nil {
+		return
+	}
+	journal.entries = compacted.entries
+}
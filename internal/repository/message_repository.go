@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+)
+
+// ErrMessageNotFound is returned when no message matches the given ID
+var ErrMessageNotFound = errors.New("Message not found")
+
+// ErrStatusConflict is returned when a message is not in the expected status
+var ErrStatusConflict = errors.New("Message status conflict")
+
+// MessageRepositoryer is the interface for persisting messages
+type MessageRepositoryer interface {
+	Insert(ctx context.Context, message *model.Message) error
+	InsertMany(ctx context.Context, messages []*model.Message) error
+	GetByID(ctx context.Context, id string) (*model.Message, error)
+	GetByStatus(ctx context.Context, status model.Status) ([]*model.Message, error)
+	GetDue(ctx context.Context, now time.Time) ([]*model.Message, error)
+	List(ctx context.Context, filter *MessageFilter) ([]*model.Message, error)
+	UpdateStatus(ctx context.Context, id string, from model.Status, change model.StatusChange) error
+	Reschedule(ctx context.Context, id string, sendAt time.Time, change model.StatusChange) error
+	RecordOpen(ctx context.Context, id string, userAgent model.UserAgentClass, time time.Time) error
+	RecordClick(ctx context.Context, id, url string, userAgent model.UserAgentClass, time time.Time) error
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// MessageFilter selects the messages returned by List. Empty fields match every message.
+type MessageFilter struct {
+	To            string
+	Status        model.Status
+	CorrelationID string
+	// ClientID keeps the messages sent by this client
+	ClientID      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// AfterID continues the listing after the message with this ID
+	AfterID string
+	Limit   int
+}
+
+// finalStatuses are the statuses of the messages no longer waiting to be sent, which are
+// purged once they are older than the retention
+var finalStatuses = map[model.Status]bool{
+	model.StatusSent:         true,
+	model.StatusDelivered:    true,
+	model.StatusBounced:      true,
+	model.StatusComplained:   true,
+	model.StatusUnsubscribed: true,
+	model.StatusFailed:       true,
+	model.StatusCancelled:    true,
+}
+
+// FileMessageRepository keeps messages in memory and appends their changes to a journal
+// file so that pending messages survive restarts. An empty path disables persistence.
+// Every status change is published to the event bus, if any, in the order it is stored.
+type FileMessageRepository struct {
+	mutex    sync.Mutex
+	journal  *messageJournal
+	messages map[string]*model.Message
+	eventBus event.Buser
+}
+
+var _ MessageRepositoryer = &FileMessageRepository{}
+
+// NewFileMessageRepository creates a message repository loading any messages stored at path
+func NewFileMessageRepository(path string, eventBus event.Buser) (*FileMessageRepository, error) {
+	repository := &FileMessageRepository{
+		messages: make(map[string]*model.Message),
+		eventBus: eventBus,
+	}
+	if path == "" {
+		return repository, nil
+	}
+	journal, err := loadJournal(path, "message store", repository.messages)
+	if err != nil {
+		return nil, err
+	}
+	repository.journal = journal
+	return repository, nil
+}
+
+// CorruptEntries returns the number of corrupt entries of the journal skipped on load
+func (repository *FileMessageRepository) CorruptEntries() int {
+	if repository.journal == nil {
+		return 0
+	}
+	return repository.journal.skipped
+}
+
+// Insert stores a new message
+func (repository *FileMessageRepository) Insert(_ context.Context, message *model.Message) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, exists := repository.messages[message.ID]; exists {
+		return fmt.Errorf("Message %s already exists", message.ID)
+	}
+	repository.messages[message.ID] = clone(message)
+	if err := repository.persist(message); err != nil {
+		delete(repository.messages, message.ID)
+		return err
+	}
+	for _, change := range message.History {
+		repository.publish(message, change)
+	}
+	return nil
+}
+
+// InsertMany stores new messages at once, storing none of them when any fails
+func (repository *FileMessageRepository) InsertMany(_ context.Context, messages []*model.Message) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	ids := make(map[string]bool, len(messages))
+	for _, message := range messages {
+		if _, exists := repository.messages[message.ID]; exists || ids[message.ID] {
+			return fmt.Errorf("Message %s already exists", message.ID)
+		}
+		ids[message.ID] = true
+	}
+	for _, message := range messages {
+		repository.messages[message.ID] = clone(message)
+	}
+	if err := repository.persist(messages...); err != nil {
+		for _, message := range messages {
+			delete(repository.messages, message.ID)
+		}
+		return err
+	}
+	for _, message := range messages {
+		for _, change := range message.History {
+			repository.publish(message, change)
+		}
+	}
+	return nil
+}
+
+// GetByID returns a copy of the message with the given ID
+func (repository *FileMessageRepository) GetByID(_ context.Context, id string) (*model.Message, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	message, exists := repository.messages[id]
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+	return clone(message), nil
+}
+
+// GetByStatus returns copies of the messages in the given status ordered by creation time
+func (repository *FileMessageRepository) GetByStatus(_ context.Context, status model.Status) ([]*model.Message, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return repository.filter(func(message *model.Message) bool {
+		return message.Status == status
+	}), nil
+}
+
+// List returns copies of the messages matching the filter ordered by creation time
+func (repository *FileMessageRepository) List(_ context.Context, filter *MessageFilter) ([]*model.Message, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var after *model.Message
+	if filter.AfterID != "" {
+		message, exists := repository.messages[filter.AfterID]
+		if !exists {
+			return nil, ErrMessageNotFound
+		}
+		after = message
+	}
+	to := strings.ToLower(filter.To)
+	messages := repository.filter(func(message *model.Message) bool {
+		switch {
+		case to != "" && strings.ToLower(message.To) != to,
+			filter.Status != "" && message.Status != filter.Status,
+			filter.CorrelationID != "" && message.CorrelationID != filter.CorrelationID,
+			filter.ClientID != "" && message.ClientID != filter.ClientID,
+			!filter.CreatedAfter.IsZero() && message.CreatedAt.Before(filter.CreatedAfter),
+			!filter.CreatedBefore.IsZero() && !message.CreatedAt.Before(filter.CreatedBefore),
+			after != nil && !isAfter(message, after):
+			return false
+		}
+		return true
+	})
+	if filter.Limit > 0 && len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+	}
+	return messages, nil
+}
+
+// GetDue returns copies of the scheduled and deferred messages whose send time is not after now
+func (repository *FileMessageRepository) GetDue(_ context.Context, now time.Time) ([]*model.Message, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	due := repository.filter(func(message *model.Message) bool {
+		waiting := message.Status == model.StatusScheduled || message.Status == model.StatusDeferred
+		return waiting && !message.SendAt.After(now)
+	})
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].SendAt.Before(due[j].SendAt)
+	})
+	return due, nil
+}
+
+// UpdateStatus records a status change of a message, failing with
+// ErrStatusConflict when the message is no longer in the expected status
+func (repository *FileMessageRepository) UpdateStatus(
+	_ context.Context,
+	id string,
+	from model.Status,
+	change model.StatusChange,
+) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	message, exists := repository.messages[id]
+	if !exists {
+		return ErrMessageNotFound
+	}
+	if message.Status != from {
+		return ErrStatusConflict
+	}
+	previous := clone(message)
+	message.Record(change)
+	if err := repository.persist(message); err != nil {
+		repository.messages[id] = previous
+		return err
+	}
+	repository.publish(message, change)
+	return nil
+}
+
+// Reschedule records a status change of a message being sent that will be retried at
+// a new send time and counts the deferral, failing with ErrStatusConflict when the
+// message is not being sent
+func (repository *FileMessageRepository) Reschedule(
+	_ context.Context,
+	id string,
+	sendAt time.Time,
+	change model.StatusChange,
+) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	message, exists := repository.messages[id]
+	if !exists {
+		return ErrMessageNotFound
+	}
+	if message.Status != model.StatusSending {
+		return ErrStatusConflict
+	}
+	previous := clone(message)
+	message.SendAt = sendAt
+	message.Deferrals++
+	message.Record(change)
+	if err := repository.persist(message); err != nil {
+		repository.messages[id] = previous
+		return err
+	}
+	repository.publish(message, change)
+	return nil
+}
+
+// RecordOpen counts an open of a message and publishes it as an opened event, leaving
+// the status of the message as it is
+func (repository *FileMessageRepository) RecordOpen(
+	_ context.Context,
+	id string,
+	userAgent model.UserAgentClass,
+	time time.Time,
+) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	message, exists := repository.messages[id]
+	if !exists {
+		return ErrMessageNotFound
+	}
+	previous := clone(message)
+	message.RecordOpen(time, userAgent)
+	if err := repository.persist(message); err != nil {
+		repository.messages[id] = previous
+		return err
+	}
+	repository.publish(message, model.StatusChange{
+		Status:   model.StatusOpened,
+		Time:     time,
+		Response: fmt.Sprintf("Opened from %s client", userAgent),
+	})
+	return nil
+}
+
+// RecordClick counts a click on a link of a message and publishes it as a clicked event,
+// leaving the status of the message as it is
+func (repository *FileMessageRepository) RecordClick(
+	_ context.Context,
+	id string,
+	url string,
+	userAgent model.UserAgentClass,
+	time time.Time,
+) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	message, exists := repository.messages[id]
+	if !exists {
+		return ErrMessageNotFound
+	}
+	previous := clone(message)
+	message.RecordClick(time, url, userAgent)
+	if err := repository.persist(message); err != nil {
+		repository.messages[id] = previous
+		return err
+	}
+	repository.publish(message, model.StatusChange{
+		Status:   model.StatusClicked,
+		Time:     time,
+		Response: fmt.Sprintf("Clicked %s from %s client", url, userAgent),
+	})
+	return nil
+}
+
+// Purge deletes the messages in a final status last updated before the given time, keeping
+// the ones still waiting to be sent, and returns how many were deleted
+func (repository *FileMessageRepository) Purge(_ context.Context, before time.Time) (int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	entries := []journalEntry{}
+	for id, message := range repository.messages {
+		if finalStatuses[message.Status] && message.UpdatedAt.Before(before) {
+			entries = append(entries, journalEntry{Deleted: id})
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if repository.journal != nil {
+		if err := repository.journal.append(entries...); err != nil {
+			return 0, err
+		}
+	}
+	for _, entry := range entries {
+		delete(repository.messages, entry.Deleted)
+	}
+	if repository.journal != nil {
+		repository.journal.compact(repository.messages)
+	}
+	return len(entries), nil
+}
+
+func (repository *FileMessageRepository) filter(match func(message *model.Message) bool) []*model.Message {
+	result := []*model.Message{}
+	for _, message := range repository.messages {
+		if match(message) {
+			result = append(result, clone(message))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return isAfter(result[j], result[i])
+	})
+	return result
+}
+
+func (repository *FileMessageRepository) publish(message *model.Message, change model.StatusChange) {
+	if repository.eventBus != nil {
+		repository.eventBus.Publish(message, change)
+	}
+}
+
+// isAfter reports whether the message comes after the other one in creation order
+func isAfter(message, other *model.Message) bool {
+	if message.CreatedAt.Equal(other.CreatedAt) {
+		return message.ID > other.ID
+	}
+	return message.CreatedAt.After(other.CreatedAt)
+}
+
+// clone copies a message so that callers never share its history with the store
+func clone(message *model.Message) *model.Message {
+	copied := *message
+	copied.History = append([]model.StatusChange(nil), message.History...)
+	if message.Opens != nil {
+		opens := *message.Opens
+		copied.Opens = &opens
+	}
+	if message.Clicks != nil {
+		clicks := *message.Clicks
+		clicks.Links = make(map[string]int, len(message.Clicks.Links))
+		for url, count := range message.Clicks.Links {
+			clicks.Links[url] = count
+		}
+		copied.Clicks = &clicks
+	}
+	return &copied
+}
+
+// persist appends the latest version of the messages to the journal when the repository
+// has a path
+func (repository *FileMessageRepository) persist(messages ...*model.Message) error {
+	if repository.journal == nil {
+		return nil
+	}
+	entries := make([]journalEntry, len(messages))
+	for index, message := range messages {
+		entries[index] = journalEntry{Message: message}
+	}
+	if err := repository.journal.append(entries...); err != nil {
+		return err
+	}
+	repository.journal.compact(repository.messages)
+	return nil
+}
@@ -0,0 +1,340 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+)
+
+func TestFileMessageRepository(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	newMessage := func(id string, sendAt time.Time) *model.Message {
+		return &model.Message{
+			ID:        id,
+			To:        "test@test.com",
+			SendAt:    sendAt,
+			Status:    model.StatusScheduled,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	t.Run("Messages_Survive_Reopen", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "store", "messages.jsonl")
+		ctx := context.Background()
+
+		repository, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		assert.NoError(t, repository.UpdateStatus(ctx, "1", model.StatusScheduled, model.StatusChange{
+			Status: model.StatusCancelled,
+			Time:   now.Add(time.Minute),
+		}))
+
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		message, err := reopened.GetByID(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusCancelled, message.Status)
+		assert.Equal(t, now.Add(time.Minute), message.UpdatedAt)
+		assert.Equal(t, []model.StatusChange{{Status: model.StatusCancelled, Time: now.Add(time.Minute)}}, message.History)
+	})
+
+	t.Run("Insert_Duplicate_Error", func(t *testing.T) {
+		repository, _ := NewFileMessageRepository("", nil)
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		assert.EqualError(t, repository.Insert(ctx, newMessage("1", now)), "Message 1 already exists")
+	})
+
+	t.Run("Get_Due_Returns_Scheduled_Until_Now", func(t *testing.T) {
+		repository, _ := NewFileMessageRepository("", nil)
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Insert(ctx, newMessage("later", now.Add(time.Minute))))
+		assert.NoError(t, repository.Insert(ctx, newMessage("second", now)))
+		assert.NoError(t, repository.Insert(ctx, newMessage("first", now.Add(-time.Minute))))
+		cancelled := newMessage("cancelled", now.Add(-time.Hour))
+		cancelled.Status = model.StatusCancelled
+		assert.NoError(t, repository.Insert(ctx, cancelled))
+
+		due, err := repository.GetDue(ctx, now)
+		assert.NoError(t, err)
+		assert.Len(t, due, 2)
+		assert.Equal(t, "first", due[0].ID)
+		assert.Equal(t, "second", due[1].ID)
+	})
+
+	t.Run("Update_Status_Errors", func(t *testing.T) {
+		repository, _ := NewFileMessageRepository("", nil)
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		sending := model.StatusChange{Status: model.StatusSending, Time: now}
+		assert.ErrorIs(t, repository.UpdateStatus(ctx, "2", model.StatusScheduled, sending), ErrMessageNotFound)
+		assert.ErrorIs(t, repository.UpdateStatus(ctx, "1", model.StatusSending, sending), ErrStatusConflict)
+	})
+
+	t.Run("Reschedule_Counts_Deferrals", func(t *testing.T) {
+		repository, _ := NewFileMessageRepository("", nil)
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		deferred := model.StatusChange{Status: model.StatusDeferred, Time: now, Response: "421 Try again later"}
+		assert.ErrorIs(t, repository.Reschedule(ctx, "1", now.Add(time.Minute), deferred), ErrStatusConflict)
+		assert.ErrorIs(t, repository.Reschedule(ctx, "2", now.Add(time.Minute), deferred), ErrMessageNotFound)
+		assert.NoError(t, repository.UpdateStatus(ctx, "1", model.StatusScheduled, model.StatusChange{Status: model.StatusSending, Time: now}))
+
+		assert.NoError(t, repository.Reschedule(ctx, "1", now.Add(time.Minute), deferred))
+
+		stored, err := repository.GetByID(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusDeferred, stored.Status)
+		assert.Equal(t, now.Add(time.Minute), stored.SendAt)
+		assert.Equal(t, 1, stored.Deferrals)
+		assert.Equal(t, deferred, stored.History[len(stored.History)-1])
+
+		due, err := repository.GetDue(ctx, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Len(t, due, 1)
+	})
+
+	t.Run("List_Filters_And_Pages", func(t *testing.T) {
+		repository, _ := NewFileMessageRepository("", nil)
+		ctx := context.Background()
+
+		for index, id := range []string{"a", "b", "c", "d"} {
+			message := newMessage(id, now)
+			message.CreatedAt = now.Add(time.Duration(index) * time.Minute)
+			message.CorrelationID = "correlation"
+			message.ClientID = "certificate:qd.authentication.api"
+			if id == "c" {
+				message.To = "Other@test.com"
+				message.CorrelationID = ""
+				message.ClientID = "certificate:qd.billing.api"
+			}
+			assert.NoError(t, repository.Insert(ctx, message))
+		}
+		ids := func(messages []*model.Message) []string {
+			result := []string{}
+			for _, message := range messages {
+				result = append(result, message.ID)
+			}
+			return result
+		}
+
+		messages, err := repository.List(ctx, &MessageFilter{To: "test@TEST.com", Limit: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, ids(messages))
+
+		messages, err = repository.List(ctx, &MessageFilter{To: "test@test.com", AfterID: "b", Limit: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"d"}, ids(messages))
+
+		messages, err = repository.List(ctx, &MessageFilter{
+			CorrelationID: "correlation",
+			CreatedAfter:  now.Add(time.Minute),
+			CreatedBefore: now.Add(3 * time.Minute),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b"}, ids(messages))
+
+		messages, err = repository.List(ctx, &MessageFilter{To: "other@test.com", Status: model.StatusScheduled})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c"}, ids(messages))
+
+		messages, err = repository.List(ctx, &MessageFilter{ClientID: "certificate:qd.billing.api"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c"}, ids(messages))
+
+		_, err = repository.List(ctx, &MessageFilter{AfterID: "unknown"})
+		assert.ErrorIs(t, err, ErrMessageNotFound)
+	})
+
+	t.Run("Status_Changes_Are_Published", func(t *testing.T) {
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		subscription, _ := eventBus.Subscribe("")
+		repository, _ := NewFileMessageRepository("", eventBus)
+		ctx := context.Background()
+
+		message := newMessage("1", now)
+		message.History = []model.StatusChange{
+			{Status: model.StatusAccepted, Time: now},
+			{Status: model.StatusScheduled, Time: now},
+		}
+		assert.NoError(t, repository.Insert(ctx, message))
+		assert.NoError(t, repository.UpdateStatus(ctx, "1", model.StatusScheduled, model.StatusChange{Status: model.StatusQueued, Time: now}))
+		assert.Error(t, repository.UpdateStatus(ctx, "1", model.StatusScheduled, model.StatusChange{Status: model.StatusQueued, Time: now}))
+
+		assert.Len(t, subscription.Events(), 3)
+		for _, status := range []model.Status{model.StatusAccepted, model.StatusScheduled, model.StatusQueued} {
+			published := <-subscription.Events()
+			assert.Equal(t, "1", published.MessageID)
+			assert.Equal(t, status, published.Status)
+		}
+	})
+
+	t.Run("Record_Open_Counts_And_Publishes", func(t *testing.T) {
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		repository, _ := NewFileMessageRepository("", eventBus)
+		ctx := context.Background()
+
+		message := newMessage("1", now)
+		message.Status = model.StatusSent
+		assert.NoError(t, repository.Insert(ctx, message))
+		subscription, _ := eventBus.Subscribe("")
+		assert.NoError(t, repository.RecordOpen(ctx, "1", model.UserAgentProxy, now.Add(time.Minute)))
+		assert.NoError(t, repository.RecordOpen(ctx, "1", model.UserAgentMobile, now.Add(time.Hour)))
+		assert.Equal(t, ErrMessageNotFound, repository.RecordOpen(ctx, "2", model.UserAgentMobile, now))
+
+		stored, err := repository.GetByID(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusSent, stored.Status)
+		assert.Equal(t, &model.Opens{
+			Count:         2,
+			FirstOpenedAt: now.Add(time.Minute),
+			LastOpenedAt:  now.Add(time.Hour),
+			UserAgent:     model.UserAgentProxy,
+		}, stored.Opens)
+		published := <-subscription.Events()
+		assert.Equal(t, model.StatusOpened, published.Status)
+		assert.Equal(t, "Opened from proxy client", published.Response)
+	})
+
+	t.Run("Record_Click_Counts_Links", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		repository, _ := NewFileMessageRepository(storePath, nil)
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		assert.NoError(t, repository.RecordClick(ctx, "1", "https://quadev.net/a", model.UserAgentMobile, now.Add(time.Minute)))
+		assert.NoError(t, repository.RecordClick(ctx, "1", "https://quadev.net/b", model.UserAgentDesktop, now.Add(time.Hour)))
+		assert.NoError(t, repository.RecordClick(ctx, "1", "https://quadev.net/a", model.UserAgentDesktop, now.Add(2*time.Hour)))
+
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		stored, err := reopened.GetByID(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Clicks{
+			Count:          3,
+			FirstClickedAt: now.Add(time.Minute),
+			LastClickedAt:  now.Add(2 * time.Hour),
+			UserAgent:      model.UserAgentMobile,
+			Links:          map[string]int{"https://quadev.net/a": 2, "https://quadev.net/b": 1},
+		}, stored.Clicks)
+	})
+
+	t.Run("Insert_Many_Survives_Reopen", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+
+		repository, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, repository.InsertMany(ctx, []*model.Message{newMessage("1", now), newMessage("2", now)}))
+		assert.EqualError(t, repository.InsertMany(ctx, []*model.Message{newMessage("3", now), newMessage("1", now)}), "Message 1 already exists")
+
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		messages, err := reopened.List(ctx, &MessageFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, messages, 2)
+		_, err = reopened.GetByID(ctx, "3")
+		assert.ErrorIs(t, err, ErrMessageNotFound)
+	})
+
+	t.Run("Purge_Deletes_Old_Final_Messages", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+		repository, _ := NewFileMessageRepository(storePath, nil)
+		old := newMessage("old", now)
+		old.Status = model.StatusDelivered
+		recent := newMessage("recent", now)
+		recent.Status = model.StatusSent
+		recent.UpdatedAt = now.Add(2 * time.Hour)
+		assert.NoError(t, repository.InsertMany(ctx, []*model.Message{old, recent, newMessage("scheduled", now)}))
+
+		purged, err := repository.Purge(ctx, now.Add(time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		_, err = reopened.GetByID(ctx, "old")
+		assert.ErrorIs(t, err, ErrMessageNotFound)
+		messages, _ := reopened.List(ctx, &MessageFilter{})
+		assert.Len(t, messages, 2)
+	})
+
+	t.Run("Journal_Compacted_Once_Outdated", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+		repository, _ := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+
+		for index := 0; index < compactMinEntries; index++ {
+			assert.NoError(t, repository.RecordOpen(ctx, "1", model.UserAgentDesktop, now))
+		}
+
+		content, err := os.ReadFile(storePath)
+		assert.NoError(t, err)
+		assert.Less(t, strings.Count(string(content), "\n"), compactMinEntries)
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		message, err := reopened.GetByID(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, compactMinEntries, message.Opens.Count)
+	})
+
+	t.Run("Truncated_Last_Entry_Discarded", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+		repository, _ := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		file, err := os.OpenFile(storePath, os.O_WRONLY|os.O_APPEND, 0o600)
+		assert.NoError(t, err)
+		_, err = file.WriteString(`{"message":{"id":"2"`)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, reopened.Insert(ctx, newMessage("3", now)))
+
+		reopened, err = NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		messages, _ := reopened.List(ctx, &MessageFilter{})
+		assert.Len(t, messages, 2)
+	})
+
+	t.Run("Torn_Interior_Entry_Skipped", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+		repository, _ := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, repository.Insert(ctx, newMessage("1", now)))
+		file, err := os.OpenFile(storePath, os.O_WRONLY|os.O_APPEND, 0o600)
+		assert.NoError(t, err)
+		_, err = file.WriteString("{\"message\":{\"id\":\"2\"\n")
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+		reopened, err := NewFileMessageRepository(storePath, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, reopened.Insert(ctx, newMessage("3", now)))
+
+		reopened, err = NewFileMessageRepository(storePath, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, reopened.CorruptEntries())
+		messages, _ := reopened.List(ctx, &MessageFilter{})
+		assert.Len(t, messages, 2)
+	})
+}
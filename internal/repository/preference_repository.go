@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"qd-email-api/internal/model"
+)
+
+// ErrPreferenceNotFound is returned when a recipient has no preference for a category
+var ErrPreferenceNotFound = errors.New("Preference not found")
+
+// PreferenceRepositoryer is the interface for persisting the category preferences of the recipients
+type PreferenceRepositoryer interface {
+	Set(ctx context.Context, preferences []*model.Preference) error
+	Get(ctx context.Context, address, category string) (*model.Preference, error)
+	List(ctx context.Context, address string) ([]*model.Preference, error)
+}
+
+// FilePreferenceRepository keeps the preferences in memory, by recipient and category, and
+// mirrors them to a JSON file. An empty path disables persistence. Addresses are case
+// insensitive.
+type FilePreferenceRepository struct {
+	mutex       sync.Mutex
+	path        string
+	preferences map[string]map[string]*model.Preference
+}
+
+var _ PreferenceRepositoryer = &FilePreferenceRepository{}
+
+// NewFilePreferenceRepository creates a preference repository loading any preferences stored at path
+func NewFilePreferenceRepository(path string) (*FilePreferenceRepository, error) {
+	repository := &FilePreferenceRepository{
+		path:        path,
+		preferences: make(map[string]map[string]*model.Preference),
+	}
+	if path == "" {
+		return repository, nil
+	}
+	if err := loadStore(path, "preference store", &repository.preferences); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// Set stores the preferences, replacing the previous preferences of their recipient and
+// category. The preferences are stored all together or not at all.
+func (repository *FilePreferenceRepository) Set(_ context.Context, preferences []*model.Preference) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	previous := make(map[string]map[string]*model.Preference, len(preferences))
+	for _, preference := range preferences {
+		key := strings.ToLower(preference.Address)
+		if _, saved := previous[key]; !saved {
+			previous[key] = repository.preferences[key]
+		}
+		categories := make(map[string]*model.Preference, len(repository.preferences[key])+1)
+		for category, stored := range repository.preferences[key] {
+			categories[category] = stored
+		}
+		copied := *preference
+		copied.Address = key
+		categories[preference.Category] = &copied
+		repository.preferences[key] = categories
+	}
+	if err := repository.persist(); err != nil {
+		for key, categories := range previous {
+			if categories == nil {
+				delete(repository.preferences, key)
+			} else {
+				repository.preferences[key] = categories
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns a copy of the preference of a recipient for a category
+func (repository *FilePreferenceRepository) Get(_ context.Context, address, category string) (*model.Preference, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	preference, exists := repository.preferences[strings.ToLower(address)][category]
+	if !exists {
+		return nil, ErrPreferenceNotFound
+	}
+	copied := *preference
+	return &copied, nil
+}
+
+// List returns copies of the preferences of a recipient ordered by category
+func (repository *FilePreferenceRepository) List(_ context.Context, address string) ([]*model.Preference, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	preferences := []*model.Preference{}
+	for _, preference := range repository.preferences[strings.ToLower(address)] {
+		copied := *preference
+		preferences = append(preferences, &copied)
+	}
+	sort.Slice(preferences, func(i, j int) bool {
+		return preferences[i].Category < preferences[j].Category
+	})
+	return preferences, nil
+}
+
+// persist saves the preferences when the repository has a path
+func (repository *FilePreferenceRepository) persist() error {
+	if repository.path == "" {
+		return nil
+	}
+	return saveStore(repository.path, "preference store", repository.preferences)
+}
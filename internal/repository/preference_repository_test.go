@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/model"
+)
+
+func TestFilePreferenceRepository(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Preferences_Survive_Reopen", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "store", "preferences.json")
+		ctx := context.Background()
+
+		repository, err := NewFilePreferenceRepository(storePath)
+		assert.NoError(t, err)
+		assert.NoError(t, repository.Set(ctx, []*model.Preference{
+			{Address: "User@Example.com", Category: "product-updates", Subscribed: false, UpdatedAt: now},
+			{Address: "user@example.com", Category: "newsletter", Subscribed: true, UpdatedAt: now},
+		}))
+
+		reopened, err := NewFilePreferenceRepository(storePath)
+		assert.NoError(t, err)
+		preferences, err := reopened.List(ctx, "USER@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.Preference{
+			{Address: "user@example.com", Category: "newsletter", Subscribed: true, UpdatedAt: now},
+			{Address: "user@example.com", Category: "product-updates", Subscribed: false, UpdatedAt: now},
+		}, preferences)
+	})
+
+	t.Run("Set_Replaces_Category_Preference", func(t *testing.T) {
+		repository, _ := NewFilePreferenceRepository("")
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Set(ctx, []*model.Preference{{Address: "user@example.com", Category: "newsletter", UpdatedAt: now}}))
+		assert.NoError(t, repository.Set(ctx, []*model.Preference{{Address: "user@example.com", Category: "newsletter", Subscribed: true, UpdatedAt: now.Add(time.Hour)}}))
+
+		preference, err := repository.Get(ctx, "user@example.com", "newsletter")
+		assert.NoError(t, err)
+		assert.True(t, preference.Subscribed)
+		assert.Equal(t, now.Add(time.Hour), preference.UpdatedAt)
+		_, err = repository.Get(ctx, "user@example.com", "product-updates")
+		assert.ErrorIs(t, err, ErrPreferenceNotFound)
+		preferences, err := repository.List(ctx, "other@example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, preferences)
+	})
+
+	t.Run("Set_Error_Keeps_Previous_Preferences", func(t *testing.T) {
+		directory := t.TempDir()
+		storePath := filepath.Join(directory, "preferences.json")
+		repository, _ := NewFilePreferenceRepository(storePath)
+		ctx := context.Background()
+		assert.NoError(t, repository.Set(ctx, []*model.Preference{{Address: "user@example.com", Category: "newsletter", UpdatedAt: now}}))
+
+		// A directory in place of the temporary file makes the store fail to save
+		assert.NoError(t, os.Mkdir(storePath+".tmp", 0o755))
+		err := repository.Set(ctx, []*model.Preference{
+			{Address: "user@example.com", Category: "newsletter", Subscribed: true, UpdatedAt: now},
+			{Address: "other@example.com", Category: "newsletter", UpdatedAt: now},
+		})
+
+		assert.Error(t, err)
+		preference, err := repository.Get(ctx, "user@example.com", "newsletter")
+		assert.NoError(t, err)
+		assert.False(t, preference.Subscribed)
+		_, err = repository.Get(ctx, "other@example.com", "newsletter")
+		assert.ErrorIs(t, err, ErrPreferenceNotFound)
+	})
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// loadStore reads the named store at path into value, leaving value untouched when
+// the store does not exist yet or is empty
+func loadStore(path, name string, value any) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", name, err)
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(content, value); err != nil {
+		return fmt.Errorf("Could not parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// saveStore writes value to a temporary file and renames it over the named store at
+// path so a crash never leaves a truncated file behind
+func saveStore(path, name string, value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("Could not serialize %s: %v", name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Could not create %s directory: %v", name, err)
+	}
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, content, 0o600); err != nil {
+		return fmt.Errorf("Could not write %s: %v", name, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf("Could not replace %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"qd-email-api/internal/model"
+)
+
+// ErrSuppressionNotFound is returned when an address is not suppressed
+var ErrSuppressionNotFound = errors.New("Suppression not found")
+
+// SuppressionRepositoryer is the interface for persisting the suppressed addresses
+type SuppressionRepositoryer interface {
+	Add(ctx context.Context, suppression *model.Suppression) error
+	Remove(ctx context.Context, address string) error
+	Get(ctx context.Context, address string) (*model.Suppression, error)
+	List(ctx context.Context, filter *SuppressionFilter) ([]*model.Suppression, error)
+}
+
+// SuppressionFilter selects the suppressions returned by List. Empty fields match every suppression.
+type SuppressionFilter struct {
+	Reason model.SuppressionReason
+	// AfterAddress continues the listing after this address
+	AfterAddress string
+	Limit        int
+}
+
+// FileSuppressionRepository keeps the suppressed addresses in memory and mirrors them to
+// a JSON file. An empty path disables persistence. Addresses are case insensitive.
+type FileSuppressionRepository struct {
+	mutex        sync.Mutex
+	path         string
+	suppressions map[string]*model.Suppression
+}
+
+var _ SuppressionRepositoryer = &FileSuppressionRepository{}
+
+// NewFileSuppressionRepository creates a suppression repository loading any suppressions stored at path
+func NewFileSuppressionRepository(path string) (*FileSuppressionRepository, error) {
+	repository := &FileSuppressionRepository{
+		path:         path,
+		suppressions: make(map[string]*model.Suppression),
+	}
+	if path == "" {
+		return repository, nil
+	}
+	if err := loadStore(path, "suppression store", &repository.suppressions); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// Add suppresses an address, replacing the reason of an address already suppressed
+func (repository *FileSuppressionRepository) Add(_ context.Context, suppression *model.Suppression) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := strings.ToLower(suppression.Address)
+	previous, existed := repository.suppressions[key]
+	copied := *suppression
+	copied.Address = key
+	repository.suppressions[key] = &copied
+	if err := repository.persist(); err != nil {
+		if existed {
+			repository.suppressions[key] = previous
+		} else {
+			delete(repository.suppressions, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove stops suppressing an address
+func (repository *FileSuppressionRepository) Remove(_ context.Context, address string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := strings.ToLower(address)
+	previous, exists := repository.suppressions[key]
+	if !exists {
+		return ErrSuppressionNotFound
+	}
+	delete(repository.suppressions, key)
+	if err := repository.persist(); err != nil {
+		repository.suppressions[key] = previous
+		return err
+	}
+	return nil
+}
+
+// Get returns a copy of the suppression of an address
+func (repository *FileSuppressionRepository) Get(_ context.Context, address string) (*model.Suppression, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	suppression, exists := repository.suppressions[strings.ToLower(address)]
+	if !exists {
+		return nil, ErrSuppressionNotFound
+	}
+	copied := *suppression
+	return &copied, nil
+}
+
+// List returns copies of the suppressions matching the filter ordered by address
+func (repository *FileSuppressionRepository) List(_ context.Context, filter *SuppressionFilter) ([]*model.Suppression, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	after := strings.ToLower(filter.AfterAddress)
+	suppressions := []*model.Suppression{}
+	for address, suppression := range repository.suppressions {
+		if (filter.Reason != "" && suppression.Reason != filter.Reason) || (after != "" && address <= after) {
+			continue
+		}
+		copied := *suppression
+		suppressions = append(suppressions, &copied)
+	}
+	sort.Slice(suppressions, func(i, j int) bool {
+		return suppressions[i].Address < suppressions[j].Address
+	})
+	if filter.Limit > 0 && len(suppressions) > filter.Limit {
+		suppressions = suppressions[:filter.Limit]
+	}
+	return suppressions, nil
+}
+
+// persist saves the suppressions when the repository has a path
+func (repository *FileSuppressionRepository) persist() error {
+	if repository.path == "" {
+		return nil
+	}
+	return saveStore(repository.path, "suppression store", repository.suppressions)
+}
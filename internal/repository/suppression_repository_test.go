@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/model"
+)
+
+func TestFileSuppressionRepository(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Suppressions_Survive_Reopen", func(t *testing.T) {
+		storePath := filepath.Join(t.TempDir(), "store", "suppressions.json")
+		ctx := context.Background()
+
+		repository, err := NewFileSuppressionRepository(storePath)
+		assert.NoError(t, err)
+		assert.NoError(t, repository.Add(ctx, &model.Suppression{
+			Address:     "User@Example.com",
+			Reason:      model.SuppressionHardBounce,
+			Description: "550 5.1.1 User unknown",
+			MessageID:   "1",
+			CreatedAt:   now,
+		}))
+
+		reopened, err := NewFileSuppressionRepository(storePath)
+		assert.NoError(t, err)
+		suppression, err := reopened.Get(ctx, "user@EXAMPLE.com")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Suppression{
+			Address:     "user@example.com",
+			Reason:      model.SuppressionHardBounce,
+			Description: "550 5.1.1 User unknown",
+			MessageID:   "1",
+			CreatedAt:   now,
+		}, suppression)
+	})
+
+	t.Run("Add_Replaces_And_Remove_Deletes", func(t *testing.T) {
+		repository, _ := NewFileSuppressionRepository("")
+		ctx := context.Background()
+
+		assert.NoError(t, repository.Add(ctx, &model.Suppression{Address: "user@example.com", Reason: model.SuppressionHardBounce, CreatedAt: now}))
+		assert.NoError(t, repository.Add(ctx, &model.Suppression{Address: "user@example.com", Reason: model.SuppressionComplaint, CreatedAt: now.Add(time.Hour)}))
+		suppression, err := repository.Get(ctx, "user@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, model.SuppressionComplaint, suppression.Reason)
+
+		assert.NoError(t, repository.Remove(ctx, "USER@example.com"))
+		_, err = repository.Get(ctx, "user@example.com")
+		assert.ErrorIs(t, err, ErrSuppressionNotFound)
+		assert.ErrorIs(t, repository.Remove(ctx, "user@example.com"), ErrSuppressionNotFound)
+	})
+
+	t.Run("List_Filters_And_Pages", func(t *testing.T) {
+		repository, _ := NewFileSuppressionRepository("")
+		ctx := context.Background()
+
+		for _, address := range []string{"d@test.com", "b@test.com", "a@test.com", "c@test.com"} {
+			reason := model.SuppressionHardBounce
+			if address == "c@test.com" {
+				reason = model.SuppressionManual
+			}
+			assert.NoError(t, repository.Add(ctx, &model.Suppression{Address: address, Reason: reason, CreatedAt: now}))
+		}
+		addresses := func(suppressions []*model.Suppression) []string {
+			result := []string{}
+			for _, suppression := range suppressions {
+				result = append(result, suppression.Address)
+			}
+			return result
+		}
+
+		suppressions, err := repository.List(ctx, &SuppressionFilter{Limit: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a@test.com", "b@test.com"}, addresses(suppressions))
+
+		suppressions, err = repository.List(ctx, &SuppressionFilter{Reason: model.SuppressionHardBounce, AfterAddress: "b@test.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"d@test.com"}, addresses(suppressions))
+	})
+}
@@ -0,0 +1,88 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: resolver.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockProviderer is a mock of Providerer interface.
+type MockProviderer struct {
+	ctrl     *gomock.Controller
+	recorder *MockProvidererMockRecorder
+}
+
+// MockProvidererMockRecorder is the mock recorder for MockProviderer.
+type MockProvidererMockRecorder struct {
+	mock *MockProviderer
+}
+
+// NewMockProviderer creates a new mock instance.
+func NewMockProviderer(ctrl *gomock.Controller) *MockProviderer {
+	mock := &MockProviderer{ctrl: ctrl}
+	mock.recorder = &MockProvidererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProviderer) EXPECT() *MockProvidererMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockProviderer) Get(ctx context.Context, name string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, name)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockProvidererMockRecorder) Get(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockProviderer)(nil).Get), ctx, name)
+}
+
+// MockResolverer is a mock of Resolverer interface.
+type MockResolverer struct {
+	ctrl     *gomock.Controller
+	recorder *MockResolvererMockRecorder
+}
+
+// MockResolvererMockRecorder is the mock recorder for MockResolverer.
+type MockResolvererMockRecorder struct {
+	mock *MockResolverer
+}
+
+// NewMockResolverer creates a new mock instance.
+func NewMockResolverer(ctrl *gomock.Controller) *MockResolverer {
+	mock := &MockResolverer{ctrl: ctrl}
+	mock.recorder = &MockResolvererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResolverer) EXPECT() *MockResolvererMockRecorder {
+	return m.recorder
+}
+
+// Resolve mocks base method.
+func (m *MockResolverer) Resolve(ctx context.Context, value string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", ctx, value)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resolve indicates an expected call of Resolve.
+func (mr *MockResolvererMockRecorder) Resolve(ctx, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockResolverer)(nil).Resolve), ctx, value)
+}
@@ -0,0 +1,36 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileProvider reads the secrets from files, such as the ones mounted by Docker or Kubernetes
+type FileProvider struct{}
+
+var _ Providerer = &FileProvider{}
+
+// Get returns the content of the file without its trailing line break
+func (provider *FileProvider) Get(ctx context.Context, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// EnvProvider reads the secrets from environment variables
+type EnvProvider struct{}
+
+var _ Providerer = &EnvProvider{}
+
+// Get returns the value of the environment variable
+func (provider *EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return "", fmt.Errorf("Environment variable %s is not set", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,62 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Schemes of the secret references
+const (
+	// SchemeFile reads the secret from a file, as in file:///run/secrets/smtp
+	SchemeFile = "file"
+	// SchemeEnv reads the secret from an environment variable, as in env:SMTP_PASSWORD
+	SchemeEnv = "env"
+	// SchemeAWSSecretsManager reads the secret from AWS Secrets Manager, as in awssm://smtp
+	SchemeAWSSecretsManager = "awssm"
+)
+
+// Providerer is the interface for reading the secrets of a scheme by name
+type Providerer interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Resolverer is the interface for resolving the secret references of the configuration
+type Resolverer interface {
+	Resolve(ctx context.Context, value string) (string, error)
+}
+
+// Resolver resolves the secret references through the provider of their scheme
+type Resolver struct {
+	providers map[string]Providerer
+}
+
+var _ Resolverer = &Resolver{}
+
+// NewResolver creates a new resolver with the providers of the schemes
+func NewResolver(providers map[string]Providerer) *Resolver {
+	return &Resolver{providers: providers}
+}
+
+// Resolve returns the secret a reference points to. The values without the scheme of a
+// provider are not references and are returned as they are.
+func (resolver *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, name, found := strings.Cut(value, ":")
+	if !found {
+		return value, nil
+	}
+	provider, exists := resolver.providers[scheme]
+	if !exists {
+		return value, nil
+	}
+	name = strings.TrimPrefix(name, "//")
+	if name == "" {
+		return "", fmt.Errorf("Secret reference %s has no name", value)
+	}
+	secret, err := provider.Get(ctx, name)
+	if err != nil {
+		// The reference is safe to show, unlike the secret
+		return "", fmt.Errorf("Error resolving secret %s: %v", value, err)
+	}
+	return secret, nil
+}
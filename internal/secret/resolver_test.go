@@ -0,0 +1,76 @@
+package secret
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+	secretsManager := NewFakeSecretsManager(map[string]string{
+		"qd-email-api/smtp": "secrets_manager_password",
+	})
+	resolver := NewResolver(map[string]Providerer{
+		SchemeFile:              &FileProvider{},
+		SchemeEnv:               &EnvProvider{},
+		SchemeAWSSecretsManager: NewSecretsManagerProvider(secretsManager),
+	})
+	ctx := context.Background()
+
+	t.Run("Resolve_File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "smtp")
+		assert.NoError(t, os.WriteFile(path, []byte("file_password\n"), 0600))
+
+		secret, err := resolver.Resolve(ctx, "file://"+path)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "file_password", secret)
+	})
+
+	t.Run("Resolve_Env", func(t *testing.T) {
+		os.Setenv("TEST_SMTP_PASSWORD", "env_password")
+		defer os.Unsetenv("TEST_SMTP_PASSWORD")
+
+		secret, err := resolver.Resolve(ctx, "env:TEST_SMTP_PASSWORD")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "env_password", secret)
+	})
+
+	t.Run("Resolve_AWS_Secrets_Manager", func(t *testing.T) {
+		secret, err := resolver.Resolve(ctx, "awssm://qd-email-api/smtp")
+		assert.NoError(t, err)
+		assert.Equal(t, "secrets_manager_password", secret)
+
+		secretsManager.PutSecretValue("qd-email-api/smtp", "rotated_password")
+		secret, err = resolver.Resolve(ctx, "awssm://qd-email-api/smtp")
+		assert.NoError(t, err)
+		assert.Equal(t, "rotated_password", secret)
+	})
+
+	t.Run("Resolve_Plain_Values", func(t *testing.T) {
+		for _, value := range []string{"plain_password", "", "localhost:2526", "http://localhost:8086"} {
+			secret, err := resolver.Resolve(ctx, value)
+
+			assert.NoError(t, err)
+			assert.Equal(t, value, secret)
+		}
+	})
+
+	t.Run("Resolve_Errors", func(t *testing.T) {
+		_, err := resolver.Resolve(ctx, "awssm://qd-email-api/missing")
+		assert.ErrorContains(t, err, "Error resolving secret awssm://qd-email-api/missing: ResourceNotFoundException")
+
+		_, err = resolver.Resolve(ctx, "env:TEST_MISSING_PASSWORD")
+		assert.EqualError(t, err, "Error resolving secret env:TEST_MISSING_PASSWORD: Environment variable TEST_MISSING_PASSWORD is not set")
+
+		_, err = resolver.Resolve(ctx, "file:///missing/secret")
+		assert.ErrorContains(t, err, "Error resolving secret file:///missing/secret: open /missing/secret")
+
+		_, err = resolver.Resolve(ctx, "env:")
+		assert.EqualError(t, err, "Secret reference env: has no name")
+	})
+}
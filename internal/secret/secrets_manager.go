@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// SecretsManagerer is the interface for reading the secrets of AWS Secrets Manager
+type SecretsManagerer interface {
+	GetSecretValueWithContext(
+		ctx aws.Context,
+		input *secretsmanager.GetSecretValueInput,
+		options ...request.Option,
+	) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// NewAWSSecretsManager creates a client of AWS Secrets Manager in the region
+func NewAWSSecretsManager(region, key, secret string) (*secretsmanager.SecretsManager, error) {
+	awsSession, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(key, secret, ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secretsmanager.New(awsSession), nil
+}
+
+// SecretsManagerProvider reads the secrets from AWS Secrets Manager by name or ARN
+type SecretsManagerProvider struct {
+	client SecretsManagerer
+}
+
+var _ Providerer = &SecretsManagerProvider{}
+
+// NewSecretsManagerProvider creates a new provider of the secrets of AWS Secrets Manager
+func NewSecretsManagerProvider(client SecretsManagerer) *SecretsManagerProvider {
+	return &SecretsManagerProvider{client: client}
+}
+
+// Get returns the current version of the secret
+func (provider *SecretsManagerProvider) Get(ctx context.Context, name string) (string, error) {
+	output, err := provider.client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString != nil {
+		return *output.SecretString, nil
+	}
+	if output.SecretBinary != nil {
+		return string(output.SecretBinary), nil
+	}
+	return "", errors.New("Secret has no value")
+}
+
+// FakeSecretsManager is an in-memory stand-in of AWS Secrets Manager for tests
+type FakeSecretsManager struct {
+	mutex   sync.Mutex
+	secrets map[string]string
+}
+
+var _ SecretsManagerer = &FakeSecretsManager{}
+
+// NewFakeSecretsManager creates a fake secrets manager holding the given secrets by name
+func NewFakeSecretsManager(secrets map[string]string) *FakeSecretsManager {
+	fake := &FakeSecretsManager{secrets: make(map[string]string, len(secrets))}
+	for name, value := range secrets {
+		fake.secrets[name] = value
+	}
+	return fake
+}
+
+// GetSecretValueWithContext returns the secret, or the error of AWS Secrets Manager for
+// unknown secrets
+func (fake *FakeSecretsManager) GetSecretValueWithContext(
+	ctx aws.Context,
+	input *secretsmanager.GetSecretValueInput,
+	options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	name := aws.StringValue(input.SecretId)
+	value, exists := fake.secrets[name]
+	if !exists {
+		return nil, awserr.New(
+			secretsmanager.ErrCodeResourceNotFoundException,
+			"Secrets Manager can't find the specified secret.",
+			nil,
+		)
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+	}, nil
+}
+
+// PutSecretValue rotates the secret
+func (fake *FakeSecretsManager) PutSecretValue(name, value string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.secrets[name] = value
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"net/mail"
+	"strings"
+	textTemplate "text/template"
+)
+
+// BatchTemplate renders the subject and body of a batch for every recipient
+type BatchTemplate struct {
+	subject *textTemplate.Template
+	body    *htmlTemplate.Template
+}
+
+// NewBatchTemplate parses the subject and the HTML body of a batch
+func NewBatchTemplate(subject, body string) (*BatchTemplate, error) {
+	if strings.TrimSpace(subject) == "" {
+		return nil, errors.New("Template subject is required")
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("Template body is required")
+	}
+	subjectTemplate, err := textTemplate.New("subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template subject: %v", err)
+	}
+	bodyTemplate, err := htmlTemplate.New("body").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template body: %v", err)
+	}
+	return &BatchTemplate{
+		subject: subjectTemplate,
+		body:    bodyTemplate,
+	}, nil
+}
+
+// Render returns the subject and body for the given recipient variables.
+// Variables are HTML escaped in the body and every referenced variable is required.
+func (template *BatchTemplate) Render(variables map[string]string) (string, string, error) {
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	var subject bytes.Buffer
+	if err := template.subject.Execute(&subject, variables); err != nil {
+		return "", "", fmt.Errorf("Error rendering subject: %v", err)
+	}
+	if strings.ContainsAny(subject.String(), "\r\n") {
+		return "", "", errors.New("Rendered subject contains a line break")
+	}
+	var body bytes.Buffer
+	if err := template.body.Execute(&body, variables); err != nil {
+		return "", "", fmt.Errorf("Error rendering body: %v", err)
+	}
+	return subject.String(), body.String(), nil
+}
+
+// ValidateRecipient returns the bare address of a recipient or an error if it is not valid
+func ValidateRecipient(recipient string) (string, error) {
+	address, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return "", fmt.Errorf("Invalid recipient %q", recipient)
+	}
+	return address.Address, nil
+}
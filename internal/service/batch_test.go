@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchTemplate(test *testing.T) {
+	test.Run("Render_Escapes_Body_Variables", func(test *testing.T) {
+		template, err := NewBatchTemplate("Hello {{.name}}", "<p>Hi {{.name}}, your code is {{.code}}</p>")
+		assert.NoError(test, err)
+
+		subject, body, err := template.Render(map[string]string{"name": "<Gus>", "code": "1234"})
+
+		assert.NoError(test, err)
+		assert.Equal(test, "Hello <Gus>", subject)
+		assert.Equal(test, "<p>Hi &lt;Gus&gt;, your code is 1234</p>", body)
+	})
+
+	test.Run("Render_Missing_Variable_Error", func(test *testing.T) {
+		template, err := NewBatchTemplate("Hello {{.name}}", "Body")
+		assert.NoError(test, err)
+
+		_, _, err = template.Render(nil)
+
+		assert.ErrorContains(test, err, "Error rendering subject")
+	})
+
+	test.Run("Render_Subject_Line_Break_Error", func(test *testing.T) {
+		template, err := NewBatchTemplate("Hello {{.name}}", "Body")
+		assert.NoError(test, err)
+
+		_, _, err = template.Render(map[string]string{"name": "Gus\r\nBcc: other@test.com"})
+
+		assert.EqualError(test, err, "Rendered subject contains a line break")
+	})
+
+	test.Run("Invalid_Template_Error", func(test *testing.T) {
+		_, err := NewBatchTemplate("Hello {{.name", "Body")
+		assert.ErrorContains(test, err, "Invalid template subject")
+
+		_, err = NewBatchTemplate("Subject", "")
+		assert.EqualError(test, err, "Template body is required")
+	})
+
+	test.Run("Validate_Recipient", func(test *testing.T) {
+		address, err := ValidateRecipient("Gus <gus@test.com>")
+		assert.NoError(test, err)
+		assert.Equal(test, "gus@test.com", address)
+
+		_, err = ValidateRecipient("not an email")
+		assert.EqualError(test, err, `Invalid recipient "not an email"`)
+	})
+}
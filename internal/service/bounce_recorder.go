@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+)
+
+// BounceRecorder records the bounces and complaints received on the emails they refer to
+// and suppresses the recipients of the hard bounces and of the complaints
+type BounceRecorder struct {
+	repository            repository.MessageRepositoryer
+	suppressionRepository repository.SuppressionRepositoryer
+	clock                 clock.Clocker
+	logger                log.Loggerer
+}
+
+var _ bounce.Handlerer = &BounceRecorder{}
+
+// NewBounceRecorder creates a new bounce recorder
+func NewBounceRecorder(
+	repository repository.MessageRepositoryer,
+	suppressionRepository repository.SuppressionRepositoryer,
+	clock clock.Clocker,
+	logger log.Loggerer,
+) *BounceRecorder {
+	return &BounceRecorder{
+		repository:            repository,
+		suppressionRepository: suppressionRepository,
+		clock:                 clock,
+		logger:                logger,
+	}
+}
+
+// HandleBounce marks a sent email as bounced or delivered. Delays are only logged, as the
+// recipient server keeps retrying them. Bounces that do not match a sent email are ignored.
+// The recipients of permanent failures are suppressed so they are not emailed again.
+func (recorder *BounceRecorder) HandleBounce(ctx context.Context, bounced *bounce.Bounce) error {
+	message, err := recorder.repository.GetByID(ctx, bounced.MessageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		recorder.logger.Warn(fmt.Sprintf("Bounce for unknown email %s", bounced.MessageID))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting bounced email: %v", err)
+	}
+	report, found := bounced.ReportFor(message.To)
+	if !found {
+		recorder.logger.Warn(fmt.Sprintf("Bounce for email %s does not report its recipient", bounced.MessageID))
+		return nil
+	}
+
+	change := model.StatusChange{
+		Time:     recorder.clock.Now(),
+		Response: getBounceResponse(&report),
+	}
+	var from []model.Status
+	switch report.Action {
+	case bounce.ActionFailed:
+		change.Status = model.StatusBounced
+		from = []model.Status{model.StatusSent, model.StatusDelivered}
+	case bounce.ActionDelivered, bounce.ActionRelayed, bounce.ActionExpanded:
+		change.Status = model.StatusDelivered
+		from = []model.Status{model.StatusSent}
+	default:
+		recorder.logger.Info(fmt.Sprintf("Email %s delayed by the recipient server: %s", bounced.MessageID, change.Response))
+		return nil
+	}
+	for _, status := range from {
+		err := recorder.repository.UpdateStatus(ctx, bounced.MessageID, status, change)
+		if errors.Is(err, repository.ErrStatusConflict) {
+			continue
+		}
+		if err != nil || change.Status != model.StatusBounced || isSoftBounce(&report) {
+			return err
+		}
+		if err := recorder.suppress(ctx, message, model.SuppressionHardBounce, change); err != nil {
+			return err
+		}
+		recorder.logger.Info(fmt.Sprintf("Recipient of email %s suppressed after a hard bounce", message.ID))
+		return nil
+	}
+	recorder.logger.Warn(fmt.Sprintf("Bounce for email %s ignored in status %s", bounced.MessageID, message.Status))
+	return nil
+}
+
+// HandleComplaint marks a sent or delivered email as complained and suppresses its
+// recipient, who then only receives the critical emails. Reports other than abuse, such
+// as fraud or virus reports, are only logged.
+func (recorder *BounceRecorder) HandleComplaint(ctx context.Context, complaint *bounce.Complaint) error {
+	message, err := recorder.repository.GetByID(ctx, complaint.MessageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		recorder.logger.Warn(fmt.Sprintf("Complaint for unknown email %s", complaint.MessageID))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting complained email: %v", err)
+	}
+	if complaint.FeedbackType != bounce.FeedbackAbuse {
+		recorder.logger.Info(fmt.Sprintf("Feedback report %s for email %s ignored", complaint.FeedbackType, complaint.MessageID))
+		return nil
+	}
+
+	change := model.StatusChange{
+		Status:   model.StatusComplained,
+		Time:     recorder.clock.Now(),
+		Response: getComplaintResponse(complaint),
+	}
+	updated := false
+	for _, status := range []model.Status{model.StatusSent, model.StatusDelivered} {
+		err := recorder.repository.UpdateStatus(ctx, complaint.MessageID, status, change)
+		if errors.Is(err, repository.ErrStatusConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		updated = true
+		break
+	}
+	// The recipient is suppressed even when the email moved on, as they do not want more
+	if !updated {
+		recorder.logger.Warn(fmt.Sprintf("Complaint for email %s not recorded in status %s", complaint.MessageID, message.Status))
+	}
+	if err := recorder.suppress(ctx, message, model.SuppressionComplaint, change); err != nil {
+		return err
+	}
+	recorder.logger.Info(fmt.Sprintf("Recipient of email %s suppressed after a complaint", message.ID))
+	return nil
+}
+
+func (recorder *BounceRecorder) suppress(ctx context.Context, message *model.Message, reason model.SuppressionReason, change model.StatusChange) error {
+	err := recorder.suppressionRepository.Add(ctx, &model.Suppression{
+		Address:     message.To,
+		Reason:      reason,
+		Description: change.Response,
+		MessageID:   message.ID,
+		CreatedAt:   change.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("Error suppressing recipient: %v", err)
+	}
+	return nil
+}
+
+// isSoftBounce reports whether a failure has a temporary status, as some servers give
+// up on temporary errors such as a full mailbox
+func isSoftBounce(report *bounce.Report) bool {
+	return strings.HasPrefix(report.Status, "4")
+}
+
+func getBounceResponse(report *bounce.Report) string {
+	switch {
+	case report.Diagnostic == "":
+		return report.Status
+	case report.Status == "" || strings.Contains(report.Diagnostic, report.Status):
+		return report.Diagnostic
+	}
+	return report.Status + " " + report.Diagnostic
+}
+
+func getComplaintResponse(complaint *bounce.Complaint) string {
+	if complaint.UserAgent == "" {
+		return complaint.FeedbackType + " report"
+	}
+	return complaint.FeedbackType + " report from " + complaint.UserAgent
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+)
+
+func TestBounceRecorder(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T, status model.Status) (*BounceRecorder, *repository.FileMessageRepository, *repository.FileSuppressionRepository, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		message := &model.Message{ID: "1", To: "user@example.com", CreatedAt: now}
+		message.Record(model.StatusChange{Status: status, Time: now})
+		assert.NoError(test, messageRepository.Insert(context.Background(), message))
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		recorder := NewBounceRecorder(messageRepository, suppressionRepository, clock.NewFakeClock(now.Add(time.Hour)), loggerMock)
+		return recorder, messageRepository, suppressionRepository, loggerMock, controller
+	}
+	newBounce := func(action bounce.Action, status string) *bounce.Bounce {
+		return &bounce.Bounce{
+			MessageID: "1",
+			Reports: []bounce.Report{{
+				Recipient:  "User@Example.com",
+				Action:     action,
+				Status:     status,
+				Diagnostic: "smtp error",
+			}},
+		}
+	}
+	lastChange := func(messageRepository *repository.FileMessageRepository) model.StatusChange {
+		message, err := messageRepository.GetByID(context.Background(), "1")
+		assert.NoError(test, err)
+		return message.History[len(message.History)-1]
+	}
+
+	test.Run("Failed_Report_Marks_Bounced_And_Suppresses", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Recipient of email 1 suppressed after a hard bounce").Times(1)
+
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionFailed, "5.1.1")))
+		assert.Equal(test, model.StatusChange{
+			Status:   model.StatusBounced,
+			Time:     now.Add(time.Hour),
+			Response: "5.1.1 smtp error",
+		}, lastChange(messageRepository))
+		suppression, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.NoError(test, err)
+		assert.Equal(test, &model.Suppression{
+			Address:     "user@example.com",
+			Reason:      model.SuppressionHardBounce,
+			Description: "5.1.1 smtp error",
+			MessageID:   "1",
+			CreatedAt:   now.Add(time.Hour),
+		}, suppression)
+	})
+
+	test.Run("Soft_Bounce_Is_Not_Suppressed", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, _, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionFailed, "4.2.2")))
+		assert.Equal(test, model.StatusBounced, lastChange(messageRepository).Status)
+		_, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.ErrorIs(test, err, repository.ErrSuppressionNotFound)
+	})
+
+	test.Run("Delivered_Report_Marks_Delivered", func(test *testing.T) {
+		recorder, messageRepository, _, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info(gomock.Any()).Times(1)
+
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionRelayed, "2.0.0")))
+		assert.Equal(test, model.StatusDelivered, lastChange(messageRepository).Status)
+
+		// A delivered email can still bounce later
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionFailed, "5.2.2")))
+		assert.Equal(test, model.StatusBounced, lastChange(messageRepository).Status)
+	})
+
+	test.Run("Recipient_Report_Is_Chosen", func(test *testing.T) {
+		recorder, messageRepository, _, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info(gomock.Any()).Times(1)
+
+		bounced := newBounce(bounce.ActionFailed, "5.1.1")
+		bounced.Reports = append([]bounce.Report{{Recipient: "other@example.com", Action: bounce.ActionDelayed}}, bounced.Reports...)
+
+		assert.NoError(test, recorder.HandleBounce(context.Background(), bounced))
+		assert.Equal(test, model.StatusBounced, lastChange(messageRepository).Status)
+	})
+
+	test.Run("Delayed_Report_Is_Logged", func(test *testing.T) {
+		recorder, messageRepository, _, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Email 1 delayed by the recipient server: 4.2.2 smtp error").Times(1)
+
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionDelayed, "4.2.2")))
+		assert.Equal(test, model.StatusSent, lastChange(messageRepository).Status)
+	})
+
+	test.Run("Mismatched_Bounces_Are_Ignored", func(test *testing.T) {
+		recorder, messageRepository, _, loggerMock, controller := setup(test, model.StatusScheduled)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Bounce for unknown email 2").Times(1)
+		unknown := newBounce(bounce.ActionFailed, "5.1.1")
+		unknown.MessageID = "2"
+		assert.NoError(test, recorder.HandleBounce(context.Background(), unknown))
+
+		loggerMock.EXPECT().Warn("Bounce for email 1 does not report its recipient").Times(1)
+		other := newBounce(bounce.ActionFailed, "5.1.1")
+		other.Reports[0].Recipient = "other@example.com"
+		other.Reports = append(other.Reports, bounce.Report{Recipient: "another@example.com", Action: bounce.ActionFailed})
+		assert.NoError(test, recorder.HandleBounce(context.Background(), other))
+
+		loggerMock.EXPECT().Warn("Bounce for email 1 ignored in status scheduled").Times(1)
+		assert.NoError(test, recorder.HandleBounce(context.Background(), newBounce(bounce.ActionFailed, "5.1.1")))
+		assert.Equal(test, model.StatusScheduled, lastChange(messageRepository).Status)
+	})
+	test.Run("Complaint_Marks_Complained_And_Suppresses", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, loggerMock, controller := setup(test, model.StatusDelivered)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Recipient of email 1 suppressed after a complaint").Times(1)
+
+		assert.NoError(test, recorder.HandleComplaint(context.Background(), &bounce.Complaint{
+			MessageID:    "1",
+			FeedbackType: bounce.FeedbackAbuse,
+			UserAgent:    "ExampleFBL/1.0",
+		}))
+		assert.Equal(test, model.StatusChange{
+			Status:   model.StatusComplained,
+			Time:     now.Add(time.Hour),
+			Response: "abuse report from ExampleFBL/1.0",
+		}, lastChange(messageRepository))
+		suppression, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.NoError(test, err)
+		assert.Equal(test, model.SuppressionComplaint, suppression.Reason)
+		assert.Equal(test, "1", suppression.MessageID)
+	})
+
+	test.Run("Complaint_Suppresses_In_Any_Status", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, loggerMock, controller := setup(test, model.StatusBounced)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Complaint for email 1 not recorded in status bounced").Times(1)
+		loggerMock.EXPECT().Info("Recipient of email 1 suppressed after a complaint").Times(1)
+
+		assert.NoError(test, recorder.HandleComplaint(context.Background(), &bounce.Complaint{MessageID: "1", FeedbackType: bounce.FeedbackAbuse}))
+		assert.Equal(test, model.StatusBounced, lastChange(messageRepository).Status)
+		suppression, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.NoError(test, err)
+		assert.Equal(test, "abuse report", suppression.Description)
+	})
+
+	test.Run("Other_Feedback_Is_Ignored", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Complaint for unknown email 2").Times(1)
+		assert.NoError(test, recorder.HandleComplaint(context.Background(), &bounce.Complaint{MessageID: "2", FeedbackType: bounce.FeedbackAbuse}))
+
+		loggerMock.EXPECT().Info("Feedback report fraud for email 1 ignored").Times(1)
+		assert.NoError(test, recorder.HandleComplaint(context.Background(), &bounce.Complaint{MessageID: "1", FeedbackType: "fraud"}))
+		assert.Equal(test, model.StatusSent, lastChange(messageRepository).Status)
+		_, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.ErrorIs(test, err, repository.ErrSuppressionNotFound)
+	})
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+)
+
+// maxDeferrals is how many times an email is deferred before it is marked as failed
+const maxDeferrals = 10
+
+// DeliveryTracker records the delivery of the queued emails in their lifecycle. Each
+// email is claimed before sending so it is never delivered twice.
+type DeliveryTracker struct {
+	emailService EmailServicer
+	repository   repository.MessageRepositoryer
+	clock        clock.Clocker
+	logger       log.Loggerer
+}
+
+var _ EmailServicer = &DeliveryTracker{}
+
+// NewDeliveryTracker creates a new delivery tracker
+func NewDeliveryTracker(
+	emailService EmailServicer,
+	repository repository.MessageRepositoryer,
+	clock clock.Clocker,
+	logger log.Loggerer,
+) *DeliveryTracker {
+	return &DeliveryTracker{
+		emailService: emailService,
+		repository:   repository,
+		clock:        clock,
+		logger:       logger,
+	}
+}
+
+// SendEmail sends a queued email and records whether it was sent, deferred, skipped as the
+// recipient opted out of its category, or failed
+func (tracker *DeliveryTracker) SendEmail(ctx context.Context, message *model.Message) error {
+	err := tracker.repository.UpdateStatus(ctx, message.ID, model.StatusQueued, model.StatusChange{
+		Status: model.StatusSending,
+		Time:   tracker.clock.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("Error claiming email %s: %w", message.ID, err)
+	}
+
+	sendError := tracker.emailService.SendEmail(ctx, message)
+	change := model.StatusChange{
+		Status: model.StatusSent,
+		Time:   tracker.clock.Now(),
+	}
+	var deferred *DeferredError
+	var optedOut *OptedOutError
+	switch {
+	case errors.As(sendError, &optedOut):
+		change.Status = model.StatusUnsubscribed
+		change.Response = sendError.Error()
+		err = tracker.repository.UpdateStatus(ctx, message.ID, model.StatusSending, change)
+	case errors.As(sendError, &deferred) && message.Deferrals < maxDeferrals:
+		change.Status = model.StatusDeferred
+		change.Response = sendError.Error()
+		err = tracker.repository.Reschedule(ctx, message.ID, change.Time.Add(deferred.RetryAfter), change)
+	case sendError != nil:
+		change.Status = model.StatusFailed
+		change.Response = sendError.Error()
+		err = tracker.repository.UpdateStatus(ctx, message.ID, model.StatusSending, change)
+	default:
+		err = tracker.repository.UpdateStatus(ctx, message.ID, model.StatusSending, change)
+	}
+	if err != nil {
+		tracker.logger.Error(err, fmt.Sprintf("Error recording the delivery of email %s", message.ID))
+	}
+	if deferred != nil && change.Status == model.StatusFailed {
+		return fmt.Errorf("Email %s deferred too many times: %v", message.ID, sendError)
+	}
+	return sendError
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/tracing"
+)
+
+// ErrDispatcherClosed is returned when an email is dispatched after the dispatcher was closed
+var ErrDispatcherClosed = errors.New("Dispatcher is closed")
+
+// LaneConfig is the worker budget of a sending lane
+type LaneConfig struct {
+	Concurrency int
+	QueueSize   int
+}
+
+// Dispatcherer is the interface for sending emails through prioritized lanes
+type Dispatcherer interface {
+	SendEmail(ctx context.Context, message *model.Message) error
+	Stats() map[model.Priority]model.LaneStats
+	Close()
+}
+
+type dispatchJob struct {
+	ctx      context.Context
+	message  *model.Message
+	queuedAt time.Time
+	// span covers the time the email waits in its lane
+	span   trace.Span
+	result chan error
+}
+
+type lane struct {
+	queue    chan *dispatchJob
+	inFlight atomic.Int64
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+	maxWait  atomic.Int64
+	dequeued atomic.Uint64
+	waited   atomic.Int64
+}
+
+// Dispatcher queues emails per priority and sends them with a separate worker
+// budget per lane. Workers of a lane also take work from the lanes with a higher
+// priority whenever there is any, so bulk traffic never delays critical emails.
+type Dispatcher struct {
+	emailService EmailServicer
+	clock        clock.Clocker
+	lanes        map[model.Priority]*lane
+	mutex        sync.RWMutex
+	closed       bool
+	stop         chan struct{}
+	waitGroup    sync.WaitGroup
+}
+
+var _ Dispatcherer = &Dispatcher{}
+var _ EmailServicer = &Dispatcher{}
+
+// NewDispatcher creates a dispatcher and starts the workers of every lane
+func NewDispatcher(
+	emailService EmailServicer,
+	clock clock.Clocker,
+	laneConfigs map[model.Priority]LaneConfig,
+) (*Dispatcher, error) {
+	dispatcher := &Dispatcher{
+		emailService: emailService,
+		clock:        clock,
+		lanes:        make(map[model.Priority]*lane),
+		stop:         make(chan struct{}),
+	}
+	for _, priority := range model.Priorities {
+		laneConfig := laneConfigs[priority]
+		if laneConfig.Concurrency < 1 {
+			return nil, fmt.Errorf("Lane %s needs at least one worker", priority)
+		}
+		if laneConfig.QueueSize < 0 {
+			return nil, fmt.Errorf("Lane %s queue size cannot be negative", priority)
+		}
+		dispatcher.lanes[priority] = &lane{
+			queue: make(chan *dispatchJob, laneConfig.QueueSize),
+		}
+	}
+	for index, priority := range model.Priorities {
+		for worker := 0; worker < laneConfigs[priority].Concurrency; worker++ {
+			dispatcher.waitGroup.Add(1)
+			go dispatcher.work(model.Priorities[:index+1])
+		}
+	}
+	return dispatcher, nil
+}
+
+// SendEmail queues the email in the lane of its priority and waits for it to be sent. The
+// email is dropped when the context ends before it leaves its lane, so the callers that
+// stored it as queued detach it from the context of their request.
+func (dispatcher *Dispatcher) SendEmail(ctx context.Context, message *model.Message) error {
+	lane, exists := dispatcher.lanes[message.Priority]
+	if !exists {
+		lane = dispatcher.lanes[model.PriorityTransactional]
+	}
+	_, span := tracing.Start(ctx, "email.queue", attribute.String("email.priority", string(message.Priority)))
+	job := &dispatchJob{
+		ctx:      ctx,
+		message:  message,
+		queuedAt: dispatcher.clock.Now(),
+		span:     span,
+		result:   make(chan error, 1),
+	}
+
+	dispatcher.mutex.RLock()
+	if dispatcher.closed {
+		dispatcher.mutex.RUnlock()
+		tracing.End(span, ErrDispatcherClosed)
+		return ErrDispatcherClosed
+	}
+	select {
+	case lane.queue <- job:
+		dispatcher.mutex.RUnlock()
+	case <-ctx.Done():
+		dispatcher.mutex.RUnlock()
+		tracing.End(span, ctx.Err())
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-job.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work sends the jobs of the given lanes, which are ordered from the highest priority
+func (dispatcher *Dispatcher) work(priorities []model.Priority) {
+	defer dispatcher.waitGroup.Done()
+	for {
+		job, jobLane := dispatcher.next(priorities)
+		if job == nil {
+			return
+		}
+		dispatcher.send(job, jobLane)
+	}
+}
+
+// next returns the queued job with the highest priority, waiting for one if all
+// lanes are empty. It returns nil once the dispatcher is closed and the lanes are drained.
+func (dispatcher *Dispatcher) next(priorities []model.Priority) (*dispatchJob, *lane) {
+	if job, jobLane := dispatcher.poll(priorities); job != nil {
+		return job, jobLane
+	}
+	// Every worker takes from its own lane and may take from up to two higher lanes
+	var queues [3]chan *dispatchJob
+	for index, priority := range priorities {
+		queues[index] = dispatcher.lanes[priority].queue
+	}
+	select {
+	case job := <-queues[0]:
+		return job, dispatcher.lanes[priorities[0]]
+	case job := <-queues[1]:
+		return job, dispatcher.lanes[priorities[1]]
+	case job := <-queues[2]:
+		return job, dispatcher.lanes[priorities[2]]
+	case <-dispatcher.stop:
+		return dispatcher.poll(priorities)
+	}
+}
+
+// poll returns the queued job with the highest priority without waiting
+func (dispatcher *Dispatcher) poll(priorities []model.Priority) (*dispatchJob, *lane) {
+	for _, priority := range priorities {
+		select {
+		case job := <-dispatcher.lanes[priority].queue:
+			return job, dispatcher.lanes[priority]
+		default:
+		}
+	}
+	return nil, nil
+}
+
+func (dispatcher *Dispatcher) send(job *dispatchJob, jobLane *lane) {
+	wait := dispatcher.clock.Now().Sub(job.queuedAt)
+	jobLane.dequeued.Add(1)
+	jobLane.waited.Add(int64(wait))
+	for {
+		maxWait := jobLane.maxWait.Load()
+		if int64(wait) <= maxWait || jobLane.maxWait.CompareAndSwap(maxWait, int64(wait)) {
+			break
+		}
+	}
+	// The caller gave up before the email left the queue
+	if err := job.ctx.Err(); err != nil {
+		tracing.End(job.span, err)
+		job.result <- err
+		return
+	}
+	tracing.End(job.span, nil)
+
+	jobLane.inFlight.Add(1)
+	err := dispatcher.emailService.SendEmail(job.ctx, job.message)
+	jobLane.inFlight.Add(-1)
+	if err != nil {
+		jobLane.failed.Add(1)
+	} else {
+		jobLane.sent.Add(1)
+	}
+	job.result <- err
+}
+
+// Stats returns a snapshot of the activity of every lane
+func (dispatcher *Dispatcher) Stats() map[model.Priority]model.LaneStats {
+	stats := make(map[model.Priority]model.LaneStats, len(dispatcher.lanes))
+	for priority, lane := range dispatcher.lanes {
+		stats[priority] = model.LaneStats{
+			Depth:     len(lane.queue),
+			Capacity:  cap(lane.queue),
+			InFlight:  lane.inFlight.Load(),
+			Sent:      lane.sent.Load(),
+			Failed:    lane.failed.Load(),
+			MaxWait:   time.Duration(lane.maxWait.Load()),
+			Dequeued:  lane.dequeued.Load(),
+			TotalWait: time.Duration(lane.waited.Load()),
+		}
+	}
+	return stats
+}
+
+// Close stops accepting emails, sends the ones already queued and stops the workers
+func (dispatcher *Dispatcher) Close() {
+	dispatcher.mutex.Lock()
+	if dispatcher.closed {
+		dispatcher.mutex.Unlock()
+		return
+	}
+	dispatcher.closed = true
+	dispatcher.mutex.Unlock()
+
+	close(dispatcher.stop)
+	dispatcher.waitGroup.Wait()
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+)
+
+// blockingEmailService records the order of the sent emails and holds the
+// emails with a registered gate until the gate is closed
+type blockingEmailService struct {
+	mutex   sync.Mutex
+	sent    []string
+	started map[string]chan struct{}
+	gates   map[string]chan struct{}
+}
+
+func newBlockingEmailService() *blockingEmailService {
+	return &blockingEmailService{
+		started: make(map[string]chan struct{}),
+		gates:   make(map[string]chan struct{}),
+	}
+}
+
+func (service *blockingEmailService) block(id string) (started chan struct{}, release chan struct{}) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.started[id] = make(chan struct{})
+	service.gates[id] = make(chan struct{})
+	return service.started[id], service.gates[id]
+}
+
+func (service *blockingEmailService) SendEmail(_ context.Context, message *model.Message) error {
+	service.mutex.Lock()
+	started, gate := service.started[message.ID], service.gates[message.ID]
+	service.mutex.Unlock()
+	if gate != nil {
+		close(started)
+		<-gate
+	}
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.sent = append(service.sent, message.ID)
+	if message.To == wrongEmail {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
+
+func (service *blockingEmailService) order() []string {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	return append([]string{}, service.sent...)
+}
+
+const wrongEmail = "wrong@email.com"
+
+func TestDispatcher(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	laneConfigs := map[model.Priority]LaneConfig{
+		model.PriorityCritical:      {Concurrency: 1, QueueSize: 5},
+		model.PriorityTransactional: {Concurrency: 1, QueueSize: 5},
+		model.PriorityBulk:          {Concurrency: 1, QueueSize: 5},
+	}
+	newMessage := func(id string, priority model.Priority) *model.Message {
+		return &model.Message{ID: id, To: "test@test.com", Priority: priority}
+	}
+	dispatchAsync := func(dispatcher *Dispatcher, message *model.Message) chan error {
+		result := make(chan error, 1)
+		go func() {
+			result <- dispatcher.SendEmail(context.Background(), message)
+		}()
+		return result
+	}
+	waitForDepth := func(dispatcher *Dispatcher, priority model.Priority, depth int) {
+		for dispatcher.Stats()[priority].Depth != depth {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	test.Run("Invalid_Lane_Config_Error", func(test *testing.T) {
+		dispatcher, err := NewDispatcher(newBlockingEmailService(), clock.NewFakeClock(now), map[model.Priority]LaneConfig{
+			model.PriorityCritical: {Concurrency: 1},
+		})
+
+		assert.EqualError(test, err, "Lane transactional needs at least one worker")
+		assert.Nil(test, dispatcher)
+	})
+
+	test.Run("Send_Email_Returns_Delivery_Result", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		dispatcher, err := NewDispatcher(emailService, clock.NewFakeClock(now), laneConfigs)
+		assert.NoError(test, err)
+		defer dispatcher.Close()
+
+		assert.NoError(test, dispatcher.SendEmail(context.Background(), newMessage("1", model.PriorityBulk)))
+		failing := newMessage("2", "")
+		failing.To = wrongEmail
+		assert.EqualError(test, dispatcher.SendEmail(context.Background(), failing), "Invalid email address")
+
+		stats := dispatcher.Stats()
+		assert.Equal(test, uint64(1), stats[model.PriorityBulk].Sent)
+		assert.Equal(test, uint64(1), stats[model.PriorityTransactional].Failed)
+		assert.Equal(test, uint64(1), stats[model.PriorityBulk].Dequeued)
+		assert.Equal(test, time.Duration(0), stats[model.PriorityBulk].TotalWait)
+	})
+
+	test.Run("Critical_Email_Does_Not_Wait_Behind_Bulk", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		dispatcher, err := NewDispatcher(emailService, clock.NewFakeClock(now), laneConfigs)
+		assert.NoError(test, err)
+		defer dispatcher.Close()
+
+		started, release := emailService.block("bulk-1")
+		bulkResults := []chan error{dispatchAsync(dispatcher, newMessage("bulk-1", model.PriorityBulk))}
+		<-started
+		for _, id := range []string{"bulk-2", "bulk-3"} {
+			bulkResults = append(bulkResults, dispatchAsync(dispatcher, newMessage(id, model.PriorityBulk)))
+		}
+		waitForDepth(dispatcher, model.PriorityBulk, 2)
+
+		assert.NoError(test, dispatcher.SendEmail(context.Background(), newMessage("critical", model.PriorityCritical)))
+		assert.Equal(test, []string{"critical"}, emailService.order())
+		assert.Equal(test, int64(1), dispatcher.Stats()[model.PriorityBulk].InFlight)
+
+		close(release)
+		for _, result := range bulkResults {
+			assert.NoError(test, <-result)
+		}
+	})
+
+	test.Run("Idle_Bulk_Worker_Takes_Critical_First", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		dispatcher, err := NewDispatcher(emailService, clock.NewFakeClock(now), laneConfigs)
+		assert.NoError(test, err)
+		defer dispatcher.Close()
+
+		// Occupy the workers from the lowest lane up, as idle workers help higher lanes
+		bulkStarted, bulkRelease := emailService.block("bulk-1")
+		bulkResult := dispatchAsync(dispatcher, newMessage("bulk-1", model.PriorityBulk))
+		<-bulkStarted
+		transactionalStarted, transactionalRelease := emailService.block("transactional-1")
+		transactionalResult := dispatchAsync(dispatcher, newMessage("transactional-1", model.PriorityTransactional))
+		<-transactionalStarted
+		criticalStarted, criticalRelease := emailService.block("critical-1")
+		criticalResult := dispatchAsync(dispatcher, newMessage("critical-1", model.PriorityCritical))
+		<-criticalStarted
+
+		// Queue bulk work before critical work while every worker is busy
+		bulkWaiting := dispatchAsync(dispatcher, newMessage("bulk-2", model.PriorityBulk))
+		waitForDepth(dispatcher, model.PriorityBulk, 1)
+		criticalWaiting := dispatchAsync(dispatcher, newMessage("critical-2", model.PriorityCritical))
+		waitForDepth(dispatcher, model.PriorityCritical, 1)
+
+		close(bulkRelease)
+		assert.NoError(test, <-bulkResult)
+		assert.NoError(test, <-criticalWaiting)
+		assert.NoError(test, <-bulkWaiting)
+		assert.Equal(test, []string{"bulk-1", "critical-2", "bulk-2"}, emailService.order())
+
+		close(criticalRelease)
+		close(transactionalRelease)
+		assert.NoError(test, <-criticalResult)
+		assert.NoError(test, <-transactionalResult)
+	})
+
+	test.Run("Queue_Wait_Is_Traced", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		dispatcher, err := NewDispatcher(emailService, clock.NewFakeClock(now), laneConfigs)
+		assert.NoError(test, err)
+		defer dispatcher.Close()
+		recorder := tracetest.NewSpanRecorder()
+		ctx, request := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "request")
+
+		assert.NoError(test, dispatcher.SendEmail(ctx, newMessage("1", model.PriorityBulk)))
+		request.End()
+
+		spans := recorder.Ended()
+		assert.Len(test, spans, 2)
+		assert.Equal(test, "email.queue", spans[0].Name())
+		assert.Equal(test, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Contains(test, spans[0].Attributes(), attribute.String("email.priority", "bulk"))
+	})
+
+	test.Run("Close_Sends_Queued_Emails", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		dispatcher, err := NewDispatcher(emailService, clock.NewFakeClock(now), laneConfigs)
+		assert.NoError(test, err)
+
+		started, release := emailService.block("bulk-1")
+		first := dispatchAsync(dispatcher, newMessage("bulk-1", model.PriorityBulk))
+		<-started
+		second := dispatchAsync(dispatcher, newMessage("bulk-2", model.PriorityBulk))
+		waitForDepth(dispatcher, model.PriorityBulk, 1)
+
+		closed := make(chan struct{})
+		go func() {
+			dispatcher.Close()
+			close(closed)
+		}()
+		close(release)
+		<-closed
+
+		assert.NoError(test, <-first)
+		assert.NoError(test, <-second)
+		assert.ErrorIs(test, dispatcher.SendEmail(context.Background(), newMessage("3", model.PriorityBulk)), ErrDispatcherClosed)
+	})
+}
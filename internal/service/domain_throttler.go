@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+)
+
+const (
+	// busyRetryAfter is when an email is retried after every connection to its domain stayed busy
+	busyRetryAfter = 5 * time.Second
+	// deferralRetryAfter is when an email deferred by its domain is retried
+	deferralRetryAfter = time.Minute
+	// deferralBackoff is the factor applied to the rate of a domain when it defers an email
+	deferralBackoff = 0.5
+	// recoveryStep is the fraction of the configured rate recovered with every accepted email
+	recoveryStep = 0.1
+	// minRateFraction is the fraction of the configured rate a domain is never slowed below
+	minRateFraction = 0.05
+)
+
+// defaultDomainLimit is used for the domains without a configured limit when no default is configured
+var defaultDomainLimit = DomainLimit{Concurrency: 4, Rate: 10, Burst: 10}
+
+// DomainLimit is the delivery budget of a recipient domain
+type DomainLimit struct {
+	Concurrency int
+	Rate        float64
+	Burst       int
+}
+
+// DeferredError is returned when the delivery of an email was postponed and should be retried later
+type DeferredError struct {
+	Domain     string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (err *DeferredError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("Delivery to %s deferred, retry after %s: %v", err.Domain, err.RetryAfter, err.Err)
+	}
+	return fmt.Sprintf("Delivery to %s deferred, retry after %s", err.Domain, err.RetryAfter)
+}
+
+func (err *DeferredError) Unwrap() error {
+	return err.Err
+}
+
+type domainBudget struct {
+	limit   DomainLimit
+	maxWait time.Duration
+	slots   chan struct{}
+	limiter *rate.Limiter
+	rate    float64
+}
+
+// DomainThrottler sends emails with a separate concurrency and rate budget per recipient
+// domain. The rate of a domain is halved whenever it defers an email and recovers gradually
+// with every email it accepts. Emails that would wait longer than the maximum wait are
+// deferred instead, so a slow domain never holds up the delivery to the rest.
+type DomainThrottler struct {
+	emailService EmailServicer
+	clock        clock.Clocker
+	defaultLimit DomainLimit
+	limits       map[string]DomainLimit
+	maxWait      time.Duration
+	mutex        sync.Mutex
+	domains      map[string]*domainBudget
+}
+
+var _ EmailServicer = &DomainThrottler{}
+
+// NewDomainThrottler creates a new domain throttler
+func NewDomainThrottler(
+	emailService EmailServicer,
+	clock clock.Clocker,
+	defaultLimit DomainLimit,
+	limits map[string]DomainLimit,
+	maxWait time.Duration,
+) *DomainThrottler {
+	domainLimits := make(map[string]DomainLimit, len(limits))
+	for domain, limit := range limits {
+		domainLimits[strings.ToLower(domain)] = limit
+	}
+	return &DomainThrottler{
+		emailService: emailService,
+		clock:        clock,
+		defaultLimit: defaultLimit,
+		limits:       domainLimits,
+		maxWait:      maxWait,
+		domains:      make(map[string]*domainBudget),
+	}
+}
+
+// SendEmail sends the email within the budget of its recipient domain
+func (throttler *DomainThrottler) SendEmail(ctx context.Context, message *model.Message) error {
+	domain := getRecipientDomain(message.To)
+	budget := throttler.budget(domain)
+
+	// Wait for a free connection to the domain
+	select {
+	case budget.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(budget.maxWait)
+		defer timer.Stop()
+		select {
+		case budget.slots <- struct{}{}:
+		case <-timer.C:
+			return &DeferredError{Domain: domain, RetryAfter: busyRetryAfter}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() { <-budget.slots }()
+
+	// Wait for the rate of the domain
+	if delay := throttler.reserve(budget); delay > budget.maxWait {
+		return &DeferredError{Domain: domain, RetryAfter: delay}
+	} else if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := throttler.emailService.SendEmail(ctx, message)
+	deferred := isDeferral(err)
+	throttler.adapt(budget, err == nil, deferred)
+	if deferred {
+		return &DeferredError{Domain: domain, RetryAfter: deferralRetryAfter, Err: err}
+	}
+	return err
+}
+
+func (throttler *DomainThrottler) budget(domain string) *domainBudget {
+	throttler.mutex.Lock()
+	defer throttler.mutex.Unlock()
+
+	budget, exists := throttler.domains[domain]
+	if exists {
+		return budget
+	}
+	limit := throttler.limit(domain)
+	budget = &domainBudget{
+		limit:   limit,
+		maxWait: throttler.maxWait,
+		slots:   make(chan struct{}, limit.Concurrency),
+		limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst),
+		rate:    limit.Rate,
+	}
+	throttler.domains[domain] = budget
+	return budget
+}
+
+// limit returns the configured budget of the domain
+func (throttler *DomainThrottler) limit(domain string) DomainLimit {
+	limit, configured := throttler.limits[domain]
+	if !configured {
+		limit = throttler.defaultLimit
+	}
+	if limit.Concurrency < 1 || limit.Rate <= 0 {
+		limit = defaultDomainLimit
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return limit
+}
+
+// SetLimits replaces the budgets of the domains while the emails are sent. The domains
+// whose budget changed start over with the new one, while the emails in flight finish
+// within the previous one.
+func (throttler *DomainThrottler) SetLimits(
+	defaultLimit DomainLimit,
+	limits map[string]DomainLimit,
+	maxWait time.Duration,
+) {
+	domainLimits := make(map[string]DomainLimit, len(limits))
+	for domain, limit := range limits {
+		domainLimits[strings.ToLower(domain)] = limit
+	}
+
+	throttler.mutex.Lock()
+	defer throttler.mutex.Unlock()
+	throttler.defaultLimit = defaultLimit
+	throttler.limits = domainLimits
+	throttler.maxWait = maxWait
+	for domain, budget := range throttler.domains {
+		if budget.limit != throttler.limit(domain) || budget.maxWait != maxWait {
+			delete(throttler.domains, domain)
+		}
+	}
+}
+
+// reserve takes the next token of the domain and returns how long to wait for it.
+// The token is given back when the wait is longer than the maximum wait.
+func (throttler *DomainThrottler) reserve(budget *domainBudget) time.Duration {
+	throttler.mutex.Lock()
+	defer throttler.mutex.Unlock()
+
+	now := throttler.clock.Now()
+	reservation := budget.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > budget.maxWait {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// adapt slows the domain down when it defers an email and speeds it back up
+// towards its configured rate when it accepts one
+func (throttler *DomainThrottler) adapt(budget *domainBudget, accepted, deferred bool) {
+	throttler.mutex.Lock()
+	defer throttler.mutex.Unlock()
+
+	switch {
+	case deferred:
+		budget.rate = max(budget.rate*deferralBackoff, budget.limit.Rate*minRateFraction)
+	case accepted && budget.rate < budget.limit.Rate:
+		budget.rate = min(budget.rate+budget.limit.Rate*recoveryStep, budget.limit.Rate)
+	default:
+		return
+	}
+	budget.limiter.SetLimitAt(throttler.clock.Now(), rate.Limit(budget.rate))
+}
+
+// isDeferral reports whether the error is a temporary SMTP rejection, such as 421
+func isDeferral(err error) bool {
+	var smtpError *textproto.Error
+	return errors.As(err, &smtpError) && smtpError.Code >= 400 && smtpError.Code < 500
+}
+
+// getRecipientDomain returns the lower case domain of an email address
+func getRecipientDomain(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.TrimSuffix(address[at+1:], ">")
+	}
+	return address
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/service/mock"
+)
+
+func TestDomainThrottler(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	defaultLimit := DomainLimit{Concurrency: 2, Rate: 100, Burst: 100}
+	newMessage := func(id, to string) *model.Message {
+		return &model.Message{ID: id, To: to, Priority: model.PriorityTransactional}
+	}
+
+	test.Run("Busy_Domain_Does_Not_Hold_Other_Domains", func(test *testing.T) {
+		emailService := newBlockingEmailService()
+		throttler := NewDomainThrottler(emailService, clock.NewFakeClock(now), defaultLimit, map[string]DomainLimit{
+			"Slow.com": {Concurrency: 1, Rate: 100, Burst: 100},
+		}, 0)
+
+		started, release := emailService.block("slow-1")
+		result := make(chan error, 1)
+		go func() {
+			result <- throttler.SendEmail(context.Background(), newMessage("slow-1", "one@slow.com"))
+		}()
+		<-started
+
+		err := throttler.SendEmail(context.Background(), newMessage("slow-2", "two@SLOW.com"))
+		assert.Equal(test, &DeferredError{Domain: "slow.com", RetryAfter: busyRetryAfter}, err)
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("fast-1", "one@fast.com")))
+
+		close(release)
+		assert.NoError(test, <-result)
+		assert.Equal(test, []string{"fast-1", "slow-1"}, emailService.order())
+	})
+
+	test.Run("Domain_Rate_Exceeded_Deferred", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		emailService := newBlockingEmailService()
+		throttler := NewDomainThrottler(emailService, fakeClock, DomainLimit{Concurrency: 1, Rate: 1, Burst: 1}, nil, 0)
+
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("1", "one@test.com")))
+		err := throttler.SendEmail(context.Background(), newMessage("2", "two@test.com"))
+		assert.Equal(test, &DeferredError{Domain: "test.com", RetryAfter: time.Second}, err)
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("3", "three@other.com")))
+
+		fakeClock.Advance(time.Second)
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("2", "two@test.com")))
+		assert.Equal(test, []string{"1", "3", "2"}, emailService.order())
+	})
+
+	test.Run("Deferrals_Slow_Domain_Down_Until_Recovered", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		fakeClock := clock.NewFakeClock(now)
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		throttler := NewDomainThrottler(emailServiceMock, fakeClock, DomainLimit{Concurrency: 1, Rate: 10, Burst: 1}, nil, 0)
+		send := func() error {
+			fakeClock.Advance(time.Minute)
+			return throttler.SendEmail(context.Background(), newMessage("1", "user@test.com"))
+		}
+
+		deferral := &textproto.Error{Code: 421, Msg: "Try again later"}
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), gomock.Any()).Times(6).Return(deferral)
+		for _, expectedRate := range []float64{5, 2.5, 1.25, 0.625, 0.5, 0.5} {
+			err := send()
+			var deferred *DeferredError
+			assert.True(test, errors.As(err, &deferred))
+			assert.Equal(test, deferralRetryAfter, deferred.RetryAfter)
+			assert.ErrorIs(test, err, deferral)
+			assert.Equal(test, expectedRate, throttler.domains["test.com"].rate)
+		}
+
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), gomock.Any()).Times(11).Return(nil)
+		for _, expectedRate := range []float64{1.5, 2.5, 3.5, 4.5, 5.5, 6.5, 7.5, 8.5, 9.5, 10, 10} {
+			assert.NoError(test, send())
+			assert.InDelta(test, expectedRate, throttler.domains["test.com"].rate, 0.000001)
+		}
+	})
+
+	test.Run("Permanent_Error_Keeps_Rate", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		throttler := NewDomainThrottler(emailServiceMock, clock.NewFakeClock(now), defaultLimit, nil, 0)
+
+		rejection := &textproto.Error{Code: 550, Msg: "Mailbox unavailable"}
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), gomock.Any()).Times(1).Return(rejection)
+
+		err := throttler.SendEmail(context.Background(), newMessage("1", "user@test.com"))
+
+		assert.Equal(test, rejection, err)
+		assert.Equal(test, defaultLimit.Rate, throttler.domains["test.com"].rate)
+	})
+
+	test.Run("Set_Limits_Restarts_Changed_Domains", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		emailService := newBlockingEmailService()
+		throttler := NewDomainThrottler(emailService, fakeClock, DomainLimit{Concurrency: 1, Rate: 1, Burst: 1}, nil, 0)
+
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("1", "one@test.com")))
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("2", "one@other.com")))
+		throttler.SetLimits(DomainLimit{Concurrency: 1, Rate: 1, Burst: 1}, map[string]DomainLimit{
+			"Test.com": {Concurrency: 1, Rate: 1, Burst: 2},
+		}, 0)
+
+		// The budget of test.com changed while the one of other.com was kept
+		assert.NoError(test, throttler.SendEmail(context.Background(), newMessage("3", "two@test.com")))
+		err := throttler.SendEmail(context.Background(), newMessage("4", "two@other.com"))
+		assert.Equal(test, &DeferredError{Domain: "other.com", RetryAfter: time.Second}, err)
+		assert.Equal(test, []string{"1", "2", "3"}, emailService.order())
+	})
+}
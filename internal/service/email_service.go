@@ -2,8 +2,15 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/smtp"
+	"sync/atomic"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/tracking"
+	"qd-email-api/internal/unsubscribe"
 )
 
 // EmailServiceConfig constains the configuration for the email service
@@ -15,48 +22,190 @@ type EmailServiceConfig struct {
 	Password string
 	Host     string
 	Port     string
+	// BounceDomain receives the bounces at the return path of every email when set
+	BounceDomain string
+	BouncePrefix string
+	BounceSecret string
+	// UnsubscribeURL adds the one-click unsubscribe links to the emails of the unsubscribe
+	// categories when set
+	UnsubscribeURL        string
+	UnsubscribeSecret     string
+	UnsubscribeCategories []string
+	// MandatoryCategories are sent whatever the preferences of the recipients
+	MandatoryCategories []string
+	// OpenTrackingURL adds a tracking pixel to the emails tracking their opens when set
+	OpenTrackingURL string
+	// ClickTrackingURL rewrites the links of the emails tracking their clicks when set
+	ClickTrackingURL string
+	TrackingSecret   string
+}
+
+// Transport is the SMTP relay the emails are sent through and its credentials
+type Transport struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// SuppressedError is returned when the recipient of an email is suppressed
+type SuppressedError struct {
+	Suppression *model.Suppression
+}
+
+func (err *SuppressedError) Error() string {
+	return fmt.Sprintf("Recipient %s is suppressed: %s", err.Suppression.Address, err.Suppression.Reason)
+}
+
+// OptedOutError is returned when the recipient of an email opted out of its category
+type OptedOutError struct {
+	Preference *model.Preference
+}
+
+func (err *OptedOutError) Error() string {
+	return fmt.Sprintf("Recipient %s opted out of %s emails", err.Preference.Address, err.Preference.Category)
 }
 
 // EmailServicer is the interface for the email service
 type EmailServicer interface {
-	SendEmail(ctx context.Context, dest, subject, body string) error
+	SendEmail(ctx context.Context, message *model.Message) error
 }
 
 // EmailService is the implementation of the email service
 type EmailService struct {
-	config EmailServiceConfig
-	sender SMTPServicer
+	config                EmailServiceConfig
+	transport             atomic.Pointer[Transport]
+	sender                SMTPServicer
+	suppressionRepository repository.SuppressionRepositoryer
+	preferenceRepository  repository.PreferenceRepositoryer
+	verp                  *bounce.VERP
+	unsubscribeLinks      *unsubscribe.Links
+	pixels                *tracking.Pixels
+	clicks                *tracking.Clicks
+	unsubscribeCategories map[string]bool
+	mandatoryCategories   map[string]bool
 }
 
 var _ EmailServicer = &EmailService{}
 
 // NewEmailService creates a new email service
-func NewEmailService(config EmailServiceConfig, sender SMTPServicer) *EmailService {
-	return &EmailService{
-		config: config,
-		sender: &SMTPService{},
+func NewEmailService(
+	config EmailServiceConfig,
+	sender SMTPServicer,
+	suppressionRepository repository.SuppressionRepositoryer,
+	preferenceRepository repository.PreferenceRepositoryer,
+) *EmailService {
+	service := &EmailService{
+		config:                config,
+		sender:                sender,
+		suppressionRepository: suppressionRepository,
+		preferenceRepository:  preferenceRepository,
+		unsubscribeCategories: make(map[string]bool, len(config.UnsubscribeCategories)),
+		mandatoryCategories:   make(map[string]bool, len(config.MandatoryCategories)),
+	}
+	service.SetTransport(Transport{
+		Host:     config.Host,
+		Port:     config.Port,
+		Username: config.Username,
+		Password: config.Password,
+	})
+	if config.BounceDomain != "" {
+		service.verp = bounce.NewVERP(config.BouncePrefix, config.BounceDomain, config.BounceSecret)
 	}
+	if config.UnsubscribeURL != "" {
+		service.unsubscribeLinks = unsubscribe.NewLinks(config.UnsubscribeURL, config.UnsubscribeSecret)
+	}
+	if config.OpenTrackingURL != "" {
+		service.pixels = tracking.NewPixels(config.OpenTrackingURL, config.TrackingSecret)
+	}
+	if config.ClickTrackingURL != "" {
+		service.clicks = tracking.NewClicks(config.ClickTrackingURL, config.TrackingSecret)
+	}
+	for _, category := range config.UnsubscribeCategories {
+		service.unsubscribeCategories[category] = true
+	}
+	for _, category := range config.MandatoryCategories {
+		service.mandatoryCategories[category] = true
+	}
+	return service
 }
 
-// SendEmail sends an email to a single destination
-func (service *EmailService) SendEmail(_ context.Context, dest, subject, body string) error {
+// SendEmail sends an email to a single destination unless the destination is suppressed or
+// opted out of the category of the email, which is then skipped with an OptedOutError.
+// The emails of the unsubscribe categories carry the List-Unsubscribe headers of RFC 8058
+// and the emails tracking their opens carry a tracking pixel. The links of the emails
+// tracking their clicks are rewritten into tracked redirects.
+func (service *EmailService) SendEmail(ctx context.Context, message *model.Message) error {
+	unsubscribable := service.unsubscribeCategories[message.Category]
+	if !message.IgnoreSuppression {
+		suppression, err := service.suppressionRepository.Get(ctx, message.To)
+		if err == nil && suppression.Blocks(message.Priority, unsubscribable) {
+			return &SuppressedError{Suppression: suppression}
+		}
+		if err != nil && !errors.Is(err, repository.ErrSuppressionNotFound) {
+			return fmt.Errorf("Error checking suppression list: %v", err)
+		}
+	}
+	if message.Category != "" && !service.mandatoryCategories[message.Category] {
+		preference, err := service.preferenceRepository.Get(ctx, message.To, message.Category)
+		if err == nil && !preference.Subscribed {
+			return &OptedOutError{Preference: preference}
+		}
+		if err != nil && !errors.Is(err, repository.ErrPreferenceNotFound) {
+			return fmt.Errorf("Error checking preferences: %v", err)
+		}
+	}
+
 	config := service.config
 	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n"
 	from := fmt.Sprintf("\"%s\" <%s@%s>", config.AppName, config.From, config.Domain)
-	message := "From: " + from + "\n" +
-		"To: " + dest + "\n" +
-		"Subject: " + subject + "\n" +
-		mime + "\n" +
-		body
+	content := "From: " + from + "\n" +
+		"To: " + message.To + "\n" +
+		// The ID links the feedback reports of the recipient back to the email
+		"Message-ID: <" + message.ID + "@" + config.Domain + ">\n" +
+		"Subject: " + message.Subject + "\n"
+	if unsubscribable && service.unsubscribeLinks != nil {
+		url := service.unsubscribeLinks.URL(&unsubscribe.OptOut{
+			MessageID: message.ID,
+			Address:   message.To,
+			Category:  message.Category,
+		})
+		content += "List-Unsubscribe: <" + url + ">\n" +
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click\n"
+	}
+	body := message.Body
+	if message.TrackClicks && service.clicks != nil {
+		body = service.clicks.Rewrite(body, message.ID)
+	}
+	if message.TrackOpens && service.pixels != nil {
+		body = service.pixels.Embed(body, message.ID)
+	}
+	content += mime + "\n" + body
 
 	envelopeFrom := fmt.Sprintf("%s@%s", config.From, config.Domain)
-	auth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
-	resultError := smtp.SendMail(
-		fmt.Sprintf("%s:%s", config.Host, config.Port),
+	if service.verp != nil {
+		envelopeFrom = service.verp.Encode(message.ID)
+	}
+	transport := service.transport.Load()
+	auth := service.sender.PlainAuth("", transport.Username, transport.Password, transport.Host)
+	resultError := service.sender.SendMail(
+		ctx,
+		fmt.Sprintf("%s:%s", transport.Host, transport.Port),
 		auth,
 		envelopeFrom,
-		[]string{dest},
-		[]byte(message),
+		[]string{message.To},
+		[]byte(content),
 	)
 	return resultError
 }
+
+// SetTransport replaces the SMTP transport of the emails sent from now on, while the
+// emails in flight finish through the previous one
+func (service *EmailService) SetTransport(transport Transport) {
+	service.transport.Store(&transport)
+}
+
+// Transport returns the SMTP transport the emails are sent through
+func (service *EmailService) Transport() Transport {
+	return *service.transport.Load()
+}
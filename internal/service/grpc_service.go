@@ -2,56 +2,706 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
 
-	"github.com/quadev-ltd/qd-common/pb/gen/go/pb_email"
+	"github.com/google/uuid"
 	"github.com/quadev-ltd/qd-common/pkg/log"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/mtls"
+	"qd-email-api/internal/ratelimit"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/tracing"
+	"qd-email-api/internal/webhook"
+	"qd-email-api/pb/gen/go/pb_email_api"
 )
 
+// APIKeyMetadataKey is the metadata key of the API key identifying the calling client
+const APIKeyMetadataKey = "x-api-key"
+
+// ErrAdminClientRequired is returned when a client that is not an admin client calls an
+// admin request
+var ErrAdminClientRequired = errors.New("Admin client required")
+
+// ErrEmailOfOtherClient is returned when a client requests an email sent by another client
+var ErrEmailOfOtherClient = errors.New("Email sent by another client")
+
 // EmailServiceServer is the implementation of the authentication service
 type EmailServiceServer struct {
-	emailService EmailServicer
-	limitter     *rate.Limiter
-	pb_email.UnimplementedEmailServiceServer
+	scheduler             Schedulerer
+	messageRepository     repository.MessageRepositoryer
+	suppressionRepository repository.SuppressionRepositoryer
+	preferenceRepository  repository.PreferenceRepositoryer
+	feedbackHandler       bounce.Handlerer
+	eventBus              event.Buser
+	webhookNotifier       webhook.Notifierer
+	idempotencyStore      IdempotencyStorer
+	rateLimiter           ratelimit.Limiterer
+	clock                 clock.Clocker
+	maxBatchRecipients    int
+	mandatoryCategories   map[string]bool
+	adminClients          map[string]bool
+	apiKeys               map[string]string
+	pb_email_api.UnimplementedEmailServiceServer
 }
 
-var _ pb_email.EmailServiceServer = &EmailServiceServer{}
+var _ pb_email_api.EmailServiceServer = &EmailServiceServer{}
+
+// EmailServiceDependencies are the components of the email service server. The feedback
+// handler and the webhook notifier are optional and the clock defaults to the system clock.
+type EmailServiceDependencies struct {
+	Scheduler             Schedulerer
+	MessageRepository     repository.MessageRepositoryer
+	SuppressionRepository repository.SuppressionRepositoryer
+	PreferenceRepository  repository.PreferenceRepositoryer
+	FeedbackHandler       bounce.Handlerer
+	EventBus              event.Buser
+	WebhookNotifier       webhook.Notifierer
+	IdempotencyStore      IdempotencyStorer
+	RateLimiter           ratelimit.Limiterer
+	Clock                 clock.Clocker
+	MaxBatchRecipients    int
+	// MandatoryCategories are the categories the recipients cannot opt out of
+	MandatoryCategories []string
+	// AdminClients are the identities of the clients allowed to manage the suppressions
+	// and the preferences and to follow the emails of every client
+	AdminClients []string
+	// APIKeys maps the API keys the clients without a certificate may identify with to
+	// their names
+	APIKeys map[string]string
+}
 
 // NewEmailServiceServer creates a new authentication service
-func NewEmailServiceServer(emailService EmailServicer) *EmailServiceServer {
-	return &EmailServiceServer{
-		emailService: emailService,
+func NewEmailServiceServer(dependencies EmailServiceDependencies) *EmailServiceServer {
+	server := &EmailServiceServer{
+		scheduler:             dependencies.Scheduler,
+		messageRepository:     dependencies.MessageRepository,
+		suppressionRepository: dependencies.SuppressionRepository,
+		preferenceRepository:  dependencies.PreferenceRepository,
+		feedbackHandler:       dependencies.FeedbackHandler,
+		eventBus:              dependencies.EventBus,
+		webhookNotifier:       dependencies.WebhookNotifier,
+		idempotencyStore:      dependencies.IdempotencyStore,
+		rateLimiter:           dependencies.RateLimiter,
+		clock:                 dependencies.Clock,
+		maxBatchRecipients:    dependencies.MaxBatchRecipients,
+		mandatoryCategories:   make(map[string]bool, len(dependencies.MandatoryCategories)),
+		adminClients:          make(map[string]bool, len(dependencies.AdminClients)),
+		apiKeys:               make(map[string]string, len(dependencies.APIKeys)),
+	}
+	if server.clock == nil {
+		server.clock = &clock.Clock{}
+	}
+	for _, category := range dependencies.MandatoryCategories {
+		server.mandatoryCategories[category] = true
+	}
+	for _, client := range dependencies.AdminClients {
+		server.adminClients[client] = true
+	}
+	// The keys are hashed so that they are not kept in memory
+	for key, client := range dependencies.APIKeys {
+		server.apiKeys[hashAPIKey(key)] = client
 	}
+	return server
 }
 
-// SendEmail sends an email
-func (server *EmailServiceServer) SendEmail(ctx context.Context, request *pb_email.SendEmailRequest) (*pb_email.SendEmailResponse, error) {
+// SendEmail sends an email, or schedules it when a future send time is given
+func (server *EmailServiceServer) SendEmail(ctx context.Context, request *pb_email_api.SendEmailRequest) (*pb_email_api.SendEmailResponse, error) {
 	logger, err := log.GetLoggerFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check the rate limit
-	if !limiter.Allow() {
-		logger.Error(nil, "Too many requests")
-		return nil, status.Errorf(codes.ResourceExhausted, "Too many requests")
+	// Repeated requests with the same idempotency key return the original result, so only
+	// the first execution is charged to the rate limits of the client and the recipient
+	result, err := server.idempotencyStore.Execute(
+		ctx,
+		getIdempotencyKey(ctx, request),
+		getRequestFingerprint(request),
+		func() (*SendEmailResult, error) {
+			return server.sendEmail(ctx, logger, request)
+		},
+	)
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		logger.Error(err, "Idempotency key reused")
+		return nil, status.Errorf(codes.AlreadyExists, "Idempotency key already used with a different request")
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Send the email
-	err = server.emailService.SendEmail(ctx, request.To, request.Subject, request.Body)
+	return &pb_email_api.SendEmailResponse{
+		Success:   true,
+		Message:   result.Message,
+		MessageId: result.MessageID,
+	}, nil
+}
+
+func (server *EmailServiceServer) sendEmail(
+	ctx context.Context,
+	logger log.Loggerer,
+	request *pb_email_api.SendEmailRequest,
+) (*SendEmailResult, error) {
+	_, span := tracing.Start(ctx, "email.validate")
+	message, err := server.newMessage(ctx, request)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error(err, "Invalid email request")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	if err := server.checkRateLimit(logger, server.getClientID(ctx), message.To); err != nil {
+		return nil, err
+	}
+
+	// Refuse the email right away when its recipient is suppressed, only the admin
+	// clients can override the suppression
+	if message.IgnoreSuppression {
+		if err := server.authorizeAdmin(ctx, logger); err != nil {
+			return nil, err
+		}
+	} else if err := server.checkSuppression(ctx, logger, message); err != nil {
+		return nil, err
+	}
+
+	// Hold the email until its send time
+	if message.SendAt.After(message.CreatedAt) {
+		err := server.scheduler.Schedule(ctx, message)
+		if err != nil {
+			logger.Error(err, "Error scheduling email")
+			return nil, status.Errorf(codes.Internal, "Error scheduling email")
+		}
+		logger.Info("Email scheduled")
+		return &SendEmailResult{
+			MessageID: message.ID,
+			Message:   "Email scheduled",
+		}, nil
+	}
+
+	// Send the email, which is retried later when its domain defers it
+	err = server.scheduler.Send(ctx, message)
+	var deferred *DeferredError
+	if errors.As(err, &deferred) {
+		logger.Warn(deferred.Error())
+		return &SendEmailResult{
+			MessageID: message.ID,
+			Message:   "Email deferred",
+		}, nil
+	}
+	// The caller gave up waiting, the result is remembered for its retries
+	if errors.Is(err, ErrSendPending) {
+		logger.Warn(err.Error())
+		return &SendEmailResult{
+			MessageID: message.ID,
+			Message:   "Email queued",
+		}, nil
+	}
+	var optedOut *OptedOutError
+	if errors.As(err, &optedOut) {
+		logger.Info("Email skipped")
+		return &SendEmailResult{
+			MessageID: message.ID,
+			Message:   "Email skipped",
+		}, nil
+	}
+	var suppressed *SuppressedError
+	if errors.As(err, &suppressed) {
+		logger.Error(err, "Recipient suppressed")
+		return nil, status.Errorf(codes.FailedPrecondition, "Recipient is suppressed: %s", suppressed.Suppression.Reason)
+	}
 	if err != nil {
 		logger.Error(err, "Error sending email")
 		return nil, status.Errorf(codes.Internal, "Error sending email")
 	}
 
 	logger.Info("Email sent")
-	return &pb_email.SendEmailResponse{
+	return &SendEmailResult{
+		MessageID: message.ID,
+		Message:   "Email sent",
+	}, nil
+}
+
+// newMessage creates the message described by the request
+func (server *EmailServiceServer) newMessage(ctx context.Context, request *pb_email_api.SendEmailRequest) (*model.Message, error) {
+	// The recipient is looked up by its bare address in the suppressions, the preferences
+	// and the rate limits
+	address, err := ValidateRecipient(request.To)
+	if err != nil {
+		return nil, err
+	}
+	now := server.clock.Now()
+	message := &model.Message{
+		ID:        uuid.New().String(),
+		To:        strings.ToLower(address),
+		Subject:   request.Subject,
+		Body:      request.Body,
+		Category:  request.Category,
+		SendAt:    now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if request.SendAt != nil {
+		if err := request.SendAt.CheckValid(); err != nil {
+			return nil, errors.New("Invalid send time")
+		}
+		message.SendAt = request.SendAt.AsTime()
+	}
+	priority, err := getPriority(request.Priority)
+	if err != nil {
+		return nil, err
+	}
+	message.Priority = priority
+	if request.IgnoreSuppression && priority != model.PriorityCritical {
+		return nil, errors.New("Suppression can only be ignored by critical emails")
+	}
+	message.CorrelationID = getCorrelationID(ctx)
+	message.ClientID = server.getClientID(ctx)
+	message.IgnoreSuppression = request.IgnoreSuppression
+	message.TrackOpens = request.TrackOpens
+	message.TrackClicks = request.TrackClicks
+	return message, nil
+}
+
+// getCorrelationID returns the correlation ID of the request, if any
+func getCorrelationID(ctx context.Context) string {
+	if correlationID, err := log.GetCorrelationIDFromContext(ctx); err == nil {
+		return *correlationID
+	}
+	return ""
+}
+
+// isAdmin tells whether the certificate of the client names one of the admin clients
+func (server *EmailServiceServer) isAdmin(ctx context.Context) bool {
+	if identity, ok := mtls.IdentityFromContext(ctx); ok {
+		for _, name := range identity.Names() {
+			if server.adminClients[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorizeAdmin allows the requests of the admin clients
+func (server *EmailServiceServer) authorizeAdmin(ctx context.Context, logger log.Loggerer) error {
+	if server.isAdmin(ctx) {
+		return nil
+	}
+	logger.Error(ErrAdminClientRequired, "Unauthorized admin request")
+	return status.Errorf(codes.PermissionDenied, "%v", ErrAdminClientRequired)
+}
+
+// authorizeSender allows the requests about an email to the client that sent it and to
+// the admin clients
+func (server *EmailServiceServer) authorizeSender(ctx context.Context, logger log.Loggerer, message *model.Message) error {
+	if message.ClientID == server.getClientID(ctx) || server.isAdmin(ctx) {
+		return nil
+	}
+	logger.Error(ErrEmailOfOtherClient, "Unauthorized email request")
+	return status.Errorf(codes.PermissionDenied, "%v", ErrEmailOfOtherClient)
+}
+
+// getClientID identifies the calling client by the verified identity of its certificate,
+// its API key or, failing both, its address. The unknown API keys are ignored so that
+// a client cannot reset its limits by changing its key.
+func (server *EmailServiceServer) getClientID(ctx context.Context) string {
+	if identity, ok := mtls.IdentityFromContext(ctx); ok {
+		return "certificate:" + identity.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get(APIKeyMetadataKey); len(keys) > 0 {
+			if client, known := server.apiKeys[hashAPIKey(keys[0])]; known {
+				return "api-key:" + client
+			}
+		}
+	}
+	if callerPeer, hasPeer := peer.FromContext(ctx); hasPeer && callerPeer.Addr != nil {
+		address := callerPeer.Addr.String()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+		return "address:" + address
+	}
+	return ""
+}
+
+// hashAPIKey hashes an API key to look it up among the known keys
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkSuppression returns a FailedPrecondition error with the reason when the recipient
+// of the message is suppressed. Unsubscribes are left to the email service, which knows
+// the categories the recipients can unsubscribe from.
+func (server *EmailServiceServer) checkSuppression(ctx context.Context, logger log.Loggerer, message *model.Message) error {
+	suppression, err := server.suppressionRepository.Get(ctx, message.To)
+	if errors.Is(err, repository.ErrSuppressionNotFound) || (err == nil && !suppression.Blocks(message.Priority, false)) {
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Error checking suppression list")
+		return status.Errorf(codes.Internal, "Error checking suppression list")
+	}
+	logger.Error(&SuppressedError{Suppression: suppression}, "Recipient suppressed")
+	return status.Errorf(codes.FailedPrecondition, "Recipient is suppressed: %s", suppression.Reason)
+}
+
+// checkRateLimit returns a ResourceExhausted error with a retry hint in its details
+// when the request goes over one of the rate limits
+func (server *EmailServiceServer) checkRateLimit(logger log.Loggerer, clientID, recipient string) error {
+	err := server.rateLimiter.Allow(clientID, recipient)
+	if err == nil {
+		return nil
+	}
+	var limitExceeded *ratelimit.LimitExceededError
+	if !errors.As(err, &limitExceeded) {
+		logger.Error(err, "Error checking rate limit")
+		return status.Errorf(codes.Internal, "Error checking rate limit")
+	}
+	logger.Error(err, "Too many requests")
+	limitStatus := status.Newf(codes.ResourceExhausted, "Too many requests per %s", limitExceeded.Scope)
+	detailedStatus, detailsErr := limitStatus.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(limitExceeded.RetryAfter),
+	})
+	if detailsErr != nil {
+		return limitStatus.Err()
+	}
+	return detailedStatus.Err()
+}
+
+// getPriority maps the requested priority to its sending lane
+func getPriority(priority pb_email_api.Priority) (model.Priority, error) {
+	switch priority {
+	case pb_email_api.Priority_PRIORITY_CRITICAL:
+		return model.PriorityCritical, nil
+	case pb_email_api.Priority_PRIORITY_UNSPECIFIED, pb_email_api.Priority_PRIORITY_TRANSACTIONAL:
+		return model.PriorityTransactional, nil
+	case pb_email_api.Priority_PRIORITY_BULK:
+		return model.PriorityBulk, nil
+	}
+	return "", fmt.Errorf("Invalid priority %d", priority)
+}
+
+// getIdempotencyKey returns the key from the request or, failing that, from the metadata
+func getIdempotencyKey(ctx context.Context, request *pb_email_api.SendEmailRequest) string {
+	if request.IdempotencyKey != "" {
+		return request.IdempotencyKey
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get(IdempotencyKeyMetadataKey); len(keys) > 0 {
+			return keys[0]
+		}
+	}
+	return ""
+}
+
+// getRequestFingerprint hashes the fields that define the email so that a key
+// reused for a different email can be detected
+func getRequestFingerprint(request *pb_email_api.SendEmailRequest) string {
+	hash := sha256.New()
+	for _, field := range []string{request.To, request.Subject, request.Body, request.Category} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	if request.SendAt != nil {
+		hash.Write([]byte(request.SendAt.AsTime().UTC().Format(time.RFC3339Nano)))
+	}
+	var options byte
+	for index, option := range []bool{request.IgnoreSuppression, request.TrackOpens, request.TrackClicks} {
+		if option {
+			options |= 1 << index
+		}
+	}
+	hash.Write([]byte{0, byte(request.Priority), options})
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CancelEmail cancels a scheduled email that has not been sent yet, on behalf of the client
+// that sent it or of an admin client
+func (server *EmailServiceServer) CancelEmail(ctx context.Context, request *pb_email_api.CancelEmailRequest) (*pb_email_api.CancelEmailResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := server.messageRepository.GetByID(ctx, request.MessageId)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		logger.Error(err, "Email to cancel not found")
+		return nil, status.Errorf(codes.NotFound, "Email not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error getting email")
+		return nil, status.Errorf(codes.Internal, "Error getting email")
+	}
+	if err := server.authorizeSender(ctx, logger, message); err != nil {
+		return nil, err
+	}
+
+	err = server.scheduler.Cancel(ctx, message.ID)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		logger.Error(err, "Email to cancel not found")
+		return nil, status.Errorf(codes.NotFound, "Email not found")
+	case errors.Is(err, repository.ErrStatusConflict):
+		logger.Error(err, "Email can no longer be cancelled")
+		return nil, status.Errorf(codes.FailedPrecondition, "Email can no longer be cancelled")
+	case err != nil:
+		logger.Error(err, "Error cancelling email")
+		return nil, status.Errorf(codes.Internal, "Error cancelling email")
+	}
+
+	logger.Info("Email cancelled")
+	return &pb_email_api.CancelEmailResponse{
 		Success: true,
-		Message: "Email sent",
+		Message: "Email cancelled",
+	}, nil
+}
+
+// SendBatch validates every recipient of the batch and schedules the accepted ones
+func (server *EmailServiceServer) SendBatch(ctx context.Context, request *pb_email_api.SendBatchRequest) (*pb_email_api.SendBatchResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the rate limit of the client, the recipients are checked one by one
+	if err := server.checkRateLimit(logger, server.getClientID(ctx), ""); err != nil {
+		return nil, err
+	}
+
+	return server.sendBatch(ctx, logger, request.Template, request.Recipients)
+}
+
+// SendBatchStream receives the template followed by the recipients of a batch and
+// schedules the accepted recipients once the client closes the stream
+func (server *EmailServiceServer) SendBatchStream(stream pb_email_api.EmailService_SendBatchStreamServer) error {
+	ctx := stream.Context()
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check the rate limit of the client, the recipients are checked one by one
+	if err := server.checkRateLimit(logger, server.getClientID(ctx), ""); err != nil {
+		return err
+	}
+
+	template, recipients, err := server.receiveBatch(stream)
+	if err != nil {
+		logger.Error(err, "Error receiving batch")
+		return err
+	}
+
+	response, err := server.sendBatch(ctx, logger, template, recipients)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(response)
+}
+
+// receiveBatch reads the template and the recipients of a batch until the client closes the stream
+func (server *EmailServiceServer) receiveBatch(
+	stream pb_email_api.EmailService_SendBatchStreamServer,
+) (*pb_email_api.BatchTemplate, []*pb_email_api.BatchRecipient, error) {
+	var template *pb_email_api.BatchTemplate
+	recipients := []*pb_email_api.BatchRecipient{}
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return template, recipients, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch payload := request.Payload.(type) {
+		case *pb_email_api.SendBatchStreamRequest_Template:
+			if template != nil || len(recipients) > 0 {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "Template must be sent once before the recipients")
+			}
+			template = payload.Template
+		case *pb_email_api.SendBatchStreamRequest_Recipient:
+			if template == nil {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "Template must be sent once before the recipients")
+			}
+			if len(recipients) >= server.maxBatchRecipients {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "Batch exceeds the maximum of %d recipients", server.maxBatchRecipients)
+			}
+			recipients = append(recipients, payload.Recipient)
+		default:
+			return nil, nil, status.Errorf(codes.InvalidArgument, "Batch message must contain a template or a recipient")
+		}
+	}
+}
+
+// sendBatch validates and renders every recipient before scheduling the valid ones.
+// The scheduler delivers them through the sending lanes.
+func (server *EmailServiceServer) sendBatch(
+	ctx context.Context,
+	logger log.Loggerer,
+	template *pb_email_api.BatchTemplate,
+	recipients []*pb_email_api.BatchRecipient,
+) (*pb_email_api.SendBatchResponse, error) {
+	_, span := tracing.Start(ctx, "email.validate", attribute.Int("email.recipients", len(recipients)))
+	batchTemplate, priority, sendAt, err := server.validateBatch(logger, template, recipients)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	now := server.clock.Now()
+	if template.SendAt == nil {
+		sendAt = now
+	}
+	correlationID := getCorrelationID(ctx)
+	clientID := server.getClientID(ctx)
+
+	results := make([]*pb_email_api.BatchRecipientResult, len(recipients))
+	messages := make([]*model.Message, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	for index, recipient := range recipients {
+		results[index] = &pb_email_api.BatchRecipientResult{To: recipient.To}
+		address, err := ValidateRecipient(recipient.To)
+		if err != nil {
+			results[index].Error = err.Error()
+			continue
+		}
+		if seen[strings.ToLower(address)] {
+			results[index].Error = "Duplicated recipient"
+			continue
+		}
+		seen[strings.ToLower(address)] = true
+		suppression, err := server.suppressionRepository.Get(ctx, address)
+		if err == nil && suppression.Blocks(priority, false) {
+			results[index].Error = "Recipient is suppressed: " + string(suppression.Reason)
+			continue
+		}
+		if err != nil && !errors.Is(err, repository.ErrSuppressionNotFound) {
+			logger.Error(err, "Error checking suppression list")
+			results[index].Error = "Error checking suppression list"
+			continue
+		}
+		_, span := tracing.Start(ctx, "email.render")
+		subject, body, err := batchTemplate.Render(recipient.Variables)
+		tracing.End(span, err)
+		if err != nil {
+			results[index].Error = err.Error()
+			continue
+		}
+		// The domains are left to the domain throttler, which paces the delivery of batches
+		if err := server.rateLimiter.AllowRecipient(address); err != nil {
+			results[index].Error = err.Error()
+			continue
+		}
+		messages[index] = &model.Message{
+			ID:            uuid.New().String(),
+			To:            address,
+			Subject:       subject,
+			Body:          body,
+			SendAt:        sendAt,
+			Priority:      priority,
+			Category:      template.Category,
+			TrackOpens:    template.TrackOpens,
+			TrackClicks:   template.TrackClicks,
+			CorrelationID: correlationID,
+			ClientID:      clientID,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+
+	valid := []*model.Message{}
+	for _, message := range messages {
+		if message != nil {
+			valid = append(valid, message)
+		}
+	}
+	// The valid recipients are stored at once so that the batch costs a single write
+	var scheduleErr error
+	if len(valid) > 0 {
+		scheduleErr = server.scheduler.ScheduleMany(ctx, valid)
+	}
+	if scheduleErr != nil {
+		logger.Error(scheduleErr, "Error scheduling batch emails")
+	}
+	accepted := 0
+	for index, message := range messages {
+		if message == nil {
+			continue
+		}
+		if scheduleErr != nil {
+			results[index].Error = "Error scheduling email"
+			continue
+		}
+		results[index].Accepted = true
+		results[index].MessageId = message.ID
+		accepted++
+	}
+
+	summary := fmt.Sprintf("Batch accepted %d of %d recipients", accepted, len(recipients))
+	logger.Info(summary)
+	return &pb_email_api.SendBatchResponse{
+		Success: accepted > 0,
+		Message: summary,
+		Results: results,
 	}, nil
 }
 
-// TODO: inject this into the struct (dependency injection) and add the unit tests
-var limiter = rate.NewLimiter(rate.Limit(1), 5)
+// validateBatch validates the template of a batch along with its size. The send time is
+// zero when the template has none.
+func (server *EmailServiceServer) validateBatch(
+	logger log.Loggerer,
+	template *pb_email_api.BatchTemplate,
+	recipients []*pb_email_api.BatchRecipient,
+) (*BatchTemplate, model.Priority, time.Time, error) {
+	if template == nil {
+		logger.Error(nil, "Missing batch template")
+		return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "Batch template is required")
+	}
+	if len(recipients) == 0 {
+		logger.Error(nil, "Empty batch")
+		return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "Batch has no recipients")
+	}
+	if len(recipients) > server.maxBatchRecipients {
+		logger.Error(nil, "Batch too large")
+		return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "Batch exceeds the maximum of %d recipients", server.maxBatchRecipients)
+	}
+	batchTemplate, err := NewBatchTemplate(template.Subject, template.Body)
+	if err != nil {
+		logger.Error(err, "Invalid batch template")
+		return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	priority := model.PriorityBulk
+	if template.Priority != pb_email_api.Priority_PRIORITY_UNSPECIFIED {
+		priority, err = getPriority(template.Priority)
+		if err != nil {
+			logger.Error(err, "Invalid batch priority")
+			return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+	var sendAt time.Time
+	if template.SendAt != nil {
+		if err := template.SendAt.CheckValid(); err != nil {
+			logger.Error(err, "Invalid batch send time")
+			return nil, "", time.Time{}, status.Errorf(codes.InvalidArgument, "Invalid send time")
+		}
+		sendAt = template.SendAt.AsTime()
+	}
+	return batchTemplate, priority, sendAt, nil
+}
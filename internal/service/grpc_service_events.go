@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/event"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// StreamEvents sends the status changes of the emails matching the request until the
+// client cancels. The headers are sent once subscribed, after which no event is missed.
+// Clients resume after a disconnection with the cursor of the last event. The events of
+// every client are only streamed to the admin clients.
+func (server *EmailServiceServer) StreamEvents(request *pb_email_api.StreamEventsRequest, stream pb_email_api.EmailService_StreamEventsServer) error {
+	ctx := stream.Context()
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return err
+	}
+
+	subscription, err := server.eventBus.Subscribe(request.Cursor)
+	switch {
+	case errors.Is(err, event.ErrInvalidCursor):
+		logger.Error(err, "Invalid event cursor")
+		return status.Errorf(codes.InvalidArgument, "Invalid cursor")
+	case errors.Is(err, event.ErrCursorExpired):
+		logger.Error(err, "Expired event cursor")
+		return status.Errorf(codes.OutOfRange, "Cursor expired, list the emails to catch up")
+	case err != nil:
+		logger.Error(err, "Error subscribing to events")
+		return status.Errorf(codes.Internal, "Error subscribing to events")
+	}
+	defer subscription.Close()
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case emailEvent, open := <-subscription.Events():
+			if !open {
+				logger.Warn("Event subscriber fell behind")
+				return status.Errorf(codes.Unavailable, "Too many pending events, resume from the last cursor")
+			}
+			if !matchesEvent(request, &emailEvent) {
+				continue
+			}
+			if err := stream.Send(toEmailEvent(&emailEvent)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// matchesEvent reports whether the event passes every filter set in the request
+func matchesEvent(request *pb_email_api.StreamEventsRequest, emailEvent *event.Event) bool {
+	switch {
+	case request.MessageId != "" && request.MessageId != emailEvent.MessageID,
+		request.To != "" && !strings.EqualFold(request.To, emailEvent.To),
+		request.Category != "" && request.Category != emailEvent.Category:
+		return false
+	}
+	return true
+}
+
+func toEmailEvent(emailEvent *event.Event) *pb_email_api.EmailEvent {
+	return &pb_email_api.EmailEvent{
+		Cursor:    emailEvent.Cursor,
+		MessageId: emailEvent.MessageID,
+		To:        emailEvent.To,
+		Category:  emailEvent.Category,
+		Status:    emailStatuses[emailEvent.Status],
+		Time:      timestamppb.New(emailEvent.Time),
+		Response:  emailEvent.Response,
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/model"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// GetPreferences returns the category preferences of a recipient
+func (server *EmailServiceServer) GetPreferences(ctx context.Context, request *pb_email_api.GetPreferencesRequest) (*pb_email_api.GetPreferencesResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	address, err := ValidateRecipient(request.Address)
+	if err != nil {
+		logger.Error(err, "Invalid preferences address")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	address = strings.ToLower(address)
+	preferences, err := server.getPreferences(ctx, address)
+	if err != nil {
+		logger.Error(err, "Error getting preferences")
+		return nil, status.Errorf(codes.Internal, "Error getting preferences")
+	}
+
+	return &pb_email_api.GetPreferencesResponse{
+		Address:     address,
+		Preferences: preferences,
+	}, nil
+}
+
+// UpdatePreferences opts a recipient in or out of categories, leaving the other categories as they are
+func (server *EmailServiceServer) UpdatePreferences(ctx context.Context, request *pb_email_api.UpdatePreferencesRequest) (*pb_email_api.UpdatePreferencesResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	address, err := ValidateRecipient(request.Address)
+	if err != nil {
+		logger.Error(err, "Invalid preferences address")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	address = strings.ToLower(address)
+	updates, err := server.newPreferences(address, request.Preferences)
+	if err != nil {
+		logger.Error(err, "Invalid preferences")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := server.preferenceRepository.Set(ctx, updates); err != nil {
+		logger.Error(err, "Error updating preferences")
+		return nil, status.Errorf(codes.Internal, "Error updating preferences")
+	}
+	preferences, err := server.getPreferences(ctx, address)
+	if err != nil {
+		logger.Error(err, "Error getting preferences")
+		return nil, status.Errorf(codes.Internal, "Error getting preferences")
+	}
+
+	logger.Info("Preferences updated")
+	return &pb_email_api.UpdatePreferencesResponse{
+		Address:     address,
+		Preferences: preferences,
+	}, nil
+}
+
+// newPreferences validates the requested preferences. The mandatory categories cannot be
+// opted out of and are not stored, as they are always sent.
+func (server *EmailServiceServer) newPreferences(address string, requested []*pb_email_api.CategoryPreference) ([]*model.Preference, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("Preferences are required")
+	}
+	now := server.clock.Now()
+	preferences := make([]*model.Preference, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, preference := range requested {
+		switch {
+		case preference.Category == "":
+			return nil, errors.New("Category is required")
+		case seen[preference.Category]:
+			return nil, fmt.Errorf("Duplicated category %s", preference.Category)
+		case server.mandatoryCategories[preference.Category] && !preference.Subscribed:
+			return nil, fmt.Errorf("Category %s is mandatory", preference.Category)
+		}
+		seen[preference.Category] = true
+		if server.mandatoryCategories[preference.Category] {
+			continue
+		}
+		preferences = append(preferences, &model.Preference{
+			Address:    address,
+			Category:   preference.Category,
+			Subscribed: preference.Subscribed,
+			UpdatedAt:  now,
+		})
+	}
+	return preferences, nil
+}
+
+// getPreferences returns the stored preferences of a recipient along with the mandatory
+// categories, ordered by category
+func (server *EmailServiceServer) getPreferences(ctx context.Context, address string) ([]*pb_email_api.CategoryPreference, error) {
+	stored, err := server.preferenceRepository.List(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make([]*pb_email_api.CategoryPreference, 0, len(stored)+len(server.mandatoryCategories))
+	for _, preference := range stored {
+		if server.mandatoryCategories[preference.Category] {
+			continue
+		}
+		preferences = append(preferences, &pb_email_api.CategoryPreference{
+			Category:   preference.Category,
+			Subscribed: preference.Subscribed,
+			UpdatedAt:  timestamppb.New(preference.UpdatedAt),
+		})
+	}
+	for category := range server.mandatoryCategories {
+		preferences = append(preferences, &pb_email_api.CategoryPreference{
+			Category:   category,
+			Subscribed: true,
+			Mandatory:  true,
+		})
+	}
+	sort.Slice(preferences, func(i, j int) bool {
+		return preferences[i].Category < preferences[j].Category
+	})
+	return preferences, nil
+}
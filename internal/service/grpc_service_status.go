@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+var emailStatuses = map[model.Status]pb_email_api.EmailStatus{
+	model.StatusAccepted:     pb_email_api.EmailStatus_EMAIL_STATUS_ACCEPTED,
+	model.StatusScheduled:    pb_email_api.EmailStatus_EMAIL_STATUS_SCHEDULED,
+	model.StatusQueued:       pb_email_api.EmailStatus_EMAIL_STATUS_QUEUED,
+	model.StatusSending:      pb_email_api.EmailStatus_EMAIL_STATUS_SENDING,
+	model.StatusSent:         pb_email_api.EmailStatus_EMAIL_STATUS_SENT,
+	model.StatusDelivered:    pb_email_api.EmailStatus_EMAIL_STATUS_DELIVERED,
+	model.StatusDeferred:     pb_email_api.EmailStatus_EMAIL_STATUS_DEFERRED,
+	model.StatusBounced:      pb_email_api.EmailStatus_EMAIL_STATUS_BOUNCED,
+	model.StatusComplained:   pb_email_api.EmailStatus_EMAIL_STATUS_COMPLAINED,
+	model.StatusUnsubscribed: pb_email_api.EmailStatus_EMAIL_STATUS_UNSUBSCRIBED,
+	model.StatusFailed:       pb_email_api.EmailStatus_EMAIL_STATUS_FAILED,
+	model.StatusCancelled:    pb_email_api.EmailStatus_EMAIL_STATUS_CANCELLED,
+	model.StatusOpened:       pb_email_api.EmailStatus_EMAIL_STATUS_OPENED,
+	model.StatusClicked:      pb_email_api.EmailStatus_EMAIL_STATUS_CLICKED,
+}
+
+var priorities = map[model.Priority]pb_email_api.Priority{
+	model.PriorityCritical:      pb_email_api.Priority_PRIORITY_CRITICAL,
+	model.PriorityTransactional: pb_email_api.Priority_PRIORITY_TRANSACTIONAL,
+	model.PriorityBulk:          pb_email_api.Priority_PRIORITY_BULK,
+}
+
+// GetEmailStatus returns an email with the history of its delivery to the client that
+// sent it or to an admin client
+func (server *EmailServiceServer) GetEmailStatus(ctx context.Context, request *pb_email_api.GetEmailStatusRequest) (*pb_email_api.GetEmailStatusResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := server.messageRepository.GetByID(ctx, request.MessageId)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		logger.Error(err, "Email not found")
+		return nil, status.Errorf(codes.NotFound, "Email not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error getting email")
+		return nil, status.Errorf(codes.Internal, "Error getting email")
+	}
+	if err := server.authorizeSender(ctx, logger, message); err != nil {
+		return nil, err
+	}
+
+	return &pb_email_api.GetEmailStatusResponse{
+		Email: toEmail(message),
+	}, nil
+}
+
+// ListEmails returns a page of the emails matching the filters of the request, out of the
+// emails sent by the client unless it is an admin client
+func (server *EmailServiceServer) ListEmails(ctx context.Context, request *pb_email_api.ListEmailsRequest) (*pb_email_api.ListEmailsResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := getMessageFilter(request)
+	if err != nil {
+		logger.Error(err, "Invalid list request")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	// The clients only list their own emails, unlike the admin clients
+	if !server.isAdmin(ctx) {
+		filter.ClientID = server.getClientID(ctx)
+	}
+	pageSize := filter.Limit
+	// One more email is read to know whether there is a next page
+	filter.Limit++
+	messages, err := server.messageRepository.List(ctx, filter)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		logger.Error(err, "Invalid page token")
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid page token")
+	}
+	if err != nil {
+		logger.Error(err, "Error listing emails")
+		return nil, status.Errorf(codes.Internal, "Error listing emails")
+	}
+
+	response := &pb_email_api.ListEmailsResponse{}
+	if len(messages) > pageSize {
+		messages = messages[:pageSize]
+		response.NextPageToken = messages[pageSize-1].ID
+	}
+	for _, message := range messages {
+		response.Emails = append(response.Emails, toEmail(message))
+	}
+	return response, nil
+}
+
+// getMessageFilter maps the filters of the request to the repository filter
+func getMessageFilter(request *pb_email_api.ListEmailsRequest) (*repository.MessageFilter, error) {
+	var err error
+	filter := &repository.MessageFilter{
+		To:            request.To,
+		CorrelationID: request.CorrelationId,
+		AfterID:       request.PageToken,
+		Limit:         int(request.PageSize),
+	}
+	if filter.Limit < 0 {
+		return nil, errors.New("Page size cannot be negative")
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageSize
+	}
+	filter.Limit = min(filter.Limit, maxPageSize)
+	if request.Status != pb_email_api.EmailStatus_EMAIL_STATUS_UNSPECIFIED {
+		for modelStatus, emailStatus := range emailStatuses {
+			if emailStatus == request.Status {
+				filter.Status = modelStatus
+			}
+		}
+		if filter.Status == "" {
+			return nil, errors.New("Invalid status")
+		}
+	}
+	if filter.CreatedAfter, err = getOptionalTime(request.CreatedAfter); err != nil {
+		return nil, err
+	}
+	if filter.CreatedBefore, err = getOptionalTime(request.CreatedBefore); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// getOptionalTime returns the time of the timestamp or the zero time when it is not set
+func getOptionalTime(timestamp *timestamppb.Timestamp) (time.Time, error) {
+	if timestamp == nil {
+		return time.Time{}, nil
+	}
+	if err := timestamp.CheckValid(); err != nil {
+		return time.Time{}, errors.New("Invalid time range")
+	}
+	return timestamp.AsTime(), nil
+}
+
+// toEmail maps a stored message to its API representation without its body
+func toEmail(message *model.Message) *pb_email_api.Email {
+	email := &pb_email_api.Email{
+		MessageId:     message.ID,
+		To:            message.To,
+		Subject:       message.Subject,
+		Priority:      priorities[message.Priority],
+		Category:      message.Category,
+		Status:        emailStatuses[message.Status],
+		SendAt:        timestamppb.New(message.SendAt),
+		CreatedAt:     timestamppb.New(message.CreatedAt),
+		UpdatedAt:     timestamppb.New(message.UpdatedAt),
+		CorrelationId: message.CorrelationID,
+		Deferrals:     int32(message.Deferrals),
+	}
+	if message.Opens != nil {
+		email.Opens = &pb_email_api.EmailOpens{
+			Count:         int32(message.Opens.Count),
+			FirstOpenedAt: timestamppb.New(message.Opens.FirstOpenedAt),
+			LastOpenedAt:  timestamppb.New(message.Opens.LastOpenedAt),
+			UserAgent:     string(message.Opens.UserAgent),
+		}
+	}
+	if message.Clicks != nil {
+		email.Clicks = &pb_email_api.EmailClicks{
+			Count:          int32(message.Clicks.Count),
+			FirstClickedAt: timestamppb.New(message.Clicks.FirstClickedAt),
+			LastClickedAt:  timestamppb.New(message.Clicks.LastClickedAt),
+			UserAgent:      string(message.Clicks.UserAgent),
+		}
+		for url, count := range message.Clicks.Links {
+			email.Clicks.Links = append(email.Clicks.Links, &pb_email_api.LinkClicks{Url: url, Count: int32(count)})
+		}
+		sort.Slice(email.Clicks.Links, func(i, j int) bool {
+			return email.Clicks.Links[i].Url < email.Clicks.Links[j].Url
+		})
+	}
+	for _, change := range message.History {
+		email.History = append(email.History, &pb_email_api.StatusChange{
+			Status:   emailStatuses[change.Status],
+			Time:     timestamppb.New(change.Time),
+			Response: change.Response,
+		})
+	}
+	return email
+}
@@ -0,0 +1,804 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/mtls"
+	"qd-email-api/internal/ratelimit"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/service/mock"
+	"qd-email-api/internal/webhook"
+	webhookMock "qd-email-api/internal/webhook/mock"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+func TestEmailServiceServerStatus(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*EmailServiceServer, *repository.FileMessageRepository, *loggerMock.MockLoggerer, context.Context, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    10,
+			AdminClients:          []string{"qd.admin.api"},
+		})
+		return server, messageRepository, loggerMock, ctx, controller
+	}
+	insert := func(messageRepository *repository.FileMessageRepository, id, to string, status model.Status, createdAt time.Time) {
+		message := &model.Message{
+			ID:            id,
+			To:            to,
+			Subject:       "Subject " + id,
+			Body:          "Body",
+			SendAt:        createdAt,
+			Priority:      model.PriorityBulk,
+			CorrelationID: "correlation-" + id,
+			CreatedAt:     createdAt,
+		}
+		message.Record(model.StatusChange{Status: model.StatusAccepted, Time: createdAt})
+		message.Record(model.StatusChange{Status: status, Time: createdAt, Response: "421 Try again later"})
+		messageRepository.Insert(context.Background(), message)
+	}
+
+	test.Run("Get_Email_Status_Success", func(test *testing.T) {
+		server, messageRepository, _, ctx, controller := setup(test)
+		defer controller.Finish()
+		insert(messageRepository, "1", "test@test.com", model.StatusDeferred, now)
+
+		response, err := server.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+
+		assert.NoError(test, err)
+		assert.Equal(test, "1", response.Email.MessageId)
+		assert.Equal(test, "test@test.com", response.Email.To)
+		assert.Equal(test, pb_email_api.Priority_PRIORITY_BULK, response.Email.Priority)
+		assert.Equal(test, pb_email_api.EmailStatus_EMAIL_STATUS_DEFERRED, response.Email.Status)
+		assert.Equal(test, "correlation-1", response.Email.CorrelationId)
+		assert.Len(test, response.Email.History, 2)
+		assert.Equal(test, pb_email_api.EmailStatus_EMAIL_STATUS_ACCEPTED, response.Email.History[0].Status)
+		assert.Equal(test, "421 Try again later", response.Email.History[1].Response)
+		assert.Equal(test, now, response.Email.History[1].Time.AsTime())
+	})
+
+	test.Run("Get_Email_Status_Opens", func(test *testing.T) {
+		server, messageRepository, _, ctx, controller := setup(test)
+		defer controller.Finish()
+		insert(messageRepository, "1", "test@test.com", model.StatusSent, now)
+		assert.NoError(test, messageRepository.RecordOpen(ctx, "1", model.UserAgentMobile, now.Add(time.Minute)))
+		assert.NoError(test, messageRepository.RecordOpen(ctx, "1", model.UserAgentDesktop, now.Add(time.Hour)))
+
+		response, err := server.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+
+		assert.NoError(test, err)
+		assert.Equal(test, pb_email_api.EmailStatus_EMAIL_STATUS_SENT, response.Email.Status)
+		assert.Equal(test, int32(2), response.Email.Opens.Count)
+		assert.Equal(test, now.Add(time.Minute), response.Email.Opens.FirstOpenedAt.AsTime())
+		assert.Equal(test, now.Add(time.Hour), response.Email.Opens.LastOpenedAt.AsTime())
+		assert.Equal(test, "mobile", response.Email.Opens.UserAgent)
+	})
+
+	test.Run("Get_Email_Status_Clicks", func(test *testing.T) {
+		server, messageRepository, _, ctx, controller := setup(test)
+		defer controller.Finish()
+		insert(messageRepository, "1", "test@test.com", model.StatusSent, now)
+		assert.NoError(test, messageRepository.RecordClick(ctx, "1", "https://quadev.net/b", model.UserAgentMobile, now))
+		assert.NoError(test, messageRepository.RecordClick(ctx, "1", "https://quadev.net/a", model.UserAgentMobile, now))
+
+		response, err := server.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+
+		assert.NoError(test, err)
+		assert.Nil(test, response.Email.Opens)
+		assert.Equal(test, int32(2), response.Email.Clicks.Count)
+		assert.Equal(test, "mobile", response.Email.Clicks.UserAgent)
+		assert.Len(test, response.Email.Clicks.Links, 2)
+		assert.Equal(test, "https://quadev.net/a", response.Email.Clicks.Links[0].Url)
+		assert.Equal(test, int32(1), response.Email.Clicks.Links[0].Count)
+		assert.Equal(test, "https://quadev.net/b", response.Email.Clicks.Links[1].Url)
+	})
+
+	test.Run("Get_Email_Status_Not_Found_Error", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(repository.ErrMessageNotFound, "Email not found").Times(1)
+
+		response, err := server.GetEmailStatus(ctx, &pb_email_api.GetEmailStatusRequest{MessageId: "unknown"})
+
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = NotFound desc = Email not found", err.Error())
+	})
+
+	test.Run("List_Emails_Filters_And_Pages", func(test *testing.T) {
+		server, messageRepository, _, ctx, controller := setup(test)
+		defer controller.Finish()
+		insert(messageRepository, "1", "test@test.com", model.StatusSent, now)
+		insert(messageRepository, "2", "test@test.com", model.StatusFailed, now.Add(time.Minute))
+		insert(messageRepository, "3", "other@test.com", model.StatusSent, now.Add(2*time.Minute))
+		insert(messageRepository, "4", "test@test.com", model.StatusSent, now.Add(3*time.Minute))
+		insert(messageRepository, "5", "test@test.com", model.StatusSent, now.Add(4*time.Minute))
+
+		request := &pb_email_api.ListEmailsRequest{
+			To:           "test@test.com",
+			Status:       pb_email_api.EmailStatus_EMAIL_STATUS_SENT,
+			CreatedAfter: timestamppb.New(now),
+			PageSize:     2,
+		}
+		response, err := server.ListEmails(ctx, request)
+
+		assert.NoError(test, err)
+		assert.Len(test, response.Emails, 2)
+		assert.Equal(test, "1", response.Emails[0].MessageId)
+		assert.Equal(test, "4", response.Emails[1].MessageId)
+		assert.Equal(test, "4", response.NextPageToken)
+
+		request.PageToken = response.NextPageToken
+		response, err = server.ListEmails(ctx, request)
+
+		assert.NoError(test, err)
+		assert.Len(test, response.Emails, 1)
+		assert.Equal(test, "5", response.Emails[0].MessageId)
+		assert.Empty(test, response.NextPageToken)
+
+		response, err = server.ListEmails(ctx, &pb_email_api.ListEmailsRequest{
+			CorrelationId: "correlation-3",
+			CreatedBefore: timestamppb.New(now.Add(3 * time.Minute)),
+		})
+
+		assert.NoError(test, err)
+		assert.Len(test, response.Emails, 1)
+		assert.Equal(test, "other@test.com", response.Emails[0].To)
+	})
+
+	test.Run("List_Emails_Invalid_Request_Error", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(gomock.Any(), gomock.Any()).Times(3)
+
+		_, err := server.ListEmails(ctx, &pb_email_api.ListEmailsRequest{PageSize: -1})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Page size cannot be negative", err.Error())
+		_, err = server.ListEmails(ctx, &pb_email_api.ListEmailsRequest{Status: pb_email_api.EmailStatus(100)})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Invalid status", err.Error())
+		_, err = server.ListEmails(ctx, &pb_email_api.ListEmailsRequest{PageToken: "unknown"})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Invalid page token", err.Error())
+	})
+
+	test.Run("Emails_Of_Other_Clients_Are_Hidden", func(test *testing.T) {
+		server, messageRepository, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+		first := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+		second := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.billing.api"})
+		admin := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.admin.api"})
+		for id, client := range map[string]context.Context{"1": first, "2": second} {
+			assert.NoError(test, messageRepository.Insert(ctx, &model.Message{
+				ID:        id,
+				To:        "test@test.com",
+				Status:    model.StatusSent,
+				ClientID:  server.getClientID(client),
+				CreatedAt: now,
+			}))
+		}
+		loggerMock.EXPECT().Error(ErrEmailOfOtherClient, "Unauthorized email request").Times(1)
+
+		_, err := server.GetEmailStatus(first, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+		assert.NoError(test, err)
+		response, err := server.GetEmailStatus(second, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = PermissionDenied desc = Email sent by another client", err.Error())
+		_, err = server.GetEmailStatus(admin, &pb_email_api.GetEmailStatusRequest{MessageId: "1"})
+		assert.NoError(test, err)
+
+		list, err := server.ListEmails(second, &pb_email_api.ListEmailsRequest{})
+		assert.NoError(test, err)
+		assert.Len(test, list.Emails, 1)
+		assert.Equal(test, "2", list.Emails[0].MessageId)
+		list, err = server.ListEmails(admin, &pb_email_api.ListEmailsRequest{})
+		assert.NoError(test, err)
+		assert.Len(test, list.Emails, 2)
+	})
+}
+
+// eventStreamMock records the sent events and ends the stream once it has the expected count
+type eventStreamMock struct {
+	pb_email_api.EmailService_StreamEventsServer
+	ctx      context.Context
+	cancel   context.CancelFunc
+	expected int
+	events   []*pb_email_api.EmailEvent
+}
+
+func (stream *eventStreamMock) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *eventStreamMock) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (stream *eventStreamMock) Send(emailEvent *pb_email_api.EmailEvent) error {
+	stream.events = append(stream.events, emailEvent)
+	if len(stream.events) == stream.expected {
+		stream.cancel()
+	}
+	return nil
+}
+
+func TestEmailServiceServerEvents(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*EmailServiceServer, *repository.FileMessageRepository, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		eventBus := event.NewBus(fakeClock, 3, 10)
+		messageRepository, _ := repository.NewFileMessageRepository("", eventBus)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              eventBus,
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    10,
+			AdminClients:          []string{"qd.admin.api"},
+		})
+		return server, messageRepository, loggerMock.NewMockLoggerer(controller), controller
+	}
+	newStream := func(loggerMock *loggerMock.MockLoggerer, expected int) *eventStreamMock {
+		ctx := mtls.NewContext(context.WithValue(context.Background(), log.LoggerKey, loggerMock), &mtls.Identity{CommonName: "qd.admin.api"})
+		ctx, cancel := context.WithCancel(ctx)
+		return &eventStreamMock{ctx: ctx, cancel: cancel, expected: expected}
+	}
+	insert := func(messageRepository *repository.FileMessageRepository, id, to, category string) {
+		message := &model.Message{ID: id, To: to, Category: category, CreatedAt: now}
+		message.Record(model.StatusChange{Status: model.StatusAccepted, Time: now})
+		messageRepository.Insert(context.Background(), message)
+	}
+
+	test.Run("Stream_Events_Filters_And_Resumes", func(test *testing.T) {
+		server, messageRepository, loggerMock, controller := setup(test)
+		defer controller.Finish()
+		subscription, _ := server.eventBus.Subscribe("")
+		insert(messageRepository, "0", "test@test.com", "security")
+		cursor := (<-subscription.Events()).Cursor
+		subscription.Close()
+		insert(messageRepository, "1", "test@test.com", "security")
+		insert(messageRepository, "2", "other@test.com", "security")
+		insert(messageRepository, "3", "test@test.com", "news")
+
+		filtered := newStream(loggerMock, 1)
+		err := server.StreamEvents(&pb_email_api.StreamEventsRequest{
+			To:       "TEST@test.com",
+			Category: "security",
+			Cursor:   cursor,
+		}, filtered)
+
+		assert.NoError(test, err)
+		assert.Len(test, filtered.events, 1)
+		assert.Equal(test, "1", filtered.events[0].MessageId)
+		assert.Equal(test, "test@test.com", filtered.events[0].To)
+		assert.Equal(test, "security", filtered.events[0].Category)
+		assert.Equal(test, pb_email_api.EmailStatus_EMAIL_STATUS_ACCEPTED, filtered.events[0].Status)
+		assert.Equal(test, now, filtered.events[0].Time.AsTime())
+
+		resumed := newStream(loggerMock, 2)
+		err = server.StreamEvents(&pb_email_api.StreamEventsRequest{Cursor: filtered.events[0].Cursor}, resumed)
+
+		assert.NoError(test, err)
+		assert.Equal(test, "2", resumed.events[0].MessageId)
+		assert.Equal(test, "3", resumed.events[1].MessageId)
+
+		// Only the last three events are kept
+		insert(messageRepository, "4", "test@test.com", "")
+		loggerMock.EXPECT().Error(event.ErrCursorExpired, "Expired event cursor").Times(1)
+		err = server.StreamEvents(&pb_email_api.StreamEventsRequest{Cursor: cursor}, newStream(loggerMock, 1))
+		assert.Equal(test, "rpc error: code = OutOfRange desc = Cursor expired, list the emails to catch up", err.Error())
+	})
+
+	test.Run("Stream_Events_Invalid_Cursor_Error", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(event.ErrInvalidCursor, "Invalid event cursor").Times(1)
+		err := server.StreamEvents(&pb_email_api.StreamEventsRequest{Cursor: "unknown"}, newStream(loggerMock, 1))
+
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Invalid cursor", err.Error())
+	})
+
+	test.Run("Stream_Events_Require_Admin_Client", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(ErrAdminClientRequired, "Unauthorized admin request").Times(1)
+		stream := newStream(loggerMock, 1)
+		stream.ctx = mtls.NewContext(stream.ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+		err := server.StreamEvents(&pb_email_api.StreamEventsRequest{}, stream)
+
+		assert.Equal(test, "rpc error: code = PermissionDenied desc = Admin client required", err.Error())
+	})
+}
+
+func TestEmailServiceServerWebhooks(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*EmailServiceServer, *webhookMock.MockNotifierer, *loggerMock.MockLoggerer, context.Context, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		notifierMock := webhookMock.NewMockNotifierer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := mtls.NewContext(context.WithValue(context.Background(), log.LoggerKey, loggerMock), &mtls.Identity{CommonName: "qd.admin.api"})
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			WebhookNotifier:       notifierMock,
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    10,
+			AdminClients:          []string{"qd.admin.api"},
+		})
+		return server, notifierMock, loggerMock, ctx, controller
+	}
+
+	test.Run("List_Webhook_Deliveries_Success", func(test *testing.T) {
+		server, notifierMock, _, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		notifierMock.EXPECT().Deliveries("notifications").Return([]webhook.Delivery{
+			{
+				EventID:    "event",
+				Type:       webhook.EventBounced,
+				MessageID:  "1",
+				Attempt:    2,
+				Time:       now,
+				Duration:   time.Second,
+				StatusCode: 503,
+				Error:      "Unexpected status 503 Service Unavailable",
+			},
+		}, nil)
+
+		response, err := server.ListWebhookDeliveries(ctx, &pb_email_api.ListWebhookDeliveriesRequest{Endpoint: "notifications"})
+
+		assert.NoError(test, err)
+		assert.Len(test, response.Deliveries, 1)
+		delivery := response.Deliveries[0]
+		assert.Equal(test, "event", delivery.EventId)
+		assert.Equal(test, "bounced", delivery.Type)
+		assert.Equal(test, "1", delivery.MessageId)
+		assert.Equal(test, int32(2), delivery.Attempt)
+		assert.Equal(test, now, delivery.Time.AsTime())
+		assert.Equal(test, time.Second, delivery.Duration.AsDuration())
+		assert.Equal(test, int32(503), delivery.StatusCode)
+		assert.Equal(test, "Unexpected status 503 Service Unavailable", delivery.Error)
+	})
+
+	test.Run("List_Webhook_Deliveries_Not_Found_Error", func(test *testing.T) {
+		server, notifierMock, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		notifierMock.EXPECT().Deliveries("unknown").Return(nil, webhook.ErrEndpointNotFound)
+		loggerMock.EXPECT().Error(webhook.ErrEndpointNotFound, "Webhook endpoint not found").Times(1)
+
+		response, err := server.ListWebhookDeliveries(ctx, &pb_email_api.ListWebhookDeliveriesRequest{Endpoint: "unknown"})
+
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = NotFound desc = Webhook endpoint not found", err.Error())
+	})
+
+	test.Run("List_Webhook_Deliveries_Require_Admin_Client", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(ErrAdminClientRequired, "Unauthorized admin request").Times(1)
+		other := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+
+		response, err := server.ListWebhookDeliveries(other, &pb_email_api.ListWebhookDeliveriesRequest{Endpoint: "notifications"})
+
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = PermissionDenied desc = Admin client required", err.Error())
+	})
+}
+
+const complaintReport = "Subject: FW: Welcome\r\n" +
+	"Content-Type: multipart/report; report-type=feedback-report; boundary=report\r\n\r\n" +
+	"--report\r\nContent-Type: message/feedback-report\r\n\r\n" +
+	"Feedback-Type: abuse\r\nOriginal-Rcpt-To: user@test.com\r\n\r\n" +
+	"--report\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+	"To: user@test.com\r\nMessage-ID: <ABC123@test.com>\r\n" +
+	"--report--\r\n"
+
+func TestEmailServiceServerSuppressions(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*EmailServiceServer, *mock.MockSchedulerer, *loggerMock.MockLoggerer, context.Context, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := mtls.NewContext(context.WithValue(context.Background(), log.LoggerKey, loggerMock), &mtls.Identity{CommonName: "qd.admin.api"})
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    10,
+			AdminClients:          []string{"qd.admin.api"},
+		})
+		return server, schedulerMock, loggerMock, ctx, controller
+	}
+
+	test.Run("Add_Get_List_Remove_Suppression", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Suppression added").Times(2)
+		loggerMock.EXPECT().Info("Suppression removed").Times(1)
+
+		added, err := server.AddSuppression(ctx, &pb_email_api.AddSuppressionRequest{Address: "Blocked <User@Test.com>", Description: "Requested by support"})
+		assert.NoError(test, err)
+		_, err = server.AddSuppression(ctx, &pb_email_api.AddSuppressionRequest{Address: "other@test.com"})
+		assert.NoError(test, err)
+
+		found, err := server.GetSuppression(ctx, &pb_email_api.GetSuppressionRequest{Address: "user@test.com"})
+		assert.NoError(test, err)
+		assert.Equal(test, "user@test.com", added.Suppression.Address)
+		assert.Equal(test, "user@test.com", found.Suppression.Address)
+		assert.Equal(test, pb_email_api.SuppressionReason_SUPPRESSION_REASON_MANUAL, found.Suppression.Reason)
+		assert.Equal(test, "Requested by support", found.Suppression.Description)
+		assert.Equal(test, now, found.Suppression.CreatedAt.AsTime())
+
+		page, err := server.ListSuppressions(ctx, &pb_email_api.ListSuppressionsRequest{PageSize: 1})
+		assert.NoError(test, err)
+		assert.Len(test, page.Suppressions, 1)
+		assert.Equal(test, "other@test.com", page.Suppressions[0].Address)
+		page, err = server.ListSuppressions(ctx, &pb_email_api.ListSuppressionsRequest{
+			Reason:    pb_email_api.SuppressionReason_SUPPRESSION_REASON_MANUAL,
+			PageToken: page.NextPageToken,
+		})
+		assert.NoError(test, err)
+		assert.Len(test, page.Suppressions, 1)
+		assert.Equal(test, "user@test.com", page.Suppressions[0].Address)
+		assert.Empty(test, page.NextPageToken)
+
+		removed, err := server.RemoveSuppression(ctx, &pb_email_api.RemoveSuppressionRequest{Address: "USER@test.com"})
+		assert.NoError(test, err)
+		assert.True(test, removed.Success)
+	})
+
+	test.Run("Suppression_Errors", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid suppression address").Times(1)
+		loggerMock.EXPECT().Error(repository.ErrSuppressionNotFound, "Suppression not found").Times(1)
+		loggerMock.EXPECT().Error(repository.ErrSuppressionNotFound, "Suppression to remove not found").Times(1)
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid list request").Times(1)
+
+		_, err := server.AddSuppression(ctx, &pb_email_api.AddSuppressionRequest{Address: "invalid"})
+		assert.Equal(test, codes.InvalidArgument, status.Code(err))
+		_, err = server.GetSuppression(ctx, &pb_email_api.GetSuppressionRequest{Address: "user@test.com"})
+		assert.Equal(test, "rpc error: code = NotFound desc = Suppression not found", err.Error())
+		_, err = server.RemoveSuppression(ctx, &pb_email_api.RemoveSuppressionRequest{Address: "user@test.com"})
+		assert.Equal(test, "rpc error: code = NotFound desc = Suppression not found", err.Error())
+		_, err = server.ListSuppressions(ctx, &pb_email_api.ListSuppressionsRequest{Reason: 42})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Invalid reason", err.Error())
+	})
+
+	test.Run("Admin_Requests_Require_Admin_Client", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(ErrAdminClientRequired, "Unauthorized admin request").Times(7)
+		other := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+		anonymous := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		_, err := server.AddSuppression(other, &pb_email_api.AddSuppressionRequest{Address: "user@test.com"})
+		assert.Equal(test, "rpc error: code = PermissionDenied desc = Admin client required", err.Error())
+		_, err = server.RemoveSuppression(anonymous, &pb_email_api.RemoveSuppressionRequest{Address: "user@test.com"})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+		_, err = server.ReportComplaint(other, &pb_email_api.ReportComplaintRequest{Report: []byte(complaintReport)})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+		_, err = server.UpdatePreferences(anonymous, &pb_email_api.UpdatePreferencesRequest{Address: "user@test.com"})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+		_, err = server.GetSuppression(other, &pb_email_api.GetSuppressionRequest{Address: "user@test.com"})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+		_, err = server.ListSuppressions(anonymous, &pb_email_api.ListSuppressionsRequest{})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+		_, err = server.GetPreferences(other, &pb_email_api.GetPreferencesRequest{Address: "user@test.com"})
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+	})
+
+	test.Run("Suppressed_Recipient_Is_Refused", func(test *testing.T) {
+		server, schedulerMock, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, server.suppressionRepository.Add(ctx, &model.Suppression{
+			Address:   "user@test.com",
+			Reason:    model.SuppressionHardBounce,
+			CreatedAt: now,
+		}))
+		loggerMock.EXPECT().Error(gomock.Any(), "Recipient suppressed").Times(1)
+
+		response, err := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{To: "User@test.com", Subject: "Subject", Body: "Body"})
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = FailedPrecondition desc = Recipient is suppressed: hard_bounce", err.Error())
+
+		// Critical security emails can override the suppression
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message *model.Message) error {
+			assert.True(test, message.IgnoreSuppression)
+			return nil
+		})
+		loggerMock.EXPECT().Info("Email sent").Times(1)
+
+		response, err = server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:                "user@test.com",
+			Subject:           "Password reset",
+			Body:              "Body",
+			Priority:          pb_email_api.Priority_PRIORITY_CRITICAL,
+			IgnoreSuppression: true,
+		})
+		assert.NoError(test, err)
+		assert.Equal(test, "Email sent", response.Message)
+	})
+
+	test.Run("Ignore_Suppression_Requires_Critical_Admin_Email", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, server.suppressionRepository.Add(ctx, &model.Suppression{
+			Address:   "user@test.com",
+			Reason:    model.SuppressionHardBounce,
+			CreatedAt: now,
+		}))
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid email request").Times(1)
+		loggerMock.EXPECT().Error(ErrAdminClientRequired, "Unauthorized admin request").Times(1)
+
+		response, err := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:                "user@test.com",
+			Subject:           "Newsletter",
+			Body:              "Body",
+			IgnoreSuppression: true,
+		})
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Suppression can only be ignored by critical emails", err.Error())
+
+		other := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+		response, err = server.SendEmail(other, &pb_email_api.SendEmailRequest{
+			To:                "user@test.com",
+			Subject:           "Password reset",
+			Body:              "Body",
+			Priority:          pb_email_api.Priority_PRIORITY_CRITICAL,
+			IgnoreSuppression: true,
+		})
+		assert.Nil(test, response)
+		assert.Equal(test, codes.PermissionDenied, status.Code(err))
+	})
+
+	test.Run("Suppressed_Batch_Recipient_Is_Skipped", func(test *testing.T) {
+		server, schedulerMock, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, server.suppressionRepository.Add(ctx, &model.Suppression{
+			Address:   "user@test.com",
+			Reason:    model.SuppressionComplaint,
+			CreatedAt: now,
+		}))
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Len(1)).Times(1).Return(nil)
+		loggerMock.EXPECT().Info("Batch accepted 1 of 2 recipients").Times(1)
+
+		response, err := server.sendBatch(ctx, loggerMock, &pb_email_api.BatchTemplate{Subject: "Subject", Body: "Body"}, []*pb_email_api.BatchRecipient{
+			{To: "user@test.com"},
+			{To: "other@test.com"},
+		})
+
+		assert.NoError(test, err)
+		assert.False(test, response.Results[0].Accepted)
+		assert.Equal(test, "Recipient is suppressed: complaint", response.Results[0].Error)
+		assert.True(test, response.Results[1].Accepted)
+	})
+	test.Run("Complained_Recipient_Gets_Critical_Email", func(test *testing.T) {
+		server, schedulerMock, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, server.suppressionRepository.Add(ctx, &model.Suppression{
+			Address:   "user@test.com",
+			Reason:    model.SuppressionComplaint,
+			CreatedAt: now,
+		}))
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Return(nil)
+		loggerMock.EXPECT().Info("Email sent").Times(1)
+
+		response, err := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       "user@test.com",
+			Subject:  "Password reset",
+			Body:     "Body",
+			Priority: pb_email_api.Priority_PRIORITY_CRITICAL,
+		})
+
+		assert.NoError(test, err)
+		assert.Equal(test, "Email sent", response.Message)
+	})
+
+	test.Run("Report_Complaint", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		server.feedbackHandler = NewBounceRecorder(server.messageRepository, server.suppressionRepository, server.clock, loggerMock)
+		message := &model.Message{ID: "abc123", To: "user@test.com", CreatedAt: now}
+		message.Record(model.StatusChange{Status: model.StatusSent, Time: now})
+		assert.NoError(test, server.messageRepository.Insert(ctx, message))
+		loggerMock.EXPECT().Info("Recipient of email abc123 suppressed after a complaint").Times(1)
+		loggerMock.EXPECT().Info("Complaint reported").Times(1)
+
+		response, err := server.ReportComplaint(ctx, &pb_email_api.ReportComplaintRequest{Report: []byte(complaintReport)})
+
+		assert.NoError(test, err)
+		assert.Equal(test, &pb_email_api.ReportComplaintResponse{
+			MessageId:    "abc123",
+			Recipient:    "user@test.com",
+			FeedbackType: "abuse",
+		}, response)
+		suppression, err := server.suppressionRepository.Get(ctx, "user@test.com")
+		assert.NoError(test, err)
+		assert.Equal(test, model.SuppressionComplaint, suppression.Reason)
+	})
+
+	test.Run("Report_Complaint_Errors", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid feedback report").Times(2)
+		loggerMock.EXPECT().Error(repository.ErrMessageNotFound, "Complained email not found").Times(1)
+
+		_, err := server.ReportComplaint(ctx, &pb_email_api.ReportComplaintRequest{Report: []byte("Subject: Hello\r\n\r\nHow are you?")})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Message is not a feedback report", err.Error())
+		withoutID := strings.Replace(complaintReport, "Message-ID: <ABC123@test.com>\r\n", "", 1)
+		_, err = server.ReportComplaint(ctx, &pb_email_api.ReportComplaintRequest{Report: []byte(withoutID)})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Feedback report does not identify the email", err.Error())
+		_, err = server.ReportComplaint(ctx, &pb_email_api.ReportComplaintRequest{Report: []byte(complaintReport)})
+		assert.Equal(test, "rpc error: code = NotFound desc = Email not found", err.Error())
+	})
+}
+
+func TestEmailServiceServerPreferences(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*EmailServiceServer, *mock.MockSchedulerer, *loggerMock.MockLoggerer, context.Context, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := mtls.NewContext(context.WithValue(context.Background(), log.LoggerKey, loggerMock), &mtls.Identity{CommonName: "qd.admin.api"})
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    10,
+			AdminClients:          []string{"qd.admin.api"},
+			MandatoryCategories:   []string{"security-alerts"},
+		})
+		return server, schedulerMock, loggerMock, ctx, controller
+	}
+
+	test.Run("Update_Get_Preferences", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Preferences updated").Times(1)
+
+		updated, err := server.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{
+			Address: "User@Test.com",
+			Preferences: []*pb_email_api.CategoryPreference{
+				{Category: "product-updates", Subscribed: false},
+				{Category: "newsletter", Subscribed: true},
+				{Category: "security-alerts", Subscribed: true},
+			},
+		})
+		assert.NoError(test, err)
+		assert.Equal(test, "user@test.com", updated.Address)
+
+		found, err := server.GetPreferences(ctx, &pb_email_api.GetPreferencesRequest{Address: "user@test.com"})
+		assert.NoError(test, err)
+		assert.Equal(test, updated.Preferences, found.Preferences)
+		assert.Len(test, found.Preferences, 3)
+		assert.Equal(test, "newsletter", found.Preferences[0].Category)
+		assert.True(test, found.Preferences[0].Subscribed)
+		assert.Equal(test, now, found.Preferences[0].UpdatedAt.AsTime())
+		assert.Equal(test, "product-updates", found.Preferences[1].Category)
+		assert.False(test, found.Preferences[1].Subscribed)
+		assert.Equal(test, &pb_email_api.CategoryPreference{Category: "security-alerts", Subscribed: true, Mandatory: true}, found.Preferences[2])
+	})
+
+	test.Run("Preferences_Errors", func(test *testing.T) {
+		server, _, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid preferences address").Times(2)
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid preferences").Times(3)
+
+		_, err := server.GetPreferences(ctx, &pb_email_api.GetPreferencesRequest{Address: "invalid"})
+		assert.Equal(test, codes.InvalidArgument, status.Code(err))
+		_, err = server.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{Address: "invalid"})
+		assert.Equal(test, codes.InvalidArgument, status.Code(err))
+		_, err = server.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{Address: "user@test.com"})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Preferences are required", err.Error())
+		_, err = server.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{
+			Address:     "user@test.com",
+			Preferences: []*pb_email_api.CategoryPreference{{Category: "security-alerts"}},
+		})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Category security-alerts is mandatory", err.Error())
+		_, err = server.UpdatePreferences(ctx, &pb_email_api.UpdatePreferencesRequest{
+			Address:     "user@test.com",
+			Preferences: []*pb_email_api.CategoryPreference{{Category: "newsletter"}, {Category: "newsletter", Subscribed: true}},
+		})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Duplicated category newsletter", err.Error())
+	})
+
+	test.Run("Opted_Out_Email_Is_Skipped", func(test *testing.T) {
+		server, schedulerMock, loggerMock, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Return(&OptedOutError{
+			Preference: &model.Preference{Address: "user@test.com", Category: "product-updates"},
+		})
+		loggerMock.EXPECT().Info("Email skipped").Times(1)
+
+		response, err := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       "user@test.com",
+			Subject:  "Subject",
+			Body:     "Body",
+			Category: "product-updates",
+		})
+
+		assert.NoError(test, err)
+		assert.True(test, response.Success)
+		assert.Equal(test, "Email skipped", response.Message)
+		assert.NotEmpty(test, response.MessageId)
+	})
+}
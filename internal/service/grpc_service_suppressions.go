@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/bounce"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+var suppressionReasons = map[model.SuppressionReason]pb_email_api.SuppressionReason{
+	model.SuppressionHardBounce:  pb_email_api.SuppressionReason_SUPPRESSION_REASON_HARD_BOUNCE,
+	model.SuppressionComplaint:   pb_email_api.SuppressionReason_SUPPRESSION_REASON_COMPLAINT,
+	model.SuppressionManual:      pb_email_api.SuppressionReason_SUPPRESSION_REASON_MANUAL,
+	model.SuppressionUnsubscribe: pb_email_api.SuppressionReason_SUPPRESSION_REASON_UNSUBSCRIBE,
+}
+
+// AddSuppression suppresses an address manually
+func (server *EmailServiceServer) AddSuppression(ctx context.Context, request *pb_email_api.AddSuppressionRequest) (*pb_email_api.AddSuppressionResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	address, err := ValidateRecipient(request.Address)
+	if err != nil {
+		logger.Error(err, "Invalid suppression address")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	suppression := &model.Suppression{
+		Address:     strings.ToLower(address),
+		Reason:      model.SuppressionManual,
+		Description: request.Description,
+		CreatedAt:   server.clock.Now(),
+	}
+	if err := server.suppressionRepository.Add(ctx, suppression); err != nil {
+		logger.Error(err, "Error adding suppression")
+		return nil, status.Errorf(codes.Internal, "Error adding suppression")
+	}
+
+	logger.Info("Suppression added")
+	return &pb_email_api.AddSuppressionResponse{
+		Suppression: toSuppression(suppression),
+	}, nil
+}
+
+// RemoveSuppression allows sending to a suppressed address again
+func (server *EmailServiceServer) RemoveSuppression(ctx context.Context, request *pb_email_api.RemoveSuppressionRequest) (*pb_email_api.RemoveSuppressionResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	err = server.suppressionRepository.Remove(ctx, request.Address)
+	if errors.Is(err, repository.ErrSuppressionNotFound) {
+		logger.Error(err, "Suppression to remove not found")
+		return nil, status.Errorf(codes.NotFound, "Suppression not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error removing suppression")
+		return nil, status.Errorf(codes.Internal, "Error removing suppression")
+	}
+
+	logger.Info("Suppression removed")
+	return &pb_email_api.RemoveSuppressionResponse{
+		Success: true,
+		Message: "Suppression removed",
+	}, nil
+}
+
+// GetSuppression returns why and since when an address is suppressed
+func (server *EmailServiceServer) GetSuppression(ctx context.Context, request *pb_email_api.GetSuppressionRequest) (*pb_email_api.GetSuppressionResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	suppression, err := server.suppressionRepository.Get(ctx, request.Address)
+	if errors.Is(err, repository.ErrSuppressionNotFound) {
+		logger.Error(err, "Suppression not found")
+		return nil, status.Errorf(codes.NotFound, "Suppression not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error getting suppression")
+		return nil, status.Errorf(codes.Internal, "Error getting suppression")
+	}
+
+	return &pb_email_api.GetSuppressionResponse{
+		Suppression: toSuppression(suppression),
+	}, nil
+}
+
+// ListSuppressions returns a page of the suppressed addresses
+func (server *EmailServiceServer) ListSuppressions(ctx context.Context, request *pb_email_api.ListSuppressionsRequest) (*pb_email_api.ListSuppressionsResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	filter, err := getSuppressionFilter(request)
+	if err != nil {
+		logger.Error(err, "Invalid list request")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	pageSize := filter.Limit
+	// One more suppression is read to know whether there is a next page
+	filter.Limit++
+	suppressions, err := server.suppressionRepository.List(ctx, filter)
+	if err != nil {
+		logger.Error(err, "Error listing suppressions")
+		return nil, status.Errorf(codes.Internal, "Error listing suppressions")
+	}
+
+	response := &pb_email_api.ListSuppressionsResponse{}
+	if len(suppressions) > pageSize {
+		suppressions = suppressions[:pageSize]
+		response.NextPageToken = suppressions[pageSize-1].Address
+	}
+	for _, suppression := range suppressions {
+		response.Suppressions = append(response.Suppressions, toSuppression(suppression))
+	}
+	return response, nil
+}
+
+// ReportComplaint records a feedback report forwarded outside of the inbound listener,
+// suppressing the recipient of the email it refers to
+func (server *EmailServiceServer) ReportComplaint(ctx context.Context, request *pb_email_api.ReportComplaintRequest) (*pb_email_api.ReportComplaintResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	complaint, err := bounce.ParseComplaint(request.Report)
+	if err != nil {
+		logger.Error(err, "Invalid feedback report")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if complaint.MessageID == "" {
+		err := errors.New("Feedback report does not identify the email")
+		logger.Error(err, "Invalid feedback report")
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	_, err = server.messageRepository.GetByID(ctx, complaint.MessageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		logger.Error(err, "Complained email not found")
+		return nil, status.Errorf(codes.NotFound, "Email not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error getting complained email")
+		return nil, status.Errorf(codes.Internal, "Error getting email")
+	}
+	if err := server.feedbackHandler.HandleComplaint(ctx, complaint); err != nil {
+		logger.Error(err, "Error handling complaint")
+		return nil, status.Errorf(codes.Internal, "Error handling complaint")
+	}
+
+	logger.Info("Complaint reported")
+	return &pb_email_api.ReportComplaintResponse{
+		MessageId:    complaint.MessageID,
+		Recipient:    complaint.Recipient,
+		FeedbackType: complaint.FeedbackType,
+	}, nil
+}
+
+// getSuppressionFilter maps the filters of the request to the repository filter
+func getSuppressionFilter(request *pb_email_api.ListSuppressionsRequest) (*repository.SuppressionFilter, error) {
+	filter := &repository.SuppressionFilter{
+		AfterAddress: request.PageToken,
+		Limit:        int(request.PageSize),
+	}
+	if filter.Limit < 0 {
+		return nil, errors.New("Page size cannot be negative")
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultPageSize
+	}
+	filter.Limit = min(filter.Limit, maxPageSize)
+	if request.Reason != pb_email_api.SuppressionReason_SUPPRESSION_REASON_UNSPECIFIED {
+		for modelReason, reason := range suppressionReasons {
+			if reason == request.Reason {
+				filter.Reason = modelReason
+			}
+		}
+		if filter.Reason == "" {
+			return nil, errors.New("Invalid reason")
+		}
+	}
+	return filter, nil
+}
+
+// toSuppression maps a stored suppression to its API representation
+func toSuppression(suppression *model.Suppression) *pb_email_api.Suppression {
+	return &pb_email_api.Suppression{
+		Address:     suppression.Address,
+		Reason:      suppressionReasons[suppression.Reason],
+		Description: suppression.Description,
+		MessageId:   suppression.MessageID,
+		CreatedAt:   timestamppb.New(suppression.CreatedAt),
+	}
+}
@@ -3,19 +3,37 @@ package service
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
-	"github.com/quadev-ltd/qd-common/pb/gen/go/pb_email"
 	"github.com/quadev-ltd/qd-common/pkg/log"
 	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/mtls"
+	"qd-email-api/internal/ratelimit"
+	rateLimitMock "qd-email-api/internal/ratelimit/mock"
+	"qd-email-api/internal/repository"
 	"qd-email-api/internal/service/mock"
+	"qd-email-api/pb/gen/go/pb_email_api"
 )
 
 func TestEmailServiceServer(test *testing.T) {
-	sendEmailRequest := &pb_email.SendEmailRequest{
+	const maxBatchRecipients = 3
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	sendEmailRequest := &pb_email_api.SendEmailRequest{
 		To:      "test@test.com",
 		Subject: "Test subject",
 		Body:    "Test body",
@@ -24,9 +42,23 @@ func TestEmailServiceServer(test *testing.T) {
 		controller := gomock.NewController(test)
 		defer controller.Finish()
 
-		emailServiceMock := mock.NewMockEmailServicer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
 
-		server := NewEmailServiceServer(emailServiceMock)
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
 
 		response, returnedError := server.SendEmail(context.Background(), sendEmailRequest)
 
@@ -39,17 +71,29 @@ func TestEmailServiceServer(test *testing.T) {
 		controller := gomock.NewController(test)
 		defer controller.Finish()
 
-		emailServiceMock := mock.NewMockEmailServicer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
 		loggerMock := loggerMock.NewMockLoggerer(controller)
 		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
 
-		server := NewEmailServiceServer(emailServiceMock)
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
 
 		const expectedError = "Error sending email"
 		loggerMock.EXPECT().Error(gomock.Any(), gomock.Any()).Times(1)
-		emailServiceMock.EXPECT().SendEmail(
-			gomock.Any(),
-			gomock.Any(),
+		schedulerMock.EXPECT().Send(
 			gomock.Any(),
 			gomock.Any(),
 		).Times(1).Return(errors.New(expectedError))
@@ -65,16 +109,28 @@ func TestEmailServiceServer(test *testing.T) {
 		controller := gomock.NewController(test)
 		defer controller.Finish()
 
-		emailServiceMock := mock.NewMockEmailServicer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
 		loggerMock := loggerMock.NewMockLoggerer(controller)
 		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
 
-		server := NewEmailServiceServer(emailServiceMock)
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
 
 		loggerMock.EXPECT().Info(gomock.Any()).Times(1)
-		emailServiceMock.EXPECT().SendEmail(
-			gomock.Any(),
-			gomock.Any(),
+		schedulerMock.EXPECT().Send(
 			gomock.Any(),
 			gomock.Any(),
 		).Times(1).Return(nil)
@@ -86,4 +142,882 @@ func TestEmailServiceServer(test *testing.T) {
 		assert.Equal(test, "Email sent", response.Message)
 	})
 
+	test.Run("Send_Email_Normalizes_Recipient", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{Recipient: ratelimit.Limit{Rate: 0.001, Burst: 1}}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		loggerMock.EXPECT().Info("Email sent").Times(1)
+		loggerMock.EXPECT().Error(gomock.Any(), "Too many requests").Times(1)
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message *model.Message) error {
+			assert.Equal(test, "test@test.com", message.To)
+			return nil
+		})
+
+		_, returnedError := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{To: "Test <Test@TEST.com>", Subject: "Subject", Body: "Body"})
+		assert.NoError(test, returnedError)
+
+		// The other spellings of the address share its rate limit
+		_, returnedError = server.SendEmail(ctx, &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Body"})
+		assert.Equal(test, codes.ResourceExhausted, status.Code(returnedError))
+	})
+
+	test.Run("Send_Email_Invalid_Recipient_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		loggerMock.EXPECT().Error(gomock.Any(), "Invalid email request").Times(1)
+
+		response, returnedError := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{To: "invalid", Subject: "Subject", Body: "Body"})
+
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Invalid recipient \"invalid\"", returnedError.Error())
+	})
+
+	test.Run("Send_Email_Past_Send_At_Sends_Immediately", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		loggerMock.EXPECT().Info("Email sent").Times(1)
+		schedulerMock.EXPECT().Send(
+			gomock.Any(),
+			gomock.Any(),
+		).Times(1).DoAndReturn(func(_ context.Context, message *model.Message) error {
+			assert.Equal(test, sendEmailRequest.To, message.To)
+			assert.Equal(test, sendEmailRequest.Subject, message.Subject)
+			assert.Equal(test, sendEmailRequest.Body, message.Body)
+			assert.Equal(test, model.PriorityTransactional, message.Priority)
+			return nil
+		})
+
+		response, returnedError := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:      sendEmailRequest.To,
+			Subject: sendEmailRequest.Subject,
+			Body:    sendEmailRequest.Body,
+			SendAt:  timestamppb.New(now.Add(-time.Minute)),
+		})
+
+		assert.NoError(test, returnedError)
+		assert.Equal(test, "Email sent", response.Message)
+		assert.NotEmpty(test, response.MessageId)
+	})
+
+	test.Run("Send_Email_Deferred_Success", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		deferral := &DeferredError{Domain: "test.com", RetryAfter: time.Minute}
+		var sent *model.Message
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+			func(_ context.Context, message *model.Message) error {
+				sent = message
+				return deferral
+			},
+		)
+		loggerMock.EXPECT().Warn(deferral.Error()).Times(1)
+
+		response, returnedError := server.SendEmail(ctx, sendEmailRequest)
+
+		assert.NoError(test, returnedError)
+		assert.True(test, response.Success)
+		assert.Equal(test, "Email deferred", response.Message)
+		assert.Equal(test, sent.ID, response.MessageId)
+	})
+
+	test.Run("Send_Email_Pending_Remembered_For_Retries", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		var sent *model.Message
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+			func(_ context.Context, message *model.Message) error {
+				sent = message
+				return ErrSendPending
+			},
+		)
+		loggerMock.EXPECT().Warn(ErrSendPending.Error()).Times(1)
+		request := &pb_email_api.SendEmailRequest{
+			To:             sendEmailRequest.To,
+			Subject:        sendEmailRequest.Subject,
+			Body:           sendEmailRequest.Body,
+			IdempotencyKey: "retried",
+		}
+
+		response, returnedError := server.SendEmail(ctx, request)
+		retried, retriedError := server.SendEmail(ctx, request)
+
+		assert.NoError(test, returnedError)
+		assert.True(test, response.Success)
+		assert.Equal(test, "Email queued", response.Message)
+		assert.Equal(test, sent.ID, response.MessageId)
+		assert.NoError(test, retriedError)
+		assert.Equal(test, sent.ID, retried.MessageId)
+	})
+
+	test.Run("Send_Email_Scheduled_Success", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		sendAt := now.Add(time.Hour)
+		loggerMock.EXPECT().Info("Email scheduled").Times(1)
+		var scheduledID string
+		schedulerMock.EXPECT().Schedule(
+			gomock.Any(),
+			gomock.Any(),
+		).Times(1).DoAndReturn(func(_ context.Context, message *model.Message) error {
+			assert.Equal(test, sendEmailRequest.To, message.To)
+			assert.Equal(test, sendAt, message.SendAt)
+			assert.Equal(test, model.PriorityBulk, message.Priority)
+			scheduledID = message.ID
+			return nil
+		})
+
+		response, returnedError := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:       sendEmailRequest.To,
+			Subject:  sendEmailRequest.Subject,
+			Body:     sendEmailRequest.Body,
+			SendAt:   timestamppb.New(sendAt),
+			Priority: pb_email_api.Priority_PRIORITY_BULK,
+		})
+
+		assert.NoError(test, returnedError)
+		assert.True(test, response.Success)
+		assert.Equal(test, "Email scheduled", response.Message)
+		assert.Equal(test, scheduledID, response.MessageId)
+	})
+
+	test.Run("Send_Email_Scheduled_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		loggerMock.EXPECT().Error(gomock.Any(), "Error scheduling email").Times(1)
+		schedulerMock.EXPECT().Schedule(
+			gomock.Any(),
+			gomock.Any(),
+		).Times(1).Return(errors.New("store error"))
+
+		response, returnedError := server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+			To:     sendEmailRequest.To,
+			SendAt: timestamppb.New(now.Add(time.Hour)),
+		})
+
+		assert.Error(test, returnedError)
+		assert.Equal(test, "rpc error: code = Internal desc = Error scheduling email", returnedError.Error())
+		assert.Nil(test, response)
+	})
+
+	test.Run("Cancel_Email_Success", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		assert.NoError(test, messageRepository.Insert(ctx, &model.Message{ID: "message-id", To: "test@test.com", CreatedAt: now}))
+		loggerMock.EXPECT().Info("Email cancelled").Times(1)
+		schedulerMock.EXPECT().Cancel(gomock.Any(), "message-id").Times(1).Return(nil)
+
+		response, returnedError := server.CancelEmail(ctx, &pb_email_api.CancelEmailRequest{MessageId: "message-id"})
+
+		assert.NoError(test, returnedError)
+		assert.True(test, response.Success)
+		assert.Equal(test, "Email cancelled", response.Message)
+	})
+
+	test.Run("Cancel_Email_Of_Other_Client_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		assert.NoError(test, messageRepository.Insert(ctx, &model.Message{
+			ID:        "message-id",
+			To:        "test@test.com",
+			ClientID:  "certificate:qd.authentication.api",
+			CreatedAt: now,
+		}))
+		loggerMock.EXPECT().Error(ErrEmailOfOtherClient, "Unauthorized email request").Times(1)
+		other := mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.billing.api"})
+
+		response, returnedError := server.CancelEmail(other, &pb_email_api.CancelEmailRequest{MessageId: "message-id"})
+
+		assert.Nil(test, response)
+		assert.Equal(test, "rpc error: code = PermissionDenied desc = Email sent by another client", returnedError.Error())
+	})
+
+	test.Run("Cancel_Email_Not_Found_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             mock.NewMockSchedulerer(controller),
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		loggerMock.EXPECT().Error(repository.ErrMessageNotFound, "Email to cancel not found").Times(1)
+
+		response, returnedError := server.CancelEmail(ctx, &pb_email_api.CancelEmailRequest{MessageId: "message-id"})
+
+		assert.Error(test, returnedError)
+		assert.Equal(test, "rpc error: code = NotFound desc = Email not found", returnedError.Error())
+		assert.Nil(test, response)
+	})
+
+	test.Run("Cancel_Email_Already_Sent_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           ratelimit.NewLimiter(fakeClock, ratelimit.Limits{}),
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+		})
+
+		assert.NoError(test, messageRepository.Insert(ctx, &model.Message{ID: "message-id", To: "test@test.com", CreatedAt: now}))
+		loggerMock.EXPECT().Error(repository.ErrStatusConflict, gomock.Any()).Times(1)
+		schedulerMock.EXPECT().Cancel(gomock.Any(), "message-id").Times(1).Return(repository.ErrStatusConflict)
+
+		response, returnedError := server.CancelEmail(ctx, &pb_email_api.CancelEmailRequest{MessageId: "message-id"})
+
+		assert.Error(test, returnedError)
+		assert.Equal(test, "rpc error: code = FailedPrecondition desc = Email can no longer be cancelled", returnedError.Error())
+		assert.Nil(test, response)
+	})
+
+	test.Run("Send_Email_Rate_Limited_Error", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		rateLimiterMock := rateLimitMock.NewMockLimiterer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "secret-key"))
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           rateLimiterMock,
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+			APIKeys:               map[string]string{"secret-key": "notifications"},
+		})
+
+		limitError := &ratelimit.LimitExceededError{Scope: ratelimit.ScopeRecipient, RetryAfter: 30 * time.Second}
+		rateLimiterMock.EXPECT().Allow("api-key:notifications", sendEmailRequest.To).Times(1).Return(limitError)
+		loggerMock.EXPECT().Error(limitError, "Too many requests").Times(1)
+
+		response, returnedError := server.SendEmail(ctx, sendEmailRequest)
+
+		assert.Nil(test, response)
+		returnedStatus := status.Convert(returnedError)
+		assert.Equal(test, codes.ResourceExhausted, returnedStatus.Code())
+		assert.Equal(test, "Too many requests per recipient", returnedStatus.Message())
+		assert.Len(test, returnedStatus.Details(), 1)
+		retryInfo, ok := returnedStatus.Details()[0].(*errdetails.RetryInfo)
+		assert.True(test, ok)
+		assert.Equal(test, 30*time.Second, retryInfo.RetryDelay.AsDuration())
+	})
+
+	test.Run("Send_Email_Rate_Limited_Per_Client", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+		rateLimiter := ratelimit.NewLimiter(fakeClock, ratelimit.Limits{
+			Client: ratelimit.Limit{Rate: 1, Burst: 1},
+		})
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           rateLimiter,
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+			APIKeys:               map[string]string{"first-key": "first", "second-key": "second"},
+		})
+
+		firstClient := metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "first-key"))
+		secondClient := metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "second-key"))
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+		loggerMock.EXPECT().Info("Email sent").Times(3)
+		loggerMock.EXPECT().Error(gomock.Any(), "Too many requests").Times(1)
+
+		_, returnedError := server.SendEmail(firstClient, sendEmailRequest)
+		assert.NoError(test, returnedError)
+		_, returnedError = server.SendEmail(firstClient, sendEmailRequest)
+		assert.Equal(test, codes.ResourceExhausted, status.Code(returnedError))
+		_, returnedError = server.SendEmail(secondClient, sendEmailRequest)
+		assert.NoError(test, returnedError)
+
+		fakeClock.Advance(time.Second)
+		_, returnedError = server.SendEmail(firstClient, sendEmailRequest)
+		assert.NoError(test, returnedError)
+	})
+
+	test.Run("Send_Email_Rotated_API_Keys_Keep_Rate_Limit", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}})
+		rateLimiter := ratelimit.NewLimiter(fakeClock, ratelimit.Limits{
+			Client: ratelimit.Limit{Rate: 1, Burst: 1},
+		})
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           rateLimiter,
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+			APIKeys:               map[string]string{"old-key": "notifications", "new-key": "notifications"},
+		})
+
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Times(2).Return(nil)
+		loggerMock.EXPECT().Info("Email sent").Times(2)
+		loggerMock.EXPECT().Error(gomock.Any(), "Too many requests").Times(3)
+
+		// The unknown keys are charged to the address of the client
+		_, returnedError := server.SendEmail(metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "first-key")), sendEmailRequest)
+		assert.NoError(test, returnedError)
+		_, returnedError = server.SendEmail(metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "second-key")), sendEmailRequest)
+		assert.Equal(test, codes.ResourceExhausted, status.Code(returnedError))
+
+		// The known keys of a client share its limit
+		_, returnedError = server.SendEmail(metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "old-key")), sendEmailRequest)
+		assert.NoError(test, returnedError)
+		_, returnedError = server.SendEmail(metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "new-key")), sendEmailRequest)
+		assert.Equal(test, codes.ResourceExhausted, status.Code(returnedError))
+		_, returnedError = server.SendEmail(metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyMetadataKey, "other-key")), sendEmailRequest)
+		assert.Equal(test, codes.ResourceExhausted, status.Code(returnedError))
+	})
+	test.Run("Send_Email_Idempotent_Retry_Not_Rate_Limited", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		fakeClock := clock.NewFakeClock(now)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		ctx := context.WithValue(context.Background(), log.LoggerKey, loggerMock)
+		rateLimiter := ratelimit.NewLimiter(fakeClock, ratelimit.Limits{
+			Client: ratelimit.Limit{Rate: 1, Burst: 1},
+		})
+
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter:           rateLimiter,
+			Clock:                 fakeClock,
+			MaxBatchRecipients:    maxBatchRecipients,
+			APIKeys:               map[string]string{"client-key": "client"},
+		})
+
+		client := metadata.NewIncomingContext(ctx, metadata.Pairs(
+			APIKeyMetadataKey, "client-key",
+			IdempotencyKeyMetadataKey, "retried",
+		))
+		schedulerMock.EXPECT().Send(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+		loggerMock.EXPECT().Info("Email sent").Times(1)
+
+		response, returnedError := server.SendEmail(client, sendEmailRequest)
+		assert.NoError(test, returnedError)
+		retried, returnedError := server.SendEmail(client, sendEmailRequest)
+		assert.NoError(test, returnedError)
+
+		assert.Equal(test, response.MessageId, retried.MessageId)
+	})
+
+}
+
+// batchStreamMock replays the given requests as a client stream
+type batchStreamMock struct {
+	pb_email_api.EmailService_SendBatchStreamServer
+	requests []*pb_email_api.SendBatchStreamRequest
+}
+
+func (stream *batchStreamMock) Recv() (*pb_email_api.SendBatchStreamRequest, error) {
+	if len(stream.requests) == 0 {
+		return nil, io.EOF
+	}
+	request := stream.requests[0]
+	stream.requests = stream.requests[1:]
+	return request, nil
+}
+
+func TestEmailServiceServerBatch(test *testing.T) {
+	const maxBatchRecipients = 3
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	template := &pb_email_api.BatchTemplate{
+		Subject: "Hello {{.name}}",
+		Body:    "<p>Welcome {{.name}}</p>",
+	}
+	setup := func(test *testing.T) (*EmailServiceServer, *mock.MockSchedulerer, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		fakeClock := clock.NewFakeClock(now)
+		schedulerMock := mock.NewMockSchedulerer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		server := NewEmailServiceServer(EmailServiceDependencies{
+			Scheduler:             schedulerMock,
+			MessageRepository:     messageRepository,
+			SuppressionRepository: suppressionRepository,
+			PreferenceRepository:  preferenceRepository,
+			EventBus:              event.NewBus(fakeClock, 10, 10),
+			IdempotencyStore:      NewIdempotencyStore(fakeClock, time.Hour),
+			RateLimiter: ratelimit.NewLimiter(fakeClock, ratelimit.Limits{
+				Recipient: ratelimit.Limit{Rate: 1, Burst: 1},
+				Domain:    ratelimit.Limit{Rate: 1, Burst: 2},
+			}),
+			Clock:              fakeClock,
+			MaxBatchRecipients: maxBatchRecipients,
+		})
+		return server, schedulerMock, loggerMock, controller
+	}
+
+	test.Run("Send_Batch_Accepts_Valid_Recipients", func(test *testing.T) {
+		server, schedulerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		scheduled := []*model.Message{}
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+			func(_ context.Context, messages []*model.Message) error {
+				scheduled = messages
+				return nil
+			},
+		)
+		loggerMock.EXPECT().Info("Batch accepted 1 of 3 recipients").Times(1)
+
+		response, err := server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{
+			{To: "one@test.com", Variables: map[string]string{"name": "One"}},
+			{To: "invalid", Variables: map[string]string{"name": "Invalid"}},
+			{To: "two@test.com"},
+		})
+
+		assert.NoError(test, err)
+		assert.True(test, response.Success)
+		assert.Len(test, response.Results, 3)
+		assert.True(test, response.Results[0].Accepted)
+		assert.Equal(test, scheduled[0].ID, response.Results[0].MessageId)
+		assert.Equal(test, `Invalid recipient "invalid"`, response.Results[1].Error)
+		assert.Contains(test, response.Results[2].Error, "Error rendering subject")
+		assert.Equal(test, "Hello One", scheduled[0].Subject)
+		assert.Equal(test, "<p>Welcome One</p>", scheduled[0].Body)
+		assert.Equal(test, model.PriorityBulk, scheduled[0].Priority)
+		assert.Equal(test, now, scheduled[0].SendAt)
+	})
+
+	test.Run("Send_Batch_Rejects_Duplicated_Recipient", func(test *testing.T) {
+		server, schedulerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Len(1)).Times(1).Return(nil)
+		loggerMock.EXPECT().Info(gomock.Any()).Times(1)
+
+		response, err := server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{
+			{To: "one@test.com", Variables: map[string]string{"name": "One"}},
+			{To: "ONE@test.com", Variables: map[string]string{"name": "One"}},
+		})
+
+		assert.NoError(test, err)
+		assert.True(test, response.Results[0].Accepted)
+		assert.Equal(test, "Duplicated recipient", response.Results[1].Error)
+	})
+
+	test.Run("Send_Batch_Invalid_Batch_Error", func(test *testing.T) {
+		server, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		recipient := &pb_email_api.BatchRecipient{To: "one@test.com"}
+		loggerMock.EXPECT().Error(gomock.Any(), gomock.Any()).Times(4)
+
+		_, err := server.sendBatch(context.Background(), loggerMock, nil, []*pb_email_api.BatchRecipient{recipient})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Batch template is required", err.Error())
+		_, err = server.sendBatch(context.Background(), loggerMock, template, nil)
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Batch has no recipients", err.Error())
+		_, err = server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{recipient, recipient, recipient, recipient})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Batch exceeds the maximum of 3 recipients", err.Error())
+		_, err = server.sendBatch(context.Background(), loggerMock, &pb_email_api.BatchTemplate{Subject: "Subject"}, []*pb_email_api.BatchRecipient{recipient})
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Template body is required", err.Error())
+	})
+
+	test.Run("Send_Batch_Ignores_Domain_Rate_Limit", func(test *testing.T) {
+		server, schedulerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Len(3)).Times(1).Return(nil)
+		loggerMock.EXPECT().Info("Batch accepted 3 of 3 recipients").Times(1)
+
+		response, err := server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{
+			{To: "one@test.com", Variables: map[string]string{"name": "One"}},
+			{To: "two@test.com", Variables: map[string]string{"name": "Two"}},
+			{To: "three@test.com", Variables: map[string]string{"name": "Three"}},
+		})
+
+		assert.NoError(test, err)
+		assert.True(test, response.Results[2].Accepted)
+	})
+
+	test.Run("Send_Batch_Rate_Limited_Recipient_Error", func(test *testing.T) {
+		server, schedulerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, server.rateLimiter.AllowRecipient("two@test.com"))
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Len(1)).Times(1).Return(nil)
+		loggerMock.EXPECT().Info("Batch accepted 1 of 2 recipients").Times(1)
+
+		response, err := server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{
+			{To: "one@test.com", Variables: map[string]string{"name": "One"}},
+			{To: "two@test.com", Variables: map[string]string{"name": "Two"}},
+		})
+
+		assert.NoError(test, err)
+		assert.True(test, response.Results[0].Accepted)
+		assert.False(test, response.Results[1].Accepted)
+		assert.Equal(test, "Rate limit per recipient exceeded, retry after 1s", response.Results[1].Error)
+	})
+
+	test.Run("Send_Batch_Schedule_Error", func(test *testing.T) {
+		server, schedulerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		schedulerMock.EXPECT().ScheduleMany(gomock.Any(), gomock.Len(1)).Times(1).Return(errors.New("Disk full"))
+		loggerMock.EXPECT().Error(gomock.Any(), "Error scheduling batch emails").Times(1)
+		loggerMock.EXPECT().Info("Batch accepted 0 of 1 recipients").Times(1)
+
+		response, err := server.sendBatch(context.Background(), loggerMock, template, []*pb_email_api.BatchRecipient{
+			{To: "one@test.com", Variables: map[string]string{"name": "One"}},
+		})
+
+		assert.NoError(test, err)
+		assert.False(test, response.Success)
+		assert.Equal(test, "Error scheduling email", response.Results[0].Error)
+	})
+
+	test.Run("Receive_Batch_Success", func(test *testing.T) {
+		server, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		stream := &batchStreamMock{requests: []*pb_email_api.SendBatchStreamRequest{
+			{Payload: &pb_email_api.SendBatchStreamRequest_Template{Template: template}},
+			{Payload: &pb_email_api.SendBatchStreamRequest_Recipient{Recipient: &pb_email_api.BatchRecipient{To: "one@test.com"}}},
+			{Payload: &pb_email_api.SendBatchStreamRequest_Recipient{Recipient: &pb_email_api.BatchRecipient{To: "two@test.com"}}},
+		}}
+
+		receivedTemplate, recipients, err := server.receiveBatch(stream)
+
+		assert.NoError(test, err)
+		assert.Equal(test, template, receivedTemplate)
+		assert.Len(test, recipients, 2)
+	})
+
+	test.Run("Receive_Batch_Recipient_Before_Template_Error", func(test *testing.T) {
+		server, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		stream := &batchStreamMock{requests: []*pb_email_api.SendBatchStreamRequest{
+			{Payload: &pb_email_api.SendBatchStreamRequest_Recipient{Recipient: &pb_email_api.BatchRecipient{To: "one@test.com"}}},
+		}}
+
+		_, _, err := server.receiveBatch(stream)
+
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Template must be sent once before the recipients", err.Error())
+	})
+
+	test.Run("Receive_Batch_Too_Many_Recipients_Error", func(test *testing.T) {
+		server, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		requests := []*pb_email_api.SendBatchStreamRequest{
+			{Payload: &pb_email_api.SendBatchStreamRequest_Template{Template: template}},
+		}
+		for index := 0; index <= maxBatchRecipients; index++ {
+			requests = append(requests, &pb_email_api.SendBatchStreamRequest{
+				Payload: &pb_email_api.SendBatchStreamRequest_Recipient{Recipient: &pb_email_api.BatchRecipient{To: "one@test.com"}},
+			})
+		}
+
+		_, _, err := server.receiveBatch(&batchStreamMock{requests: requests})
+
+		assert.Equal(test, "rpc error: code = InvalidArgument desc = Batch exceeds the maximum of 3 recipients", err.Error())
+	})
+}
+
+func TestGetClientID(test *testing.T) {
+	server := NewEmailServiceServer(EmailServiceDependencies{
+		APIKeys: map[string]string{"secret-key": "notifications"},
+	})
+	address := &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}}
+
+	test.Run("Certificate_Identities_Are_Distinct", func(test *testing.T) {
+		first := mtls.NewContext(context.Background(), &mtls.Identity{DNSNames: []string{"auth.internal"}})
+		second := mtls.NewContext(context.Background(), &mtls.Identity{URIs: []string{"spiffe://quadev.net/billing"}})
+
+		assert.Equal(test, "certificate:auth.internal", server.getClientID(first))
+		assert.Equal(test, "certificate:spiffe://quadev.net/billing", server.getClientID(second))
+	})
+
+	test.Run("Certificate_Preferred_Over_API_Key", func(test *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyMetadataKey, "secret-key"))
+		ctx = mtls.NewContext(ctx, &mtls.Identity{CommonName: "qd.authentication.api"})
+
+		assert.Equal(test, "certificate:qd.authentication.api", server.getClientID(ctx))
+	})
+
+	test.Run("Known_API_Key", func(test *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyMetadataKey, "secret-key"))
+		ctx = peer.NewContext(ctx, address)
+
+		assert.Equal(test, "api-key:notifications", server.getClientID(ctx))
+	})
+
+	test.Run("Address_Without_Identity_Or_API_Key", func(test *testing.T) {
+		ctx := peer.NewContext(context.Background(), address)
+
+		assert.Equal(test, "address:10.0.0.1", server.getClientID(ctx))
+	})
+
+	test.Run("Address_With_Unknown_API_Key", func(test *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyMetadataKey, "guessed-key"))
+		ctx = peer.NewContext(ctx, address)
+
+		assert.Equal(test, "address:10.0.0.1", server.getClientID(ctx))
+	})
 }
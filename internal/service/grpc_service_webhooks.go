@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/webhook"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// ListWebhookDeliveries returns the latest delivery attempts of a webhook endpoint to the
+// admin clients
+func (server *EmailServiceServer) ListWebhookDeliveries(ctx context.Context, request *pb_email_api.ListWebhookDeliveriesRequest) (*pb_email_api.ListWebhookDeliveriesResponse, error) {
+	logger, err := log.GetLoggerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.authorizeAdmin(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := server.webhookNotifier.Deliveries(request.Endpoint)
+	if errors.Is(err, webhook.ErrEndpointNotFound) {
+		logger.Error(err, "Webhook endpoint not found")
+		return nil, status.Errorf(codes.NotFound, "Webhook endpoint not found")
+	}
+	if err != nil {
+		logger.Error(err, "Error getting webhook deliveries")
+		return nil, status.Errorf(codes.Internal, "Error getting webhook deliveries")
+	}
+
+	response := &pb_email_api.ListWebhookDeliveriesResponse{
+		Deliveries: make([]*pb_email_api.WebhookDelivery, 0, len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		response.Deliveries = append(response.Deliveries, &pb_email_api.WebhookDelivery{
+			EventId:    delivery.EventID,
+			Type:       string(delivery.Type),
+			MessageId:  delivery.MessageID,
+			Attempt:    int32(delivery.Attempt),
+			Time:       timestamppb.New(delivery.Time),
+			Duration:   durationpb.New(delivery.Duration),
+			StatusCode: int32(delivery.StatusCode),
+			Error:      delivery.Error,
+		})
+	}
+	return response, nil
+}
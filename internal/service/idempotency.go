@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"qd-email-api/internal/clock"
+)
+
+// IdempotencyKeyMetadataKey is the gRPC metadata key carrying the idempotency key
+const IdempotencyKeyMetadataKey = "idempotency-key"
+
+// ErrIdempotencyKeyReused is returned when a key is reused with a different payload
+var ErrIdempotencyKeyReused = errors.New("Idempotency key already used with a different request")
+
+// SendEmailResult is the outcome of an accepted email remembered for repeated requests
+type SendEmailResult struct {
+	MessageID string
+	Message   string
+}
+
+// IdempotencyStorer is the interface for deduplicating repeated requests
+type IdempotencyStorer interface {
+	Execute(
+		ctx context.Context,
+		key, fingerprint string,
+		operation func() (*SendEmailResult, error),
+	) (*SendEmailResult, error)
+}
+
+type idempotencyEntry struct {
+	fingerprint string
+	result      *SendEmailResult
+	expiresAt   time.Time
+	done        chan struct{}
+}
+
+// IdempotencyStore remembers the results of successful requests in memory for a window
+type IdempotencyStore struct {
+	mutex   sync.Mutex
+	clock   clock.Clocker
+	window  time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+var _ IdempotencyStorer = &IdempotencyStore{}
+
+// NewIdempotencyStore creates a new idempotency store keeping results for the given window
+func NewIdempotencyStore(clock clock.Clocker, window time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		clock:   clock,
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Execute runs the operation once per key and fingerprint within the window.
+// Repeated calls return the remembered result, calls arriving while the first one
+// is in progress wait for it, and failed operations are forgotten so they can be retried.
+func (store *IdempotencyStore) Execute(
+	ctx context.Context,
+	key, fingerprint string,
+	operation func() (*SendEmailResult, error),
+) (*SendEmailResult, error) {
+	if key == "" {
+		return operation()
+	}
+
+	for {
+		store.mutex.Lock()
+		store.removeExpired()
+		entry, exists := store.entries[key]
+		if !exists {
+			entry = &idempotencyEntry{
+				fingerprint: fingerprint,
+				done:        make(chan struct{}),
+			}
+			store.entries[key] = entry
+			store.mutex.Unlock()
+			return store.run(key, entry, operation)
+		}
+		store.mutex.Unlock()
+
+		if entry.fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if entry.result != nil {
+			return entry.result, nil
+		}
+		// The first request failed and released the key, try again
+	}
+}
+
+func (store *IdempotencyStore) run(
+	key string,
+	entry *idempotencyEntry,
+	operation func() (*SendEmailResult, error),
+) (*SendEmailResult, error) {
+	result, err := operation()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err != nil {
+		delete(store.entries, key)
+	} else {
+		entry.result = result
+		entry.expiresAt = store.clock.Now().Add(store.window)
+	}
+	close(entry.done)
+	return result, err
+}
+
+// removeExpired must be called with the mutex held
+func (store *IdempotencyStore) removeExpired() {
+	now := store.clock.Now()
+	for key, entry := range store.entries {
+		if entry.result != nil && !now.Before(entry.expiresAt) {
+			delete(store.entries, key)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+func TestIdempotencyStore(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	countingOperation := func(calls *int, err error) func() (*SendEmailResult, error) {
+		return func() (*SendEmailResult, error) {
+			*calls++
+			if err != nil {
+				return nil, err
+			}
+			return &SendEmailResult{MessageID: "message-id", Message: "Email sent"}, nil
+		}
+	}
+
+	test.Run("Same_Key_Returns_Original_Result", func(test *testing.T) {
+		store := NewIdempotencyStore(clock.NewFakeClock(now), time.Hour)
+		calls := 0
+
+		first, err := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+		assert.NoError(test, err)
+		second, err := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+		assert.NoError(test, err)
+
+		assert.Equal(test, 1, calls)
+		assert.Equal(test, first, second)
+	})
+
+	test.Run("Same_Key_Different_Payload_Error", func(test *testing.T) {
+		store := NewIdempotencyStore(clock.NewFakeClock(now), time.Hour)
+		calls := 0
+
+		_, err := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+		assert.NoError(test, err)
+		result, err := store.Execute(context.Background(), "key", "other", countingOperation(&calls, nil))
+
+		assert.ErrorIs(test, err, ErrIdempotencyKeyReused)
+		assert.Nil(test, result)
+		assert.Equal(test, 1, calls)
+	})
+
+	test.Run("Key_Expires_After_Window", func(test *testing.T) {
+		fakeClock := clock.NewFakeClock(now)
+		store := NewIdempotencyStore(fakeClock, time.Hour)
+		calls := 0
+
+		_, err := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+		assert.NoError(test, err)
+		fakeClock.Advance(time.Hour)
+		_, err = store.Execute(context.Background(), "key", "other", countingOperation(&calls, nil))
+
+		assert.NoError(test, err)
+		assert.Equal(test, 2, calls)
+	})
+
+	test.Run("Failed_Operation_Can_Be_Retried", func(test *testing.T) {
+		store := NewIdempotencyStore(clock.NewFakeClock(now), time.Hour)
+		calls := 0
+		expectedError := errors.New("Error sending email")
+
+		_, err := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, expectedError))
+		assert.ErrorIs(test, err, expectedError)
+		_, err = store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+
+		assert.NoError(test, err)
+		assert.Equal(test, 2, calls)
+	})
+
+	test.Run("Empty_Key_Is_Not_Deduplicated", func(test *testing.T) {
+		store := NewIdempotencyStore(clock.NewFakeClock(now), time.Hour)
+		calls := 0
+
+		_, _ = store.Execute(context.Background(), "", "fingerprint", countingOperation(&calls, nil))
+		_, _ = store.Execute(context.Background(), "", "fingerprint", countingOperation(&calls, nil))
+
+		assert.Equal(test, 2, calls)
+	})
+
+	test.Run("Concurrent_Requests_Wait_For_First", func(test *testing.T) {
+		store := NewIdempotencyStore(clock.NewFakeClock(now), time.Hour)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		var calls int
+		var waitGroup sync.WaitGroup
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			_, _ = store.Execute(context.Background(), "key", "fingerprint", func() (*SendEmailResult, error) {
+				calls++
+				close(started)
+				<-release
+				return &SendEmailResult{MessageID: "message-id"}, nil
+			})
+		}()
+		<-started
+
+		results := make(chan *SendEmailResult, 1)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			result, _ := store.Execute(context.Background(), "key", "fingerprint", countingOperation(&calls, nil))
+			results <- result
+		}()
+		close(release)
+		waitGroup.Wait()
+
+		assert.Equal(test, 1, calls)
+		assert.Equal(test, "message-id", (<-results).MessageID)
+	})
+}
+
+func TestIdempotencyKey(test *testing.T) {
+	test.Run("Request_Field_Takes_Precedence", func(test *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyMetadataKey, "metadata-key"))
+
+		assert.Equal(test, "request-key", getIdempotencyKey(ctx, &pb_email_api.SendEmailRequest{IdempotencyKey: "request-key"}))
+		assert.Equal(test, "metadata-key", getIdempotencyKey(ctx, &pb_email_api.SendEmailRequest{}))
+		assert.Equal(test, "", getIdempotencyKey(context.Background(), &pb_email_api.SendEmailRequest{}))
+	})
+
+	test.Run("Fingerprint_Depends_On_Payload", func(test *testing.T) {
+		request := &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Body", IdempotencyKey: "a"}
+		sameRequest := &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Body", IdempotencyKey: "b"}
+		otherBody := &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Other"}
+		otherSendAt := &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Body", SendAt: timestamppb.Now()}
+
+		assert.Equal(test, getRequestFingerprint(request), getRequestFingerprint(sameRequest))
+		assert.NotEqual(test, getRequestFingerprint(request), getRequestFingerprint(otherBody))
+		assert.NotEqual(test, getRequestFingerprint(request), getRequestFingerprint(otherSendAt))
+	})
+
+	newRequest := func() *pb_email_api.SendEmailRequest {
+		return &pb_email_api.SendEmailRequest{To: "test@test.com", Subject: "Subject", Body: "Body"}
+	}
+	changes := map[string]func(request *pb_email_api.SendEmailRequest){
+		"To":                 func(request *pb_email_api.SendEmailRequest) { request.To = "other@test.com" },
+		"Subject":            func(request *pb_email_api.SendEmailRequest) { request.Subject = "Other" },
+		"Body":               func(request *pb_email_api.SendEmailRequest) { request.Body = "Other" },
+		"Send_At":            func(request *pb_email_api.SendEmailRequest) { request.SendAt = timestamppb.Now() },
+		"Priority":           func(request *pb_email_api.SendEmailRequest) { request.Priority = pb_email_api.Priority_PRIORITY_BULK },
+		"Category":           func(request *pb_email_api.SendEmailRequest) { request.Category = "news" },
+		"Ignore_Suppression": func(request *pb_email_api.SendEmailRequest) { request.IgnoreSuppression = true },
+		"Track_Opens":        func(request *pb_email_api.SendEmailRequest) { request.TrackOpens = true },
+		"Track_Clicks":       func(request *pb_email_api.SendEmailRequest) { request.TrackClicks = true },
+	}
+	for field, change := range changes {
+		test.Run("Fingerprint_Depends_On_"+field, func(test *testing.T) {
+			request := newRequest()
+			change(request)
+
+			assert.NotEqual(test, getRequestFingerprint(newRequest()), getRequestFingerprint(request))
+		})
+	}
+}
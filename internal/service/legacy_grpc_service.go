@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+
+	"github.com/quadev-ltd/qd-common/pb/gen/go/pb_email"
+
+	"qd-email-api/pb/gen/go/pb_email_api"
+)
+
+// LegacyEmailServiceServer serves the shared pb_email.EmailService definition
+// used by the other services by delegating to the email API server
+type LegacyEmailServiceServer struct {
+	server pb_email_api.EmailServiceServer
+	pb_email.UnimplementedEmailServiceServer
+}
+
+var _ pb_email.EmailServiceServer = &LegacyEmailServiceServer{}
+
+// NewLegacyEmailServiceServer creates a new legacy email service server
+func NewLegacyEmailServiceServer(server pb_email_api.EmailServiceServer) *LegacyEmailServiceServer {
+	return &LegacyEmailServiceServer{
+		server: server,
+	}
+}
+
+// SendEmail sends an email
+func (legacyServer *LegacyEmailServiceServer) SendEmail(ctx context.Context, request *pb_email.SendEmailRequest) (*pb_email.SendEmailResponse, error) {
+	response, err := legacyServer.server.SendEmail(ctx, &pb_email_api.SendEmailRequest{
+		To:      request.To,
+		Subject: request.Subject,
+		Body:    request.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb_email.SendEmailResponse{
+		Success: response.Success,
+		Message: response.Message,
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: dispatcher.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	model "qd-email-api/internal/model"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockDispatcherer is a mock of Dispatcherer interface.
+type MockDispatcherer struct {
+	ctrl     *gomock.Controller
+	recorder *MockDispatchererMockRecorder
+}
+
+// MockDispatchererMockRecorder is the mock recorder for MockDispatcherer.
+type MockDispatchererMockRecorder struct {
+	mock *MockDispatcherer
+}
+
+// NewMockDispatcherer creates a new mock instance.
+func NewMockDispatcherer(ctrl *gomock.Controller) *MockDispatcherer {
+	mock := &MockDispatcherer{ctrl: ctrl}
+	mock.recorder = &MockDispatchererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDispatcherer) EXPECT() *MockDispatchererMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockDispatcherer) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockDispatchererMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockDispatcherer)(nil).Close))
+}
+
+// SendEmail mocks base method.
+func (m *MockDispatcherer) SendEmail(ctx context.Context, message *model.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendEmail", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendEmail indicates an expected call of SendEmail.
+func (mr *MockDispatchererMockRecorder) SendEmail(ctx, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendEmail", reflect.TypeOf((*MockDispatcherer)(nil).SendEmail), ctx, message)
+}
+
+// Stats mocks base method.
+func (m *MockDispatcherer) Stats() map[model.Priority]model.LaneStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(map[model.Priority]model.LaneStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockDispatchererMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockDispatcherer)(nil).Stats))
+}
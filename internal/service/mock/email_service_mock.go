@@ -6,6 +6,7 @@ package mock
 
 import (
 	context "context"
+	model "qd-email-api/internal/model"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,15 +36,15 @@ func (m *MockEmailServicer) EXPECT() *MockEmailServicerMockRecorder {
 }
 
 // SendEmail mocks base method.
-func (m *MockEmailServicer) SendEmail(ctx context.Context, dest, subject, body string) error {
+func (m *MockEmailServicer) SendEmail(ctx context.Context, message *model.Message) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendEmail", ctx, dest, subject, body)
+	ret := m.ctrl.Call(m, "SendEmail", ctx, message)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendEmail indicates an expected call of SendEmail.
-func (mr *MockEmailServicerMockRecorder) SendEmail(ctx, dest, subject, body interface{}) *gomock.Call {
+func (mr *MockEmailServicerMockRecorder) SendEmail(ctx, message interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendEmail", reflect.TypeOf((*MockEmailServicer)(nil).SendEmail), ctx, dest, subject, body)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendEmail", reflect.TypeOf((*MockEmailServicer)(nil).SendEmail), ctx, message)
 }
@@ -0,0 +1,146 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: scheduler.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	model "qd-email-api/internal/model"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSchedulerer is a mock of Schedulerer interface.
+type MockSchedulerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockSchedulererMockRecorder
+}
+
+// MockSchedulererMockRecorder is the mock recorder for MockSchedulerer.
+type MockSchedulererMockRecorder struct {
+	mock *MockSchedulerer
+}
+
+// NewMockSchedulerer creates a new mock instance.
+func NewMockSchedulerer(ctrl *gomock.Controller) *MockSchedulerer {
+	mock := &MockSchedulerer{ctrl: ctrl}
+	mock.recorder = &MockSchedulererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSchedulerer) EXPECT() *MockSchedulererMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockSchedulerer) Cancel(ctx context.Context, messageID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, messageID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockSchedulererMockRecorder) Cancel(ctx, messageID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockSchedulerer)(nil).Cancel), ctx, messageID)
+}
+
+// ProcessDue mocks base method.
+func (m *MockSchedulerer) ProcessDue(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessDue", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProcessDue indicates an expected call of ProcessDue.
+func (mr *MockSchedulererMockRecorder) ProcessDue(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessDue", reflect.TypeOf((*MockSchedulerer)(nil).ProcessDue), ctx)
+}
+
+// Purge mocks base method.
+func (m *MockSchedulerer) Purge(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockSchedulererMockRecorder) Purge(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockSchedulerer)(nil).Purge), ctx)
+}
+
+// Schedule mocks base method.
+func (m *MockSchedulerer) Schedule(ctx context.Context, message *model.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Schedule", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Schedule indicates an expected call of Schedule.
+func (mr *MockSchedulererMockRecorder) Schedule(ctx, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockSchedulerer)(nil).Schedule), ctx, message)
+}
+
+// ScheduleMany mocks base method.
+func (m *MockSchedulerer) ScheduleMany(ctx context.Context, messages []*model.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScheduleMany", ctx, messages)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScheduleMany indicates an expected call of ScheduleMany.
+func (mr *MockSchedulererMockRecorder) ScheduleMany(ctx, messages interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScheduleMany", reflect.TypeOf((*MockSchedulerer)(nil).ScheduleMany), ctx, messages)
+}
+
+// Send mocks base method.
+func (m *MockSchedulerer) Send(ctx context.Context, message *model.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockSchedulererMockRecorder) Send(ctx, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockSchedulerer)(nil).Send), ctx, message)
+}
+
+// Start mocks base method.
+func (m *MockSchedulerer) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockSchedulererMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockSchedulerer)(nil).Start))
+}
+
+// Stop mocks base method.
+func (m *MockSchedulerer) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockSchedulererMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockSchedulerer)(nil).Stop))
+}
@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	smtp "net/smtp"
 	reflect "reflect"
 
@@ -49,15 +50,29 @@ func (mr *MockSmtpServicerMockRecorder) PlainAuth(identity, from, password, host
 }
 
 // SendMail mocks base method.
-func (m *MockSmtpServicer) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+func (m *MockSmtpServicer) SendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendMail", addr, a, from, to, msg)
+	ret := m.ctrl.Call(m, "SendMail", ctx, addr, a, from, to, msg)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendMail indicates an expected call of SendMail.
-func (mr *MockSmtpServicerMockRecorder) SendMail(addr, a, from, to, msg interface{}) *gomock.Call {
+func (mr *MockSmtpServicerMockRecorder) SendMail(ctx, addr, a, from, to, msg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMail", reflect.TypeOf((*MockSmtpServicer)(nil).SendMail), addr, a, from, to, msg)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMail", reflect.TypeOf((*MockSmtpServicer)(nil).SendMail), ctx, addr, a, from, to, msg)
+}
+
+// Verify mocks base method.
+func (m *MockSmtpServicer) Verify(ctx context.Context, addr string, a smtp.Auth) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, addr, a)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockSmtpServicerMockRecorder) Verify(ctx, addr, a interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockSmtpServicer)(nil).Verify), ctx, addr, a)
 }
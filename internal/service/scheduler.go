@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+)
+
+// ErrSendPending is returned when the caller stops waiting for an email that was already
+// stored as queued, which is still sent
+var ErrSendPending = errors.New("Email queued, sending continues in the background")
+
+// Schedulerer is the interface for storing emails and holding them until their send time
+type Schedulerer interface {
+	Send(ctx context.Context, message *model.Message) error
+	Schedule(ctx context.Context, message *model.Message) error
+	ScheduleMany(ctx context.Context, messages []*model.Message) error
+	Cancel(ctx context.Context, messageID string) error
+	ProcessDue(ctx context.Context) error
+	Purge(ctx context.Context) error
+	Start() error
+	Stop()
+}
+
+// purgeInterval is how often the messages older than the retention are purged
+const purgeInterval = time.Hour
+
+// Scheduler is the implementation of the email scheduler
+type Scheduler struct {
+	repository   repository.MessageRepositoryer
+	emailService EmailServicer
+	clock        clock.Clocker
+	logger       log.Loggerer
+	pollInterval time.Duration
+	concurrency  int
+	retention    time.Duration
+	stop         chan struct{}
+	waitGroup    sync.WaitGroup
+}
+
+var _ Schedulerer = &Scheduler{}
+
+// NewScheduler creates a new email scheduler. The sent, failed and cancelled emails are kept
+// for the retention, or forever when it is zero.
+func NewScheduler(
+	repository repository.MessageRepositoryer,
+	emailService EmailServicer,
+	clock clock.Clocker,
+	logger log.Loggerer,
+	pollInterval time.Duration,
+	concurrency int,
+	retention time.Duration,
+) *Scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Scheduler{
+		repository:   repository,
+		emailService: emailService,
+		clock:        clock,
+		logger:       logger,
+		pollInterval: pollInterval,
+		concurrency:  concurrency,
+		retention:    retention,
+	}
+}
+
+// Send stores an email and sends it right away. Once stored, the email is sent even when
+// the caller stops waiting, in which case ErrSendPending is returned.
+func (scheduler *Scheduler) Send(ctx context.Context, message *model.Message) error {
+	if err := scheduler.store(ctx, message, model.StatusQueued); err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- scheduler.emailService.SendEmail(context.WithoutCancel(ctx), message)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ErrSendPending
+	}
+}
+
+// Schedule stores an email to be sent at its send time
+func (scheduler *Scheduler) Schedule(ctx context.Context, message *model.Message) error {
+	return scheduler.store(ctx, message, model.StatusScheduled)
+}
+
+// ScheduleMany stores emails to be sent at their send time at once, storing none of them
+// when any fails
+func (scheduler *Scheduler) ScheduleMany(ctx context.Context, messages []*model.Message) error {
+	now := scheduler.clock.Now()
+	for _, message := range messages {
+		message.Record(model.StatusChange{Status: model.StatusAccepted, Time: message.CreatedAt})
+		message.Record(model.StatusChange{Status: model.StatusScheduled, Time: now})
+	}
+	if err := scheduler.repository.InsertMany(ctx, messages); err != nil {
+		return fmt.Errorf("Error storing emails: %v", err)
+	}
+	return nil
+}
+
+func (scheduler *Scheduler) store(ctx context.Context, message *model.Message, status model.Status) error {
+	message.Record(model.StatusChange{Status: model.StatusAccepted, Time: message.CreatedAt})
+	message.Record(model.StatusChange{Status: status, Time: scheduler.clock.Now()})
+	if err := scheduler.repository.Insert(ctx, message); err != nil {
+		return fmt.Errorf("Error storing email: %v", err)
+	}
+	return nil
+}
+
+// Cancel cancels a scheduled or deferred email that has not been claimed for sending yet
+func (scheduler *Scheduler) Cancel(ctx context.Context, messageID string) error {
+	cancelled := model.StatusChange{
+		Status: model.StatusCancelled,
+		Time:   scheduler.clock.Now(),
+	}
+	err := scheduler.repository.UpdateStatus(ctx, messageID, model.StatusScheduled, cancelled)
+	if errors.Is(err, repository.ErrStatusConflict) {
+		err = scheduler.repository.UpdateStatus(ctx, messageID, model.StatusDeferred, cancelled)
+	}
+	return err
+}
+
+// ProcessDue queues every scheduled or deferred email whose send time has been
+// reached, sending up to the configured number of emails concurrently
+func (scheduler *Scheduler) ProcessDue(ctx context.Context) error {
+	due, err := scheduler.repository.GetDue(ctx, scheduler.clock.Now())
+	if err != nil {
+		return fmt.Errorf("Error getting due emails: %v", err)
+	}
+	slots := make(chan struct{}, scheduler.concurrency)
+	var waitGroup sync.WaitGroup
+	for _, message := range due {
+		slots <- struct{}{}
+		waitGroup.Add(1)
+		go func(message *model.Message) {
+			defer func() {
+				<-slots
+				waitGroup.Done()
+			}()
+			scheduler.send(ctx, message)
+		}(message)
+	}
+	waitGroup.Wait()
+	return nil
+}
+
+func (scheduler *Scheduler) send(ctx context.Context, message *model.Message) {
+	err := scheduler.repository.UpdateStatus(ctx, message.ID, message.Status, model.StatusChange{
+		Status: model.StatusQueued,
+		Time:   scheduler.clock.Now(),
+	})
+	if errors.Is(err, repository.ErrStatusConflict) {
+		return
+	}
+	if err != nil {
+		scheduler.logger.Error(err, fmt.Sprintf("Error queueing scheduled email %s", message.ID))
+		return
+	}
+
+	err = scheduler.emailService.SendEmail(ctx, message)
+	var deferred *DeferredError
+	var optedOut *OptedOutError
+	switch {
+	case errors.As(err, &optedOut):
+		scheduler.logger.Info(fmt.Sprintf("Scheduled email %s skipped: %v", message.ID, err))
+	case errors.As(err, &deferred):
+		scheduler.logger.Warn(fmt.Sprintf("Scheduled email %s deferred, retry after %s", message.ID, deferred.RetryAfter))
+	case err != nil:
+		scheduler.logger.Error(err, fmt.Sprintf("Error sending scheduled email %s", message.ID))
+	}
+}
+
+// Purge deletes the emails that are no longer waiting to be sent once they are older than
+// the retention
+func (scheduler *Scheduler) Purge(ctx context.Context) error {
+	if scheduler.retention <= 0 {
+		return nil
+	}
+	purged, err := scheduler.repository.Purge(ctx, scheduler.clock.Now().Add(-scheduler.retention))
+	if err != nil {
+		return fmt.Errorf("Error purging emails: %v", err)
+	}
+	if purged > 0 {
+		scheduler.logger.Info(fmt.Sprintf("Purged %d emails older than %s", purged, scheduler.retention))
+	}
+	return nil
+}
+
+// recover puts back the emails left queued by a previous run and marks as failed the
+// ones left sending, as whether they reached the relay is unknown
+func (scheduler *Scheduler) recover(ctx context.Context) error {
+	queued, err := scheduler.repository.GetByStatus(ctx, model.StatusQueued)
+	if err != nil {
+		return fmt.Errorf("Error getting queued emails: %v", err)
+	}
+	for _, message := range queued {
+		err := scheduler.repository.UpdateStatus(ctx, message.ID, model.StatusQueued, model.StatusChange{
+			Status: model.StatusScheduled,
+			Time:   scheduler.clock.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("Error requeueing email %s: %v", message.ID, err)
+		}
+	}
+
+	interrupted, err := scheduler.repository.GetByStatus(ctx, model.StatusSending)
+	if err != nil {
+		return fmt.Errorf("Error getting interrupted emails: %v", err)
+	}
+	for _, message := range interrupted {
+		err := scheduler.repository.UpdateStatus(ctx, message.ID, model.StatusSending, model.StatusChange{
+			Status:   model.StatusFailed,
+			Time:     scheduler.clock.Now(),
+			Response: "Interrupted while sending",
+		})
+		if err != nil {
+			return fmt.Errorf("Error updating interrupted email %s: %v", message.ID, err)
+		}
+		scheduler.logger.Warn(fmt.Sprintf("Email %s was interrupted while sending and will not be retried", message.ID))
+	}
+	return nil
+}
+
+// Start recovers interrupted emails, polls for due emails and purges the old ones in
+// the background
+func (scheduler *Scheduler) Start() error {
+	if err := scheduler.recover(context.Background()); err != nil {
+		return err
+	}
+	if err := scheduler.Purge(context.Background()); err != nil {
+		scheduler.logger.Error(err, "Error purging emails")
+	}
+	scheduler.stop = make(chan struct{})
+	scheduler.waitGroup.Add(1)
+	go func() {
+		defer scheduler.waitGroup.Done()
+		ticker := time.NewTicker(scheduler.pollInterval)
+		defer ticker.Stop()
+		purgeTicker := time.NewTicker(purgeInterval)
+		defer purgeTicker.Stop()
+		for {
+			select {
+			case <-scheduler.stop:
+				return
+			case <-ticker.C:
+				if err := scheduler.ProcessDue(context.Background()); err != nil {
+					scheduler.logger.Error(err, "Error processing scheduled emails")
+				}
+			case <-purgeTicker.C:
+				if err := scheduler.Purge(context.Background()); err != nil {
+					scheduler.logger.Error(err, "Error purging emails")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops polling and waits for the emails being sent to finish
+func (scheduler *Scheduler) Stop() {
+	if scheduler.stop == nil {
+		return
+	}
+	close(scheduler.stop)
+	scheduler.waitGroup.Wait()
+	scheduler.stop = nil
+}
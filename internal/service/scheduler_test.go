@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/service/mock"
+)
+
+type messageIDMatcher string
+
+func (matcher messageIDMatcher) Matches(value interface{}) bool {
+	message, ok := value.(*model.Message)
+	return ok && message.ID == string(matcher)
+}
+
+func (matcher messageIDMatcher) String() string {
+	return "is message " + string(matcher)
+}
+
+func TestScheduler(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	const (
+		dest    = "test@test.com"
+		subject = "Test subject"
+		body    = "Test body"
+	)
+	newMessage := func(id string, sendAt time.Time) *model.Message {
+		return &model.Message{
+			ID:        id,
+			To:        dest,
+			Subject:   subject,
+			Body:      body,
+			SendAt:    sendAt,
+			Priority:  model.PriorityTransactional,
+			CreatedAt: now,
+		}
+	}
+
+	test.Run("Process_Due_Sends_Only_Due_Emails", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		message := newMessage("1", now.Add(time.Hour))
+		assert.NoError(test, scheduler.Schedule(ctx, message))
+
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		fakeClock.Advance(time.Hour)
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(message.ID)).Times(1).Return(nil)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusSent, stored.Status)
+		statuses := []model.Status{}
+		for _, change := range stored.History {
+			statuses = append(statuses, change.Status)
+		}
+		assert.Equal(test, []model.Status{
+			model.StatusAccepted,
+			model.StatusScheduled,
+			model.StatusQueued,
+			model.StatusSending,
+			model.StatusSent,
+		}, statuses)
+	})
+
+	test.Run("Schedule_Many_Stores_Scheduled_Emails", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, nil, fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		err := scheduler.ScheduleMany(ctx, []*model.Message{newMessage("1", now), newMessage("2", now)})
+
+		assert.NoError(test, err)
+		due, err := messageRepository.GetDue(ctx, now)
+		assert.NoError(test, err)
+		assert.Len(test, due, 2)
+		assert.Equal(test, model.StatusScheduled, due[0].Status)
+	})
+
+	test.Run("Purge_Deletes_Emails_Older_Than_Retention", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, nil, fakeClock, loggerMock, time.Second, 2, time.Hour)
+		ctx := context.Background()
+		assert.NoError(test, scheduler.Schedule(ctx, newMessage("scheduled", now)))
+		assert.NoError(test, scheduler.Schedule(ctx, newMessage("cancelled", now)))
+		assert.NoError(test, scheduler.Cancel(ctx, "cancelled"))
+
+		assert.NoError(test, scheduler.Purge(ctx))
+		fakeClock.Advance(2 * time.Hour)
+		loggerMock.EXPECT().Info("Purged 1 emails older than 1h0m0s").Times(1)
+		assert.NoError(test, scheduler.Purge(ctx))
+
+		_, err := messageRepository.GetByID(ctx, "cancelled")
+		assert.ErrorIs(test, err, repository.ErrMessageNotFound)
+		_, err = messageRepository.GetByID(ctx, "scheduled")
+		assert.NoError(test, err)
+	})
+
+	test.Run("Send_Continues_When_Caller_Gives_Up", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		release := make(chan struct{})
+		sent := make(chan struct{})
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher("1")).Times(1).DoAndReturn(
+			func(ctx context.Context, _ *model.Message) error {
+				<-release
+				assert.NoError(test, ctx.Err())
+				close(sent)
+				return nil
+			},
+		)
+		go func() {
+			cancel()
+		}()
+
+		assert.ErrorIs(test, scheduler.Send(ctx, newMessage("1", now)), ErrSendPending)
+		close(release)
+		<-sent
+
+		assert.Eventually(test, func() bool {
+			stored, err := messageRepository.GetByID(context.Background(), "1")
+			return err == nil && stored.Status == model.StatusSent
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	test.Run("Process_Due_Send_Error_Marks_Failed", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, clock.NewFakeClock(now), loggerMock), clock.NewFakeClock(now), loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		message := newMessage("1", now)
+		assert.NoError(test, scheduler.Schedule(ctx, message))
+
+		sendError := errors.New("relay unavailable")
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(message.ID)).Times(1).Return(sendError)
+		loggerMock.EXPECT().Error(sendError, gomock.Any()).Times(1)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusFailed, stored.Status)
+		assert.Equal(test, "relay unavailable", stored.History[len(stored.History)-1].Response)
+	})
+
+	test.Run("Process_Due_Deferred_Email_Is_Rescheduled", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		message := newMessage("1", now)
+		message.Deferrals = maxDeferrals - 1
+		assert.NoError(test, scheduler.Schedule(ctx, message))
+
+		deferral := &DeferredError{Domain: "test.com", RetryAfter: time.Minute}
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(message.ID)).Times(2).Return(deferral)
+		loggerMock.EXPECT().Warn("Scheduled email 1 deferred, retry after 1m0s").Times(1)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusDeferred, stored.Status)
+		assert.Equal(test, now.Add(time.Minute), stored.SendAt)
+		assert.Equal(test, maxDeferrals, stored.Deferrals)
+
+		// Once deferred too many times the email is given up
+		fakeClock.Advance(time.Minute)
+		loggerMock.EXPECT().Error(gomock.Any(), "Error sending scheduled email 1").Times(1)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err = messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusFailed, stored.Status)
+	})
+
+	test.Run("Process_Due_Opted_Out_Email_Is_Skipped", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		message := newMessage("1", now)
+		assert.NoError(test, scheduler.Schedule(ctx, message))
+
+		optedOut := &OptedOutError{Preference: &model.Preference{Address: "test@test.com", Category: "newsletter"}}
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(message.ID)).Times(1).Return(optedOut)
+		loggerMock.EXPECT().Info("Scheduled email 1 skipped: Recipient test@test.com opted out of newsletter emails").Times(1)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusUnsubscribed, stored.Status)
+		assert.Equal(test, "Recipient test@test.com opted out of newsletter emails", stored.History[len(stored.History)-1].Response)
+	})
+
+	test.Run("Cancel_Prevents_Sending", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		message := newMessage("1", now.Add(time.Minute))
+		assert.NoError(test, scheduler.Schedule(ctx, message))
+
+		assert.NoError(test, scheduler.Cancel(ctx, message.ID))
+		assert.ErrorIs(test, scheduler.Cancel(ctx, message.ID), repository.ErrStatusConflict)
+		assert.ErrorIs(test, scheduler.Cancel(ctx, "unknown"), repository.ErrMessageNotFound)
+
+		fakeClock.Advance(time.Hour)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, message.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusCancelled, stored.Status)
+	})
+
+	test.Run("Send_Records_Delivery", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		fakeClock := clock.NewFakeClock(now)
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Second, 2, 0)
+		ctx := context.Background()
+
+		deferral := &DeferredError{Domain: "test.com", RetryAfter: time.Minute}
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher("1")).Times(1).Return(deferral)
+		assert.ErrorIs(test, scheduler.Send(ctx, newMessage("1", now)), deferral)
+
+		stored, err := messageRepository.GetByID(ctx, "1")
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusDeferred, stored.Status)
+		assert.Equal(test, now.Add(time.Minute), stored.SendAt)
+		assert.Equal(test, []model.StatusChange{
+			{Status: model.StatusAccepted, Time: now},
+			{Status: model.StatusQueued, Time: now},
+			{Status: model.StatusSending, Time: now},
+			{Status: model.StatusDeferred, Time: now, Response: deferral.Error()},
+		}, stored.History)
+
+		// Deferred emails can still be cancelled
+		assert.NoError(test, scheduler.Cancel(ctx, "1"))
+	})
+
+	test.Run("Restart_Does_Not_Send_Twice", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		emailServiceMock := mock.NewMockEmailServicer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		storePath := filepath.Join(test.TempDir(), "messages.jsonl")
+		ctx := context.Background()
+
+		// A previous run scheduled three emails and crashed while sending the first one
+		// with the second one waiting in its lane
+		previousRepository, err := repository.NewFileMessageRepository(storePath, nil)
+		assert.NoError(test, err)
+		previousScheduler := NewScheduler(previousRepository, NewDeliveryTracker(emailServiceMock, previousRepository, clock.NewFakeClock(now), loggerMock), clock.NewFakeClock(now), loggerMock, time.Second, 2, 0)
+		interrupted := newMessage("interrupted", now)
+		assert.NoError(test, previousScheduler.Schedule(ctx, interrupted))
+		pending := newMessage("pending", now.Add(time.Hour))
+		assert.NoError(test, previousScheduler.Schedule(ctx, pending))
+		queued := newMessage("queued", now)
+		assert.NoError(test, previousScheduler.Schedule(ctx, queued))
+		assert.NoError(test, previousRepository.UpdateStatus(ctx, interrupted.ID, model.StatusScheduled, model.StatusChange{Status: model.StatusSending, Time: now}))
+		assert.NoError(test, previousRepository.UpdateStatus(ctx, queued.ID, model.StatusScheduled, model.StatusChange{Status: model.StatusQueued, Time: now}))
+
+		messageRepository, err := repository.NewFileMessageRepository(storePath, nil)
+		assert.NoError(test, err)
+		fakeClock := clock.NewFakeClock(now.Add(time.Hour))
+		scheduler := NewScheduler(messageRepository, NewDeliveryTracker(emailServiceMock, messageRepository, fakeClock, loggerMock), fakeClock, loggerMock, time.Hour, 2, 0)
+
+		loggerMock.EXPECT().Warn(gomock.Any()).Times(1)
+		assert.NoError(test, scheduler.Start())
+		defer scheduler.Stop()
+
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(pending.ID)).Times(1).Return(nil)
+		emailServiceMock.EXPECT().SendEmail(gomock.Any(), messageIDMatcher(queued.ID)).Times(1).Return(nil)
+		assert.NoError(test, scheduler.ProcessDue(ctx))
+
+		stored, err := messageRepository.GetByID(ctx, interrupted.ID)
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusFailed, stored.Status)
+		for _, id := range []string{pending.ID, queued.ID} {
+			stored, err = messageRepository.GetByID(ctx, id)
+			assert.NoError(test, err)
+			assert.Equal(test, model.StatusSent, stored.Status)
+		}
+	})
+}
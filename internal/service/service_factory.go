@@ -3,12 +3,58 @@ package service
 import (
 	commonConfig "github.com/quadev-ltd/qd-common/pkg/config"
 
+	"qd-email-api/internal/clock"
 	"qd-email-api/internal/config"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/tracking"
+	"qd-email-api/internal/unsubscribe"
 )
 
 // Factoryer is a factory for creating a service
 type Factoryer interface {
-	CreateService(config *config.Config, centralConfig *commonConfig.Config) (EmailServicer, error)
+	CreateService(
+		config *config.Config,
+		centralConfig *commonConfig.Config,
+		suppressionRepository repository.SuppressionRepositoryer,
+		preferenceRepository repository.PreferenceRepositoryer,
+		sender SMTPServicer,
+	) (ReloadableEmailServicer, error)
+	CreateDispatcher(config *config.Config, emailService EmailServicer) (Dispatcherer, error)
+}
+
+// ReloadableEmailServicer is an email service whose SMTP transport and domain throttle can
+// be reloaded while it sends emails
+type ReloadableEmailServicer interface {
+	EmailServicer
+	Reload(config *config.Config)
+	Transport() Transport
+}
+
+// ReloadableEmailService is the email service created by the factory, sending through the
+// domain throttler
+type ReloadableEmailService struct {
+	*DomainThrottler
+	emailService *EmailService
+}
+
+var _ ReloadableEmailServicer = &ReloadableEmailService{}
+
+// Reload applies the SMTP transport and the domain throttle of the configuration
+func (service *ReloadableEmailService) Reload(config *config.Config) {
+	service.emailService.SetTransport(Transport{
+		Host:     config.SMTP.Host,
+		Port:     config.SMTP.Port,
+		Username: config.SMTP.Username,
+		Password: config.SMTP.Password,
+	})
+	defaultLimit, domainLimits := getDomainLimits(config)
+	service.DomainThrottler.SetLimits(defaultLimit, domainLimits, config.DomainThrottle.MaxWait)
+}
+
+// Transport returns the SMTP transport the emails are sent through
+func (service *ReloadableEmailService) Transport() Transport {
+	return service.emailService.Transport()
 }
 
 // Factory is the implementation of the service factory
@@ -20,7 +66,10 @@ var _ Factoryer = &Factory{}
 func (serviceFactory *Factory) CreateService(
 	config *config.Config,
 	centralConfig *commonConfig.Config,
-) (EmailServicer, error) {
+	suppressionRepository repository.SuppressionRepositoryer,
+	preferenceRepository repository.PreferenceRepositoryer,
+	sender SMTPServicer,
+) (ReloadableEmailServicer, error) {
 
 	emailServiceConfig := EmailServiceConfig{
 		From:     config.SMTP.From,
@@ -30,6 +79,73 @@ func (serviceFactory *Factory) CreateService(
 		Password: config.SMTP.Password,
 		Host:     config.SMTP.Host,
 		Port:     config.SMTP.Port,
+		// The emails of the unsubscribe categories are suppressed even without the links
+		UnsubscribeCategories: config.Unsubscribe.Categories,
+		MandatoryCategories:   config.Preferences.MandatoryCategories,
+	}
+	if config.HTTP.Enabled {
+		emailServiceConfig.UnsubscribeURL = config.HTTP.URL + unsubscribe.Path
+		emailServiceConfig.UnsubscribeSecret = config.Unsubscribe.Secret
+		emailServiceConfig.OpenTrackingURL = config.HTTP.URL + tracking.OpenPath
+		emailServiceConfig.ClickTrackingURL = config.HTTP.URL + tracking.ClickPath
+		emailServiceConfig.TrackingSecret = config.Tracking.Secret
+	}
+	if config.Bounces.Enabled {
+		emailServiceConfig.BounceDomain = config.Bounces.Domain
+		emailServiceConfig.BouncePrefix = config.Bounces.Prefix
+		emailServiceConfig.BounceSecret = config.Bounces.Secret
+	}
+	emailService := NewEmailService(emailServiceConfig, sender, suppressionRepository, preferenceRepository)
+	defaultLimit, domainLimits := getDomainLimits(config)
+	return &ReloadableEmailService{
+		DomainThrottler: NewDomainThrottler(
+			emailService,
+			&clock.Clock{},
+			defaultLimit,
+			domainLimits,
+			config.DomainThrottle.MaxWait,
+		),
+		emailService: emailService,
+	}, nil
+}
+
+// getDomainLimits returns the default budget of the recipient domains and the budgets of
+// the configured ones
+func getDomainLimits(config *config.Config) (DomainLimit, map[string]DomainLimit) {
+	domainLimits := make(map[string]DomainLimit, len(config.DomainThrottle.Domains))
+	for _, domainLimit := range config.DomainThrottle.Domains {
+		domainLimits[domainLimit.Domain] = DomainLimit{
+			Concurrency: domainLimit.Concurrency,
+			Rate:        domainLimit.Rate,
+			Burst:       domainLimit.Burst,
+		}
+	}
+	defaultLimit := config.DomainThrottle.Default
+	return DomainLimit{
+		Concurrency: defaultLimit.Concurrency,
+		Rate:        defaultLimit.Rate,
+		Burst:       defaultLimit.Burst,
+	}, domainLimits
+}
+
+// CreateDispatcher creates the dispatcher sending emails through the configured lanes
+func (serviceFactory *Factory) CreateDispatcher(
+	config *config.Config,
+	emailService EmailServicer,
+) (Dispatcherer, error) {
+	laneConfigs := map[model.Priority]LaneConfig{
+		model.PriorityCritical: {
+			Concurrency: config.Lanes.Critical.Concurrency,
+			QueueSize:   config.Lanes.Critical.QueueSize,
+		},
+		model.PriorityTransactional: {
+			Concurrency: config.Lanes.Transactional.Concurrency,
+			QueueSize:   config.Lanes.Transactional.QueueSize,
+		},
+		model.PriorityBulk: {
+			Concurrency: config.Lanes.Bulk.Concurrency,
+			QueueSize:   config.Lanes.Bulk.QueueSize,
+		},
 	}
-	return NewEmailService(emailServiceConfig, &SMTPService{}), nil
+	return NewDispatcher(emailService, &clock.Clock{}, laneConfigs)
 }
@@ -1,10 +1,22 @@
 package service
 
-import "net/smtp"
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+
+	"qd-email-api/internal/tracing"
+)
 
 // SMTPServicer is the interface for the smtp service dependency injection
 type SMTPServicer interface {
-	SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	SendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	Verify(ctx context.Context, addr string, a smtp.Auth) error
 	PlainAuth(identity, from, password, host string) smtp.Auth
 }
 
@@ -13,9 +25,128 @@ type SMTPService struct{}
 
 var _ SMTPServicer = &SMTPService{}
 
-// SendMail sends an email
-func (smtpService *SMTPService) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
-	return smtp.SendMail(addr, a, from, to, msg)
+// SendMail sends an email the way smtp.SendMail does, tracing every stage of the SMTP
+// conversation as a child span of the span of the context
+func (smtpService *SMTPService) SendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "smtp.send", semconv.ServerAddress(addr))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	client, closeClient, err := connect(ctx, addr, a)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	if err = stage(ctx, "smtp.mail", func() error {
+		return client.Mail(from)
+	}); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err = stage(ctx, "smtp.rcpt", func() error {
+			return client.Rcpt(recipient)
+		}, attribute.String("smtp.recipient", recipient)); err != nil {
+			return err
+		}
+	}
+	if err = stage(ctx, "smtp.data", func() error {
+		writer, err := client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(msg); err != nil {
+			writer.Close()
+			return err
+		}
+		return writer.Close()
+	}, attribute.Int("smtp.size", len(msg))); err != nil {
+		return err
+	}
+	return stage(ctx, "smtp.quit", client.Quit)
+}
+
+// Verify checks that the relay accepts connections and the credentials without sending
+// any email
+func (smtpService *SMTPService) Verify(ctx context.Context, addr string, a smtp.Auth) (err error) {
+	ctx, span := tracing.Start(ctx, "smtp.verify", semconv.ServerAddress(addr))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	client, closeClient, err := connect(ctx, addr, a)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	return stage(ctx, "smtp.quit", client.Quit)
+}
+
+// connect opens an SMTP conversation up to the authentication. The returned function
+// closes the connection, which is also closed when the context is done.
+func connect(ctx context.Context, addr string, a smtp.Auth) (*smtp.Client, func(), error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var client *smtp.Client
+	err = stage(ctx, "smtp.dial", func() error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		client, err = smtp.NewClient(conn, host)
+		if err != nil {
+			conn.Close()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Closing the connection interrupts the conversation when the caller gives up
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+	closeClient := func() {
+		stop()
+		client.Close()
+	}
+
+	if err = stage(ctx, "smtp.hello", func() error {
+		return client.Hello("localhost")
+	}); err != nil {
+		closeClient()
+		return nil, nil, err
+	}
+	if supported, _ := client.Extension("STARTTLS"); supported {
+		if err = stage(ctx, "smtp.starttls", func() error {
+			return client.StartTLS(&tls.Config{ServerName: host})
+		}); err != nil {
+			closeClient()
+			return nil, nil, err
+		}
+	}
+	if a != nil {
+		if err = stage(ctx, "smtp.auth", func() error {
+			if supported, _ := client.Extension("AUTH"); !supported {
+				return errors.New("smtp: server doesn't support AUTH")
+			}
+			return client.Auth(a)
+		}); err != nil {
+			closeClient()
+			return nil, nil, err
+		}
+	}
+	return client, closeClient, nil
+}
+
+// stage runs a stage of the SMTP conversation in its own span
+func stage(ctx context.Context, name string, run func() error, attributes ...attribute.KeyValue) error {
+	_, span := tracing.Start(ctx, name, attributes...)
+	err := run()
+	tracing.End(span, err)
+	return err
 }
 
 // PlainAuth returns an Auth that implements the PLAIN authentication mechanism
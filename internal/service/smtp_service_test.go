@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"qd-email-api/internal/bounce"
+	bounceMock "qd-email-api/internal/bounce/mock"
+)
+
+func TestSMTPService(test *testing.T) {
+	verp := bounce.NewVERP("bounce", "bounces.test.com", "secret")
+	// The bounce server is the SMTP relay receiving the emails
+	setup := func(test *testing.T) (string, *loggerMock.MockLoggerer, *tracetest.SpanRecorder, context.Context, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		server, err := bounce.NewServer("127.0.0.1:0", "localhost", verp, "fbl@bounces.test.com", bounceMock.NewMockHandlerer(controller), loggerMock, 1<<20)
+		assert.NoError(test, err)
+		served := make(chan error)
+		go func() {
+			served <- server.Serve()
+		}()
+		test.Cleanup(func() {
+			assert.NoError(test, server.Close())
+			assert.NoError(test, <-served)
+		})
+		recorder := tracetest.NewSpanRecorder()
+		ctx, _ := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "request")
+		return server.Addr().String(), loggerMock, recorder, ctx, controller
+	}
+	spanNames := func(recorder *tracetest.SpanRecorder) []string {
+		names := []string{}
+		for _, span := range recorder.Ended() {
+			names = append(names, span.Name())
+		}
+		return names
+	}
+
+	test.Run("Every_Stage_Is_Traced", func(test *testing.T) {
+		address, loggerMock, recorder, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn(gomock.Any()).Times(1)
+
+		err := (&SMTPService{}).SendMail(ctx, address, nil, "sender@example.com", []string{verp.Encode("1")}, []byte("Subject: Hello\r\n\r\nHow are you?\r\n"))
+
+		assert.NoError(test, err)
+		assert.Equal(test, []string{
+			"smtp.dial",
+			"smtp.hello",
+			"smtp.mail",
+			"smtp.rcpt",
+			"smtp.data",
+			"smtp.quit",
+			"smtp.send",
+		}, spanNames(recorder))
+		send := recorder.Ended()[6]
+		for _, stage := range recorder.Ended()[:6] {
+			assert.Equal(test, send.SpanContext().SpanID(), stage.Parent().SpanID())
+		}
+	})
+
+	test.Run("Rejected_Stage_Ends_The_Conversation", func(test *testing.T) {
+		address, _, recorder, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		err := (&SMTPService{}).SendMail(ctx, address, nil, "", []string{"postmaster@bounces.test.com"}, []byte("Subject: Hello\r\n\r\n"))
+
+		assert.ErrorContains(test, err, "550")
+		assert.Equal(test, []string{"smtp.dial", "smtp.hello", "smtp.mail", "smtp.rcpt", "smtp.send"}, spanNames(recorder))
+		assert.Equal(test, codes.Error, recorder.Ended()[3].Status().Code)
+		assert.Equal(test, codes.Error, recorder.Ended()[4].Status().Code)
+	})
+
+	test.Run("Verify_Does_Not_Send", func(test *testing.T) {
+		address, _, recorder, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		err := (&SMTPService{}).Verify(ctx, address, nil)
+
+		assert.NoError(test, err)
+		assert.Equal(test, []string{"smtp.dial", "smtp.hello", "smtp.quit", "smtp.verify"}, spanNames(recorder))
+	})
+
+	test.Run("Verify_Without_AUTH_Error", func(test *testing.T) {
+		address, _, recorder, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		err := (&SMTPService{}).Verify(ctx, address, smtp.PlainAuth("", "username", "password", "127.0.0.1"))
+
+		assert.EqualError(test, err, "smtp: server doesn't support AUTH")
+		assert.Equal(test, []string{"smtp.dial", "smtp.hello", "smtp.auth", "smtp.verify"}, spanNames(recorder))
+	})
+
+	test.Run("Dial_Error", func(test *testing.T) {
+		_, _, recorder, ctx, controller := setup(test)
+		defer controller.Finish()
+
+		err := (&SMTPService{}).SendMail(ctx, "127.0.0.1:1", nil, "", []string{"user@example.com"}, nil)
+
+		assert.Error(test, err)
+		assert.Equal(test, []string{"smtp.dial", "smtp.send"}, spanNames(recorder))
+	})
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/tracking"
+)
+
+// TrackingRecorder records the activity of the recipients on the tracked emails
+type TrackingRecorder struct {
+	repository repository.MessageRepositoryer
+	clock      clock.Clocker
+	logger     log.Loggerer
+}
+
+var _ tracking.Handlerer = &TrackingRecorder{}
+
+// NewTrackingRecorder creates a new tracking recorder
+func NewTrackingRecorder(repository repository.MessageRepositoryer, clock clock.Clocker, logger log.Loggerer) *TrackingRecorder {
+	return &TrackingRecorder{
+		repository: repository,
+		clock:      clock,
+		logger:     logger,
+	}
+}
+
+// HandleOpen counts an open of an email. Opens of emails no longer stored are ignored.
+func (recorder *TrackingRecorder) HandleOpen(ctx context.Context, open *tracking.Open) error {
+	err := recorder.repository.RecordOpen(ctx, open.MessageID, open.UserAgent, recorder.clock.Now())
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		recorder.logger.Warn(fmt.Sprintf("Open of unknown email %s", open.MessageID))
+		return nil
+	}
+	return err
+}
+
+// HandleClick counts a click on a link of an email. Clicks of emails no longer stored are ignored.
+func (recorder *TrackingRecorder) HandleClick(ctx context.Context, click *tracking.Click) error {
+	err := recorder.repository.RecordClick(ctx, click.MessageID, click.URL, click.UserAgent, recorder.clock.Now())
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		recorder.logger.Warn(fmt.Sprintf("Click of unknown email %s", click.MessageID))
+		return nil
+	}
+	return err
+}
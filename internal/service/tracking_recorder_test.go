@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/tracking"
+)
+
+func TestTrackingRecorder(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	setup := func(test *testing.T) (*TrackingRecorder, *repository.FileMessageRepository, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		message := &model.Message{ID: "1", To: "user@example.com", TrackOpens: true, CreatedAt: now}
+		message.Record(model.StatusChange{Status: model.StatusSent, Time: now})
+		assert.NoError(test, messageRepository.Insert(context.Background(), message))
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		recorder := NewTrackingRecorder(messageRepository, clock.NewFakeClock(now.Add(time.Hour)), loggerMock)
+		return recorder, messageRepository, loggerMock, controller
+	}
+
+	test.Run("Open_Is_Counted", func(test *testing.T) {
+		recorder, messageRepository, _, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, recorder.HandleOpen(context.Background(), &tracking.Open{MessageID: "1", UserAgent: model.UserAgentDesktop}))
+		message, err := messageRepository.GetByID(context.Background(), "1")
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusSent, message.Status)
+		assert.Equal(test, &model.Opens{
+			Count:         1,
+			FirstOpenedAt: now.Add(time.Hour),
+			LastOpenedAt:  now.Add(time.Hour),
+			UserAgent:     model.UserAgentDesktop,
+		}, message.Opens)
+	})
+
+	test.Run("Open_Of_Unknown_Email_Is_Ignored", func(test *testing.T) {
+		recorder, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Open of unknown email 2").Times(1)
+
+		assert.NoError(test, recorder.HandleOpen(context.Background(), &tracking.Open{MessageID: "2", UserAgent: model.UserAgentDesktop}))
+	})
+	test.Run("Click_Is_Counted", func(test *testing.T) {
+		recorder, messageRepository, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		assert.NoError(test, recorder.HandleClick(context.Background(), &tracking.Click{
+			MessageID: "1",
+			URL:       "https://quadev.net",
+			UserAgent: model.UserAgentMobile,
+		}))
+		message, err := messageRepository.GetByID(context.Background(), "1")
+		assert.NoError(test, err)
+		assert.Equal(test, map[string]int{"https://quadev.net": 1}, message.Clicks.Links)
+
+		loggerMock.EXPECT().Warn("Click of unknown email 2").Times(1)
+		assert.NoError(test, recorder.HandleClick(context.Background(), &tracking.Click{MessageID: "2", URL: "https://quadev.net"}))
+	})
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/unsubscribe"
+)
+
+// UnsubscribeRecorder records the unsubscribes of the recipients on the emails they
+// unsubscribed from and opts them out of the category of the email, or suppresses them
+// from every category they can opt out of when they unsubscribe from all the emails
+type UnsubscribeRecorder struct {
+	repository            repository.MessageRepositoryer
+	suppressionRepository repository.SuppressionRepositoryer
+	preferenceRepository  repository.PreferenceRepositoryer
+	clock                 clock.Clocker
+	logger                log.Loggerer
+}
+
+var _ unsubscribe.Handlerer = &UnsubscribeRecorder{}
+
+// NewUnsubscribeRecorder creates a new unsubscribe recorder
+func NewUnsubscribeRecorder(
+	repository repository.MessageRepositoryer,
+	suppressionRepository repository.SuppressionRepositoryer,
+	preferenceRepository repository.PreferenceRepositoryer,
+	clock clock.Clocker,
+	logger log.Loggerer,
+) *UnsubscribeRecorder {
+	return &UnsubscribeRecorder{
+		repository:            repository,
+		suppressionRepository: suppressionRepository,
+		preferenceRepository:  preferenceRepository,
+		clock:                 clock,
+		logger:                logger,
+	}
+}
+
+// HandleOptOut marks a sent or delivered email as unsubscribed and opts its recipient out
+// of the category of the email. The opt out is signed, so it is recorded even when the email
+// moved on or is no longer stored.
+func (recorder *UnsubscribeRecorder) HandleOptOut(ctx context.Context, optOut *unsubscribe.OptOut) error {
+	change := model.StatusChange{
+		Status:   model.StatusUnsubscribed,
+		Time:     recorder.clock.Now(),
+		Response: fmt.Sprintf("Unsubscribed from %s emails", optOut.Category),
+	}
+	if optOut.All || optOut.Category == "" {
+		change.Response = "Unsubscribed from all emails"
+	}
+	updated := false
+	for _, status := range []model.Status{model.StatusSent, model.StatusDelivered} {
+		err := recorder.repository.UpdateStatus(ctx, optOut.MessageID, status, change)
+		if errors.Is(err, repository.ErrStatusConflict) {
+			continue
+		}
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		updated = true
+		break
+	}
+	if !updated {
+		recorder.logger.Warn(fmt.Sprintf("Unsubscribe from email %s not recorded on the email", optOut.MessageID))
+	}
+
+	if optOut.All || optOut.Category == "" {
+		return recorder.suppress(ctx, optOut, change)
+	}
+	err := recorder.preferenceRepository.Set(ctx, []*model.Preference{{
+		Address:    optOut.Address,
+		Category:   optOut.Category,
+		Subscribed: false,
+		UpdatedAt:  change.Time,
+	}})
+	if err != nil {
+		return fmt.Errorf("Error opting out unsubscribed recipient: %v", err)
+	}
+	recorder.logger.Info(fmt.Sprintf("Recipient of email %s unsubscribed from %s emails", optOut.MessageID, optOut.Category))
+	return nil
+}
+
+// suppress suppresses the recipient of an opt out from all the emails. An address already
+// suppressed for another reason keeps its suppression, which stops more emails.
+func (recorder *UnsubscribeRecorder) suppress(ctx context.Context, optOut *unsubscribe.OptOut, change model.StatusChange) error {
+	suppression, err := recorder.suppressionRepository.Get(ctx, optOut.Address)
+	if err == nil && suppression.Reason != model.SuppressionUnsubscribe {
+		recorder.logger.Info(fmt.Sprintf("Recipient of email %s already suppressed: %s", optOut.MessageID, suppression.Reason))
+		return nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrSuppressionNotFound) {
+		return fmt.Errorf("Error checking suppression list: %v", err)
+	}
+	err = recorder.suppressionRepository.Add(ctx, &model.Suppression{
+		Address:     optOut.Address,
+		Reason:      model.SuppressionUnsubscribe,
+		Description: change.Response,
+		MessageID:   optOut.MessageID,
+		CreatedAt:   change.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("Error suppressing unsubscribed recipient: %v", err)
+	}
+	recorder.logger.Info(fmt.Sprintf("Recipient of email %s unsubscribed", optOut.MessageID))
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/repository"
+	"qd-email-api/internal/unsubscribe"
+)
+
+func TestUnsubscribeRecorder(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	optOut := &unsubscribe.OptOut{MessageID: "1", Address: "user@example.com", Category: "newsletter"}
+	allOptOut := &unsubscribe.OptOut{MessageID: "1", Address: "user@example.com", Category: "newsletter", All: true}
+	setup := func(test *testing.T, status model.Status) (*UnsubscribeRecorder, *repository.FileMessageRepository, *repository.FileSuppressionRepository, *repository.FilePreferenceRepository, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		messageRepository, _ := repository.NewFileMessageRepository("", nil)
+		message := &model.Message{ID: "1", To: "user@example.com", Category: "newsletter", CreatedAt: now}
+		message.Record(model.StatusChange{Status: status, Time: now})
+		assert.NoError(test, messageRepository.Insert(context.Background(), message))
+		suppressionRepository, _ := repository.NewFileSuppressionRepository("")
+		preferenceRepository, _ := repository.NewFilePreferenceRepository("")
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		recorder := NewUnsubscribeRecorder(messageRepository, suppressionRepository, preferenceRepository, clock.NewFakeClock(now.Add(time.Hour)), loggerMock)
+		return recorder, messageRepository, suppressionRepository, preferenceRepository, loggerMock, controller
+	}
+
+	test.Run("Opt_Out_Marks_Unsubscribed_And_Opts_Out_Of_Category", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, preferenceRepository, loggerMock, controller := setup(test, model.StatusDelivered)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Recipient of email 1 unsubscribed from newsletter emails").Times(1)
+
+		assert.NoError(test, recorder.HandleOptOut(context.Background(), optOut))
+		message, err := messageRepository.GetByID(context.Background(), "1")
+		assert.NoError(test, err)
+		assert.Equal(test, model.StatusChange{
+			Status:   model.StatusUnsubscribed,
+			Time:     now.Add(time.Hour),
+			Response: "Unsubscribed from newsletter emails",
+		}, message.History[len(message.History)-1])
+		preference, err := preferenceRepository.Get(context.Background(), "user@example.com", "newsletter")
+		assert.NoError(test, err)
+		assert.Equal(test, &model.Preference{
+			Address:   "user@example.com",
+			Category:  "newsletter",
+			UpdatedAt: now.Add(time.Hour),
+		}, preference)
+		_, err = suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.ErrorIs(test, err, repository.ErrSuppressionNotFound)
+	})
+
+	test.Run("Opt_Out_Of_All_Suppresses", func(test *testing.T) {
+		recorder, messageRepository, suppressionRepository, preferenceRepository, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Info("Recipient of email 1 unsubscribed").Times(1)
+
+		assert.NoError(test, recorder.HandleOptOut(context.Background(), allOptOut))
+		message, err := messageRepository.GetByID(context.Background(), "1")
+		assert.NoError(test, err)
+		assert.Equal(test, "Unsubscribed from all emails", message.History[len(message.History)-1].Response)
+		suppression, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.NoError(test, err)
+		assert.Equal(test, &model.Suppression{
+			Address:     "user@example.com",
+			Reason:      model.SuppressionUnsubscribe,
+			Description: "Unsubscribed from all emails",
+			MessageID:   "1",
+			CreatedAt:   now.Add(time.Hour),
+		}, suppression)
+		_, err = preferenceRepository.Get(context.Background(), "user@example.com", "newsletter")
+		assert.ErrorIs(test, err, repository.ErrPreferenceNotFound)
+	})
+
+	test.Run("Opt_Out_Of_Unknown_Email_Suppresses", func(test *testing.T) {
+		recorder, _, suppressionRepository, _, loggerMock, controller := setup(test, model.StatusSent)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Unsubscribe from email 2 not recorded on the email").Times(1)
+		loggerMock.EXPECT().Info("Recipient of email 2 unsubscribed").Times(1)
+
+		assert.NoError(test, recorder.HandleOptOut(context.Background(), &unsubscribe.OptOut{MessageID: "2", Address: "other@example.com"}))
+		_, err := suppressionRepository.Get(context.Background(), "other@example.com")
+		assert.NoError(test, err)
+	})
+
+	test.Run("Stricter_Suppression_Is_Kept", func(test *testing.T) {
+		recorder, _, suppressionRepository, _, loggerMock, controller := setup(test, model.StatusBounced)
+		defer controller.Finish()
+
+		assert.NoError(test, suppressionRepository.Add(context.Background(), &model.Suppression{
+			Address:   "user@example.com",
+			Reason:    model.SuppressionHardBounce,
+			CreatedAt: now,
+		}))
+		loggerMock.EXPECT().Warn("Unsubscribe from email 1 not recorded on the email").Times(1)
+		loggerMock.EXPECT().Info("Recipient of email 1 already suppressed: hard_bounce").Times(1)
+
+		assert.NoError(test, recorder.HandleOptOut(context.Background(), allOptOut))
+		suppression, err := suppressionRepository.Get(context.Background(), "user@example.com")
+		assert.NoError(test, err)
+		assert.Equal(test, model.SuppressionHardBounce, suppression.Reason)
+	})
+}
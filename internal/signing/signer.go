@@ -0,0 +1,65 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// signatureLength is the number of hex characters of the signature kept in the tokens
+const signatureLength = 32
+
+// Signer creates the tokens of the links of the emails and verifies them when they are
+// followed. The tokens hold fields signed with an HMAC, so they cannot be made up.
+type Signer struct {
+	secret []byte
+	// invalid is returned for the tokens that are not tokens of the signer
+	invalid error
+	// forged is returned for the tokens whose signature does not match their content
+	forged error
+}
+
+// NewSigner creates a signer of tokens with the secret, failing the verification of the
+// tokens with the given errors
+func NewSigner(secret string, invalid, forged error) *Signer {
+	return &Signer{
+		secret:  []byte(secret),
+		invalid: invalid,
+		forged:  forged,
+	}
+}
+
+// Token returns the signed token of the fields, which cannot contain new lines
+func (signer *Signer) Token(fields ...string) string {
+	payload := strings.Join(fields, "\n")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signer.sign(payload)
+}
+
+// Verify returns the count fields of a token, the first one not empty, once its signature
+// is verified
+func (signer *Signer) Verify(token string, count int) ([]string, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, signer.invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, signer.invalid
+	}
+	fields := strings.Split(string(payload), "\n")
+	if len(fields) != count || fields[0] == "" {
+		return nil, signer.invalid
+	}
+	if !hmac.Equal([]byte(signature), []byte(signer.sign(string(payload)))) {
+		return nil, signer.forged
+	}
+	return fields, nil
+}
+
+func (signer *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, signer.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
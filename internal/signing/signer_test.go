@@ -0,0 +1,43 @@
+package signing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(test *testing.T) {
+	errInvalid := errors.New("Invalid token")
+	errForged := errors.New("Forged token")
+	signer := NewSigner("secret", errInvalid, errForged)
+
+	test.Run("Token_Verified", func(test *testing.T) {
+		fields, err := signer.Verify(signer.Token("1", "user@example.com"), 2)
+
+		assert.NoError(test, err)
+		assert.Equal(test, []string{"1", "user@example.com"}, fields)
+	})
+
+	test.Run("Forged_Token_Error", func(test *testing.T) {
+		token := signer.Token("1", "user@example.com")
+		encoded, _, _ := strings.Cut(token, ".")
+		forged := []string{
+			NewSigner("other", errInvalid, errForged).Token("1", "user@example.com"),
+			strings.Replace(token, encoded, strings.Split(signer.Token("2", "user@example.com"), ".")[0], 1),
+			encoded + ".0000",
+		}
+		for _, token := range forged {
+			_, err := signer.Verify(token, 2)
+			assert.ErrorIs(test, err, errForged, token)
+		}
+	})
+
+	test.Run("Invalid_Token_Error", func(test *testing.T) {
+		for _, token := range []string{"", "no-signature", "!!!.0000", signer.Token("1"), signer.Token("", "user@example.com")} {
+			_, err := signer.Verify(token, 2)
+			assert.ErrorIs(test, err, errInvalid, token)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// propagator reads the W3C trace context and baggage of the incoming requests
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// metadataCarrier reads the trace context from the gRPC metadata
+type metadataCarrier metadata.MD
+
+var _ propagation.TextMapCarrier = metadataCarrier{}
+
+// Get returns the first value of the key
+func (carrier metadataCarrier) Get(key string) string {
+	values := metadata.MD(carrier).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Set replaces the values of the key
+func (carrier metadataCarrier) Set(key, value string) {
+	metadata.MD(carrier).Set(key, value)
+}
+
+// Keys returns the keys of the metadata
+func (carrier metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// UnaryServerInterceptor starts a span for every unary gRPC request, continuing the trace
+// of the client when its metadata carries one
+func UnaryServerInterceptor(provider trace.TracerProvider) grpc.UnaryServerInterceptor {
+	tracer := provider.Tracer(instrumentationName)
+	return func(
+		ctx context.Context,
+		request interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, tracer, info.FullMethod)
+		response, err := handler(ctx, request)
+		endServerSpan(span, err)
+		return response, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor
+func StreamServerInterceptor(provider trace.TracerProvider) grpc.StreamServerInterceptor {
+	tracer := provider.Tracer(instrumentationName)
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, span := startServerSpan(stream.Context(), tracer, info.FullMethod)
+		err := handler(server, &contextServerStream{ServerStream: stream, ctx: ctx})
+		endServerSpan(span, err)
+		return err
+	}
+}
+
+// contextServerStream overrides the context of a server stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context
+func (stream *contextServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+func startServerSpan(ctx context.Context, tracer trace.Tracer, fullMethod string) (context.Context, trace.Span) {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	ctx = propagator.Extract(ctx, metadataCarrier(incoming))
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return tracer.Start(
+		ctx,
+		fullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)),
+	)
+}
+
+func endServerSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if err != nil {
+		span.SetStatus(codes.Error, status.Convert(err).Message())
+	}
+	span.End()
+}
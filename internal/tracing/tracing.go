@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer of the service
+const instrumentationName = "qd-email-api"
+
+// Config is the configuration of the OTLP exporter of the traces
+type Config struct {
+	ServiceName string
+	// Endpoint is the host and port of the OTLP gRPC collector
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the fraction of the traces started by the service that are kept.
+	// The traces started by the clients follow their sampling decision.
+	SampleRatio float64
+}
+
+// Providerer is the interface for the tracer provider the application shuts down on close
+type Providerer interface {
+	trace.TracerProvider
+	Shutdown(ctx context.Context) error
+}
+
+// NewProvider creates a tracer provider exporting the spans to the OTLP collector in batches
+func NewProvider(ctx context.Context, config Config) (*sdktrace.TracerProvider, error) {
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating the OTLP exporter: %v", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	), nil
+}
+
+// Start starts a span as a child of the span of the context, with the tracer provider of
+// that span. Without a span in the context, the span is not recorded.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentationName).Start(
+		ctx,
+		name,
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// End records the error of the operation of the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,127 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"qd-email-api/internal/tracing"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracing(test *testing.T) {
+	setup := func() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+		recorder := tracetest.NewSpanRecorder()
+		return recorder, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb_email_api.EmailService/SendEmail"}
+
+	test.Run("Unary_Span_Continues_Client_Trace", func(test *testing.T) {
+		recorder, provider := setup()
+		interceptor := tracing.UnaryServerInterceptor(provider)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceParent))
+
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+			_, span := tracing.Start(ctx, "email.validate")
+			tracing.End(span, nil)
+			return nil, nil
+		})
+
+		assert.NoError(test, err)
+		spans := recorder.Ended()
+		assert.Len(test, spans, 2)
+		child, server := spans[0], spans[1]
+		assert.Equal(test, "email.validate", child.Name())
+		assert.Equal(test, server.SpanContext().SpanID(), child.Parent().SpanID())
+		assert.Equal(test, "/pb_email_api.EmailService/SendEmail", server.Name())
+		assert.Equal(test, trace.SpanKindServer, server.SpanKind())
+		assert.Equal(test, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+		assert.Equal(test, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.True(test, server.Parent().IsRemote())
+		assert.Contains(test, server.Attributes(), semconv.RPCService("pb_email_api.EmailService"))
+		assert.Contains(test, server.Attributes(), semconv.RPCMethod("SendEmail"))
+		assert.Contains(test, server.Attributes(), semconv.RPCGRPCStatusCodeKey.Int(0))
+		assert.Equal(test, codes.Unset, server.Status().Code)
+	})
+
+	test.Run("Unary_Span_Without_Client_Trace_Is_Root", func(test *testing.T) {
+		recorder, provider := setup()
+		interceptor := tracing.UnaryServerInterceptor(provider)
+
+		_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, status.Errorf(grpcCodes.InvalidArgument, "Invalid email address")
+		})
+
+		assert.Error(test, err)
+		spans := recorder.Ended()
+		assert.Len(test, spans, 1)
+		assert.False(test, spans[0].Parent().IsValid())
+		assert.Contains(test, spans[0].Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(grpcCodes.InvalidArgument)))
+		assert.Equal(test, codes.Error, spans[0].Status().Code)
+		assert.Equal(test, "Invalid email address", spans[0].Status().Description)
+	})
+
+	test.Run("Stream_Span_Is_In_Stream_Context", func(test *testing.T) {
+		recorder, provider := setup()
+		interceptor := tracing.StreamServerInterceptor(provider)
+		stream := &serverStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceParent))}
+
+		err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pb_email_api.EmailService/SendBatchStream"}, func(server interface{}, stream grpc.ServerStream) error {
+			_, span := tracing.Start(stream.Context(), "email.render")
+			tracing.End(span, nil)
+			return nil
+		})
+
+		assert.NoError(test, err)
+		spans := recorder.Ended()
+		assert.Len(test, spans, 2)
+		assert.Equal(test, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Equal(test, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext().TraceID().String())
+	})
+
+	test.Run("End_Records_Error", func(test *testing.T) {
+		recorder, provider := setup()
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+		_, span := tracing.Start(ctx, "smtp.rcpt", attribute.String("smtp.recipient", "user@example.com"))
+		tracing.End(span, errors.New("550 User unknown"))
+		parent.End()
+
+		spans := recorder.Ended()
+		assert.Len(test, spans, 2)
+		assert.Equal(test, codes.Error, spans[0].Status().Code)
+		assert.Equal(test, "550 User unknown", spans[0].Status().Description)
+		assert.Equal(test, "exception", spans[0].Events()[0].Name)
+		assert.Contains(test, spans[0].Attributes(), attribute.String("smtp.recipient", "user@example.com"))
+	})
+
+	test.Run("Start_Without_Span_Is_Not_Recorded", func(test *testing.T) {
+		_, span := tracing.Start(context.Background(), "email.render")
+
+		assert.False(test, span.IsRecording())
+		tracing.End(span, nil)
+	})
+}
+
+// serverStream is a server stream with the given context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *serverStream) Context() context.Context {
+	return stream.ctx
+}
@@ -0,0 +1,96 @@
+package tracking
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"qd-email-api/internal/signing"
+)
+
+// ClickPath is the path of the click tracking endpoint on the HTTP server
+const ClickPath = "/click"
+
+// NoTrackAttribute is the attribute of the links left as they are in the tracked emails
+const NoTrackAttribute = "data-no-track"
+
+// anchorTag matches the opening tag of the links
+var anchorTag = regexp.MustCompile(`(?i)<a\s[^>]*>`)
+
+// hrefAttribute matches the href attribute of a link, its value being double quoted,
+// single quoted or unquoted
+var hrefAttribute = regexp.MustCompile(`(?i)(\shref\s*=\s*)(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// noTrackAttribute matches the attribute opting a link out of the tracking
+var noTrackAttribute = regexp.MustCompile(`(?i)\s` + NoTrackAttribute + `(?:[\s=>/]|$)`)
+
+// Clicks rewrites the links of the emails into redirects through the click tracking
+// endpoint and verifies the redirects when they are followed. The tokens hold the email
+// and the target of the link, signed so the endpoint cannot be used as an open redirect.
+type Clicks struct {
+	url    string
+	signer *signing.Signer
+}
+
+// NewClicks creates the redirects of the click tracking endpoint at the given URL, without
+// a query, signed with the secret
+func NewClicks(url, secret string) *Clicks {
+	return &Clicks{
+		url:    url,
+		signer: signing.NewSigner(secret, ErrInvalidToken, ErrForgedToken),
+	}
+}
+
+// URL returns the redirect URL to the target through the click tracking endpoint
+func (clicks *Clicks) URL(messageID, target string) string {
+	return clicks.url + "?token=" + clicks.signer.Token(messageID, target)
+}
+
+// Verify returns the email and the target of a redirect token once its signature is verified
+func (clicks *Clicks) Verify(token string) (string, string, error) {
+	fields, err := clicks.signer.Verify(token, 2)
+	if err != nil {
+		return "", "", err
+	}
+	if !isTrackable(fields[1]) {
+		return "", "", ErrInvalidToken
+	}
+	return fields[0], fields[1], nil
+}
+
+// Rewrite replaces the web links of the HTML body with redirects through the click
+// tracking endpoint. Unsubscribe links, links other than web links and links with the
+// NoTrackAttribute are left as they are.
+func (clicks *Clicks) Rewrite(body, messageID string) string {
+	return anchorTag.ReplaceAllStringFunc(body, func(tag string) string {
+		if noTrackAttribute.MatchString(tag) {
+			return tag
+		}
+		match := hrefAttribute.FindStringSubmatchIndex(tag)
+		if match == nil {
+			return tag
+		}
+		value := ""
+		for group := 2; group <= 4; group++ {
+			if match[2*group] >= 0 {
+				value = tag[match[2*group]:match[2*group+1]]
+			}
+		}
+		target := strings.TrimSpace(html.UnescapeString(value))
+		if !isTrackable(target) || strings.Contains(strings.ToLower(target), "unsubscribe") {
+			return tag
+		}
+		redirect := html.EscapeString(clicks.URL(messageID, target))
+		return tag[:match[3]] + `"` + redirect + `"` + tag[match[1]:]
+	})
+}
+
+// isTrackable reports whether the target is a web link the endpoint can redirect to
+func isTrackable(target string) bool {
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" || strings.ContainsAny(target, "\n\r") {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
@@ -0,0 +1,72 @@
+package tracking
+
+import (
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/signing"
+)
+
+func TestClicks(test *testing.T) {
+	clicks := NewClicks("https://email.test.com/click", "secret")
+
+	test.Run("URL_Verify", func(test *testing.T) {
+		url := clicks.URL("1", "https://quadev.net/welcome?step=1&source=email")
+		assert.Regexp(test, `^https://email\.test\.com/click\?token=[A-Za-z0-9_-]+\.[0-9a-f]{32}$`, url)
+
+		messageID, target, err := clicks.Verify(strings.TrimPrefix(url, "https://email.test.com/click?token="))
+		assert.NoError(test, err)
+		assert.Equal(test, "1", messageID)
+		assert.Equal(test, "https://quadev.net/welcome?step=1&source=email", target)
+	})
+
+	test.Run("Verify_Tampered_Token_Error", func(test *testing.T) {
+		token := strings.TrimPrefix(clicks.URL("1", "https://quadev.net"), "https://email.test.com/click?token=")
+		_, signature, _ := strings.Cut(token, ".")
+		tampered := signing.NewSigner("other", ErrInvalidToken, ErrForgedToken).Token("1", "https://evil.test.com")
+		encoded, _, _ := strings.Cut(tampered, ".")
+
+		_, _, err := clicks.Verify(encoded + "." + signature)
+		assert.ErrorIs(test, err, ErrForgedToken)
+		_, _, err = clicks.Verify(tampered)
+		assert.ErrorIs(test, err, ErrForgedToken)
+		// Pixel tokens are not redirects
+		_, _, err = clicks.Verify(signing.NewSigner("secret", ErrInvalidToken, ErrForgedToken).Token("1"))
+		assert.ErrorIs(test, err, ErrInvalidToken)
+	})
+
+	test.Run("Verify_Signed_Unsafe_Target_Error", func(test *testing.T) {
+		for _, target := range []string{"javascript:alert(1)", "//evil.test.com", "mailto:user@example.com"} {
+			_, _, err := clicks.Verify(signing.NewSigner("secret", ErrInvalidToken, ErrForgedToken).Token("1", target))
+			assert.ErrorIs(test, err, ErrInvalidToken, target)
+		}
+	})
+
+	test.Run("Rewrite_Links", func(test *testing.T) {
+		redirect := func(target string) string {
+			return html.EscapeString(clicks.URL("1", target))
+		}
+		body := `<p><a href="https://quadev.net/welcome?step=1&amp;source=email" class="button">Start</a>` +
+			`<A HREF='http://quadev.net/docs'>Docs</A>` +
+			`<a target=_blank href=https://quadev.net/blog>Blog</a>` +
+			`<a href="https://quadev.net/settings/unsubscribe">Unsubscribe</a>` +
+			`<a href="mailto:support@quadev.net">Support</a>` +
+			`<a href="#top">Top</a>` +
+			`<a data-no-track href="https://quadev.net/private">Private</a>` +
+			`<a name="anchor">Anchor</a>` +
+			`<abbr title="HyperText">HTML</abbr></p>`
+
+		assert.Equal(test, `<p><a href="`+redirect("https://quadev.net/welcome?step=1&source=email")+`" class="button">Start</a>`+
+			`<A HREF="`+redirect("http://quadev.net/docs")+`">Docs</A>`+
+			`<a target=_blank href="`+redirect("https://quadev.net/blog")+`">Blog</a>`+
+			`<a href="https://quadev.net/settings/unsubscribe">Unsubscribe</a>`+
+			`<a href="mailto:support@quadev.net">Support</a>`+
+			`<a href="#top">Top</a>`+
+			`<a data-no-track href="https://quadev.net/private">Private</a>`+
+			`<a name="anchor">Anchor</a>`+
+			`<abbr title="HyperText">HTML</abbr></p>`, clicks.Rewrite(body, "1"))
+	})
+}
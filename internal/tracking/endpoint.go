@@ -0,0 +1,136 @@
+package tracking
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+
+	"qd-email-api/internal/model"
+)
+
+// pixel is a transparent 1x1 GIF
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Open is an open of a tracked email
+type Open struct {
+	MessageID string
+	UserAgent model.UserAgentClass
+}
+
+// Click is a click on a link of a tracked email
+type Click struct {
+	MessageID string
+	URL       string
+	UserAgent model.UserAgentClass
+}
+
+// Handlerer is the interface for recording the activity of the recipients on the tracked emails
+type Handlerer interface {
+	HandleOpen(ctx context.Context, open *Open) error
+	HandleClick(ctx context.Context, click *Click) error
+}
+
+// OpenEndpoint serves the tracking pixels. The pixel is served even when the open cannot
+// be recorded so the emails never show a broken image.
+type OpenEndpoint struct {
+	pixels  *Pixels
+	handler Handlerer
+	logger  log.Loggerer
+}
+
+var _ http.Handler = &OpenEndpoint{}
+
+// NewOpenEndpoint creates the endpoint of the given pixels, passing the opens to the handler
+func NewOpenEndpoint(pixels *Pixels, handler Handlerer, logger log.Loggerer) *OpenEndpoint {
+	return &OpenEndpoint{
+		pixels:  pixels,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+func (endpoint *OpenEndpoint) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	messageID, err := endpoint.pixels.Verify(request.URL.Query().Get("token"))
+	if err != nil {
+		endpoint.logger.Warn(fmt.Sprintf("Rejected open from %s: %v", request.RemoteAddr, err))
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// HEAD requests are sent by link checkers rather than by the mail clients
+	if request.Method == http.MethodGet {
+		open := &Open{
+			MessageID: messageID,
+			UserAgent: ClassifyUserAgent(request.UserAgent()),
+		}
+		if err := endpoint.handler.HandleOpen(request.Context(), open); err != nil {
+			endpoint.logger.Error(err, fmt.Sprintf("Error recording open of email %s", messageID))
+		}
+	}
+
+	writer.Header().Set("Content-Type", "image/gif")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(pixel)))
+	// Every fetch of the pixel must reach the server to be counted
+	writer.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(pixel)
+}
+
+// ClickEndpoint serves the redirects of the tracked links. Only the redirects signed by
+// the service are followed, and the recipient is redirected even when the click cannot
+// be recorded.
+type ClickEndpoint struct {
+	clicks  *Clicks
+	handler Handlerer
+	logger  log.Loggerer
+}
+
+var _ http.Handler = &ClickEndpoint{}
+
+// NewClickEndpoint creates the endpoint of the given redirects, passing the clicks to the handler
+func NewClickEndpoint(clicks *Clicks, handler Handlerer, logger log.Loggerer) *ClickEndpoint {
+	return &ClickEndpoint{
+		clicks:  clicks,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+func (endpoint *ClickEndpoint) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	messageID, target, err := endpoint.clicks.Verify(request.URL.Query().Get("token"))
+	if err != nil {
+		endpoint.logger.Warn(fmt.Sprintf("Rejected click from %s: %v", request.RemoteAddr, err))
+		http.Error(writer, "This link is not valid.", http.StatusBadRequest)
+		return
+	}
+	// HEAD requests are sent by link checkers rather than by the recipients
+	if request.Method == http.MethodGet {
+		click := &Click{
+			MessageID: messageID,
+			URL:       target,
+			UserAgent: ClassifyUserAgent(request.UserAgent()),
+		}
+		if err := endpoint.handler.HandleClick(request.Context(), click); err != nil {
+			endpoint.logger.Error(err, fmt.Sprintf("Error recording click of email %s", messageID))
+		}
+	}
+
+	writer.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	http.Redirect(writer, request, target, http.StatusFound)
+}
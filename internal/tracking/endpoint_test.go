@@ -0,0 +1,165 @@
+package tracking_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/model"
+	"qd-email-api/internal/tracking"
+	"qd-email-api/internal/tracking/mock"
+)
+
+func TestOpenEndpoint(test *testing.T) {
+	pixels := tracking.NewPixels("https://email.test.com/open", "secret")
+	target := strings.TrimPrefix(pixels.URL("1"), "https://email.test.com")
+	setup := func(test *testing.T) (*tracking.OpenEndpoint, *mock.MockHandlerer, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		handlerMock := mock.NewMockHandlerer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		return tracking.NewOpenEndpoint(pixels, handlerMock, loggerMock), handlerMock, loggerMock, controller
+	}
+
+	test.Run("Get_Records_Open", func(test *testing.T) {
+		endpoint, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleOpen(gomock.Any(), &tracking.Open{MessageID: "1", UserAgent: model.UserAgentMobile}).Return(nil)
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, request)
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+		assert.Equal(test, "image/gif", recorder.Header().Get("Content-Type"))
+		assert.Equal(test, "no-cache, no-store, must-revalidate", recorder.Header().Get("Cache-Control"))
+		assert.True(test, strings.HasPrefix(recorder.Body.String(), "GIF89a"))
+	})
+
+	test.Run("Head_Does_Not_Record", func(test *testing.T) {
+		endpoint, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, target, nil))
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+	})
+
+	test.Run("Handler_Error_Serves_Pixel", func(test *testing.T) {
+		endpoint, handlerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		handlerError := errors.New("Error storing messages")
+		handlerMock.EXPECT().HandleOpen(gomock.Any(), gomock.Any()).Return(handlerError)
+		loggerMock.EXPECT().Error(handlerError, "Error recording open of email 1").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+		assert.Equal(test, "image/gif", recorder.Header().Get("Content-Type"))
+	})
+
+	test.Run("Invalid_Token_Is_Rejected", func(test *testing.T) {
+		endpoint, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		loggerMock.EXPECT().Warn("Rejected open from 192.0.2.1:1234: Invalid tracking token").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/open?token=invalid", nil))
+
+		assert.Equal(test, http.StatusBadRequest, recorder.Code)
+	})
+
+	test.Run("Method_Not_Allowed", func(test *testing.T) {
+		endpoint, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+
+		assert.Equal(test, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(test, "GET, HEAD", recorder.Header().Get("Allow"))
+	})
+}
+
+func TestClickEndpoint(test *testing.T) {
+	clicks := tracking.NewClicks("https://email.test.com/click", "secret")
+	target := strings.TrimPrefix(clicks.URL("1", "https://quadev.net/welcome"), "https://email.test.com")
+	setup := func(test *testing.T) (*tracking.ClickEndpoint, *mock.MockHandlerer, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		handlerMock := mock.NewMockHandlerer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		return tracking.NewClickEndpoint(clicks, handlerMock, loggerMock), handlerMock, loggerMock, controller
+	}
+
+	test.Run("Get_Records_Click_And_Redirects", func(test *testing.T) {
+		endpoint, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleClick(gomock.Any(), &tracking.Click{
+			MessageID: "1",
+			URL:       "https://quadev.net/welcome",
+			UserAgent: model.UserAgentDesktop,
+		}).Return(nil)
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)")
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, request)
+
+		assert.Equal(test, http.StatusFound, recorder.Code)
+		assert.Equal(test, "https://quadev.net/welcome", recorder.Header().Get("Location"))
+	})
+
+	test.Run("Handler_Error_Redirects", func(test *testing.T) {
+		endpoint, handlerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		handlerError := errors.New("Error storing messages")
+		handlerMock.EXPECT().HandleClick(gomock.Any(), gomock.Any()).Return(handlerError)
+		loggerMock.EXPECT().Error(handlerError, "Error recording click of email 1").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		assert.Equal(test, http.StatusFound, recorder.Code)
+		assert.Equal(test, "https://quadev.net/welcome", recorder.Header().Get("Location"))
+	})
+
+	test.Run("Tampered_Token_Is_Rejected", func(test *testing.T) {
+		endpoint, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		forged := tracking.NewClicks("https://email.test.com/click", "guessed").URL("1", "https://evil.test.com")
+		loggerMock.EXPECT().Warn("Rejected click from 192.0.2.1:1234: Forged tracking token").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(forged, "https://email.test.com"), nil))
+
+		assert.Equal(test, http.StatusBadRequest, recorder.Code)
+		assert.Empty(test, recorder.Header().Get("Location"))
+	})
+
+	test.Run("Method_Not_Allowed", func(test *testing.T) {
+		endpoint, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+
+		assert.Equal(test, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
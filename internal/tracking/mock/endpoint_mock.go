@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: endpoint.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	tracking "qd-email-api/internal/tracking"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHandlerer is a mock of Handlerer interface.
+type MockHandlerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockHandlererMockRecorder
+}
+
+// MockHandlererMockRecorder is the mock recorder for MockHandlerer.
+type MockHandlererMockRecorder struct {
+	mock *MockHandlerer
+}
+
+// NewMockHandlerer creates a new mock instance.
+func NewMockHandlerer(ctrl *gomock.Controller) *MockHandlerer {
+	mock := &MockHandlerer{ctrl: ctrl}
+	mock.recorder = &MockHandlererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHandlerer) EXPECT() *MockHandlererMockRecorder {
+	return m.recorder
+}
+
+// HandleClick mocks base method.
+func (m *MockHandlerer) HandleClick(ctx context.Context, click *tracking.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleClick", ctx, click)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandleClick indicates an expected call of HandleClick.
+func (mr *MockHandlererMockRecorder) HandleClick(ctx, click interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleClick", reflect.TypeOf((*MockHandlerer)(nil).HandleClick), ctx, click)
+}
+
+// HandleOpen mocks base method.
+func (m *MockHandlerer) HandleOpen(ctx context.Context, open *tracking.Open) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleOpen", ctx, open)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandleOpen indicates an expected call of HandleOpen.
+func (mr *MockHandlererMockRecorder) HandleOpen(ctx, open interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleOpen", reflect.TypeOf((*MockHandlerer)(nil).HandleOpen), ctx, open)
+}
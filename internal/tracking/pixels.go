@@ -0,0 +1,55 @@
+package tracking
+
+import (
+	"fmt"
+	"regexp"
+
+	"qd-email-api/internal/signing"
+)
+
+// OpenPath is the path of the open tracking endpoint on the HTTP server
+const OpenPath = "/open"
+
+// bodyEnd matches the closing tag of the HTML body
+var bodyEnd = regexp.MustCompile(`(?i)</body\s*>`)
+
+// Pixels creates the tracking pixels of the emails and verifies them when they are
+// fetched. The tokens of the pixels hold the email, signed so opens cannot be recorded
+// on emails that were not sent with a pixel.
+type Pixels struct {
+	url    string
+	signer *signing.Signer
+}
+
+// NewPixels creates the pixels of the open tracking endpoint at the given URL, without
+// a query, signed with the secret
+func NewPixels(url, secret string) *Pixels {
+	return &Pixels{
+		url:    url,
+		signer: signing.NewSigner(secret, ErrInvalidToken, ErrForgedToken),
+	}
+}
+
+// URL returns the pixel URL of the email
+func (pixels *Pixels) URL(messageID string) string {
+	return pixels.url + "?token=" + pixels.signer.Token(messageID)
+}
+
+// Verify returns the email of a pixel token once its signature is verified
+func (pixels *Pixels) Verify(token string) (string, error) {
+	fields, err := pixels.signer.Verify(token, 1)
+	if err != nil {
+		return "", err
+	}
+	return fields[0], nil
+}
+
+// Embed adds the pixel of the email at the end of the HTML body
+func (pixels *Pixels) Embed(body, messageID string) string {
+	image := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display:none">`, pixels.URL(messageID))
+	if location := bodyEnd.FindAllStringIndex(body, -1); len(location) > 0 {
+		last := location[len(location)-1][0]
+		return body[:last] + image + body[last:]
+	}
+	return body + image
+}
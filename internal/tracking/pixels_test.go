@@ -0,0 +1,74 @@
+package tracking
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/model"
+)
+
+func TestPixels(test *testing.T) {
+	pixels := NewPixels("https://email.test.com/open", "secret")
+
+	test.Run("URL_Verify", func(test *testing.T) {
+		url := pixels.URL("1")
+		assert.Regexp(test, `^https://email\.test\.com/open\?token=[A-Za-z0-9_-]+\.[0-9a-f]{32}$`, url)
+
+		messageID, err := pixels.Verify(strings.TrimPrefix(url, "https://email.test.com/open?token="))
+		assert.NoError(test, err)
+		assert.Equal(test, "1", messageID)
+	})
+
+	test.Run("Verify_Forged_Token_Error", func(test *testing.T) {
+		token := strings.TrimPrefix(pixels.URL("1"), "https://email.test.com/open?token=")
+		_, signature, _ := strings.Cut(token, ".")
+		for _, forged := range []string{
+			base64.RawURLEncoding.EncodeToString([]byte("2")) + "." + signature,
+			strings.TrimPrefix(NewPixels("https://email.test.com/open", "other").URL("1"), "https://email.test.com/open?token="),
+			strings.TrimSuffix(token, signature),
+		} {
+			_, err := pixels.Verify(forged)
+			assert.ErrorIs(test, err, ErrForgedToken, forged)
+		}
+	})
+
+	test.Run("Verify_Invalid_Token_Error", func(test *testing.T) {
+		signature := strings.Repeat("0", 32)
+		for _, token := range []string{
+			"",
+			"no-signature",
+			"not base64!." + signature,
+			base64.RawURLEncoding.EncodeToString([]byte("1\n2")) + "." + signature,
+		} {
+			_, err := pixels.Verify(token)
+			assert.ErrorIs(test, err, ErrInvalidToken, token)
+		}
+	})
+
+	test.Run("Embed_Before_Body_End", func(test *testing.T) {
+		image := `<img src="` + pixels.URL("1") + `" width="1" height="1" alt="" style="display:none">`
+
+		assert.Equal(test, "<html><body>Hello"+image+"</BODY></html>", pixels.Embed("<html><body>Hello</BODY></html>", "1"))
+		assert.Equal(test, "<p>Hello</p>"+image, pixels.Embed("<p>Hello</p>", "1"))
+	})
+}
+
+func TestClassifyUserAgent(test *testing.T) {
+	for userAgent, class := range map[string]model.UserAgentClass{
+		"": model.UserAgentUnknown,
+		"Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)": model.UserAgentProxy,
+		"YahooMailProxy; https://help.yahoo.com/kb/yahoo-mail-proxy-SLN28749.html":                  model.UserAgentProxy,
+		"Mozilla/5.0 (compatible; Barracuda Link Scanner)":                                          model.UserAgentBot,
+		"curl/8.4.0": model.UserAgentBot,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko)": model.UserAgentMobile,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36":   model.UserAgentMobile,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko)":        model.UserAgentDesktop,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Thunderbird/115.5.0":          model.UserAgentDesktop,
+		"Lynx/2.9.0": model.UserAgentUnknown,
+	} {
+		assert.Equal(test, class, ClassifyUserAgent(userAgent), userAgent)
+	}
+}
@@ -0,0 +1,9 @@
+package tracking
+
+import "errors"
+
+// ErrInvalidToken is returned when a token is not a tracking token of the service
+var ErrInvalidToken = errors.New("Invalid tracking token")
+
+// ErrForgedToken is returned when the signature of a token does not match its content
+var ErrForgedToken = errors.New("Forged tracking token")
@@ -0,0 +1,44 @@
+package tracking
+
+import (
+	"strings"
+
+	"qd-email-api/internal/model"
+)
+
+// proxies are the user agents of the mailbox providers fetching the images of the emails
+// before or instead of the recipients, so the opens they record are less reliable
+var proxies = []string{"googleimageproxy", "ggpht.com", "yahoomailproxy", "outlook-ios", "ms-office"}
+
+var bots = []string{"bot", "crawler", "spider", "scanner", "preview", "curl", "wget", "python", "go-http-client", "java/"}
+
+var mobiles = []string{"iphone", "ipad", "android", "mobile"}
+
+var desktops = []string{"windows", "macintosh", "mac os x", "linux", "x11", "thunderbird", "outlook"}
+
+// ClassifyUserAgent returns the class of the client of the user agent header
+func ClassifyUserAgent(userAgent string) model.UserAgentClass {
+	userAgent = strings.ToLower(userAgent)
+	switch {
+	case userAgent == "":
+		return model.UserAgentUnknown
+	case containsAny(userAgent, proxies):
+		return model.UserAgentProxy
+	case containsAny(userAgent, bots):
+		return model.UserAgentBot
+	case containsAny(userAgent, mobiles):
+		return model.UserAgentMobile
+	case containsAny(userAgent, desktops):
+		return model.UserAgentDesktop
+	}
+	return model.UserAgentUnknown
+}
+
+func containsAny(text string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package unsubscribe
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/quadev-ltd/qd-common/pkg/log"
+)
+
+// Handlerer is the interface for recording the opt outs of the recipients
+type Handlerer interface {
+	HandleOptOut(ctx context.Context, optOut *OptOut) error
+}
+
+// page is the content of the pages shown to the recipients
+type page struct {
+	Title string
+	Text  string
+	// Confirm shows the button unsubscribing the recipient
+	Confirm bool
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Text}}</p>
+{{if .Confirm}}<form method="post"><input type="hidden" name="List-Unsubscribe" value="One-Click"><button type="submit">Unsubscribe</button> <button type="submit" name="scope" value="all">Unsubscribe from all emails</button></form>{{end}}
+</body>
+</html>
+`))
+
+// Endpoint serves the unsubscribe links. Following a link shows a confirmation page, as
+// link scanners open the links of the emails, while the one-click POST of RFC 8058 sent
+// by the mailbox providers and the confirmation form record the opt out. Only the
+// confirmation form unsubscribes from all the emails rather than their category.
+type Endpoint struct {
+	links   *Links
+	handler Handlerer
+	logger  log.Loggerer
+}
+
+var _ http.Handler = &Endpoint{}
+
+// NewEndpoint creates the endpoint of the given links, passing the opt outs to the handler
+func NewEndpoint(links *Links, handler Handlerer, logger log.Loggerer) *Endpoint {
+	return &Endpoint{
+		links:   links,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+func (endpoint *Endpoint) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead && request.Method != http.MethodPost {
+		writer.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	optOut, err := endpoint.links.Verify(request.URL.Query().Get("token"))
+	if err != nil {
+		endpoint.logger.Warn(fmt.Sprintf("Rejected unsubscribe from %s: %v", request.RemoteAddr, err))
+		render(writer, http.StatusBadRequest, &page{
+			Title: "Invalid link",
+			Text:  "This unsubscribe link is not valid.",
+		})
+		return
+	}
+	if request.Method != http.MethodPost {
+		render(writer, http.StatusOK, &page{
+			Title:   "Unsubscribe",
+			Text:    fmt.Sprintf("Stop sending %s emails to %s?", optOut.Category, optOut.Address),
+			Confirm: true,
+		})
+		return
+	}
+
+	optOut.All = request.PostFormValue("scope") == "all"
+	if err := endpoint.handler.HandleOptOut(request.Context(), optOut); err != nil {
+		endpoint.logger.Error(err, fmt.Sprintf("Error unsubscribing from email %s", optOut.MessageID))
+		render(writer, http.StatusInternalServerError, &page{
+			Title: "Unsubscribe failed",
+			Text:  "Your request could not be processed, please try again later.",
+		})
+		return
+	}
+	text := fmt.Sprintf("%s will no longer receive %s emails.", optOut.Address, optOut.Category)
+	if optOut.All {
+		text = fmt.Sprintf("%s is unsubscribed from all emails.", optOut.Address)
+	}
+	render(writer, http.StatusOK, &page{
+		Title: "Unsubscribed",
+		Text:  text,
+	})
+}
+
+func render(writer http.ResponseWriter, statusCode int, content *page) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(statusCode)
+	pageTemplate.Execute(writer, content)
+}
@@ -0,0 +1,118 @@
+package unsubscribe_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/unsubscribe"
+	"qd-email-api/internal/unsubscribe/mock"
+)
+
+func TestEndpoint(test *testing.T) {
+	links := unsubscribe.NewLinks("https://email.test.com/unsubscribe", "secret")
+	optOut := &unsubscribe.OptOut{MessageID: "1", Address: "user@example.com", Category: "newsletter"}
+	target := "/unsubscribe?token=" + links.Token(optOut)
+	setup := func(test *testing.T) (*unsubscribe.Endpoint, *mock.MockHandlerer, *loggerMock.MockLoggerer, *gomock.Controller) {
+		controller := gomock.NewController(test)
+		handlerMock := mock.NewMockHandlerer(controller)
+		loggerMock := loggerMock.NewMockLoggerer(controller)
+		return unsubscribe.NewEndpoint(links, handlerMock, loggerMock), handlerMock, loggerMock, controller
+	}
+
+	test.Run("One_Click_Post_Unsubscribes", func(test *testing.T) {
+		endpoint, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleOptOut(gomock.Any(), optOut).Return(nil)
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader("List-Unsubscribe=One-Click"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, request)
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+		assert.Contains(test, recorder.Body.String(), "user@example.com will no longer receive newsletter emails.")
+	})
+
+	test.Run("Confirmation_Unsubscribes_From_All", func(test *testing.T) {
+		endpoint, handlerMock, _, controller := setup(test)
+		defer controller.Finish()
+
+		handlerMock.EXPECT().HandleOptOut(gomock.Any(), &unsubscribe.OptOut{
+			MessageID: "1",
+			Address:   "user@example.com",
+			Category:  "newsletter",
+			All:       true,
+		}).Return(nil)
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader("List-Unsubscribe=One-Click&scope=all"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, request)
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+		assert.Contains(test, recorder.Body.String(), "user@example.com is unsubscribed from all emails.")
+	})
+
+	test.Run("Get_Shows_Confirmation", func(test *testing.T) {
+		endpoint, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		assert.Equal(test, http.StatusOK, recorder.Code)
+		assert.Equal(test, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Contains(test, recorder.Body.String(), "Stop sending newsletter emails to user@example.com?")
+		assert.Contains(test, recorder.Body.String(), `<form method="post">`)
+		assert.Contains(test, recorder.Body.String(), `name="scope" value="all"`)
+	})
+
+	test.Run("Invalid_Token_Is_Rejected", func(test *testing.T) {
+		endpoint, _, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		forged := unsubscribe.NewLinks("https://email.test.com/unsubscribe", "guessed").Token(optOut)
+		loggerMock.EXPECT().Warn("Rejected unsubscribe from 192.0.2.1:1234: Forged unsubscribe token").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/unsubscribe?token="+forged, nil))
+
+		assert.Equal(test, http.StatusBadRequest, recorder.Code)
+		assert.Contains(test, recorder.Body.String(), "This unsubscribe link is not valid.")
+	})
+
+	test.Run("Handler_Error", func(test *testing.T) {
+		endpoint, handlerMock, loggerMock, controller := setup(test)
+		defer controller.Finish()
+
+		handlerError := errors.New("Error storing suppressions")
+		handlerMock.EXPECT().HandleOptOut(gomock.Any(), gomock.Any()).Return(handlerError)
+		loggerMock.EXPECT().Error(handlerError, "Error unsubscribing from email 1").Times(1)
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+
+		assert.Equal(test, http.StatusInternalServerError, recorder.Code)
+	})
+
+	test.Run("Method_Not_Allowed", func(test *testing.T) {
+		endpoint, _, _, controller := setup(test)
+		defer controller.Finish()
+
+		recorder := httptest.NewRecorder()
+
+		endpoint.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, target, nil))
+
+		assert.Equal(test, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(test, "GET, HEAD, POST", recorder.Header().Get("Allow"))
+	})
+}
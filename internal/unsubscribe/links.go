@@ -0,0 +1,71 @@
+package unsubscribe
+
+import (
+	"errors"
+	"strings"
+
+	"qd-email-api/internal/signing"
+)
+
+// Path is the path of the unsubscribe endpoint on the HTTP server
+const Path = "/unsubscribe"
+
+// ErrInvalidToken is returned when a token is not an unsubscribe token of the service
+var ErrInvalidToken = errors.New("Invalid unsubscribe token")
+
+// ErrForgedToken is returned when the signature of a token does not match its content
+var ErrForgedToken = errors.New("Forged unsubscribe token")
+
+// OptOut is the request of a recipient to stop receiving the emails of a category
+type OptOut struct {
+	// MessageID is the email the recipient unsubscribed from
+	MessageID string
+	Address   string
+	Category  string
+	// All unsubscribes the recipient from every category it can opt out of. It is chosen on
+	// the confirmation page and is not part of the token.
+	All bool
+}
+
+// Links creates the unsubscribe links of the emails and verifies them when they are
+// followed. The tokens of the links hold the email, the recipient and the category,
+// signed so recipients cannot unsubscribe other addresses.
+type Links struct {
+	url    string
+	signer *signing.Signer
+}
+
+// NewLinks creates the links of the unsubscribe endpoint at the given URL, without
+// a query, signed with the secret
+func NewLinks(url, secret string) *Links {
+	return &Links{
+		url:    url,
+		signer: signing.NewSigner(secret, ErrInvalidToken, ErrForgedToken),
+	}
+}
+
+// URL returns the unsubscribe link of the opt out
+func (links *Links) URL(optOut *OptOut) string {
+	return links.url + "?token=" + links.Token(optOut)
+}
+
+// Token returns the signed token of the opt out
+func (links *Links) Token(optOut *OptOut) string {
+	return links.signer.Token(optOut.MessageID, strings.ToLower(optOut.Address), optOut.Category)
+}
+
+// Verify returns the opt out of a token once its signature is verified
+func (links *Links) Verify(token string) (*OptOut, error) {
+	fields, err := links.signer.Verify(token, 3)
+	if err != nil {
+		return nil, err
+	}
+	if fields[1] == "" {
+		return nil, ErrInvalidToken
+	}
+	return &OptOut{
+		MessageID: fields[0],
+		Address:   fields[1],
+		Category:  fields[2],
+	}, nil
+}
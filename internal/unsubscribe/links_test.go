@@ -0,0 +1,51 @@
+package unsubscribe
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinks(test *testing.T) {
+	links := NewLinks("https://email.test.com/unsubscribe", "secret")
+	optOut := &OptOut{MessageID: "1", Address: "User@Example.com", Category: "newsletter"}
+
+	test.Run("URL_Verify", func(test *testing.T) {
+		url := links.URL(optOut)
+		assert.Regexp(test, `^https://email\.test\.com/unsubscribe\?token=[A-Za-z0-9_-]+\.[0-9a-f]{32}$`, url)
+
+		verified, err := links.Verify(strings.TrimPrefix(url, "https://email.test.com/unsubscribe?token="))
+		assert.NoError(test, err)
+		assert.Equal(test, &OptOut{MessageID: "1", Address: "user@example.com", Category: "newsletter"}, verified)
+	})
+
+	test.Run("Verify_Forged_Token_Error", func(test *testing.T) {
+		token := links.Token(optOut)
+		_, signature, _ := strings.Cut(token, ".")
+		other := base64.RawURLEncoding.EncodeToString([]byte("1\nother@example.com\nnewsletter"))
+		for _, forged := range []string{
+			other + "." + signature,
+			NewLinks("https://email.test.com/unsubscribe", "other").Token(optOut),
+			strings.TrimSuffix(token, signature),
+		} {
+			_, err := links.Verify(forged)
+			assert.ErrorIs(test, err, ErrForgedToken, forged)
+		}
+	})
+
+	test.Run("Verify_Invalid_Token_Error", func(test *testing.T) {
+		signature := strings.Repeat("0", 32)
+		for _, token := range []string{
+			"",
+			"no-signature",
+			"not base64!." + signature,
+			base64.RawURLEncoding.EncodeToString([]byte("1\nuser@example.com")) + "." + signature,
+			base64.RawURLEncoding.EncodeToString([]byte("\nuser@example.com\nnewsletter")) + "." + signature,
+		} {
+			_, err := links.Verify(token)
+			assert.ErrorIs(test, err, ErrInvalidToken, token)
+		}
+	})
+}
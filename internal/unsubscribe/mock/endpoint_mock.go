@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: endpoint.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	unsubscribe "qd-email-api/internal/unsubscribe"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHandlerer is a mock of Handlerer interface.
+type MockHandlerer struct {
+	ctrl     *gomock.Controller
+	recorder *MockHandlererMockRecorder
+}
+
+// MockHandlererMockRecorder is the mock recorder for MockHandlerer.
+type MockHandlererMockRecorder struct {
+	mock *MockHandlerer
+}
+
+// NewMockHandlerer creates a new mock instance.
+func NewMockHandlerer(ctrl *gomock.Controller) *MockHandlerer {
+	mock := &MockHandlerer{ctrl: ctrl}
+	mock.recorder = &MockHandlererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHandlerer) EXPECT() *MockHandlererMockRecorder {
+	return m.recorder
+}
+
+// HandleOptOut mocks base method.
+func (m *MockHandlerer) HandleOptOut(ctx context.Context, optOut *unsubscribe.OptOut) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleOptOut", ctx, optOut)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandleOptOut indicates an expected call of HandleOptOut.
+func (mr *MockHandlererMockRecorder) HandleOptOut(ctx, optOut interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleOptOut", reflect.TypeOf((*MockHandlerer)(nil).HandleOptOut), ctx, optOut)
+}
@@ -0,0 +1,76 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: notifier.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	webhook "qd-email-api/internal/webhook"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockNotifierer is a mock of Notifierer interface.
+type MockNotifierer struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotifiererMockRecorder
+}
+
+// MockNotifiererMockRecorder is the mock recorder for MockNotifierer.
+type MockNotifiererMockRecorder struct {
+	mock *MockNotifierer
+}
+
+// NewMockNotifierer creates a new mock instance.
+func NewMockNotifierer(ctrl *gomock.Controller) *MockNotifierer {
+	mock := &MockNotifierer{ctrl: ctrl}
+	mock.recorder = &MockNotifiererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotifierer) EXPECT() *MockNotifiererMockRecorder {
+	return m.recorder
+}
+
+// Deliveries mocks base method.
+func (m *MockNotifierer) Deliveries(endpoint string) ([]webhook.Delivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deliveries", endpoint)
+	ret0, _ := ret[0].([]webhook.Delivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Deliveries indicates an expected call of Deliveries.
+func (mr *MockNotifiererMockRecorder) Deliveries(endpoint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deliveries", reflect.TypeOf((*MockNotifierer)(nil).Deliveries), endpoint)
+}
+
+// Start mocks base method.
+func (m *MockNotifierer) Start() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockNotifiererMockRecorder) Start() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockNotifierer)(nil).Start))
+}
+
+// Stop mocks base method.
+func (m *MockNotifierer) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockNotifiererMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockNotifierer)(nil).Stop))
+}
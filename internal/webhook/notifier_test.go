@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	loggerMock "github.com/quadev-ltd/qd-common/pkg/log/mock"
+	"github.com/stretchr/testify/assert"
+
+	"qd-email-api/internal/clock"
+	"qd-email-api/internal/event"
+	"qd-email-api/internal/model"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts an endpoint answering with the given status codes in turn, the
+// last one repeated, and forwarding every request it receives
+func newReceiver(test *testing.T, statusCodes ...int) (*httptest.Server, chan receivedRequest) {
+	requests := make(chan receivedRequest, 10)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		index := min(int(atomic.AddInt32(&count, 1))-1, len(statusCodes)-1)
+		writer.WriteHeader(statusCodes[index])
+		requests <- receivedRequest{header: request.Header, body: body}
+	}))
+	test.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestNotifier(test *testing.T) {
+	now := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+	message := &model.Message{ID: "1", To: "test@test.com", Category: "security"}
+	retry := Retry{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	options := Options{Retry: retry, QueueSize: 10, LogSize: 10}
+
+	test.Run("Posts_Signed_Events_To_Subscribed_Endpoints", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		everything, everythingRequests := newReceiver(test, http.StatusOK)
+		bounces, bounceRequests := newReceiver(test, http.StatusNoContent)
+		notifier, err := NewNotifier(eventBus, []Endpoint{
+			{Name: "everything", URL: everything.URL, Secret: "everything-secret"},
+			{Name: "bounces", URL: bounces.URL, Secret: "bounces-secret", Events: []EventType{EventBounced}},
+		}, http.DefaultClient, clock.NewFakeClock(now), loggerMock.NewMockLoggerer(controller), options)
+		assert.NoError(test, err)
+		assert.NoError(test, notifier.Start())
+		defer notifier.Stop()
+
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusQueued, Time: now})
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusSent, Time: now})
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusBounced, Time: now, Response: "550 No such user"})
+
+		sent := <-everythingRequests
+		var payload Payload
+		assert.NoError(test, json.Unmarshal(sent.body, &payload))
+		assert.Equal(test, EventSent, payload.Type)
+		assert.Equal(test, "1", payload.MessageID)
+		assert.Equal(test, "test@test.com", payload.To)
+		assert.Equal(test, "security", payload.Category)
+		assert.Equal(test, now, payload.Time)
+		assert.Equal(test, payload.ID, sent.header.Get(IDHeader))
+		assert.Equal(test, "application/json", sent.header.Get("Content-Type"))
+		assert.Equal(test, strconv.FormatInt(now.Unix(), 10), sent.header.Get(TimestampHeader))
+		assert.Equal(test, Sign("everything-secret", now.Unix(), sent.body), sent.header.Get(SignatureHeader))
+		assert.Equal(test, EventBounced, decodeType(test, (<-everythingRequests).body))
+
+		bounced := <-bounceRequests
+		assert.NoError(test, json.Unmarshal(bounced.body, &payload))
+		assert.Equal(test, EventBounced, payload.Type)
+		assert.Equal(test, "550 No such user", payload.Response)
+		assert.Equal(test, Sign("bounces-secret", now.Unix(), bounced.body), bounced.header.Get(SignatureHeader))
+		assert.NotEqual(test, Sign("everything-secret", now.Unix(), bounced.body), bounced.header.Get(SignatureHeader))
+		assert.Empty(test, bounceRequests)
+	})
+
+	test.Run("Retries_Failed_Deliveries", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		receiver, requests := newReceiver(test, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+		notifier, err := NewNotifier(eventBus, []Endpoint{
+			{Name: "receiver", URL: receiver.URL, Secret: "secret"},
+		}, http.DefaultClient, clock.NewFakeClock(now), loggerMock.NewMockLoggerer(controller), options)
+		assert.NoError(test, err)
+		assert.NoError(test, notifier.Start())
+		defer notifier.Stop()
+
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusDeferred, Time: now})
+
+		ids := []string{}
+		for index := 0; index < 3; index++ {
+			ids = append(ids, (<-requests).header.Get(IDHeader))
+		}
+		assert.Equal(test, ids[0], ids[1])
+		assert.Equal(test, ids[0], ids[2])
+		assert.Eventually(test, func() bool {
+			deliveries, _ := notifier.Deliveries("receiver")
+			return len(deliveries) == 3
+		}, time.Second, time.Millisecond)
+
+		deliveries, err := notifier.Deliveries("receiver")
+		assert.NoError(test, err)
+		for index, statusCode := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK} {
+			assert.Equal(test, index+1, deliveries[index].Attempt)
+			assert.Equal(test, statusCode, deliveries[index].StatusCode)
+			assert.Equal(test, ids[0], deliveries[index].EventID)
+			assert.Equal(test, EventDeferred, deliveries[index].Type)
+		}
+		assert.Equal(test, "Unexpected status 503 Service Unavailable", deliveries[0].Error)
+		assert.Empty(test, deliveries[2].Error)
+	})
+
+	test.Run("Gives_Up_On_Rejected_Deliveries", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		rejecting, rejectingRequests := newReceiver(test, http.StatusBadRequest)
+		failing, failingRequests := newReceiver(test, http.StatusInternalServerError)
+		logger := loggerMock.NewMockLoggerer(controller)
+		notifier, err := NewNotifier(eventBus, []Endpoint{
+			{Name: "rejecting", URL: rejecting.URL, Secret: "secret"},
+			{Name: "failing", URL: failing.URL, Secret: "secret"},
+		}, http.DefaultClient, clock.NewFakeClock(now), logger, Options{Retry: retry, QueueSize: 10, LogSize: 2})
+		assert.NoError(test, err)
+		assert.NoError(test, notifier.Start())
+		defer notifier.Stop()
+
+		subscription, _ := eventBus.Subscribe("")
+		defer subscription.Close()
+		errorMessages := make(chan string, 2)
+		logger.EXPECT().Error(gomock.Any(), gomock.Any()).Do(func(err error, message string) {
+			errorMessages <- message
+		}).Times(2)
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusSent, Time: now})
+		cursor := (<-subscription.Events()).Cursor
+
+		<-rejectingRequests
+		for index := 0; index < 3; index++ {
+			<-failingRequests
+		}
+		expected := []string{
+			"Webhook rejecting gave up on event " + cursor + " after 1 attempts",
+			"Webhook failing gave up on event " + cursor + " after 3 attempts",
+		}
+		assert.Contains(test, expected, <-errorMessages)
+		assert.Contains(test, expected, <-errorMessages)
+		failingDeliveries, err := notifier.Deliveries("failing")
+		assert.NoError(test, err)
+		assert.Len(test, failingDeliveries, 2)
+		assert.Equal(test, 3, failingDeliveries[1].Attempt)
+		deliveries, err := notifier.Deliveries("rejecting")
+		assert.NoError(test, err)
+		assert.Len(test, deliveries, 1)
+		assert.Equal(test, http.StatusBadRequest, deliveries[0].StatusCode)
+		assert.Empty(test, rejectingRequests)
+	})
+
+	test.Run("Retry_Does_Not_Delay_Next_Events", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		receiver, requests := newReceiver(test, http.StatusServiceUnavailable, http.StatusOK)
+		logger := loggerMock.NewMockLoggerer(controller)
+		notifier, err := NewNotifier(eventBus, []Endpoint{
+			{Name: "receiver", URL: receiver.URL, Secret: "secret"},
+		}, http.DefaultClient, clock.NewFakeClock(now), logger, Options{
+			Retry:     Retry{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+			QueueSize: 10,
+			LogSize:   10,
+		})
+		assert.NoError(test, err)
+		assert.NoError(test, notifier.Start())
+		defer notifier.Stop()
+
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusDeferred, Time: now})
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusSent, Time: now})
+
+		assert.Equal(test, EventDeferred, decodeType(test, (<-requests).body))
+		select {
+		case request := <-requests:
+			assert.Equal(test, EventSent, decodeType(test, request.body))
+		case <-time.After(time.Second):
+			test.Fatal("Next event delayed by the backoff of the failed delivery")
+		}
+		logger.EXPECT().Warn("Dropped 1 pending webhook deliveries")
+	})
+
+	test.Run("Pending_Deliveries_Resumed_After_Restart", func(test *testing.T) {
+		controller := gomock.NewController(test)
+		defer controller.Finish()
+
+		fakeClock := clock.NewFakeClock(now)
+		eventBus := event.NewBus(fakeClock, 10, 10)
+		receiver, requests := newReceiver(test, http.StatusServiceUnavailable, http.StatusOK)
+		endpoints := []Endpoint{{Name: "receiver", URL: receiver.URL, Secret: "secret"}}
+		options := Options{
+			Retry:     Retry{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+			QueueSize: 10,
+			LogSize:   10,
+			StorePath: filepath.Join(test.TempDir(), "webhooks.json"),
+		}
+		notifier, err := NewNotifier(eventBus, endpoints, http.DefaultClient, fakeClock, loggerMock.NewMockLoggerer(controller), options)
+		assert.NoError(test, err)
+		assert.NoError(test, notifier.Start())
+
+		eventBus.Publish(message, model.StatusChange{Status: model.StatusDeferred, Time: now})
+		failed := <-requests
+		assert.Eventually(test, func() bool {
+			deliveries, _ := notifier.Deliveries("receiver")
+			return len(deliveries) == 1
+		}, time.Second, time.Millisecond)
+		notifier.Stop()
+		assert.FileExists(test, options.StorePath)
+
+		restarted, err := NewNotifier(eventBus, endpoints, http.DefaultClient, fakeClock, loggerMock.NewMockLoggerer(controller), options)
+		assert.NoError(test, err)
+		fakeClock.Advance(time.Hour)
+		assert.NoError(test, restarted.Start())
+		defer restarted.Stop()
+
+		retried := <-requests
+		assert.Equal(test, failed.header.Get(IDHeader), retried.header.Get(IDHeader))
+		assert.NoFileExists(test, options.StorePath)
+		assert.Eventually(test, func() bool {
+			deliveries, _ := restarted.Deliveries("receiver")
+			return len(deliveries) == 1 && deliveries[0].Attempt == 2 && deliveries[0].Error == ""
+		}, time.Second, time.Millisecond)
+	})
+
+	test.Run("Invalid_Endpoint_Errors", func(test *testing.T) {
+		eventBus := event.NewBus(clock.NewFakeClock(now), 10, 10)
+		newNotifier := func(endpoints ...Endpoint) error {
+			_, err := NewNotifier(eventBus, endpoints, http.DefaultClient, clock.NewFakeClock(now), nil, options)
+			return err
+		}
+		endpoint := Endpoint{Name: "endpoint", URL: "http://localhost", Secret: "secret"}
+
+		assert.EqualError(test, newNotifier(Endpoint{URL: "http://localhost", Secret: "secret"}), "Webhook endpoint name is required")
+		assert.EqualError(test, newNotifier(endpoint, endpoint), "Webhook endpoint endpoint is duplicated")
+		assert.EqualError(test, newNotifier(Endpoint{Name: "endpoint", Secret: "secret"}), "Webhook endpoint endpoint URL is required")
+		assert.EqualError(test, newNotifier(Endpoint{Name: "endpoint", URL: "http://localhost"}), "Webhook endpoint endpoint secret is required")
+		endpoint.Events = []EventType{EventSent, "read"}
+		assert.EqualError(test, newNotifier(endpoint), `Webhook endpoint endpoint has unknown event type "read"`)
+
+		notifier, err := NewNotifier(eventBus, nil, http.DefaultClient, clock.NewFakeClock(now), nil, options)
+		assert.NoError(test, err)
+		_, err = notifier.Deliveries("endpoint")
+		assert.ErrorIs(test, err, ErrEndpointNotFound)
+	})
+}
+
+func decodeType(test *testing.T, body []byte) EventType {
+	var payload Payload
+	assert.NoError(test, json.Unmarshal(body, &payload))
+	return payload.Type
+}
@@ -0,0 +1,726 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: v1/email/email.proto
+
+package pb_email_api
+
+import (
+	context "context"
+
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	EmailService_SendEmail_FullMethodName             = "/pb_email_api.EmailService/SendEmail"
+	EmailService_CancelEmail_FullMethodName           = "/pb_email_api.EmailService/CancelEmail"
+	EmailService_SendBatch_FullMethodName             = "/pb_email_api.EmailService/SendBatch"
+	EmailService_SendBatchStream_FullMethodName       = "/pb_email_api.EmailService/SendBatchStream"
+	EmailService_GetEmailStatus_FullMethodName        = "/pb_email_api.EmailService/GetEmailStatus"
+	EmailService_ListEmails_FullMethodName            = "/pb_email_api.EmailService/ListEmails"
+	EmailService_StreamEvents_FullMethodName          = "/pb_email_api.EmailService/StreamEvents"
+	EmailService_ListWebhookDeliveries_FullMethodName = "/pb_email_api.EmailService/ListWebhookDeliveries"
+	EmailService_AddSuppression_FullMethodName        = "/pb_email_api.EmailService/AddSuppression"
+	EmailService_RemoveSuppression_FullMethodName     = "/pb_email_api.EmailService/RemoveSuppression"
+	EmailService_GetSuppression_FullMethodName        = "/pb_email_api.EmailService/GetSuppression"
+	EmailService_ListSuppressions_FullMethodName      = "/pb_email_api.EmailService/ListSuppressions"
+	EmailService_ReportComplaint_FullMethodName       = "/pb_email_api.EmailService/ReportComplaint"
+	EmailService_GetPreferences_FullMethodName        = "/pb_email_api.EmailService/GetPreferences"
+	EmailService_UpdatePreferences_FullMethodName     = "/pb_email_api.EmailService/UpdatePreferences"
+)
+
+// EmailServiceClient is the client API for EmailService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EmailServiceClient interface {
+	SendEmail(ctx context.Context, in *SendEmailRequest, opts ...grpc.CallOption) (*SendEmailResponse, error)
+	// CancelEmail cancels a scheduled email of the calling client, or of any client for the
+	// admin clients.
+	CancelEmail(ctx context.Context, in *CancelEmailRequest, opts ...grpc.CallOption) (*CancelEmailResponse, error)
+	SendBatch(ctx context.Context, in *SendBatchRequest, opts ...grpc.CallOption) (*SendBatchResponse, error)
+	// SendBatchStream expects the template in the first message followed by the recipients.
+	SendBatchStream(ctx context.Context, opts ...grpc.CallOption) (EmailService_SendBatchStreamClient, error)
+	// GetEmailStatus returns an email sent by the calling client, or by any client to the
+	// admin clients.
+	GetEmailStatus(ctx context.Context, in *GetEmailStatusRequest, opts ...grpc.CallOption) (*GetEmailStatusResponse, error)
+	// ListEmails lists the emails sent by the calling client, or by every client to the
+	// admin clients.
+	ListEmails(ctx context.Context, in *ListEmailsRequest, opts ...grpc.CallOption) (*ListEmailsResponse, error)
+	// StreamEvents pushes the status changes of the emails as they happen.
+	// The events are only streamed to the admin clients.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (EmailService_StreamEventsClient, error)
+	// ListWebhookDeliveries returns the latest delivery attempts of a webhook endpoint.
+	// The deliveries are only listed to the admin clients.
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error)
+	// AddSuppression stops the emails to an address until it is removed.
+	AddSuppression(ctx context.Context, in *AddSuppressionRequest, opts ...grpc.CallOption) (*AddSuppressionResponse, error)
+	RemoveSuppression(ctx context.Context, in *RemoveSuppressionRequest, opts ...grpc.CallOption) (*RemoveSuppressionResponse, error)
+	GetSuppression(ctx context.Context, in *GetSuppressionRequest, opts ...grpc.CallOption) (*GetSuppressionResponse, error)
+	ListSuppressions(ctx context.Context, in *ListSuppressionsRequest, opts ...grpc.CallOption) (*ListSuppressionsResponse, error)
+	// ReportComplaint records a feedback report forwarded by a mailbox provider outside
+	// of the inbound listener, such as through a provider API.
+	ReportComplaint(ctx context.Context, in *ReportComplaintRequest, opts ...grpc.CallOption) (*ReportComplaintResponse, error)
+	// GetPreferences returns the categories a recipient opted in or out of, and the
+	// mandatory categories the recipient always receives.
+	GetPreferences(ctx context.Context, in *GetPreferencesRequest, opts ...grpc.CallOption) (*GetPreferencesResponse, error)
+	// UpdatePreferences opts a recipient in or out of categories. The emails of the
+	// categories a recipient opted out of are skipped, except for the mandatory ones.
+	UpdatePreferences(ctx context.Context, in *UpdatePreferencesRequest, opts ...grpc.CallOption) (*UpdatePreferencesResponse, error)
+}
+
+type emailServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEmailServiceClient(cc grpc.ClientConnInterface) EmailServiceClient {
+	return &emailServiceClient{cc}
+}
+
+func (c *emailServiceClient) SendEmail(ctx context.Context, in *SendEmailRequest, opts ...grpc.CallOption) (*SendEmailResponse, error) {
+	out := new(SendEmailResponse)
+	err := c.cc.Invoke(ctx, EmailService_SendEmail_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) CancelEmail(ctx context.Context, in *CancelEmailRequest, opts ...grpc.CallOption) (*CancelEmailResponse, error) {
+	out := new(CancelEmailResponse)
+	err := c.cc.Invoke(ctx, EmailService_CancelEmail_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) SendBatch(ctx context.Context, in *SendBatchRequest, opts ...grpc.CallOption) (*SendBatchResponse, error) {
+	out := new(SendBatchResponse)
+	err := c.cc.Invoke(ctx, EmailService_SendBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) SendBatchStream(ctx context.Context, opts ...grpc.CallOption) (EmailService_SendBatchStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[0], EmailService_SendBatchStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &emailServiceSendBatchStreamClient{stream}
+	return x, nil
+}
+
+type EmailService_SendBatchStreamClient interface {
+	Send(*SendBatchStreamRequest) error
+	CloseAndRecv() (*SendBatchResponse, error)
+	grpc.ClientStream
+}
+
+type emailServiceSendBatchStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *emailServiceSendBatchStreamClient) Send(m *SendBatchStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *emailServiceSendBatchStreamClient) CloseAndRecv() (*SendBatchResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(SendBatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *emailServiceClient) GetEmailStatus(ctx context.Context, in *GetEmailStatusRequest, opts ...grpc.CallOption) (*GetEmailStatusResponse, error) {
+	out := new(GetEmailStatusResponse)
+	err := c.cc.Invoke(ctx, EmailService_GetEmailStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) ListEmails(ctx context.Context, in *ListEmailsRequest, opts ...grpc.CallOption) (*ListEmailsResponse, error) {
+	out := new(ListEmailsResponse)
+	err := c.cc.Invoke(ctx, EmailService_ListEmails_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (EmailService_StreamEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[1], EmailService_StreamEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &emailServiceStreamEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EmailService_StreamEventsClient interface {
+	Recv() (*EmailEvent, error)
+	grpc.ClientStream
+}
+
+type emailServiceStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *emailServiceStreamEventsClient) Recv() (*EmailEvent, error) {
+	m := new(EmailEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *emailServiceClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error) {
+	out := new(ListWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, EmailService_ListWebhookDeliveries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) AddSuppression(ctx context.Context, in *AddSuppressionRequest, opts ...grpc.CallOption) (*AddSuppressionResponse, error) {
+	out := new(AddSuppressionResponse)
+	err := c.cc.Invoke(ctx, EmailService_AddSuppression_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) RemoveSuppression(ctx context.Context, in *RemoveSuppressionRequest, opts ...grpc.CallOption) (*RemoveSuppressionResponse, error) {
+	out := new(RemoveSuppressionResponse)
+	err := c.cc.Invoke(ctx, EmailService_RemoveSuppression_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) GetSuppression(ctx context.Context, in *GetSuppressionRequest, opts ...grpc.CallOption) (*GetSuppressionResponse, error) {
+	out := new(GetSuppressionResponse)
+	err := c.cc.Invoke(ctx, EmailService_GetSuppression_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) ListSuppressions(ctx context.Context, in *ListSuppressionsRequest, opts ...grpc.CallOption) (*ListSuppressionsResponse, error) {
+	out := new(ListSuppressionsResponse)
+	err := c.cc.Invoke(ctx, EmailService_ListSuppressions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) ReportComplaint(ctx context.Context, in *ReportComplaintRequest, opts ...grpc.CallOption) (*ReportComplaintResponse, error) {
+	out := new(ReportComplaintResponse)
+	err := c.cc.Invoke(ctx, EmailService_ReportComplaint_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) GetPreferences(ctx context.Context, in *GetPreferencesRequest, opts ...grpc.CallOption) (*GetPreferencesResponse, error) {
+	out := new(GetPreferencesResponse)
+	err := c.cc.Invoke(ctx, EmailService_GetPreferences_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *emailServiceClient) UpdatePreferences(ctx context.Context, in *UpdatePreferencesRequest, opts ...grpc.CallOption) (*UpdatePreferencesResponse, error) {
+	out := new(UpdatePreferencesResponse)
+	err := c.cc.Invoke(ctx, EmailService_UpdatePreferences_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EmailServiceServer is the server API for EmailService service.
+// All implementations must embed UnimplementedEmailServiceServer
+// for forward compatibility
+type EmailServiceServer interface {
+	SendEmail(context.Context, *SendEmailRequest) (*SendEmailResponse, error)
+	// CancelEmail cancels a scheduled email of the calling client, or of any client for the
+	// admin clients.
+	CancelEmail(context.Context, *CancelEmailRequest) (*CancelEmailResponse, error)
+	SendBatch(context.Context, *SendBatchRequest) (*SendBatchResponse, error)
+	// SendBatchStream expects the template in the first message followed by the recipients.
+	SendBatchStream(EmailService_SendBatchStreamServer) error
+	// GetEmailStatus returns an email sent by the calling client, or by any client to the
+	// admin clients.
+	GetEmailStatus(context.Context, *GetEmailStatusRequest) (*GetEmailStatusResponse, error)
+	// ListEmails lists the emails sent by the calling client, or by every client to the
+	// admin clients.
+	ListEmails(context.Context, *ListEmailsRequest) (*ListEmailsResponse, error)
+	// StreamEvents pushes the status changes of the emails as they happen.
+	// The events are only streamed to the admin clients.
+	StreamEvents(*StreamEventsRequest, EmailService_StreamEventsServer) error
+	// ListWebhookDeliveries returns the latest delivery attempts of a webhook endpoint.
+	// The deliveries are only listed to the admin clients.
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error)
+	// AddSuppression stops the emails to an address until it is removed.
+	AddSuppression(context.Context, *AddSuppressionRequest) (*AddSuppressionResponse, error)
+	RemoveSuppression(context.Context, *RemoveSuppressionRequest) (*RemoveSuppressionResponse, error)
+	GetSuppression(context.Context, *GetSuppressionRequest) (*GetSuppressionResponse, error)
+	ListSuppressions(context.Context, *ListSuppressionsRequest) (*ListSuppressionsResponse, error)
+	// ReportComplaint records a feedback report forwarded by a mailbox provider outside
+	// of the inbound listener, such as through a provider API.
+	ReportComplaint(context.Context, *ReportComplaintRequest) (*ReportComplaintResponse, error)
+	// GetPreferences returns the categories a recipient opted in or out of, and the
+	// mandatory categories the recipient always receives.
+	GetPreferences(context.Context, *GetPreferencesRequest) (*GetPreferencesResponse, error)
+	// UpdatePreferences opts a recipient in or out of categories. The emails of the
+	// categories a recipient opted out of are skipped, except for the mandatory ones.
+	UpdatePreferences(context.Context, *UpdatePreferencesRequest) (*UpdatePreferencesResponse, error)
+	mustEmbedUnimplementedEmailServiceServer()
+}
+
+// UnimplementedEmailServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedEmailServiceServer struct {
+}
+
+func (UnimplementedEmailServiceServer) SendEmail(context.Context, *SendEmailRequest) (*SendEmailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendEmail not implemented")
+}
+func (UnimplementedEmailServiceServer) CancelEmail(context.Context, *CancelEmailRequest) (*CancelEmailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelEmail not implemented")
+}
+func (UnimplementedEmailServiceServer) SendBatch(context.Context, *SendBatchRequest) (*SendBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendBatch not implemented")
+}
+func (UnimplementedEmailServiceServer) SendBatchStream(EmailService_SendBatchStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SendBatchStream not implemented")
+}
+func (UnimplementedEmailServiceServer) GetEmailStatus(context.Context, *GetEmailStatusRequest) (*GetEmailStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEmailStatus not implemented")
+}
+func (UnimplementedEmailServiceServer) ListEmails(context.Context, *ListEmailsRequest) (*ListEmailsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEmails not implemented")
+}
+func (UnimplementedEmailServiceServer) StreamEvents(*StreamEventsRequest, EmailService_StreamEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedEmailServiceServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedEmailServiceServer) AddSuppression(context.Context, *AddSuppressionRequest) (*AddSuppressionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) RemoveSuppression(context.Context, *RemoveSuppressionRequest) (*RemoveSuppressionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) GetSuppression(context.Context, *GetSuppressionRequest) (*GetSuppressionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) ListSuppressions(context.Context, *ListSuppressionsRequest) (*ListSuppressionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSuppressions not implemented")
+}
+func (UnimplementedEmailServiceServer) ReportComplaint(context.Context, *ReportComplaintRequest) (*ReportComplaintResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportComplaint not implemented")
+}
+func (UnimplementedEmailServiceServer) GetPreferences(context.Context, *GetPreferencesRequest) (*GetPreferencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPreferences not implemented")
+}
+func (UnimplementedEmailServiceServer) UpdatePreferences(context.Context, *UpdatePreferencesRequest) (*UpdatePreferencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdatePreferences not implemented")
+}
+func (UnimplementedEmailServiceServer) mustEmbedUnimplementedEmailServiceServer() {}
+
+// UnsafeEmailServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EmailServiceServer will
+// result in compilation errors.
+type UnsafeEmailServiceServer interface {
+	mustEmbedUnimplementedEmailServiceServer()
+}
+
+func RegisterEmailServiceServer(s grpc.ServiceRegistrar, srv EmailServiceServer) {
+	s.RegisterService(&EmailService_ServiceDesc, srv)
+}
+
+func _EmailService_SendEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendEmailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).SendEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_SendEmail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).SendEmail(ctx, req.(*SendEmailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_CancelEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelEmailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).CancelEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_CancelEmail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).CancelEmail(ctx, req.(*CancelEmailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_SendBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).SendBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_SendBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).SendBatch(ctx, req.(*SendBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_SendBatchStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EmailServiceServer).SendBatchStream(&emailServiceSendBatchStreamServer{stream})
+}
+
+type EmailService_SendBatchStreamServer interface {
+	SendAndClose(*SendBatchResponse) error
+	Recv() (*SendBatchStreamRequest, error)
+	grpc.ServerStream
+}
+
+type emailServiceSendBatchStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *emailServiceSendBatchStreamServer) SendAndClose(m *SendBatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *emailServiceSendBatchStreamServer) Recv() (*SendBatchStreamRequest, error) {
+	m := new(SendBatchStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EmailService_GetEmailStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEmailStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).GetEmailStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_GetEmailStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).GetEmailStatus(ctx, req.(*GetEmailStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_ListEmails_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEmailsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ListEmails(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_ListEmails_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ListEmails(ctx, req.(*ListEmailsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EmailServiceServer).StreamEvents(m, &emailServiceStreamEventsServer{stream})
+}
+
+type EmailService_StreamEventsServer interface {
+	Send(*EmailEvent) error
+	grpc.ServerStream
+}
+
+type emailServiceStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *emailServiceStreamEventsServer) Send(m *EmailEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _EmailService_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ListWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_ListWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_AddSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSuppressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).AddSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_AddSuppression_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).AddSuppression(ctx, req.(*AddSuppressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_RemoveSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveSuppressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).RemoveSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_RemoveSuppression_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).RemoveSuppression(ctx, req.(*RemoveSuppressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_GetSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSuppressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).GetSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_GetSuppression_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).GetSuppression(ctx, req.(*GetSuppressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_ListSuppressions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSuppressionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ListSuppressions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_ListSuppressions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ListSuppressions(ctx, req.(*ListSuppressionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_ReportComplaint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportComplaintRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ReportComplaint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_ReportComplaint_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ReportComplaint(ctx, req.(*ReportComplaintRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_GetPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPreferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).GetPreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_GetPreferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).GetPreferences(ctx, req.(*GetPreferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_UpdatePreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePreferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).UpdatePreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmailService_UpdatePreferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).UpdatePreferences(ctx, req.(*UpdatePreferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EmailService_ServiceDesc is the grpc.ServiceDesc for EmailService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EmailService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb_email_api.EmailService",
+	HandlerType: (*EmailServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendEmail",
+			Handler:    _EmailService_SendEmail_Handler,
+		},
+		{
+			MethodName: "CancelEmail",
+			Handler:    _EmailService_CancelEmail_Handler,
+		},
+		{
+			MethodName: "SendBatch",
+			Handler:    _EmailService_SendBatch_Handler,
+		},
+		{
+			MethodName: "GetEmailStatus",
+			Handler:    _EmailService_GetEmailStatus_Handler,
+		},
+		{
+			MethodName: "ListEmails",
+			Handler:    _EmailService_ListEmails_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _EmailService_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "AddSuppression",
+			Handler:    _EmailService_AddSuppression_Handler,
+		},
+		{
+			MethodName: "RemoveSuppression",
+			Handler:    _EmailService_RemoveSuppression_Handler,
+		},
+		{
+			MethodName: "GetSuppression",
+			Handler:    _EmailService_GetSuppression_Handler,
+		},
+		{
+			MethodName: "ListSuppressions",
+			Handler:    _EmailService_ListSuppressions_Handler,
+		},
+		{
+			MethodName: "ReportComplaint",
+			Handler:    _EmailService_ReportComplaint_Handler,
+		},
+		{
+			MethodName: "GetPreferences",
+			Handler:    _EmailService_GetPreferences_Handler,
+		},
+		{
+			MethodName: "UpdatePreferences",
+			Handler:    _EmailService_UpdatePreferences_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendBatchStream",
+			Handler:       _EmailService_SendBatchStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _EmailService_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "v1/email/email.proto",
+}